@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/archive"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// handleArchiveList prints the trees in the archive, oldest first.
+func handleArchiveList(p paths) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	records, err := archive.ReadTrees(p.Archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: %v\n", err)
+	}
+	writeArchiveList(os.Stdout, records, f)
+	return nil
+}
+
+// writeArchiveList lists archive records with their root content and size.
+// Records whose tree is back in the forest are marked live; records whose
+// topic fingerprint matches a live tree under another ID are marked
+// recurring, since restoring them would duplicate that topic.
+func writeArchiveList(w io.Writer, records []archive.TreeRecord, f *forest.Forest) {
+	if len(records) == 0 {
+		fmt.Fprintln(w, "[Focus] No archived trees.")
+		return
+	}
+	fingerprints := make(map[string]bool, len(f.Trees))
+	for _, t := range f.Trees {
+		if t.Fingerprint != "" {
+			fingerprints[t.Fingerprint] = true
+		}
+	}
+	fmt.Fprintf(w, "[Focus] %d archived trees\n", len(records))
+	for _, r := range records {
+		if r.Tree == nil || r.Tree.Root() == nil {
+			continue
+		}
+		live := ""
+		if f.TreeByID(r.Tree.ID) != nil {
+			live = "  (live)"
+		} else if fingerprints[r.Tree.Fingerprint] {
+			live = "  (recurring)"
+		}
+		fmt.Fprintf(w, "  %s  %s  %d nodes  %q%s\n",
+			r.ID, time.UnixMilli(r.ArchivedAt).Format("2006-01-02 15:04"),
+			r.Tree.NodeCount(), r.Tree.Root().Content, live)
+	}
+}
+
+// handleRestoreTree returns an archived tree to the forest and re-indexes its
+// nodes. The record stays in the archive, which is append-only.
+func handleRestoreTree(p paths, cfg focusgate.Config, ref string) error {
+	records, err := archive.ReadTrees(p.Archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: %v\n", err)
+	}
+	r := archive.FindTreeRecord(records, ref)
+	if r == nil {
+		return fmt.Errorf("no archived tree matches %q", ref)
+	}
+
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	gt := gate.NewWithChain(f, e, markov.New(), cfg.GateConfig())
+	if err := gt.RestoreTree(r.Tree); err != nil {
+		return err
+	}
+
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
+	}
+	if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+		return fmt.Errorf("save engine: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "[Focus] Restored tree %s (%d nodes) as Tree #%d. %d/%d mem.\n",
+		r.Tree.ID, r.Tree.NodeCount(), len(f.Trees)-1, f.NodeCount(), cfg.MemorySize)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/audit"
+)
+
+// handleAudit summarizes the decision log from since (Unix ms; zero for all
+// of it).
+func handleAudit(p paths, since int64, asJSON bool) error {
+	decisions, err := audit.Read(p.Decisions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: %v\n", err)
+	}
+	s := audit.Summarize(decisions, since)
+	if asJSON {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal audit: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	writeAuditSummary(os.Stdout, s, len(decisions))
+	return nil
+}
+
+func writeAuditSummary(w io.Writer, s audit.Summary, logged int) {
+	if logged == 0 {
+		fmt.Fprintln(w, `[Focus] No decisions logged. Set "auditLog": true in config.json to record them.`)
+		return
+	}
+	if s.Decisions == 0 {
+		fmt.Fprintf(w, "[Focus] No decisions since %s (%d logged).\n", msToTime(s.Since), logged)
+		return
+	}
+	fmt.Fprintf(w, "[Focus] %d decisions, %s to %s (%d logged)\n",
+		s.Decisions, msToTime(s.First), msToTime(s.Last), logged)
+	for _, action := range []string{"new", "branch", "extend"} {
+		n := s.Actions[action]
+		fmt.Fprintf(w, "  %-7s %5d  %5.1f%%\n", action, n, 100*float64(n)/float64(s.Decisions))
+	}
+	fmt.Fprintf(w, "  pruning after %d prompts (%.1f%%), %d nodes removed\n",
+		s.PrunedPrompts, 100*float64(s.PrunedPrompts)/float64(s.Decisions), s.PrunedNodes)
+}
+
+// parseSince reads a --since value relative to now: a duration back from now
+// ("24h", "90m"), a date ("2026-01-31", local time) or an RFC 3339 time.
+// It returns Unix milliseconds.
+func parseSince(v string, now time.Time) (int64, error) {
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d).UnixMilli(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UnixMilli(), nil
+	}
+	return 0, fmt.Errorf("invalid --since %q: want a duration (24h), a date (2006-01-02) or an RFC 3339 time", v)
+}
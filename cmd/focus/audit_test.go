@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/audit"
+)
+
+func TestAuditLogAndSummary(t *testing.T) {
+	p := pathsIn(t.TempDir(), "")
+	cfg := focusgate.DefaultConfig()
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT token expiry in authentication",
+		"migrate the database schema to postgres",
+	}
+
+	// Off by default: nothing is logged.
+	if err := handlePrompt(p, cfg, hookInput{Prompt: prompts[0]}); err != nil {
+		t.Fatalf("handlePrompt: %v", err)
+	}
+	if _, err := os.Stat(p.Decisions); !os.IsNotExist(err) {
+		t.Fatalf("decision log written with auditLog off: %v", err)
+	}
+
+	cfg.AuditLog = true
+	for _, prompt := range prompts[1:] {
+		if err := handlePrompt(p, cfg, hookInput{Prompt: prompt}); err != nil {
+			t.Fatalf("handlePrompt: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(p.Decisions)
+	if err != nil {
+		t.Fatalf("read decision log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, line := range lines {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		for _, key := range []string{"time", "promptHash", "action", "treeId", "score"} {
+			if _, ok := fields[key]; !ok {
+				t.Errorf("line %d missing %q: %s", i, key, line)
+			}
+		}
+		if _, ok := fields["prompt"]; ok {
+			t.Errorf("line %d stores the prompt text: %s", i, line)
+		}
+		if fields["promptHash"] != audit.Hash(prompts[i+1]) {
+			t.Errorf("line %d hash = %v, want the hash of %q", i, fields["promptHash"], prompts[i+1])
+		}
+	}
+
+	decisions, err := audit.Read(p.Decisions)
+	if err != nil {
+		t.Fatalf("audit.Read: %v", err)
+	}
+	var out bytes.Buffer
+	writeAuditSummary(&out, audit.Summarize(decisions, 0), len(decisions))
+	got := out.String()
+	if !strings.Contains(got, "[Focus] 2 decisions") {
+		t.Errorf("summary header missing:\n%s", got)
+	}
+	for _, d := range decisions {
+		if !strings.Contains(got, d.Action+" ") {
+			t.Errorf("summary missing action %q:\n%s", d.Action, got)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	got, err := parseSince("24h", now)
+	if err != nil || got != now.Add(-24*time.Hour).UnixMilli() {
+		t.Errorf("parseSince(24h) = %d, %v", got, err)
+	}
+	got, err = parseSince("2026-03-01T00:00:00Z", now)
+	if err != nil || got != time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("parseSince(RFC 3339) = %d, %v", got, err)
+	}
+	if _, err := parseSince("2026-03-01", now); err != nil {
+		t.Errorf("parseSince(date): %v", err)
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Error("want an error for an unparseable value")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// handleCalibrate suggests extend and branch thresholds from how the current
+// forest's leaves score against their own and other trees' roots. It only
+// prints; config.json is left for the user to edit.
+func handleCalibrate(p paths, cfg focusgate.Config, asJSON bool) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	gt := gate.NewWithChain(f, e, markov.New(), cfg.GateConfig())
+	c := gt.Calibrate()
+	if asJSON {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal calibration: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	writeCalibration(os.Stdout, c, cfg)
+	return nil
+}
+
+func writeCalibration(w io.Writer, c gate.Calibration, cfg focusgate.Config) {
+	if c.Intra.Count == 0 || c.Inter.Count == 0 {
+		fmt.Fprintln(w, "[Focus] Not enough data to calibrate: need at least two trees, one with a prompt below its root.")
+		return
+	}
+	fmt.Fprintf(w, "[Focus] Leaf-to-root %s similarity\n", c.Metric)
+	for _, s := range []struct {
+		label string
+		s     gate.Spread
+	}{{"same topic", c.Intra}, {"other topics", c.Inter}} {
+		fmt.Fprintf(w, "  %-12s  n=%-5d min=%.3f  median=%.3f  p90=%.3f  max=%.3f\n",
+			s.label, s.s.Count, s.s.Min, s.s.Median, s.s.P90, s.s.Max)
+	}
+	fmt.Fprintf(w, "  Suggested: extend %.2f (same-topic median), branch %.2f (other-topic p90)\n", c.Extend, c.Branch)
+	fmt.Fprintf(w, "  Current:   extend %.2f, branch %.2f\n", cfg.Similarity.Extend, cfg.Similarity.Branch)
+	if c.Branch >= c.Extend {
+		fmt.Fprintln(w, "  Topics overlap: the suggested branch is not below extend, so the forest does not separate cleanly yet.")
+	}
+	fmt.Fprintln(w, "  Nothing was written; set \"similarity\" in config.json to use these.")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	focusgate "github.com/kuandriy/focus-gate"
+)
+
+// Config value sources reported by --config.
+const (
+	sourceFile    = "file"
+	sourceDefault = "default"
+)
+
+// configField is one resolved config value and where it came from.
+type configField struct {
+	Value  json.RawMessage `json:"value"`
+	Source string          `json:"source"`
+}
+
+// configReport is the --config output: every effective config field keyed
+// by its JSON name (nested fields as "similarity.extend"), plus any keys in
+// the file that match no field and were therefore ignored.
+type configReport struct {
+	Fields  map[string]configField `json:"fields"`
+	Ignored []string               `json:"ignored,omitempty"`
+}
+
+// buildConfigReport annotates the merged config with the provenance
+// returned by focusgate.LoadConfig.
+func buildConfigReport(cfg focusgate.Config, userKeys map[string]bool) (configReport, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return configReport{}, err
+	}
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return configReport{}, err
+	}
+	values := make(map[string]json.RawMessage, len(top)+1)
+	for k, v := range top {
+		if k != "similarity" {
+			values[k] = v
+			continue
+		}
+		var sim map[string]json.RawMessage
+		if err := json.Unmarshal(v, &sim); err != nil {
+			return configReport{}, err
+		}
+		for sk, sv := range sim {
+			values["similarity."+sk] = sv
+		}
+	}
+
+	r := configReport{Fields: make(map[string]configField, len(values))}
+	for k, v := range values {
+		src := sourceDefault
+		if userKeys[k] {
+			src = sourceFile
+		}
+		r.Fields[k] = configField{Value: v, Source: src}
+	}
+	for k := range userKeys {
+		if _, ok := values[k]; !ok {
+			r.Ignored = append(r.Ignored, k)
+		}
+	}
+	sort.Strings(r.Ignored)
+	return r, nil
+}
+
+// checkConfig reports whether the config has problems, for --config --check.
+// LoadConfig has already logged each problem to stderr, so only the verdict
+// is printed here; any problem is returned as an error to exit nonzero.
+func checkConfig(w io.Writer, cfg focusgate.Config) error {
+	if problems := cfg.Problems(); len(problems) > 0 {
+		return fmt.Errorf("config has %d problems", len(problems))
+	}
+	fmt.Fprintln(w, "[Focus] Config OK.")
+	return nil
+}
+
+// handleConfig prints the effective config as JSON, marking each field as
+// set in the config file or left at its default.
+func handleConfig(cfg focusgate.Config, userKeys map[string]bool) error {
+	r, err := buildConfigReport(cfg, userKeys)
+	if err != nil {
+		return fmt.Errorf("config report: %w", err)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	fmt.Fprintln(os.Stdout, string(data))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	focusgate "github.com/kuandriy/focus-gate"
+)
+
+func TestConfigReportProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"decayRate": 0.1, "decay_rate": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, userKeys := focusgate.LoadConfig(path)
+	if cfg.DecayRate != 0.1 {
+		t.Fatalf("DecayRate = %v, want 0.1", cfg.DecayRate)
+	}
+	r, err := buildConfigReport(cfg, userKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := r.Fields["decayRate"]; f.Source != sourceFile || string(f.Value) != "0.1" {
+		t.Errorf("decayRate = %+v, want 0.1 from file", f)
+	}
+	for _, k := range []string{"memorySize", "similarity.extend", "similarity.branch", "guideSize"} {
+		if _, ok := r.Fields[k]; !ok {
+			t.Errorf("report is missing %s", k)
+		}
+	}
+	for k, f := range r.Fields {
+		if k != "decayRate" && f.Source != sourceDefault {
+			t.Errorf("%s source = %s, want default", k, f.Source)
+		}
+	}
+	if len(r.Ignored) != 1 || r.Ignored[0] != "decay_rate" {
+		t.Errorf("Ignored = %v, want [decay_rate]", r.Ignored)
+	}
+}
+
+func TestConfigReportMissingFile(t *testing.T) {
+	cfg, userKeys := focusgate.LoadConfig(filepath.Join(t.TempDir(), "config.json"))
+	r, err := buildConfigReport(cfg, userKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, f := range r.Fields {
+		if f.Source != sourceDefault {
+			t.Errorf("%s source = %s, want default with no config file", k, f.Source)
+		}
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"similarity": {"branch": 0.6, "extend": 0.5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := focusgate.LoadConfig(path)
+	problems := cfg.Problems()
+	if len(problems) != 1 || !strings.Contains(problems[0], "branch is unreachable") {
+		t.Errorf("Problems = %q, want the branch unreachable warning", problems)
+	}
+	var out bytes.Buffer
+	if err := checkConfig(&out, cfg); err == nil {
+		t.Error("--config --check should fail for an unreachable branch")
+	}
+
+	cfg.Similarity.Branch = 0.25
+	cfg.DecayRate, cfg.MemorySize, cfg.GuideSize, cfg.TransitionBoost = -0.1, 0, -1, -0.2
+	cfg.MaxChildren, cfg.ContextTemplate, cfg.WeightCurve = 1, "{{range .Trees}}", "cubic"
+	if got := cfg.Problems(); len(got) != 7 {
+		t.Errorf("Problems = %q, want 7", got)
+	}
+
+	out.Reset()
+	if err := checkConfig(&out, focusgate.DefaultConfig()); err != nil || !strings.Contains(out.String(), "Config OK") {
+		t.Errorf("default config: %v, %q", err, out.String())
+	}
+}
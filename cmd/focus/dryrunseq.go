@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// handleDryRunSeq simulates a conversation: the JSON array of prompts on
+// stdin runs through a copy of the loaded state, which changes from prompt
+// to prompt as it would for real and is then thrown away.
+func handleDryRunSeq(p paths, cfg focusgate.Config) error {
+	return dryRunSeq(os.Stdin, os.Stdout, p, cfg)
+}
+
+func dryRunSeq(r io.Reader, w io.Writer, p paths, cfg focusgate.Config) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read stdin: %w", err)
+	}
+	prompts, err := parsePromptList(data)
+	if err != nil {
+		return fmt.Errorf("usage: focus --dry-run-seq < prompts.json: %w", err)
+	}
+
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	sim, results := gt.Simulate(prompts)
+	writeDryRunSeq(w, sim, results, cfg.ScoreParams())
+	return nil
+}
+
+// parsePromptList accepts a JSON array of prompt strings, or of hook inputs
+// as --batch reads them.
+func parsePromptList(data []byte) ([]string, error) {
+	var prompts []string
+	if err := json.Unmarshal(data, &prompts); err == nil {
+		return prompts, nil
+	}
+	var inputs []hookInput
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return nil, err
+	}
+	prompts = make([]string, len(inputs))
+	for i, in := range inputs {
+		prompts[i] = in.Prompt
+	}
+	return prompts, nil
+}
+
+// writeDryRunSeq prints each prompt's action followed by the forest the
+// sequence would leave behind.
+func writeDryRunSeq(w io.Writer, sim *gate.Gate, results []gate.BatchResult, sp forest.ScoreParams) {
+	writeBatchResults(w, "Dry-run sequence (nothing saved)", results)
+	fmt.Fprintf(w, "\n[Focus] Resulting forest: %d trees, %d/%d nodes\n",
+		len(sim.Forest.Trees), sim.Forest.NodeCount(), sim.Config.MemorySize)
+	now := time.Now().UnixMilli()
+	for i, t := range sim.Forest.Trees {
+		fmt.Fprintf(w, "  Tree #%d [id=%s]\n", i, t.ID)
+		writeNodeTree(w, t, t.RootID, "    ", now, t.Params(sp), true)
+	}
+}
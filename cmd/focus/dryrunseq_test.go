@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	focusgate "github.com/kuandriy/focus-gate"
+)
+
+func TestDryRunSeqLeavesStateUntouched(t *testing.T) {
+	p := pathsIn(t.TempDir(), "")
+	cfg := focusgate.DefaultConfig()
+	if err := handlePrompt(p, cfg, hookInput{Prompt: "add JWT authentication to the API"}); err != nil {
+		t.Fatalf("handlePrompt: %v", err)
+	}
+	before := map[string][]byte{}
+	for _, path := range []string{p.Intent, p.Engine, p.Markov, p.Journal} {
+		data, _ := os.ReadFile(path)
+		before[path] = data
+	}
+
+	in := strings.NewReader(`["fix JWT token expiry", "migrate the database schema", "the"]`)
+	var out bytes.Buffer
+	if err := dryRunSeq(in, &out, p, cfg); err != nil {
+		t.Fatalf("dryRunSeq: %v", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "processed 2 of 3 prompts") {
+		t.Errorf("summary missing:\n%s", got)
+	}
+	if !strings.Contains(got, "Tree #1 [id=") || !strings.Contains(got, "migrate the database schema") {
+		t.Errorf("resulting forest missing the new tree:\n%s", got)
+	}
+
+	for path, want := range before {
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, want) {
+			t.Errorf("%s changed by a dry run", path)
+		}
+	}
+
+	// Hook inputs are accepted as --batch reads them.
+	if err := dryRunSeq(strings.NewReader(`[{"prompt": "fix JWT token expiry"}]`), &out, p, cfg); err != nil {
+		t.Errorf("hook-input array: %v", err)
+	}
+	if err := dryRunSeq(strings.NewReader(`{"prompt": "x"}`), &out, p, cfg); err == nil {
+		t.Error("want an error for input that is not an array")
+	}
+}
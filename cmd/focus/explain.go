@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/guide"
+)
+
+// handleExplain prints why a node exists and scores as it does: its tree,
+// the chain of abstractions from the root down to it, the prompts it came
+// from, each factor of its score, and the guide entries linked to it.
+func handleExplain(p paths, cfg focusgate.Config, nodeID string) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	g := guide.New(cfg.GuideSize)
+	focusgate.LoadState("guide", p.Guide, g)
+
+	return writeExplain(os.Stdout, f, g, cfg.ScoreParams(), time.Now().UnixMilli(), nodeID)
+}
+
+func writeExplain(w io.Writer, f *forest.Forest, g *guide.Guide, sp forest.ScoreParams, now int64, nodeID string) error {
+	tree, n := f.FindNode(nodeID)
+	if n == nil {
+		return fmt.Errorf("no node matches %q", nodeID)
+	}
+	treeIdx := -1
+	for i, t := range f.Trees {
+		if t == tree {
+			treeIdx = i
+		}
+	}
+
+	fmt.Fprintf(w, "[Focus] Node %s in Tree #%d %s\n", n.ID, treeIdx, tree.ID)
+	fmt.Fprintf(w, "  %q\n", n.Content)
+
+	fmt.Fprintln(w, "  Lineage:")
+	for _, a := range tree.Ancestors(n.ID) {
+		fmt.Fprintf(w, "    depth=%d  %-14s  %q\n", a.Depth, a.ID, a.Content)
+	}
+	fmt.Fprintf(w, "    depth=%d  %-14s  %q  <- this node\n", n.Depth, n.ID, n.Content)
+
+	sources := "(none)"
+	if len(n.Sources) > 0 {
+		sources = strings.Join(n.Sources, ", ")
+	}
+	fmt.Fprintf(w, "  Sources: %s\n", sources)
+	fmt.Fprintf(w, "  Frequency: %d  indexed=%v\n", n.Frequency, n.Indexed)
+
+	tp := tree.Params(sp)
+	sf := n.ScoreFactors(now, tp)
+	fmt.Fprintf(w, "  Score: %.4f = weight %.4f × recency %.4f × depthFactor %.4f\n",
+		n.Score(now, tp), sf.Weight, sf.Recency, sf.DepthFactor)
+	fmt.Fprintf(w, "    recency     = e^(-%.4g/h × %.1fh)\n", tp.DecayRate, sf.AgeHours)
+	fmt.Fprintf(w, "    depthFactor = 1 / (1 + %d × %.4g)\n", n.Depth, tp.DepthPenalty)
+
+	linked := g.LinkedTo(n.ID)
+	if len(linked) == 0 {
+		fmt.Fprintln(w, "  Guide: no linked entries")
+		return nil
+	}
+	fmt.Fprintf(w, "  Guide: %d linked entries\n", len(linked))
+	for _, e := range linked {
+		fmt.Fprintf(w, "    - %s\n", e.Summary)
+	}
+	return nil
+}
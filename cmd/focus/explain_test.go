@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/guide"
+)
+
+func TestExplainLeaf(t *testing.T) {
+	f := forest.NewForest()
+	tree := forest.NewTree("auth and sessions", "")
+	mid := tree.AddChild(tree.RootID, "auth token handling", "")
+	leaf := tree.AddChild(mid.ID, "refresh the auth token", "p3")
+	leaf.Touch(5, "p7", "")
+	f.AddTree(tree)
+
+	g := guide.New(10)
+	g.Add("added token refresh", leaf.ID, nil)
+	g.Add("unrelated entry", mid.ID, nil)
+
+	sp := forest.ScoreParams{DecayRate: 0.05, DepthPenalty: 0.15}
+	now := leaf.LastAccessed + 3*3600000
+	var buf bytes.Buffer
+	if err := writeExplain(&buf, f, g, sp, now, leaf.ID); err != nil {
+		t.Fatalf("writeExplain: %v", err)
+	}
+	out := buf.String()
+
+	// Lineage runs root, abstraction, then the leaf itself.
+	root, abs, self := strings.Index(out, tree.RootID), strings.Index(out, "depth=1  "+mid.ID), strings.Index(out, "<- this node")
+	if root < 0 || abs < 0 || self < 0 || !(root < abs && abs < self) {
+		t.Errorf("lineage out of order (root=%d mid=%d leaf=%d):\n%s", root, abs, self, out)
+	}
+	if !strings.Contains(out, "Sources: p3, p7") {
+		t.Errorf("sources missing:\n%s", out)
+	}
+	if !strings.Contains(out, "added token refresh") || strings.Contains(out, "unrelated entry") {
+		t.Errorf("guide entries should be only those linked to the leaf:\n%s", out)
+	}
+
+	sf := leaf.ScoreFactors(now, sp)
+	want := fmt.Sprintf("Score: %.4f = weight %.4f × recency %.4f × depthFactor %.4f",
+		sf.Weight*sf.Recency*sf.DepthFactor, sf.Weight, sf.Recency, sf.DepthFactor)
+	if !strings.Contains(out, want) {
+		t.Errorf("score line missing %q:\n%s", want, out)
+	}
+	if got := sf.Weight * sf.Recency * sf.DepthFactor; got != leaf.Score(now, sp) {
+		t.Errorf("factors multiply to %f, Score = %f", got, leaf.Score(now, sp))
+	}
+}
+
+func TestExplainUnknownNode(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeExplain(&buf, forest.NewForest(), guide.New(10), forest.ScoreParams{}, 0, "nope")
+	if err == nil {
+		t.Error("expected an error for an unknown node")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// defaultForecastHours is how far ahead --forecast looks when no horizon is
+// given.
+const defaultForecastHours = 24
+
+// handleForecast previews tree scores hours from now, flagging the trees
+// that would be pruned first if the user stepped away that long.
+func handleForecast(p paths, cfg focusgate.Config, hours float64, asJSON bool) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	gt := gate.New(f, tfidf.NewEngine(), cfg.GateConfig())
+	fc := gt.Forecast(time.Now().UnixMilli(), hours)
+	if asJSON {
+		data, err := json.MarshalIndent(fc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal forecast: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	writeForecastText(os.Stdout, fc)
+	return nil
+}
+
+// writeForecastText prints a forecast one tree per line, first-to-prune
+// first.
+func writeForecastText(w io.Writer, fc gate.Forecast) {
+	fmt.Fprintf(w, "[Focus] Forecast in %sh: %d/%d mem, %d prompts before pruning starts, prune line %.3f\n",
+		strconv.FormatFloat(fc.Hours, 'f', -1, 64), fc.NodeCount, fc.MemorySize, fc.Headroom, fc.Cutoff)
+	if len(fc.Trees) == 0 {
+		fmt.Fprintln(w, "  No topics yet.")
+		return
+	}
+	for _, t := range fc.Trees {
+		id := t.TreeID
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		root := t.Root
+		if len(root) > topicRootWidth {
+			root = root[:topicRootWidth] + "..."
+		}
+		status := fmt.Sprintf("%d/%d leaves below", t.LeavesBelow, t.Leaves)
+		switch {
+		case t.Pinned:
+			status = "[pinned]"
+		case t.Below:
+			status += "  at risk"
+		}
+		fmt.Fprintf(w, "  #%-2d %s  %-*q  score=%.3f -> %.3f  %s\n",
+			t.Index, id, topicRootWidth+5, root, t.Score, t.ScoreAt, status)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/gate"
+)
+
+func TestWriteForecastText(t *testing.T) {
+	fc := gate.Forecast{
+		Hours: 36, Cutoff: 0.05, NodeCount: 7, MemorySize: 10, Headroom: 3,
+		Trees: []gate.TreeForecast{
+			{Index: 1, TreeID: "mvb6zf7d-lx3k9a", Root: "stale topic", Score: 0.09, ScoreAt: 0.015, Leaves: 2, LeavesBelow: 2, Below: true},
+			{Index: 0, TreeID: "abc", Root: "busy topic", Score: 0.8, ScoreAt: 0.13, Leaves: 3},
+			{Index: 2, TreeID: "def", Root: "pinned topic", Pinned: true, Score: 0.1, ScoreAt: 0.02, Leaves: 1},
+		},
+	}
+	var out bytes.Buffer
+	writeForecastText(&out, fc)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("want a header and 3 trees, got:\n%s", out.String())
+	}
+	if want := "[Focus] Forecast in 36h: 7/10 mem, 3 prompts before pruning starts, prune line 0.050"; lines[0] != want {
+		t.Errorf("header = %q, want %q", lines[0], want)
+	}
+	for i, want := range []string{
+		`#1  mvb6zf7d  "stale topic"`,
+		`score=0.800 -> 0.130  0/3 leaves below`,
+		`[pinned]`,
+	} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("line %d = %q, want it to contain %q", i+1, lines[i+1], want)
+		}
+	}
+	if !strings.HasSuffix(lines[1], "2/2 leaves below  at risk") || strings.Contains(lines[2], "at risk") {
+		t.Errorf("only the stale tree should be at risk:\n%s", out.String())
+	}
+}
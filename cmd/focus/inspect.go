@@ -3,15 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
+	focusgate "github.com/kuandriy/focus-gate"
 	"github.com/kuandriy/focus-gate/internal/forest"
 	"github.com/kuandriy/focus-gate/internal/gate"
 	"github.com/kuandriy/focus-gate/internal/guide"
 	"github.com/kuandriy/focus-gate/internal/markov"
-	"github.com/kuandriy/focus-gate/internal/persist"
 	"github.com/kuandriy/focus-gate/internal/text"
 	"github.com/kuandriy/focus-gate/internal/tfidf"
 )
@@ -30,6 +32,30 @@ func hasFlag(args []string, flag string) bool {
 	return false
 }
 
+// flagValue returns the argument following flag in args, or "" if flag is
+// absent or last.
+func flagValue(args []string, flag string) string {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// takeFlagValue removes flag and the argument following it from args and
+// returns that argument with the remaining args. If flag is absent or last,
+// args are returned unchanged with an empty value.
+func takeFlagValue(args []string, flag string) (string, []string) {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return args[i+1], rest
+		}
+	}
+	return "", args
+}
+
 // ---------------------------------------------------------------------------
 // handleInspect — full state dump
 // ---------------------------------------------------------------------------
@@ -39,18 +65,18 @@ func hasFlag(args []string, flag string) bool {
 // statistics, guide entries with reinforcement state, and the Markov transition
 // matrix. This lets the user verify at a glance whether the system is tracking
 // intent correctly after a series of prompts.
-func handleInspect(p paths, cfg config, asJSON bool) error {
+func handleInspect(p paths, cfg focusgate.Config, asJSON bool) error {
 	f := forest.NewForest()
-	logLoadErr("intent", persist.Load(p.intentFile, f))
+	focusgate.LoadState("intent", p.Intent, f)
 
 	e := tfidf.NewEngine()
-	logLoadErr("engine", persist.Load(p.engineFile, e))
+	focusgate.LoadState("engine", p.Engine, e)
 
 	g := guide.New(cfg.GuideSize)
-	logLoadErr("guide", persist.Load(p.guideFile, g))
+	focusgate.LoadState("guide", p.Guide, g)
 
 	c := markov.New()
-	logLoadErr("markov", persist.Load(p.markovFile, c))
+	focusgate.LoadState("markov", p.Markov, c)
 
 	if asJSON {
 		return inspectJSON(f, e, g, c, cfg)
@@ -66,27 +92,26 @@ func handleInspect(p paths, cfg config, asJSON bool) error {
 // modifying any persisted state, showing exactly how the classifier would
 // score each tree. Useful for understanding why a prompt was classified a
 // certain way or testing threshold tuning.
-func handleDryRun(p paths, cfg config, prompt string, asJSON bool) error {
+func handleDryRun(p paths, cfg focusgate.Config, prompt string, asJSON bool) error {
 	f := forest.NewForest()
-	logLoadErr("intent", persist.Load(p.intentFile, f))
+	focusgate.LoadState("intent", p.Intent, f)
 
 	e := tfidf.NewEngine()
-	logLoadErr("engine", persist.Load(p.engineFile, e))
+	focusgate.LoadState("engine", p.Engine, e)
 
 	g := guide.New(cfg.GuideSize)
-	logLoadErr("guide", persist.Load(p.guideFile, g))
+	focusgate.LoadState("guide", p.Guide, g)
 
 	c := markov.New()
-	logLoadErr("markov", persist.Load(p.markovFile, c))
+	focusgate.LoadState("markov", p.Markov, c)
 
 	// Clean the prompt the same way the hook path does.
-	prompt = text.CleanPrompt(prompt)
+	prompt = text.NewTokenizer(cfg.TokenizerOptions()).CleanPrompt(prompt)
 	if prompt == "" {
 		return fmt.Errorf("prompt is empty after cleaning")
 	}
 
-	gt := gate.NewWithChain(f, e, c, toGateConfig(cfg))
-	result := gt.DryRun(prompt)
+	result := readGate(p, cfg, f, e, c).DryRun(prompt)
 
 	if asJSON {
 		return dryRunJSON(result)
@@ -94,13 +119,108 @@ func handleDryRun(p paths, cfg config, prompt string, asJSON bool) error {
 	return dryRunText(result, cfg)
 }
 
+// readGate builds a gate over loaded state for a read-only command. The last
+// prompt saves a vector for every node, so loading that cache spares the
+// command re-vectorizing them; the cache is never saved back, so the command
+// leaves every file untouched.
+func readGate(p paths, cfg focusgate.Config, f *forest.Forest, e *tfidf.Engine, c *markov.Chain) *gate.Gate {
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	focusgate.LogLoadErr("veccache", gt.LoadVecCache(p.VecCache))
+	return gt
+}
+
+// ---------------------------------------------------------------------------
+// handleSearch — find existing content by similarity
+// ---------------------------------------------------------------------------
+
+// searchLimit is the number of matches --search prints.
+const searchLimit = 10
+
+// handleSearch ranks every stored node, and guide summaries when withGuide is
+// set, by similarity to query. Nothing is saved, so searching leaves all
+// persisted state untouched.
+func handleSearch(p paths, cfg focusgate.Config, query string, withGuide, asJSON bool) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	var g *guide.Guide
+	if withGuide {
+		g = guide.New(cfg.GuideSize)
+		focusgate.LoadState("guide", p.Guide, g)
+	}
+
+	query = text.NewTokenizer(cfg.TokenizerOptions()).CleanPrompt(query)
+	if query == "" {
+		return fmt.Errorf("query is empty after cleaning")
+	}
+
+	hits := readGate(p, cfg, f, e, markov.New()).Search(query, g, searchLimit)
+
+	if asJSON {
+		if hits == nil {
+			hits = []gate.SearchHit{}
+		}
+		data, err := json.MarshalIndent(hits, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal search: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	return searchText(query, hits)
+}
+
+// ---------------------------------------------------------------------------
+// handleFind — literal lookup by node ID or content
+// ---------------------------------------------------------------------------
+
+// handleFind looks a node up by ID (or unique ID prefix) and lists every node
+// whose content contains query, ignoring case. Unlike --search it matches
+// literal text, not TF-IDF similarity.
+func handleFind(p paths, cfg focusgate.Config, query string) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	var refs []forest.NodeRef
+	if tree, n := f.FindNode(query); n != nil {
+		for i, t := range f.Trees {
+			if t == tree {
+				refs = append(refs, forest.NodeRef{TreeIdx: i, Tree: t, Node: n})
+			}
+		}
+	}
+	for _, r := range f.FindNodesByContent(query) {
+		if len(refs) > 0 && r.Node == refs[0].Node {
+			continue // already listed as the ID match
+		}
+		refs = append(refs, r)
+	}
+
+	w := os.Stdout
+	if len(refs) == 0 {
+		fmt.Fprintf(w, "[Focus] No nodes match %q.\n", query)
+		return nil
+	}
+	now, sp := time.Now().UnixMilli(), cfg.ScoreParams()
+	for _, r := range refs {
+		fmt.Fprintf(w, "  Tree #%d %s  %-14s  depth=%d  score=%.3f  indexed=%v  %q\n",
+			r.TreeIdx, r.Tree.ID, r.Node.ID, r.Node.Depth,
+			r.Node.Score(now, r.Tree.Params(sp)), r.Node.Indexed, r.Node.Content)
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Text formatters
 // ---------------------------------------------------------------------------
 
-func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Chain, cfg config) error {
+func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Chain, cfg focusgate.Config) error {
 	w := os.Stdout
 	now := time.Now().UnixMilli()
+	sp := cfg.ScoreParams()
 
 	fmt.Fprintln(w, "=== Focus Gate Inspect ===")
 	fmt.Fprintln(w)
@@ -109,6 +229,7 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 	fmt.Fprintln(w, "--- Config ---")
 	fmt.Fprintf(w, "  memorySize:        %d\n", cfg.MemorySize)
 	fmt.Fprintf(w, "  decayRate:         %.3f\n", cfg.DecayRate)
+	fmt.Fprintf(w, "  depthPenalty:      %.3f\n", cfg.DepthPenalty)
 	fmt.Fprintf(w, "  similarity.extend: %.3f\n", cfg.Similarity.Extend)
 	fmt.Fprintf(w, "  similarity.branch: %.3f\n", cfg.Similarity.Branch)
 	fmt.Fprintf(w, "  contextLimit:      %d\n", cfg.ContextLimit)
@@ -121,8 +242,13 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 	// --- Forest ---
 	fmt.Fprintf(w, "--- Forest: %d trees, %d/%d nodes, %d prompts ---\n",
 		len(f.Trees), f.NodeCount(), cfg.MemorySize, f.Meta.TotalPrompts)
-	fmt.Fprintf(w, "  created:    %s\n", msToTime(f.Meta.Created))
-	fmt.Fprintf(w, "  lastUpdate: %s\n", msToTime(f.Meta.LastUpdate))
+	fmt.Fprintf(w, "  created:     %s\n", msToTime(f.Meta.Created))
+	fmt.Fprintf(w, "  lastUpdate:  %s\n", msToTime(f.Meta.LastUpdate))
+	if cutoff := f.PruneCutoff(now, cfg.MemorySize, sp); cutoff == forest.NoPruneCutoff {
+		fmt.Fprintln(w, "  pruneCutoff: none (under budget)")
+	} else {
+		fmt.Fprintf(w, "  pruneCutoff: %.3f\n", cutoff)
+	}
 	fmt.Fprintln(w)
 
 	for i, tree := range f.Trees {
@@ -130,11 +256,19 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 		if root == nil {
 			continue
 		}
-		rootScore := root.Score(now, cfg.DecayRate)
-		fmt.Fprintf(w, "  Tree #%d [id=%s] score=%.3f\n", i, tree.ID, rootScore)
+		tsp := tree.Params(sp)
+		rootScore := root.Score(now, tsp)
+		pin := ""
+		if tree.Pinned {
+			pin = " [pinned]"
+		}
+		if tree.DecayRate != nil {
+			pin += fmt.Sprintf(" [decay=%g]", *tree.DecayRate)
+		}
+		fmt.Fprintf(w, "  Tree #%d [id=%s] score=%.3f%s\n", i, tree.ID, rootScore, pin)
 		fmt.Fprintf(w, "    %d nodes, %d leaves, created %s\n",
 			tree.NodeCount(), len(tree.GetLeaves()), msToTime(tree.Created))
-		writeNodeTree(w, tree, tree.RootID, "    ", now, cfg.DecayRate, true)
+		writeNodeTree(w, tree, tree.RootID, "    ", now, tsp, true)
 		fmt.Fprintln(w)
 	}
 
@@ -182,6 +316,10 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 	} else {
 		fmt.Fprintln(w, "  Last topic: (none)")
 	}
+	if len(c.Counts) > 0 {
+		fmt.Fprintf(w, "  Avg entropy: %.2f bits (0 = fully predictable)\n", c.AverageEntropy())
+	}
+	writeMarkovHistory(w, f, c)
 
 	// Sort transition sources for deterministic output.
 	froms := make([]string, 0, len(c.Counts))
@@ -194,16 +332,17 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 		row := c.Counts[from]
 		total := c.Totals[from]
 		name := treeNameByID(f, from)
+		metrics := fmt.Sprintf("[entropy=%.2f bits, perplexity=%.2f]", c.Entropy(from), c.Perplexity(from))
 		if name != "" {
-			fmt.Fprintf(w, "  %s (%s) ->\n", from, name)
+			fmt.Fprintf(w, "  %s (%s) ->  %s\n", from, name, metrics)
 		} else {
-			fmt.Fprintf(w, "  %s ->\n", from)
+			fmt.Fprintf(w, "  %s ->  %s\n", from, metrics)
 		}
 
 		// Sort destinations by count descending.
 		type dest struct {
 			to    string
-			count int
+			count float64
 		}
 		dests := make([]dest, 0, len(row))
 		for to, count := range row {
@@ -212,12 +351,12 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 		sort.Slice(dests, func(i, j int) bool { return dests[i].count > dests[j].count })
 
 		for _, d := range dests {
-			prob := float64(d.count) / float64(total) * 100
+			prob := d.count / total * 100
 			dName := treeNameByID(f, d.to)
 			if dName != "" {
-				fmt.Fprintf(w, "    %s (%s): %d/%d (%.1f%%)\n", d.to, dName, d.count, total, prob)
+				fmt.Fprintf(w, "    %s (%s): %s/%s (%.1f%%)\n", d.to, dName, fmtCount(d.count), fmtCount(total), prob)
 			} else {
-				fmt.Fprintf(w, "    %s: %d/%d (%.1f%%)\n", d.to, d.count, total, prob)
+				fmt.Fprintf(w, "    %s: %s/%s (%.1f%%)\n", d.to, fmtCount(d.count), fmtCount(total), prob)
 			}
 		}
 	}
@@ -225,7 +364,7 @@ func inspectText(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 	return nil
 }
 
-func dryRunText(result gate.DryRunResult, cfg config) error {
+func dryRunText(result gate.DryRunResult, cfg focusgate.Config) error {
 	w := os.Stdout
 
 	fmt.Fprintln(w, "=== Focus Gate Dry Run ===")
@@ -243,8 +382,8 @@ func dryRunText(result gate.DryRunResult, cfg config) error {
 		fmt.Fprintln(w)
 	}
 
-	fmt.Fprintf(w, "Thresholds: extend >= %.3f, branch >= %.3f\n",
-		cfg.Similarity.Extend, cfg.Similarity.Branch)
+	fmt.Fprintf(w, "Thresholds: extend >= %.3f, branch >= %.3f (%s)\n",
+		cfg.Similarity.Extend, cfg.Similarity.Branch, result.Metric)
 	fmt.Fprintln(w)
 
 	// Per-tree scoring
@@ -255,9 +394,18 @@ func dryRunText(result gate.DryRunResult, cfg config) error {
 			if len(rootContent) > 50 {
 				rootContent = rootContent[:50] + "..."
 			}
-			fmt.Fprintf(w, "  Tree #%d %q  [boost=%.3f]\n", ts.TreeIdx, rootContent, ts.BoostFactor)
-			fmt.Fprintf(w, "    Root %-14s  cosine=%.4f  boosted=%.4f\n",
-				ts.RootID, ts.RootCosine, ts.RootBoosted)
+			pin := ""
+			if ts.Pinned {
+				pin = " [pinned]"
+			}
+			boost := fmt.Sprintf("%.3f", ts.BoostFactor)
+			if result.BoostMode == gate.BoostAdditive {
+				boost = fmt.Sprintf("+%.3f", ts.BoostFactor)
+			}
+			fmt.Fprintf(w, "  Tree #%d %q  [boost=%s]%s\n", ts.TreeIdx, rootContent, boost, pin)
+			fmt.Fprintf(w, "    Root %-14s  %s=%.4f  boosted=%.4f\n",
+				ts.RootID, result.Metric, ts.RootCosine, ts.RootBoosted)
+			writeContributions(w, ts.RootContributions)
 
 			for _, ls := range ts.LeafScores {
 				leafContent := ls.Content
@@ -268,8 +416,9 @@ func dryRunText(result gate.DryRunResult, cfg config) error {
 				if ls.LeafID == result.BestLeaf && result.BestTree == ts.TreeIdx {
 					marker = "  <- BEST"
 				}
-				fmt.Fprintf(w, "    Leaf %-14s  cosine=%.4f  boosted=%.4f  %q%s\n",
-					ls.LeafID, ls.Cosine, ls.Boosted, leafContent, marker)
+				fmt.Fprintf(w, "    Leaf %-14s  %s=%.4f  boosted=%.4f  %q%s\n",
+					ls.LeafID, result.Metric, ls.Cosine, ls.Boosted, leafContent, marker)
+				writeContributions(w, ls.Contributions)
 			}
 			fmt.Fprintln(w)
 		}
@@ -279,16 +428,65 @@ func dryRunText(result gate.DryRunResult, cfg config) error {
 	}
 
 	// Final result
-	fmt.Fprintf(w, "Result: %s (score=%.4f)\n", result.BestAction, result.BestScore)
+	fmt.Fprintf(w, "Result: %s (score=%.4f, confidence: %s %.2f)\n",
+		result.BestAction, result.BestScore, gate.ConfidenceLabel(result.Confidence), result.Confidence)
 	switch result.BestAction {
 	case "new":
 		fmt.Fprintln(w, "  Would create a new topic tree with this prompt.")
 	case "branch":
 		fmt.Fprintf(w, "  Would add as new subtopic under root of Tree #%d.\n", result.BestTree)
+		if result.Jaccard > 0 {
+			fmt.Fprintf(w, "  Matched by token overlap (jaccard=%.4f), not cosine.\n", result.Jaccard)
+		}
 	case "extend":
 		fmt.Fprintf(w, "  Would add as sibling near leaf %s in Tree #%d.\n", result.BestLeaf, result.BestTree)
 	}
+	if result.SecondTree >= 0 {
+		fmt.Fprintf(w, "  Bridges Tree #%d (score=%.4f): the prompt is close to both topics.\n",
+			result.SecondTree, result.SecondScore)
+	}
+
+	return nil
+}
+
+// topContributions is how many shared terms dryRunText lists per node.
+const topContributions = 3
+
+// writeContributions prints the strongest shared terms behind a node's
+// cosine score, if any.
+func writeContributions(w *os.File, cs []gate.TermContribution) {
+	if len(cs) == 0 {
+		return
+	}
+	if len(cs) > topContributions {
+		cs = cs[:topContributions]
+	}
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = fmt.Sprintf("%s %.4f", c.Term, c.Product)
+	}
+	fmt.Fprintf(w, "      shared: %s\n", strings.Join(parts, ", "))
+}
 
+func searchText(query string, hits []gate.SearchHit) error {
+	w := os.Stdout
+	if len(hits) == 0 {
+		fmt.Fprintf(w, "[Focus] No matches for %q.\n", query)
+		return nil
+	}
+	fmt.Fprintf(w, "=== Focus Gate Search: %q ===\n", query)
+	fmt.Fprintln(w)
+	for _, h := range hits {
+		content := h.Content
+		if len(content) > 60 {
+			content = content[:60] + "..."
+		}
+		where := "(pruned)"
+		if h.TreeIdx >= 0 {
+			where = fmt.Sprintf("Tree #%d %s", h.TreeIdx, h.TreeID)
+		}
+		fmt.Fprintf(w, "  %.4f  %-5s  %s  %-14s  %q\n", h.Score, h.Kind, where, h.NodeID, content)
+	}
 	return nil
 }
 
@@ -301,11 +499,11 @@ func dryRunText(result gate.DryRunResult, cfg config) error {
 // don't need to re-derive them.
 
 type jsonInspect struct {
-	Config config     `json:"config"`
-	Forest jsonForest `json:"forest"`
-	TFIDF  jsonTFIDF  `json:"tfidf"`
-	Guide  jsonGuide  `json:"guide"`
-	Markov jsonMarkov `json:"markov"`
+	Config focusgate.Config `json:"config"`
+	Forest jsonForest       `json:"forest"`
+	TFIDF  jsonTFIDF        `json:"tfidf"`
+	Guide  jsonGuide        `json:"guide"`
+	Markov jsonMarkov       `json:"markov"`
 }
 
 type jsonForest struct {
@@ -315,6 +513,7 @@ type jsonForest struct {
 	TreeCount    int        `json:"treeCount"`
 	Created      int64      `json:"created"`
 	LastUpdate   int64      `json:"lastUpdate"`
+	PruneCutoff  float64    `json:"pruneCutoff"`
 	Trees        []jsonTree `json:"trees"`
 }
 
@@ -326,6 +525,8 @@ type jsonTree struct {
 	RootScore    float64  `json:"rootScore"`
 	Created      int64    `json:"created"`
 	LastAccessed int64    `json:"lastAccessed"`
+	Pinned       bool     `json:"pinned"`
+	DecayRate    *float64 `json:"decayRate,omitempty"`
 	Root         jsonNode `json:"root"`
 }
 
@@ -370,23 +571,28 @@ type jsonGuideEntry struct {
 type jsonMarkov struct {
 	LastTopic   string           `json:"lastTopic"`
 	TopicCount  int              `json:"topicCount"`
+	AvgEntropy  float64          `json:"avgEntropy"`
+	History     []string         `json:"history,omitempty"`
 	Transitions []jsonTransition `json:"transitions"`
 }
 
 type jsonTransition struct {
-	From  string        `json:"from"`
-	Total int           `json:"total"`
-	To    []jsonTransTo `json:"to"`
+	From       string        `json:"from"`
+	Total      float64       `json:"total"`
+	Entropy    float64       `json:"entropy"`
+	Perplexity float64       `json:"perplexity"`
+	To         []jsonTransTo `json:"to"`
 }
 
 type jsonTransTo struct {
 	TopicID     string  `json:"topicId"`
-	Count       int     `json:"count"`
+	Count       float64 `json:"count"`
 	Probability float64 `json:"probability"`
 }
 
-func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Chain, cfg config) error {
+func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Chain, cfg focusgate.Config) error {
 	now := time.Now().UnixMilli()
+	sp := cfg.ScoreParams()
 
 	// Build forest tree structures
 	trees := make([]jsonTree, 0, len(f.Trees))
@@ -400,10 +606,12 @@ func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 			RootID:       tree.RootID,
 			NodeCount:    tree.NodeCount(),
 			LeafCount:    len(tree.GetLeaves()),
-			RootScore:    root.Score(now, cfg.DecayRate),
+			RootScore:    root.Score(now, tree.Params(sp)),
 			Created:      tree.Created,
 			LastAccessed: tree.LastAccessed,
-			Root:         buildNodeJSON(tree, tree.RootID, now, cfg.DecayRate),
+			Pinned:       tree.Pinned,
+			DecayRate:    tree.DecayRate,
+			Root:         buildNodeJSON(tree, tree.RootID, now, tree.Params(sp)),
 		})
 	}
 
@@ -434,14 +642,16 @@ func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 			tos = append(tos, jsonTransTo{
 				TopicID:     to,
 				Count:       count,
-				Probability: float64(count) / float64(total),
+				Probability: count / total,
 			})
 		}
 		sort.Slice(tos, func(i, j int) bool { return tos[i].Count > tos[j].Count })
 		transitions = append(transitions, jsonTransition{
-			From:  from,
-			Total: total,
-			To:    tos,
+			From:       from,
+			Total:      total,
+			Entropy:    c.Entropy(from),
+			Perplexity: c.Perplexity(from),
+			To:         tos,
 		})
 	}
 
@@ -454,6 +664,7 @@ func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 			TreeCount:    len(f.Trees),
 			Created:      f.Meta.Created,
 			LastUpdate:   f.Meta.LastUpdate,
+			PruneCutoff:  f.PruneCutoff(now, cfg.MemorySize, sp),
 			Trees:        trees,
 		},
 		TFIDF: jsonTFIDF{
@@ -469,6 +680,8 @@ func inspectJSON(f *forest.Forest, e *tfidf.Engine, g *guide.Guide, c *markov.Ch
 		Markov: jsonMarkov{
 			LastTopic:   c.LastTopic,
 			TopicCount:  len(c.Counts),
+			AvgEntropy:  c.AverageEntropy(),
+			History:     c.History,
 			Transitions: transitions,
 		},
 	}
@@ -495,15 +708,16 @@ func dryRunJSON(result gate.DryRunResult) error {
 // ---------------------------------------------------------------------------
 
 // writeNodeTree recursively prints a tree's node hierarchy with box-drawing
-// connectors. isRoot controls whether the node metadata is printed (children
-// are always printed by their parent's iteration).
-func writeNodeTree(w *os.File, tree *forest.Tree, nodeID string, prefix string, now int64, decayRate float64, isRoot bool) {
+// connectors, listing under each node the prompts that contributed to it.
+// isRoot controls whether the node metadata is printed (children are always
+// printed by their parent's iteration).
+func writeNodeTree(w io.Writer, tree *forest.Tree, nodeID string, prefix string, now int64, sp forest.ScoreParams, isRoot bool) {
 	node := tree.Nodes[nodeID]
 	if node == nil {
 		return
 	}
 
-	score := node.Score(now, decayRate)
+	score := node.Score(now, sp)
 	idx := "-"
 	if node.Indexed {
 		idx = "Y"
@@ -517,6 +731,7 @@ func writeNodeTree(w *os.File, tree *forest.Tree, nodeID string, prefix string,
 		fmt.Fprintf(w, "%s[root] %s  d=%d w=%.2f f=%d idx=%s s=%.3f\n",
 			prefix, node.ID, node.Depth, node.Weight, node.Frequency, idx, score)
 		fmt.Fprintf(w, "%s%q\n", prefix, content)
+		writeSources(w, prefix, node)
 	}
 
 	for i, childID := range node.ChildIDs {
@@ -533,7 +748,7 @@ func writeNodeTree(w *os.File, tree *forest.Tree, nodeID string, prefix string,
 			extension = "    "
 		}
 
-		cScore := child.Score(now, decayRate)
+		cScore := child.Score(now, sp)
 		cIdx := "-"
 		if child.Indexed {
 			cIdx = "Y"
@@ -546,14 +761,22 @@ func writeNodeTree(w *os.File, tree *forest.Tree, nodeID string, prefix string,
 		fmt.Fprintf(w, "%s%s%s  d=%d w=%.2f f=%d idx=%s s=%.3f\n",
 			prefix, connector, child.ID, child.Depth, child.Weight, child.Frequency, cIdx, cScore)
 		fmt.Fprintf(w, "%s%s%q\n", prefix, extension, cContent)
+		writeSources(w, prefix+extension, child)
 
 		// Recurse into grandchildren with updated prefix.
-		writeNodeTree(w, tree, childID, prefix+extension, now, decayRate, false)
+		writeNodeTree(w, tree, childID, prefix+extension, now, sp, false)
+	}
+}
+
+// writeSources prints a node's source IDs, oldest first, if it has any.
+func writeSources(w io.Writer, prefix string, n *forest.Node) {
+	if len(n.Sources) > 0 {
+		fmt.Fprintf(w, "%ssrc: %s\n", prefix, strings.Join(n.Sources, ", "))
 	}
 }
 
 // buildNodeJSON recursively builds a JSON-friendly node hierarchy.
-func buildNodeJSON(tree *forest.Tree, nodeID string, now int64, decayRate float64) jsonNode {
+func buildNodeJSON(tree *forest.Tree, nodeID string, now int64, sp forest.ScoreParams) jsonNode {
 	node := tree.Nodes[nodeID]
 	if node == nil {
 		return jsonNode{}
@@ -566,14 +789,14 @@ func buildNodeJSON(tree *forest.Tree, nodeID string, now int64, decayRate float6
 		Weight:       node.Weight,
 		Frequency:    node.Frequency,
 		Indexed:      node.Indexed,
-		Score:        node.Score(now, decayRate),
+		Score:        node.Score(now, sp),
 		Created:      node.Created,
 		LastAccessed: node.LastAccessed,
 		Sources:      node.Sources,
 	}
 
 	for _, childID := range node.ChildIDs {
-		jn.Children = append(jn.Children, buildNodeJSON(tree, childID, now, decayRate))
+		jn.Children = append(jn.Children, buildNodeJSON(tree, childID, now, sp))
 	}
 
 	return jn
@@ -583,13 +806,15 @@ func buildNodeJSON(tree *forest.Tree, nodeID string, now int64, decayRate float6
 type termDF struct {
 	term string
 	df   int
+	idf  float64
 }
 
-// topTermsByDF returns the top n terms from the TF-IDF engine sorted by DF descending.
+// topTermsByDF returns the top n terms from the TF-IDF engine sorted by DF
+// descending, then by term. n <= 0 returns every term.
 func topTermsByDF(e *tfidf.Engine, n int) []termDF {
 	terms := make([]termDF, 0, len(e.DocFreq))
 	for t, df := range e.DocFreq {
-		terms = append(terms, termDF{t, df})
+		terms = append(terms, termDF{t, df, e.IDF(t)})
 	}
 	sort.Slice(terms, func(i, j int) bool {
 		if terms[i].df != terms[j].df {
@@ -597,12 +822,21 @@ func topTermsByDF(e *tfidf.Engine, n int) []termDF {
 		}
 		return terms[i].term < terms[j].term
 	})
-	if n > len(terms) {
+	if n <= 0 || n > len(terms) {
 		n = len(terms)
 	}
 	return terms[:n]
 }
 
+// fmtCount formats a transition count: whole numbers print as integers,
+// decayed counts with two decimals.
+func fmtCount(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
 // msToTime formats a Unix-millisecond timestamp as a human-readable string.
 // Returns "(none)" for zero timestamps.
 func msToTime(ms int64) string {
@@ -612,6 +846,22 @@ func msToTime(ms int64) string {
 	return time.UnixMilli(ms).Format("2006-01-02 15:04:05")
 }
 
+// writeMarkovHistory prints the recorded topic visits, oldest first, naming
+// trees that are still in the forest.
+func writeMarkovHistory(w io.Writer, f *forest.Forest, c *markov.Chain) {
+	if len(c.History) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  History (%d visits, oldest first):\n", len(c.History))
+	for _, id := range c.History {
+		if name := treeNameByID(f, id); name != "" {
+			fmt.Fprintf(w, "    %s (%s)\n", id, name)
+		} else {
+			fmt.Fprintf(w, "    %s\n", id)
+		}
+	}
+}
+
 // treeNameByID returns the truncated root content for a tree ID, or "".
 func treeNameByID(f *forest.Forest, treeID string) string {
 	for _, tree := range f.Trees {
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+)
+
+func TestInspectTextShowsSources(t *testing.T) {
+	tree := forest.NewTree("auth and sessions", "p1")
+	leaf := tree.AddChild(tree.RootID, "refresh the auth token", "p3")
+	for i := 4; i <= 8; i++ {
+		leaf.Touch(3, fmt.Sprintf("p%d", i), "")
+	}
+	leaf.Touch(3, "guide-reinforce", "")
+	quiet := tree.AddChild(tree.RootID, "log out idle sessions", "")
+
+	sp := forest.ScoreParams{DecayRate: 0.05, DepthPenalty: 0.15}
+	var buf bytes.Buffer
+	writeNodeTree(&buf, tree, tree.RootID, "    ", leaf.LastAccessed, sp, true)
+	out := buf.String()
+
+	if !strings.Contains(out, "    src: p1\n") {
+		t.Errorf("root sources missing:\n%s", out)
+	}
+	// Only the newest three sources survive, in order, under the leaf.
+	leafAt := strings.Index(out, leaf.ID)
+	src := strings.Index(out, "src: p7, p8, guide-reinforce\n")
+	if leafAt < 0 || src < leafAt {
+		t.Errorf("leaf sources missing or misplaced:\n%s", out)
+	}
+	if strings.Contains(out, "p3,") || strings.Contains(out, "p6,") {
+		t.Errorf("sources beyond the cap shown:\n%s", out)
+	}
+	// A node without sources gets no src line.
+	if after := out[strings.Index(out, quiet.ID):]; strings.Contains(after, "src:") {
+		t.Errorf("src line printed for a node without sources:\n%s", out)
+	}
+}
@@ -1,146 +1,105 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/archive"
 	"github.com/kuandriy/focus-gate/internal/forest"
 	"github.com/kuandriy/focus-gate/internal/gate"
 	"github.com/kuandriy/focus-gate/internal/guide"
 	"github.com/kuandriy/focus-gate/internal/markov"
 	"github.com/kuandriy/focus-gate/internal/persist"
-	"github.com/kuandriy/focus-gate/internal/text"
 	"github.com/kuandriy/focus-gate/internal/tfidf"
 )
 
-// paths resolves data file paths relative to the binary location.
+// paths locates a workspace's state files and the shared config file.
 type paths struct {
-	dataDir    string
-	intentFile string
-	engineFile string
-	guideFile  string
-	markovFile string
+	focusgate.Files
 	configFile string
 }
 
-func resolvePaths() paths {
+// resolvePaths returns the state paths for workspace. With no workspace,
+// state lives in data/ next to the binary; each named workspace gets its own
+// subdirectory of data/, so one installed binary can serve several projects
+// without blending their forests. config.json is always shared.
+func resolvePaths(workspace string) paths {
 	exe, err := os.Executable()
 	if err != nil {
 		exe = "."
 	}
-	dir := filepath.Dir(exe)
+	return pathsIn(filepath.Dir(exe), workspace)
+}
+
+// pathsIn lays out the state paths for workspace under dir, the directory
+// holding the binary and config.json.
+func pathsIn(dir, workspace string) paths {
 	dataDir := filepath.Join(dir, "data")
+	if workspace != "" {
+		dataDir = filepath.Join(dataDir, workspaceKey(workspace))
+	}
 	return paths{
-		dataDir:    dataDir,
-		intentFile: filepath.Join(dataDir, "intent.json"),
-		engineFile: filepath.Join(dataDir, "engine.json"),
-		guideFile:  filepath.Join(dataDir, "guide.json"),
-		markovFile: filepath.Join(dataDir, "markov.json"),
+		Files:      focusgate.FilesIn(dataDir),
 		configFile: filepath.Join(dir, "config.json"),
 	}
 }
 
-// config matches the JSON config file structure.
-type config struct {
-	MemorySize int     `json:"memorySize"`
-	DecayRate  float64 `json:"decayRate"`
-	Similarity struct {
-		Extend float64 `json:"extend"`
-		Branch float64 `json:"branch"`
-	} `json:"similarity"`
-	ContextLimit      int     `json:"contextLimit"`
-	BubbleUpTerms     int     `json:"bubbleUpTerms"`
-	MaxSourcesPerNode int     `json:"maxSourcesPerNode"`
-	GuideSize         int     `json:"guideSize"`
-	TransitionBoost   float64 `json:"transitionBoost"`
-}
-
-func defaultConfig() config {
-	c := config{
-		MemorySize:        100,
-		DecayRate:         0.05,
-		ContextLimit:      600,
-		BubbleUpTerms:     6,
-		MaxSourcesPerNode: 20,
-		GuideSize:         15,
-		TransitionBoost:   0.2,
-	}
-	c.Similarity.Extend = 0.55
-	c.Similarity.Branch = 0.25
-	return c
+// workspaceKey names a workspace's state directory: a hash of the cleaned
+// workspace path, so any path maps to a short, filesystem-safe name.
+func workspaceKey(workspace string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(workspace)))
+	return hex.EncodeToString(sum[:8])
 }
 
-// loadConfig uses a two-phase JSON approach to distinguish "user set field to 0"
-// from "field absent" (should use default). Phase 1 loads a raw map to detect
-// which keys are present. Phase 2 loads the full struct. Only explicitly present
-// keys override defaults, so users can intentionally set transitionBoost=0 or
-// decayRate=0 without the value being silently replaced.
-func loadConfig(path string) config {
-	cfg := defaultConfig()
+// hookInput is the JSON structure sent by Claude Code on stdin.
+type hookInput struct {
+	Prompt         string `json:"prompt"`
+	TranscriptPath string `json:"transcript_path"`
 
-	// Phase 1: Detect which keys the user explicitly set.
-	raw := make(map[string]json.RawMessage)
-	if err := persist.Load(path, &raw); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: load config: %v\n", err)
-		return cfg
-	}
-	if len(raw) == 0 {
-		return cfg
-	}
+	// Workspace selects per-project state. Cwd, which Claude Code always
+	// sends, does so only with workspaceFromCwd set, so existing installs
+	// keep using the shared data/ directory.
+	Workspace string `json:"workspace"`
+	Cwd       string `json:"cwd"`
+}
 
-	// Phase 2: Parse into full struct.
-	var userCfg config
-	if err := persist.Load(path, &userCfg); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: parse config: %v\n", err)
-		return cfg
+// workspace returns the workspace the input names, if any, falling back to
+// Cwd when fromCwd is set.
+func (in hookInput) workspace(fromCwd bool) string {
+	if in.Workspace != "" || !fromCwd {
+		return in.Workspace
 	}
+	return in.Cwd
+}
 
-	// Phase 3: Apply only the keys the user explicitly wrote.
-	if _, ok := raw["memorySize"]; ok {
-		cfg.MemorySize = userCfg.MemorySize
-	}
-	if _, ok := raw["decayRate"]; ok {
-		cfg.DecayRate = userCfg.DecayRate
-	}
-	if _, ok := raw["contextLimit"]; ok {
-		cfg.ContextLimit = userCfg.ContextLimit
-	}
-	if _, ok := raw["bubbleUpTerms"]; ok {
-		cfg.BubbleUpTerms = userCfg.BubbleUpTerms
-	}
-	if _, ok := raw["maxSourcesPerNode"]; ok {
-		cfg.MaxSourcesPerNode = userCfg.MaxSourcesPerNode
-	}
-	if _, ok := raw["guideSize"]; ok {
-		cfg.GuideSize = userCfg.GuideSize
-	}
-	if _, ok := raw["transitionBoost"]; ok {
-		cfg.TransitionBoost = userCfg.TransitionBoost
+// readHookInput reads and parses the hook's JSON input from stdin. It
+// returns nil for empty input.
+func readHookInput() (*hookInput, error) {
+	// Read all of stdin — works on Windows, Linux, macOS
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
 	}
-	// Handle nested "similarity" object.
-	if simRaw, ok := raw["similarity"]; ok {
-		var simMap map[string]json.RawMessage
-		if json.Unmarshal(simRaw, &simMap) == nil {
-			if _, ok := simMap["extend"]; ok {
-				cfg.Similarity.Extend = userCfg.Similarity.Extend
-			}
-			if _, ok := simMap["branch"]; ok {
-				cfg.Similarity.Branch = userCfg.Similarity.Branch
-			}
-		}
+	if len(data) == 0 {
+		return nil, nil
 	}
 
-	return cfg
-}
-
-// hookInput is the JSON structure sent by Claude Code on stdin.
-type hookInput struct {
-	Prompt         string `json:"prompt"`
-	TranscriptPath string `json:"transcript_path"`
+	var input hookInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("parse stdin: %w", err)
+	}
+	return &input, nil
 }
 
 func main() {
@@ -158,261 +117,720 @@ func main() {
 }
 
 func run() error {
-	p := resolvePaths()
+	// --workspace selects a project's state for any command. It is removed
+	// from the arguments so commands see their usual positions.
+	workspace, args := takeFlagValue(os.Args, "--workspace")
+	os.Args = args
+
+	// Hook mode: read the prompt first, since the input can name the
+	// workspace whose state to use.
+	var input *hookInput
+	if len(os.Args) < 2 {
+		in, err := readHookInput()
+		if err != nil || in == nil {
+			return err
+		}
+		input = in
+	}
 
-	// Recover .tmp files from interrupted saves before loading any state.
-	persist.RecoverTmpFiles(p.intentFile, p.engineFile, p.guideFile, p.markovFile)
-	cfg := loadConfig(p.configFile)
+	// config.json is shared by all workspaces, so it is read before the
+	// workspace is settled: workspaceFromCwd decides whether the hook's cwd
+	// picks one.
+	cfg, userKeys := focusgate.LoadConfig(resolvePaths("").configFile)
+	if input != nil && workspace == "" {
+		workspace = input.workspace(cfg.WorkspaceFromCwd)
+	}
+	p := resolvePaths(workspace)
 
 	// Parse CLI flags. --json is a modifier flag that can appear alongside
-	// --inspect or --dry-run to switch output from human-readable text to
+	// --status, --inspect, --topics, --dry-run, --search, --terms,
+	// --metrics, --calibrate or --audit to switch output from human-readable text to
 	// machine-readable JSON.
 	jsonOutput := hasFlag(os.Args, "--json")
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "--reset":
-			return handleReset(p)
-		case "--status":
-			return handleStatus(p, cfg)
-		case "--inspect":
-			return handleInspect(p, cfg, jsonOutput)
-		case "--dry-run":
-			// --dry-run expects the next argument to be the prompt string.
-			prompt := ""
-			if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
-				prompt = os.Args[2]
+	// Hook mode, --status and --batch run through a focusgate.Session, which
+	// takes the state lock and recovers interrupted saves itself. --status
+	// --watch only reads, and takes no lock at all.
+	if input != nil {
+		return handlePrompt(p, cfg, *input)
+	}
+	switch os.Args[1] {
+	case "--status":
+		if hasFlag(os.Args, "--watch") {
+			interval := defaultWatchInterval
+			if v := flagValue(os.Args, "--interval"); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return fmt.Errorf("usage: focus --status --watch [--interval 2s] [--json]")
+				}
+				interval = d
+			}
+			return handleStatusWatch(p, cfg, jsonOutput, interval)
+		}
+		return handleStatus(p, cfg, jsonOutput)
+	case "--batch":
+		return handleBatch(p, cfg)
+	}
+
+	// Serialize overlapping invocations (fast successive prompts, --status
+	// during a prompt) so they don't clobber each other's state files. The
+	// lock is advisory: on timeout we warn and proceed rather than block.
+	lock, err := persist.AcquireLock(p.Lock, focusgate.LockTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: state lock: %v; continuing without it\n", err)
+	}
+	defer lock.Release()
+
+	// Recover .tmp files from interrupted saves before loading any state,
+	// in both storage formats, then adopt files saved in the other format.
+	p.Files = p.Prepare(cfg)
+
+	switch os.Args[1] {
+	case "--reset":
+		return handleReset(p)
+	case "--config":
+		if hasFlag(os.Args, "--check") {
+			return checkConfig(os.Stdout, cfg)
+		}
+		return handleConfig(cfg, userKeys)
+	case "--inspect":
+		return handleInspect(p, cfg, jsonOutput)
+	case "--dry-run":
+		// --dry-run expects the next argument to be the prompt string.
+		prompt := ""
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			prompt = os.Args[2]
+		}
+		if prompt == "" {
+			return fmt.Errorf("usage: focus --dry-run \"prompt text\" [--json]")
+		}
+		return handleDryRun(p, cfg, prompt, jsonOutput)
+	case "--calibrate":
+		return handleCalibrate(p, cfg, jsonOutput)
+	case "--dry-run-seq":
+		return handleDryRunSeq(p, cfg)
+	case "--search":
+		query := ""
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			query = os.Args[2]
+		}
+		if query == "" {
+			return fmt.Errorf("usage: focus --search \"query\" [--guide] [--json]")
+		}
+		return handleSearch(p, cfg, query, hasFlag(os.Args, "--guide"), jsonOutput)
+	case "--find":
+		query := ""
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			query = os.Args[2]
+		}
+		if query == "" {
+			return fmt.Errorf("usage: focus --find <nodeId|text>")
+		}
+		return handleFind(p, cfg, query)
+	case "--topics":
+		return handleTopics(p, cfg, jsonOutput)
+	case "--forecast":
+		hours := float64(defaultForecastHours)
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			v, err := strconv.ParseFloat(os.Args[2], 64)
+			if err != nil || v < 0 {
+				return fmt.Errorf("usage: focus --forecast [hours] [--json]")
+			}
+			hours = v
+		}
+		return handleForecast(p, cfg, hours, jsonOutput)
+	case "--digest":
+		n := digestTerms
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			v, err := strconv.Atoi(os.Args[2])
+			if err != nil || v < 1 {
+				return fmt.Errorf("usage: focus --digest [N]")
+			}
+			n = v
+		}
+		return handleDigest(p, cfg, n)
+	case "--explain":
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			return fmt.Errorf("usage: focus --explain <nodeId>")
+		}
+		return handleExplain(p, cfg, os.Args[2])
+	case "--archive-list":
+		return handleArchiveList(p)
+	case "--restore-tree":
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			return fmt.Errorf("usage: focus --restore-tree <archiveId>")
+		}
+		return handleRestoreTree(p, cfg, os.Args[2])
+	case "--terms":
+		minDF := 0
+		if v := flagValue(os.Args, "--min-df"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("usage: focus --terms [--min-df N] [--json]")
+			}
+			minDF = n
+		}
+		return handleTerms(p, minDF, jsonOutput)
+	case "--metrics":
+		return handleMetrics(p, jsonOutput)
+	case "--audit":
+		var since int64
+		if v := flagValue(os.Args, "--since"); v != "" {
+			t, err := parseSince(v, time.Now())
+			if err != nil {
+				return fmt.Errorf("usage: focus --audit [--since 24h|2006-01-02] [--json]: %w", err)
 			}
-			if prompt == "" {
-				return fmt.Errorf("usage: focus --dry-run \"prompt text\" [--json]")
+			since = t
+		}
+		return handleAudit(p, since, jsonOutput)
+	case "--undo":
+		return handleUndo(p, cfg)
+	case "--prune":
+		// --prune takes an optional node budget; default is memorySize.
+		budget := cfg.MemorySize
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 0 {
+				return fmt.Errorf("usage: focus --prune [N]")
 			}
-			return handleDryRun(p, cfg, prompt, jsonOutput)
+			budget = n
+		}
+		return handlePrune(p, cfg, budget)
+	case "--compact":
+		return handleCompact(p, cfg)
+	case "--dedupe-trees":
+		return handleDedupeTrees(p, cfg)
+	case "--pin", "--unpin":
+		ref := ""
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			ref = os.Args[2]
+		}
+		if ref == "" {
+			return fmt.Errorf("usage: focus %s <treeIndexOrId>", os.Args[1])
+		}
+		return handlePin(p, cfg, ref, os.Args[1] == "--pin")
+	case "--split":
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			return fmt.Errorf("usage: focus --split <treeIndexOrId>")
+		}
+		return handleSplit(p, cfg, os.Args[2])
+	case "--move":
+		if len(os.Args) < 4 || strings.HasPrefix(os.Args[2], "--") {
+			return fmt.Errorf("usage: focus --move <nodeId> <treeIndexOrId>")
 		}
+		return handleMove(p, cfg, os.Args[2], os.Args[3])
+	case "--decay":
+		if len(os.Args) < 4 || strings.HasPrefix(os.Args[2], "--") {
+			return fmt.Errorf("usage: focus --decay <treeIndexOrId> <rate|global>")
+		}
+		return handleDecay(p, cfg, os.Args[2], os.Args[3])
+	case "--export", "--import":
+		file := ""
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			file = os.Args[2]
+		}
+		if file == "" {
+			return fmt.Errorf("usage: focus %s <file>", os.Args[1])
+		}
+		if os.Args[1] == "--export" {
+			return handleExport(p, cfg, file)
+		}
+		return handleImport(p, cfg, file)
+	case "--restore":
+		// --restore takes an optional backup number; default is the
+		// most recent backup.
+		n := 1
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "--") {
+			v, err := strconv.Atoi(os.Args[2])
+			if err != nil || v < 1 {
+				return fmt.Errorf("usage: focus --restore [n]")
+			}
+			n = v
+		}
+		return handleRestore(p, n)
 	}
 
-	// Default: hook mode — read prompt from stdin
-	return handlePrompt(p, cfg)
+	return fmt.Errorf("unknown command %q", os.Args[1])
 }
 
 func handleReset(p paths) error {
-	persist.Remove(p.intentFile)
-	persist.Remove(p.engineFile)
-	persist.Remove(p.guideFile)
-	persist.Remove(p.markovFile)
+	for _, path := range p.StateFiles() {
+		persist.Remove(path)
+		persist.Remove(focusgate.Alternate(path))
+	}
+	persist.Remove(p.Archive)
+	persist.Remove(p.Decisions)
 	fmt.Fprint(os.Stdout, "[Focus] Reset complete. All tracking data cleared.\n")
 	return nil
 }
 
-// logLoadErr logs non-nil persist.Load errors to stderr. Errors are logged
-// rather than returned because a corrupt file should not block the user's
-// prompt — the system continues with empty/default state and the user can
-// --reset if needed.
-func logLoadErr(name string, err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: load %s: %v\n", name, err)
+// handleUndo reverses the most recent prompt using the journal written by
+// handlePrompt. The journal is removed afterwards, so only one level of undo
+// is available.
+func handleUndo(p paths, cfg focusgate.Config) error {
+	if !persist.Exists(p.Journal) {
+		fmt.Fprint(os.Stdout, "[Focus] Nothing to undo.\n")
+		return nil
+	}
+	var j gate.Journal
+	if err := persist.Load(p.Journal, &j); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+		return fmt.Errorf("load journal: %w", err)
 	}
-}
 
-func handleStatus(p paths, cfg config) error {
 	f := forest.NewForest()
-	logLoadErr("intent", persist.Load(p.intentFile, f))
+	focusgate.LoadState("intent", p.Intent, f)
 
 	e := tfidf.NewEngine()
-	logLoadErr("engine", persist.Load(p.engineFile, e))
-
-	g := guide.New(cfg.GuideSize)
-	logLoadErr("guide", persist.Load(p.guideFile, g))
+	focusgate.LoadState("engine", p.Engine, e)
 
 	c := markov.New()
-	logLoadErr("markov", persist.Load(p.markovFile, c))
+	focusgate.LoadState("markov", p.Markov, c)
 
-	gateCfg := toGateConfig(cfg)
-	gt := gate.NewWithChain(f, e, c, gateCfg)
-	ctx := gt.GenerateContext()
-	if ctx != "" {
-		fmt.Fprint(os.Stdout, ctx)
-	} else {
-		fmt.Fprintf(os.Stdout, "[Focus | %d prompts | %d/%d mem | %d trees]\n[/Focus]\n",
-			f.Meta.TotalPrompts, f.NodeCount(), cfg.MemorySize, len(f.Trees))
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	if err := gt.Undo(&j); err != nil {
+		return fmt.Errorf("undo: %w", err)
 	}
 
-	guideCtx := g.Render(f)
-	if guideCtx != "" {
-		fmt.Fprint(os.Stdout, guideCtx)
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
 	}
+	if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+		return fmt.Errorf("save engine: %w", err)
+	}
+	if cfg.MarkovEnabled {
+		if err := focusgate.SaveState(cfg, p.Markov, c); err != nil {
+			return fmt.Errorf("save markov: %w", err)
+		}
+	}
+	persist.Remove(p.Journal)
 
+	fmt.Fprintf(os.Stdout, "[Focus] Undid last prompt (%s). %d prompts, %d trees.\n",
+		j.Action, f.Meta.TotalPrompts, len(f.Trees))
 	return nil
 }
 
-func handlePrompt(p paths, cfg config) error {
-	// Read all of stdin — works on Windows, Linux, macOS
-	data, err := io.ReadAll(os.Stdin)
-	if err != nil {
-		return fmt.Errorf("read stdin: %w", err)
+// handlePrune trims the forest to budget nodes on demand, keeping the engine
+// and Markov chain in sync exactly as automatic pruning does.
+func handlePrune(p paths, cfg focusgate.Config, budget int) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	res := gt.Prune(budget)
+	focusgate.ArchivePrunedTrees(p.Archive, gt)
+
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
 	}
-	if len(data) == 0 {
-		return nil
+	if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+		return fmt.Errorf("save engine: %w", err)
+	}
+	if cfg.MarkovEnabled {
+		if err := focusgate.SaveState(cfg, p.Markov, c); err != nil {
+			return fmt.Errorf("save markov: %w", err)
+		}
 	}
 
-	var input hookInput
-	if err := json.Unmarshal(data, &input); err != nil {
-		return fmt.Errorf("parse stdin: %w", err)
+	fmt.Fprintf(os.Stdout, "[Focus] Pruned %d nodes, %d trees. %d/%d mem, %d trees remain.\n",
+		res.Nodes, res.Trees, f.NodeCount(), budget, len(f.Trees))
+	return nil
+}
+
+// handleCompact merges near-duplicate sibling leaves in every tree, removing
+// the absorbed prompts from the TF-IDF corpus.
+func handleCompact(p paths, cfg focusgate.Config) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	gt := gate.New(f, e, cfg.GateConfig())
+	merged, trees := 0, 0
+	for _, t := range f.Trees {
+		if n := gt.Compact(t); n > 0 {
+			merged += n
+			trees++
+		}
 	}
 
-	prompt := text.CleanPrompt(input.Prompt)
-	if prompt == "" {
-		return nil
+	if merged > 0 {
+		if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+			return fmt.Errorf("save intent: %w", err)
+		}
+		if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+			return fmt.Errorf("save engine: %w", err)
+		}
 	}
 
-	// Load persisted state
+	fmt.Fprintf(os.Stdout, "[Focus] Compacted %d leaves in %d trees. %d/%d mem.\n",
+		merged, trees, f.NodeCount(), cfg.MemorySize)
+	return nil
+}
+
+// handleDedupeTrees merges trees whose roots duplicate an earlier tree's,
+// moving their Markov transitions along with them.
+func handleDedupeTrees(p paths, cfg focusgate.Config) error {
 	f := forest.NewForest()
-	logLoadErr("intent", persist.Load(p.intentFile, f))
+	focusgate.LoadState("intent", p.Intent, f)
 
 	e := tfidf.NewEngine()
-	logLoadErr("engine", persist.Load(p.engineFile, e))
-
-	g := guide.New(cfg.GuideSize)
-	logLoadErr("guide", persist.Load(p.guideFile, g))
+	focusgate.LoadState("engine", p.Engine, e)
 
 	c := markov.New()
-	logLoadErr("markov", persist.Load(p.markovFile, c))
+	focusgate.LoadState("markov", p.Markov, c)
+
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	merged := gt.DedupeTrees()
 
-	// Update guide from transcript (if available)
-	if input.TranscriptPath != "" {
-		updateGuide(g, input.TranscriptPath, f)
+	if merged > 0 {
+		if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+			return fmt.Errorf("save intent: %w", err)
+		}
+		if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+			return fmt.Errorf("save engine: %w", err)
+		}
+		if cfg.MarkovEnabled {
+			if err := focusgate.SaveState(cfg, p.Markov, c); err != nil {
+				return fmt.Errorf("save markov: %w", err)
+			}
+		}
 	}
 
-	// Process prompt
-	gateCfg := toGateConfig(cfg)
-	gt := gate.NewWithChain(f, e, c, gateCfg)
+	fmt.Fprintf(os.Stdout, "[Focus] Merged %d duplicate trees. %d trees, %d/%d mem.\n",
+		merged, len(f.Trees), f.NodeCount(), cfg.MemorySize)
+	return nil
+}
+
+// handlePin sets or clears the pin on a tree, addressed by ID or by the
+// index shown in --inspect.
+func handlePin(p paths, cfg focusgate.Config, ref string, pinned bool) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
 
-	// Reinforce the forest from new AI response summaries before classifying
-	// the incoming prompt, so tree scores reflect recent assistant activity.
-	if reinforced := gt.ReinforceFromGuide(g); reinforced > 0 {
-		fmt.Fprintf(os.Stderr, "focus-gate: reinforced %d guide entries\n", reinforced)
+	t := f.FindTree(ref)
+	if t == nil {
+		return fmt.Errorf("no tree %q", ref)
+	}
+	t.Pinned = pinned
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
 	}
 
-	// Process the new prompt
-	ctx := gt.ProcessPrompt(prompt, fmt.Sprintf("p%d", f.Meta.TotalPrompts))
+	verb := "Pinned"
+	if !pinned {
+		verb = "Unpinned"
+	}
+	name := ""
+	if root := t.Root(); root != nil {
+		name = root.Content
+	}
+	fmt.Fprintf(os.Stdout, "[Focus] %s tree %s %q\n", verb, t.ID, name)
+	return nil
+}
+
+// handleMove moves a node, with its subtree, under the root of the tree
+// addressed by ID or by the index shown in --inspect.
+func handleMove(p paths, cfg focusgate.Config, nodeID, ref string) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
 
-	// Append guide context
-	guideCtx := g.Render(f)
-	if guideCtx != "" {
-		// Insert guide before [/Focus]
-		ctx = strings.Replace(ctx, "[/Focus]\n", guideCtx+"[/Focus]\n", 1)
+	t := f.FindTree(ref)
+	if t == nil {
+		return fmt.Errorf("no tree %q", ref)
+	}
+	_, node := f.FindNode(nodeID)
+	if node == nil {
+		return fmt.Errorf("no node %q", nodeID)
+	}
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	if err := gt.MoveNode(node.ID, slices.Index(f.Trees, t)); err != nil {
+		return err
 	}
 
-	// Save all state atomically
-	if err := persist.SaveAtomic(p.intentFile, f); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: save intent: %v\n", err)
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
 	}
-	if err := persist.SaveAtomic(p.engineFile, e); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: save engine: %v\n", err)
+	if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+		return fmt.Errorf("save engine: %w", err)
 	}
-	if err := persist.SaveAtomic(p.guideFile, g); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: save guide: %v\n", err)
+	if cfg.MarkovEnabled {
+		if err := focusgate.SaveState(cfg, p.Markov, c); err != nil {
+			return fmt.Errorf("save markov: %w", err)
+		}
 	}
-	if err := persist.SaveAtomic(p.markovFile, c); err != nil {
-		fmt.Fprintf(os.Stderr, "focus-gate: save markov: %v\n", err)
+
+	fmt.Fprintf(os.Stdout, "[Focus] Moved node %s %q to tree %s %q. %d trees, %d/%d mem.\n",
+		node.ID, node.Content, t.ID, t.Root().Content, len(f.Trees), f.NodeCount(), cfg.MemorySize)
+	return nil
+}
+
+// handleSplit splits a tree, addressed by ID or by the index shown in
+// --inspect, into two trees by clustering its leaves.
+func handleSplit(p paths, cfg focusgate.Config, ref string) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	t := f.FindTree(ref)
+	if t == nil {
+		return fmt.Errorf("no tree %q", ref)
+	}
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	idx := 0
+	for i, tree := range f.Trees {
+		if tree == t {
+			idx = i
+		}
+	}
+	split, err := gt.SplitTree(idx)
+	if err != nil {
+		return err
 	}
 
-	// Output context to stdout
-	fmt.Fprint(os.Stdout, ctx)
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
+	}
+	if err := focusgate.SaveState(cfg, p.Engine, e); err != nil {
+		return fmt.Errorf("save engine: %w", err)
+	}
+	if cfg.MarkovEnabled {
+		if err := focusgate.SaveState(cfg, p.Markov, c); err != nil {
+			return fmt.Errorf("save markov: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "[Focus] Split tree %s %q (%d leaves) from tree %s %q (%d leaves).\n",
+		split.ID, split.Root().Content, len(split.GetLeaves()),
+		t.ID, t.Root().Content, len(t.GetLeaves()))
 	return nil
 }
 
-// updateGuide extracts the last assistant message from a Claude Code transcript
-// and adds it to the guide. Uses structured JSON decoding to handle all valid
-// transcript formats — plain string content, arrays of content blocks, nested
-// objects, and escaped characters.
-func updateGuide(g *guide.Guide, transcriptPath string, f *forest.Forest) {
-	data, err := os.ReadFile(transcriptPath)
+// handleDecay sets a tree's decay rate override, or clears it when rate is
+// "global" so the tree follows decayRate again.
+func handleDecay(p paths, cfg focusgate.Config, ref, rate string) error {
+	var override *float64
+	if rate != "global" {
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r < 0 {
+			return fmt.Errorf("invalid decay rate %q: want a number >= 0 or \"global\"", rate)
+		}
+		override = &r
+	}
+
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	t := f.FindTree(ref)
+	if t == nil {
+		return fmt.Errorf("no tree %q", ref)
+	}
+	t.DecayRate = override
+	if err := focusgate.SaveState(cfg, p.Intent, f); err != nil {
+		return fmt.Errorf("save intent: %w", err)
+	}
+
+	name := ""
+	if root := t.Root(); root != nil {
+		name = root.Content
+	}
+	if override == nil {
+		fmt.Fprintf(os.Stdout, "[Focus] Tree %s %q uses the global decay rate (%g).\n", t.ID, name, cfg.DecayRate)
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "[Focus] Tree %s %q decays at %g per hour.\n", t.ID, name, *override)
+	return nil
+}
+
+// handleExport bundles the persisted state and the effective config into a
+// single archive file.
+func handleExport(p paths, cfg focusgate.Config, file string) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	g := guide.New(cfg.GuideSize)
+	focusgate.LoadState("guide", p.Guide, g)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	cfgData, err := json.Marshal(cfg)
 	if err != nil {
-		return
+		return fmt.Errorf("marshal config: %w", err)
 	}
 
-	// Claude Code transcript: JSON array of {role, message: {content}} objects.
-	// content may be a plain string or an array of {type, text} blocks.
-	type transcriptEntry struct {
-		Role    string `json:"role"`
-		Message struct {
-			Content json.RawMessage `json:"content"`
-		} `json:"message"`
+	a := &archive.Archive{Config: cfgData, Intent: f, Engine: e, Guide: g, Markov: c}
+	if err := archive.Export(file, a); err != nil {
+		return fmt.Errorf("export: %w", err)
 	}
+	fmt.Fprintf(os.Stdout, "[Focus] Exported %d trees, %d nodes to %s\n", len(f.Trees), f.NodeCount(), file)
+	return nil
+}
 
-	var transcript []transcriptEntry
-	if err := json.Unmarshal(data, &transcript); err != nil {
-		return
+// handleImport validates an archive and replaces the persisted state and
+// config with its contents. Nothing is written unless the archive is valid.
+func handleImport(p paths, cfg focusgate.Config, file string) error {
+	a, err := archive.Import(file)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	err = a.Restore(archive.Files{
+		Intent: p.Intent,
+		Engine: p.Engine,
+		Guide:  p.Guide,
+		Markov: p.Markov,
+		Config: p.configFile,
+		Backup: cfg.BackupCount,
+	})
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
 	}
+	// Cached vectors and the undo journal belong to the replaced state.
+	persist.Remove(p.VecCache)
+	persist.Remove(p.Journal)
+	fmt.Fprintf(os.Stdout, "[Focus] Imported %d trees, %d nodes from %s\n", len(a.Intent.Trees), a.Intent.NodeCount(), file)
+	return nil
+}
 
-	// Walk backwards to find the last assistant message.
-	snippet := ""
-	for i := len(transcript) - 1; i >= 0; i-- {
-		if transcript[i].Role != "assistant" {
+// handleRestore promotes backup n of each state file to the live file. State
+// files without that backup are left as they are.
+func handleRestore(p paths, n int) error {
+	restored := 0
+	for _, path := range p.BackedUpFiles() {
+		if !persist.Exists(persist.BackupPath(path, n)) {
 			continue
 		}
-
-		raw := transcript[i].Message.Content
-		if len(raw) == 0 {
-			continue
+		if err := persist.RestoreBackup(path, n); err != nil {
+			return fmt.Errorf("restore %s: %w", filepath.Base(path), err)
 		}
+		restored++
+	}
+	if restored == 0 {
+		fmt.Fprintf(os.Stdout, "[Focus] No backup %d found.\n", n)
+		return nil
+	}
+	// Cached vectors and the undo journal belong to the replaced state.
+	persist.Remove(p.VecCache)
+	persist.Remove(p.Journal)
+	fmt.Fprintf(os.Stdout, "[Focus] Restored %d state files from backup %d.\n", restored, n)
+	return nil
+}
 
-		// Try content as plain string first, then as array of content blocks.
-		var contentStr string
-		if json.Unmarshal(raw, &contentStr) == nil && contentStr != "" {
-			snippet = contentStr
-			break
-		}
+func handleStatus(p paths, cfg focusgate.Config, asJSON bool) error {
+	s, err := focusgate.Open(p.Dir, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
 
-		// Array of content blocks (Claude format): [{type, text}, ...].
-		var blocks []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		}
-		if json.Unmarshal(raw, &blocks) == nil {
-			for _, block := range blocks {
-				if block.Text != "" {
-					snippet = block.Text
-					break
-				}
-			}
-			if snippet != "" {
-				break
-			}
+	if asJSON {
+		data, err := s.StatusJSON()
+		if err != nil {
+			return fmt.Errorf("marshal status: %w", err)
 		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	fmt.Fprint(os.Stdout, s.StatusDisplay())
+	return nil
+}
+
+// handlePrompt is hook mode: it classifies the prompt read from stdin and
+// prints the resulting context. A failed save is logged rather than returned
+// so the context still reaches the prompt.
+func handlePrompt(p paths, cfg focusgate.Config, input hookInput) error {
+	s, err := focusgate.Open(p.Dir, cfg)
+	if err != nil {
+		return err
 	}
+	defer s.Close()
 
-	// Truncate to a summary length.
-	if len(snippet) > 200 {
-		snippet = snippet[:200] + "..."
+	ctx, err := s.Process(input.Prompt, input.TranscriptPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: %v\n", err)
 	}
-	snippet = strings.TrimSpace(snippet)
-	if snippet == "" {
-		return
+	fmt.Fprint(os.Stdout, ctx)
+	return nil
+}
+
+// handleBatch backfills state from a JSON array of hook inputs on stdin. The
+// prompts go through one gate in order, so Markov transitions chain across
+// them, and state is saved once at the end. Transcript paths are ignored: a
+// transcript read now reflects the end of its session, not the moment each
+// past prompt was sent.
+func handleBatch(p paths, cfg focusgate.Config) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("read stdin: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
 	}
 
-	// Link to the most recent leaf in the last tree.
-	intentID := ""
-	if len(f.Trees) > 0 {
-		lastTree := f.Trees[len(f.Trees)-1]
-		leaves := lastTree.GetLeaves()
-		if len(leaves) > 0 {
-			intentID = leaves[len(leaves)-1].ID
-		}
+	var inputs []hookInput
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return fmt.Errorf("parse stdin: %w", err)
+	}
+	prompts := make([]string, len(inputs))
+	for i, in := range inputs {
+		prompts[i] = in.Prompt
+	}
+
+	s, err := focusgate.Open(p.Dir, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ctx, results, err := s.ProcessBatch(prompts)
+	if err != nil {
+		return err
 	}
 
-	g.Add(snippet, intentID, nil)
+	writeBatchResults(os.Stdout, "Batch", results)
+	fmt.Fprint(os.Stdout, ctx)
+	return nil
 }
 
-func toGateConfig(cfg config) gate.Config {
-	return gate.Config{
-		ExtendThreshold:   cfg.Similarity.Extend,
-		BranchThreshold:   cfg.Similarity.Branch,
-		BubbleUpTerms:     cfg.BubbleUpTerms,
-		MaxSourcesPerNode: cfg.MaxSourcesPerNode,
-		MemorySize:        cfg.MemorySize,
-		DecayRate:         cfg.DecayRate,
-		ContextLimit:      cfg.ContextLimit,
-		TransitionBoost:   cfg.TransitionBoost,
+// writeBatchResults prints a summary line headed by label and the action and
+// tree for each prompt.
+func writeBatchResults(w io.Writer, label string, results []focusgate.BatchResult) {
+	processed := 0
+	for _, r := range results {
+		if !r.Skipped {
+			processed++
+		}
+	}
+	fmt.Fprintf(w, "[Focus] %s: processed %d of %d prompts.\n", label, processed, len(results))
+	for i, r := range results {
+		prompt := r.Prompt
+		if len(prompt) > 50 {
+			prompt = prompt[:50] + "..."
+		}
+		if r.Skipped {
+			fmt.Fprintf(w, "  %3d. %-7s %-16s %q\n", i+1, "skipped", "", prompt)
+			continue
+		}
+		fmt.Fprintf(w, "  %3d. %-7s %-16s %q\n", i+1, r.Action, r.TreeID, prompt)
 	}
 }
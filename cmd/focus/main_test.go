@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+func TestResolvePathsWorkspaces(t *testing.T) {
+	shared := resolvePaths("")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(exe), "data"); shared.Dir != want {
+		t.Errorf("default dataDir = %s, want %s", shared.Dir, want)
+	}
+
+	a, b := resolvePaths("/home/me/project-a"), resolvePaths("/home/me/project-b")
+	if a.Dir == b.Dir || a.Dir == shared.Dir {
+		t.Fatalf("workspaces should get separate data dirs: %s, %s", a.Dir, b.Dir)
+	}
+	if filepath.Dir(a.Dir) != shared.Dir {
+		t.Errorf("workspace dir %s should be inside %s", a.Dir, shared.Dir)
+	}
+	if a.configFile != shared.configFile {
+		t.Error("config.json should be shared across workspaces")
+	}
+	if resolvePaths("/home/me/project-a/").Dir != a.Dir {
+		t.Error("equivalent workspace paths should share state")
+	}
+}
+
+func TestHookInputWorkspace(t *testing.T) {
+	in := hookInput{Cwd: "/work/a"}
+	if got := in.workspace(false); got != "" {
+		t.Errorf("cwd without workspaceFromCwd = %q, want shared data/", got)
+	}
+	if got := in.workspace(true); got != "/work/a" {
+		t.Errorf("cwd with workspaceFromCwd = %q", got)
+	}
+	in.Workspace = "/work/b"
+	for _, fromCwd := range []bool{false, true} {
+		if got := in.workspace(fromCwd); got != "/work/b" {
+			t.Errorf("workspace field (fromCwd %v) = %q", fromCwd, got)
+		}
+	}
+}
+
+func TestWorkspaceForestsIndependent(t *testing.T) {
+	cfg := focusgate.DefaultConfig()
+	root := t.TempDir()
+	a, b := pathsIn(root, "/work/a"), pathsIn(root, "/work/b")
+
+	fa := forest.NewForest()
+	fa.AddTree(forest.NewTree("add JWT authentication", "p1"))
+	if err := focusgate.SaveState(cfg, a.Intent, fa); err != nil {
+		t.Fatal(err)
+	}
+
+	fb := forest.NewForest()
+	focusgate.LoadState("intent", b.Intent, fb)
+	if len(fb.Trees) != 0 {
+		t.Errorf("workspace b sees %d trees from workspace a", len(fb.Trees))
+	}
+	reloaded := forest.NewForest()
+	focusgate.LoadState("intent", a.Intent, reloaded)
+	if len(reloaded.Trees) != 1 {
+		t.Errorf("workspace a has %d trees, want 1", len(reloaded.Trees))
+	}
+}
+
+func TestPromptMetricsFlag(t *testing.T) {
+	prompts := []string{"add JWT authentication to the API", "fix JWT token expiry", "fix the database migration"}
+	run := func(enabled bool) paths {
+		p := pathsIn(t.TempDir(), "")
+		cfg := focusgate.DefaultConfig()
+		cfg.Metrics = enabled
+		for _, prompt := range prompts {
+			if err := handlePrompt(p, cfg, hookInput{Prompt: prompt}); err != nil {
+				t.Fatalf("handlePrompt: %v", err)
+			}
+		}
+		return p
+	}
+
+	on := run(true)
+	m := gate.NewMetrics()
+	focusgate.LoadState("metrics", on.Metrics, m)
+	s := m.Stages[gate.StageClassify]
+	if s == nil || s.Count != len(prompts) || s.MeanMs <= 0 {
+		t.Errorf("classify timing = %+v, want %d nonzero samples", s, len(prompts))
+	}
+
+	if off := run(false); persist.Exists(off.Metrics) {
+		t.Error("metrics disabled: nothing should be recorded")
+	}
+}
+
+func TestPromptTagsOnlyPrintsStatus(t *testing.T) {
+	p := pathsIn(t.TempDir(), "")
+	cfg := focusgate.DefaultConfig()
+	if err := handlePrompt(p, cfg, hookInput{Prompt: "add JWT authentication to the API"}); err != nil {
+		t.Fatalf("handlePrompt: %v", err)
+	}
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = stdout
+	err = handlePrompt(p, cfg, hookInput{Prompt: "<ide_selection>func main() {}</ide_selection>"})
+	os.Stdout = orig
+	if err != nil {
+		t.Fatalf("handlePrompt(tags only): %v", err)
+	}
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "JWT") {
+		t.Errorf("tag-only prompt should print the Status block, got %q", out)
+	}
+}
+
+func TestTakeFlagValue(t *testing.T) {
+	v, rest := takeFlagValue([]string{"focus", "--workspace", "/w", "--status"}, "--workspace")
+	if v != "/w" || len(rest) != 2 || rest[1] != "--status" {
+		t.Errorf("got %q %v", v, rest)
+	}
+	if v, rest := takeFlagValue([]string{"focus", "--status"}, "--workspace"); v != "" || len(rest) != 2 {
+		t.Errorf("absent flag: got %q %v", v, rest)
+	}
+}
+
+func TestReadOnlyCommandsHitVecCache(t *testing.T) {
+	p := pathsIn(t.TempDir(), "")
+	cfg := focusgate.DefaultConfig()
+	for _, prompt := range []string{"add JWT authentication to the API", "fix JWT token expiry", "fix the database migration"} {
+		if err := handlePrompt(p, cfg, hookInput{Prompt: prompt}); err != nil {
+			t.Fatalf("handlePrompt: %v", err)
+		}
+	}
+	saved, err := os.ReadFile(p.VecCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each read-only run loads the cache the last prompt saved and
+	// vectorizes no stored node itself.
+	for run := 0; run < 2; run++ {
+		f, e, c := forest.NewForest(), tfidf.NewEngine(), markov.New()
+		focusgate.LoadState("intent", p.Intent, f)
+		focusgate.LoadState("engine", p.Engine, e)
+		focusgate.LoadState("markov", p.Markov, c)
+		gt := readGate(p, cfg, f, e, c)
+		gt.DryRun("refresh the JWT token")
+		gt.Search("database", nil, searchLimit)
+		if st := gt.VecCacheStats(); st.Misses != 0 || st.Entries != f.NodeCount() {
+			t.Errorf("run %d: cache stats %+v, want every node cached and no misses", run, st)
+		}
+	}
+
+	s, err := focusgate.Peek(p.Dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Status()
+	if after, _ := os.ReadFile(p.VecCache); string(after) != string(saved) {
+		t.Error("read-only commands should not rewrite the vector cache")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/persist"
+)
+
+// handleMetrics prints the prompt-stage timings accumulated while the
+// metrics flag is on.
+func handleMetrics(p paths, asJSON bool) error {
+	m := gate.NewMetrics()
+	if persist.Exists(p.Metrics) {
+		focusgate.LoadState("metrics", p.Metrics, m)
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal metrics: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	writeMetricsText(os.Stdout, m)
+	return nil
+}
+
+func writeMetricsText(w io.Writer, m *gate.Metrics) {
+	if len(m.Stages) == 0 {
+		fmt.Fprintln(w, `[Focus] No metrics recorded. Set "metrics": true in config.json to time prompts.`)
+		return
+	}
+	fmt.Fprintln(w, "[Focus] Prompt stage latency (ms)")
+	total := 0.0
+	for _, name := range m.StageNames() {
+		s := m.Stages[name]
+		fmt.Fprintf(w, "  %-10s count=%-6d mean=%-8.3f last=%-8.3f max=%.3f\n",
+			name, s.Count, s.MeanMs, s.LastMs, s.MaxMs)
+		total += s.MeanMs
+	}
+	fmt.Fprintf(w, "  %-10s mean=%.3f\n", "total", total)
+}
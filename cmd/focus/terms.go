@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// termStat is one corpus term in --terms --json output.
+type termStat struct {
+	Term string  `json:"term"`
+	DF   int     `json:"df"`
+	IDF  float64 `json:"idf"`
+}
+
+// handleTerms prints every term in the TF-IDF corpus with its document
+// frequency and IDF, most common first. Terms in fewer than minDF documents
+// are left out. High-DF, low-IDF terms carry little weight in matching and
+// are candidates for stopWords.
+func handleTerms(p paths, minDF int, asJSON bool) error {
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	terms := corpusTerms(e, minDF)
+	if asJSON {
+		return writeTermsJSON(os.Stdout, terms)
+	}
+	writeTermsText(os.Stdout, e, terms)
+	return nil
+}
+
+// corpusTerms returns the engine's terms with DF >= minDF, sorted by DF
+// descending, then by term.
+func corpusTerms(e *tfidf.Engine, minDF int) []termDF {
+	var kept []termDF
+	for _, t := range topTermsByDF(e, 0) {
+		if t.df >= minDF {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func writeTermsText(w io.Writer, e *tfidf.Engine, terms []termDF) {
+	fmt.Fprintf(w, "[Focus] %d of %d terms across %d docs\n", len(terms), len(e.DocFreq), e.TotalDocs)
+	for _, t := range terms {
+		fmt.Fprintf(w, "  %-20s df=%-4d idf=%.3f\n", t.term, t.df, t.idf)
+	}
+}
+
+func writeTermsJSON(w io.Writer, terms []termDF) error {
+	out := make([]termStat, len(terms))
+	for i, t := range terms {
+		out[i] = termStat{Term: t.term, DF: t.df, IDF: t.idf}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal terms: %w", err)
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+func TestCorpusTerms(t *testing.T) {
+	e := tfidf.NewEngine()
+	e.AddDocument([]string{"auth", "token"})
+	e.AddDocument([]string{"auth", "session"})
+	e.AddDocument([]string{"auth", "token", "migrat"})
+
+	var buf bytes.Buffer
+	writeTermsText(&buf, e, corpusTerms(e, 0))
+	out := buf.String()
+	common, rare := strings.Index(out, "auth "), strings.Index(out, "migrat ")
+	if common < 0 || rare < 0 || common > rare {
+		t.Errorf("high-DF term should be listed before a rare one:\n%s", out)
+	}
+
+	terms := corpusTerms(e, 2)
+	var got []string
+	for _, term := range terms {
+		got = append(got, term.term)
+	}
+	if strings.Join(got, ",") != "auth,token" {
+		t.Errorf("--min-df 2 terms = %v, want [auth token]", got)
+	}
+	if terms[0].idf >= terms[1].idf {
+		t.Errorf("auth idf %.3f should be below token idf %.3f", terms[0].idf, terms[1].idf)
+	}
+}
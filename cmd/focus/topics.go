@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// topicRootWidth is how much of a root's content --topics shows.
+const topicRootWidth = 50
+
+// handleTopics prints one line per tree, ranked as the context block ranks
+// them: the everyday view of what is being tracked.
+func handleTopics(p paths, cfg focusgate.Config, asJSON bool) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	gt := gate.NewWithChain(f, tfidf.NewEngine(), c, cfg.GateConfig())
+	now := time.Now().UnixMilli()
+	topics := gt.Topics(now)
+	if asJSON {
+		data, err := json.MarshalIndent(topics, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal topics: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	}
+	writeTopicsText(os.Stdout, topics, now, cfg.NormalizeScores)
+	return nil
+}
+
+// digestTerms is how many terms --digest lists when no count is given.
+const digestTerms = 8
+
+// handleDigest prints a one-line summary of current focus, for pasting into a
+// new session.
+func handleDigest(p paths, cfg focusgate.Config, maxTerms int) error {
+	f := forest.NewForest()
+	focusgate.LoadState("intent", p.Intent, f)
+
+	e := tfidf.NewEngine()
+	focusgate.LoadState("engine", p.Engine, e)
+
+	c := markov.New()
+	focusgate.LoadState("markov", p.Markov, c)
+
+	gt := gate.NewWithChain(f, e, c, cfg.GateConfig())
+	digest := gt.Digest(maxTerms)
+	if digest == "" {
+		fmt.Fprintln(os.Stdout, "[Focus] No topics yet.")
+		return nil
+	}
+	fmt.Fprintln(os.Stdout, digest)
+	return nil
+}
+
+// writeTopicsText lists topics one per line, labelled with their raw score
+// or, with intensity set, their 0–100 focus intensity.
+func writeTopicsText(w io.Writer, topics []gate.Topic, now int64, intensity bool) {
+	if len(topics) == 0 {
+		fmt.Fprintln(w, "[Focus] No topics yet.")
+		return
+	}
+	fmt.Fprintf(w, "[Focus] %d topics\n", len(topics))
+	for _, t := range topics {
+		id := t.TreeID
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		root := t.Root
+		if len(root) > topicRootWidth {
+			root = root[:topicRootWidth] + "..."
+		}
+		pin := ""
+		if t.Pinned {
+			pin = "  [pinned]"
+		}
+		score := fmt.Sprintf("score=%.3f", t.Score)
+		if intensity {
+			score = fmt.Sprintf("intensity=%3.0f", t.Intensity)
+		}
+		fmt.Fprintf(w, "  #%-2d %s  %-*q  %3d nodes  %s  %s%s\n",
+			t.Index, id, topicRootWidth+5, root, t.Nodes, score, relativeTime(now, t.LastAccessed), pin)
+	}
+}
+
+// relativeTime describes how long before now a millisecond timestamp was, in
+// the largest whole unit: "just now", "5m ago", "3h ago", "2d ago".
+func relativeTime(now, then int64) string {
+	d := time.Duration(now-then) * time.Millisecond
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
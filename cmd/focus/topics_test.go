@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+func TestTopicsScoreDescending(t *testing.T) {
+	cfg := gate.DefaultConfig()
+	cfg.TransitionBoost = 0
+	g := gate.New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	g.ProcessPrompt("fix the database migration schema error", "p3")
+	g.ProcessPrompt("style the frontend react component", "p4")
+
+	// Age the frontend tree so it ranks last despite being newest.
+	stale := g.Forest.Trees[len(g.Forest.Trees)-1]
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour).UnixMilli()
+	for _, n := range stale.Nodes {
+		n.LastAccessed = weekAgo
+	}
+	stale.LastAccessed = weekAgo
+	stale.Pinned = true
+
+	now := time.Now().UnixMilli()
+	topics := g.Topics(now)
+	if len(topics) != len(g.Forest.Trees) {
+		t.Fatalf("got %d topics for %d trees", len(topics), len(g.Forest.Trees))
+	}
+	for i := 1; i < len(topics); i++ {
+		if topics[i].Score > topics[i-1].Score {
+			t.Errorf("topics not score-descending at %d: %f > %f", i, topics[i].Score, topics[i-1].Score)
+		}
+	}
+	for _, tp := range topics {
+		if want := g.Forest.Trees[tp.Index].NodeCount(); tp.Nodes != want {
+			t.Errorf("tree #%d: nodes = %d, want %d", tp.Index, tp.Nodes, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeTopicsText(&buf, topics, now, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(topics)+1 {
+		t.Fatalf("expected a header and %d lines:\n%s", len(topics), buf.String())
+	}
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, stale.ID[:8]) || !strings.Contains(last, "7d ago") || !strings.Contains(last, "[pinned]") {
+		t.Errorf("stale pinned tree should be listed last as 7d ago:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	writeTopicsText(&buf, topics, now, true)
+	if first := strings.Split(buf.String(), "\n")[1]; !strings.Contains(first, "intensity=100") {
+		t.Errorf("top topic should show intensity 100:\n%s", buf.String())
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Now().UnixMilli()
+	for _, tc := range []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{30 * time.Second, "just now"},
+		{5 * time.Minute, "5m ago"},
+		{3*time.Hour + 20*time.Minute, "3h ago"},
+		{50 * time.Hour, "2d ago"},
+	} {
+		if got := relativeTime(now, now-tc.ago.Milliseconds()); got != tc.want {
+			t.Errorf("relativeTime(-%v) = %q, want %q", tc.ago, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+)
+
+// defaultWatchInterval is how often --status --watch checks the state files
+// when --interval is not given.
+const defaultWatchInterval = time.Second
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// handleStatusWatch re-renders --status whenever the state files change,
+// until interrupted.
+func handleStatusWatch(p paths, cfg focusgate.Config, asJSON bool, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watchStatus(ctx, os.Stdout, p, cfg, asJSON, interval)
+}
+
+// watchStatus polls the state files every interval and writes the status to
+// w each time they change, clearing the screen first for text output; JSON
+// output is one document per change. State is read with focusgate.Peek, so
+// nothing is written. A render is skipped, and retried on the next poll,
+// while another process holds the lock, if a file fails to load, or if the
+// files changed while they were being read.
+func watchStatus(ctx context.Context, w io.Writer, p paths, cfg focusgate.Config, asJSON bool, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	shown := ""
+	for {
+		if stamp := stateStamp(p.Files); stamp != shown {
+			if out, err := peekStatus(p, cfg, asJSON); err == nil && stateStamp(p.Files) == stamp {
+				if !asJSON {
+					fmt.Fprint(w, clearScreen)
+				}
+				fmt.Fprint(w, out)
+				shown = stamp
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// peekStatus renders the status block, or its JSON, from a read-only
+// session.
+func peekStatus(p paths, cfg focusgate.Config, asJSON bool) (string, error) {
+	s, err := focusgate.Peek(p.Dir, cfg)
+	if err != nil {
+		return "", err
+	}
+	if !asJSON {
+		return s.StatusDisplay(), nil
+	}
+	data, err := s.StatusJSON()
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// stateStamp summarizes the size and modification time of every state file
+// in either storage format, so any save changes it.
+func stateStamp(f focusgate.Files) string {
+	var b strings.Builder
+	for _, path := range f.StateFiles() {
+		for _, name := range []string{path, focusgate.Alternate(path)} {
+			if info, err := os.Stat(name); err == nil {
+				fmt.Fprintf(&b, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	focusgate "github.com/kuandriy/focus-gate"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the watch goroutine while
+// the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchStatusRerendersOnChange(t *testing.T) {
+	p := pathsIn(t.TempDir(), "")
+	cfg := focusgate.DefaultConfig()
+	if err := handlePrompt(p, cfg, hookInput{Prompt: "add JWT authentication to the API"}); err != nil {
+		t.Fatalf("handlePrompt: %v", err)
+	}
+	type fileState struct {
+		data []byte
+		mod  time.Time
+	}
+	snapshot := func() map[string]fileState {
+		m := map[string]fileState{}
+		for _, path := range p.StateFiles() {
+			if info, err := os.Stat(path); err == nil {
+				data, _ := os.ReadFile(path)
+				m[path] = fileState{data, info.ModTime()}
+			}
+		}
+		return m
+	}
+	before := snapshot()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	done := make(chan error)
+	go func() { done <- watchStatus(ctx, &out, p, cfg, false, 5*time.Millisecond) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchStatus: %v", err)
+		}
+	}()
+
+	renders := func() int { return strings.Count(out.String(), clearScreen) }
+	waitFor := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for renders() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d renders, want %d:\n%s", renders(), n, out.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor(1)
+	time.Sleep(50 * time.Millisecond)
+	if n := renders(); n != 1 {
+		t.Errorf("%d renders without a state change, want 1", n)
+	}
+	after := snapshot()
+	for path, st := range before {
+		if got := after[path]; !bytes.Equal(got.data, st.data) || !got.mod.Equal(st.mod) {
+			t.Errorf("%s modified while watching", path)
+		}
+	}
+	if len(after) != len(before) {
+		t.Errorf("watching created state files: %d before, %d after", len(before), len(after))
+	}
+
+	if err := handlePrompt(p, cfg, hookInput{Prompt: "fix the database migration schema"}); err != nil {
+		t.Fatalf("handlePrompt: %v", err)
+	}
+	waitFor(2)
+	if last := out.String()[strings.LastIndex(out.String(), clearScreen):]; !strings.Contains(last, "database") {
+		t.Errorf("re-render does not show the new prompt:\n%s", last)
+	}
+}
@@ -0,0 +1,475 @@
+package focusgate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/guide"
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/text"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// Config is the focus-gate configuration, matching the JSON config file. It
+// holds the gate's tuning plus the settings for state storage, the guide and
+// transcripts that sit around it.
+type Config struct {
+	MemorySize   int     `json:"memorySize"`
+	DecayRate    float64 `json:"decayRate"`
+	DepthPenalty float64 `json:"depthPenalty"`
+	Similarity   struct {
+		Extend float64 `json:"extend"`
+		Branch float64 `json:"branch"`
+	} `json:"similarity"`
+	ContextLimit         int                 `json:"contextLimit"`
+	BubbleUpTerms        int                 `json:"bubbleUpTerms"`
+	MaxSourcesPerNode    int                 `json:"maxSourcesPerNode"`
+	GuideSize            int                 `json:"guideSize"`
+	TransitionBoost      float64             `json:"transitionBoost"`
+	PredictThreshold     float64             `json:"predictThreshold"`
+	PredictCount         int                 `json:"predictCount"`
+	StopWords            []string            `json:"stopWords"`
+	StopWordsReplace     bool                `json:"stopWordsReplace"`
+	TermBlacklist        []string            `json:"termBlacklist"`
+	SplitIdentifiers     bool                `json:"splitIdentifiers"`
+	Bigrams              bool                `json:"bigrams"`
+	AggressiveStemming   bool                `json:"aggressiveStemming"`
+	StripCode            bool                `json:"stripCode"`
+	TagPatterns          []string            `json:"tagPatterns"`
+	TFScaling            string              `json:"tfScaling"`
+	TermBoosts           map[string]float64  `json:"termBoosts"`
+	MaxVectorTerms       int                 `json:"maxVectorTerms"`
+	MarkovOrder          int                 `json:"markovOrder"`
+	MarkovDecay          float64             `json:"markovDecay"`
+	MarkovSmoothing      float64             `json:"markovSmoothing"`
+	MergeDelta           float64             `json:"mergeDelta"`
+	MaxDepth             int                 `json:"maxDepth"`
+	CompactThreshold     float64             `json:"compactThreshold"`
+	JaccardFallback      float64             `json:"jaccardFallback"`
+	PruneStrategy        string              `json:"pruneStrategy"`
+	IndexAbstractions    bool                `json:"indexAbstractions"`
+	ReinforceThreshold   float64             `json:"reinforceThreshold"`
+	Compress             bool                `json:"compress"`
+	BackupCount          int                 `json:"backupCount"`
+	TranscriptFormat     string              `json:"transcriptFormat"`
+	GuideSummaryLen      int                 `json:"guideSummaryLen"`
+	GuideMaxAgeHours     float64             `json:"guideMaxAgeHours"`
+	GuideTopicOnly       bool                `json:"guideTopicOnly"`
+	GuideRenderLimit     int                 `json:"guideRenderLimit"`
+	ReconcileOnLoad      bool                `json:"reconcileOnLoad"`
+	Metrics              bool                `json:"metrics"`
+	DropPureNumbers      bool                `json:"dropPureNumbers"`
+	Synonyms             map[string][]string `json:"synonyms"`
+	ArchivePruned        bool                `json:"archivePruned"`
+	SimilarityMetric     string              `json:"similarityMetric"`
+	MarkovEnabled        bool                `json:"markovEnabled"`
+	BubbleUpTermsByDepth []int               `json:"bubbleUpTermsByDepth"`
+	AbstractionSeparator string              `json:"abstractionSeparator"`
+	AbstractionIDF       bool                `json:"abstractionIDF"`
+	BoostMode            string              `json:"boostMode"`
+	MarkovHistorySize    int                 `json:"markovHistorySize"`
+	AuditLog             bool                `json:"auditLog"`
+	AuditPromptText      bool                `json:"auditPromptText"`
+	MinTokenLen          int                 `json:"minTokenLen"`
+	Stemmer              string              `json:"stemmer"`
+	MaxChildren          int                 `json:"maxChildren"`
+	ContextTemplate      string              `json:"contextTemplate"`
+	WeightCurve          string              `json:"weightCurve"`
+
+	RecencyWeightedAbstraction bool `json:"recencyWeightedAbstraction"`
+	PredictPathDepth           int  `json:"predictPathDepth"`
+	NormalizeScores            bool `json:"normalizeScores"`
+	WorkspaceFromCwd           bool `json:"workspaceFromCwd"`
+}
+
+// DefaultConfig returns the configuration used for every field a config
+// file leaves out.
+func DefaultConfig() Config {
+	c := Config{
+		MemorySize:           100,
+		DecayRate:            0.05,
+		DepthPenalty:         forest.DefaultDepthPenalty,
+		ContextLimit:         600,
+		BubbleUpTerms:        6,
+		MaxSourcesPerNode:    20,
+		GuideSize:            15,
+		GuideSummaryLen:      guide.DefaultSummaryLen,
+		TransitionBoost:      0.2,
+		PredictThreshold:     0.3,
+		PredictCount:         3,
+		MarkovOrder:          1,
+		MergeDelta:           0.05,
+		CompactThreshold:     0.8,
+		PruneStrategy:        gate.PruneLeaf,
+		MarkovEnabled:        true,
+		AbstractionSeparator: gate.DefaultAbstractionSeparator,
+		BoostMode:            gate.BoostMultiplicative,
+		MinTokenLen:          text.DefaultMinTokenLen,
+		Stemmer:              text.StemmerLight,
+		WeightCurve:          forest.WeightLog2,
+	}
+	c.Similarity.Extend = 0.55
+	c.Similarity.Branch = 0.25
+	return c
+}
+
+// LoadConfig uses a two-phase JSON approach to distinguish "user set field to 0"
+// from "field absent" (should use default). Phase 1 loads a raw map to detect
+// which keys are present. Phase 2 loads the full struct. Only explicitly present
+// keys override defaults, so users can intentionally set transitionBoost=0 or
+// decayRate=0 without the value being silently replaced.
+//
+// It also returns the keys the file set, with the nested similarity keys as
+// "similarity.extend" and "similarity.branch", so --config can tell values
+// taken from the file apart from defaults. The set is empty whenever the
+// defaults are returned because the file is missing or unreadable.
+func LoadConfig(path string) (Config, map[string]bool) {
+	cfg := DefaultConfig()
+	userKeys := make(map[string]bool)
+
+	// Phase 1: Detect which keys the user explicitly set.
+	raw := make(map[string]json.RawMessage)
+	// The config is hand-written, so it never carries a checksum.
+	if err := persist.Load(path, &raw); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+		fmt.Fprintf(os.Stderr, "focus-gate: load config: %v\n", err)
+		return cfg, userKeys
+	}
+	if len(raw) == 0 {
+		return cfg, userKeys
+	}
+
+	// Phase 2: Parse into full struct.
+	var userCfg Config
+	if err := persist.Load(path, &userCfg); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+		fmt.Fprintf(os.Stderr, "focus-gate: parse config: %v\n", err)
+		return cfg, userKeys
+	}
+
+	// Phase 3: Apply only the keys the user explicitly wrote.
+	if _, ok := raw["memorySize"]; ok {
+		cfg.MemorySize = userCfg.MemorySize
+	}
+	if _, ok := raw["decayRate"]; ok {
+		cfg.DecayRate = userCfg.DecayRate
+	}
+	if _, ok := raw["depthPenalty"]; ok {
+		cfg.DepthPenalty = userCfg.DepthPenalty
+	}
+	if _, ok := raw["contextLimit"]; ok {
+		cfg.ContextLimit = userCfg.ContextLimit
+	}
+	if _, ok := raw["bubbleUpTerms"]; ok {
+		cfg.BubbleUpTerms = userCfg.BubbleUpTerms
+	}
+	if _, ok := raw["maxSourcesPerNode"]; ok {
+		cfg.MaxSourcesPerNode = userCfg.MaxSourcesPerNode
+	}
+	if _, ok := raw["guideSize"]; ok {
+		cfg.GuideSize = userCfg.GuideSize
+	}
+	if _, ok := raw["transitionBoost"]; ok {
+		cfg.TransitionBoost = userCfg.TransitionBoost
+	}
+	// stopWords keeps nil (absent) distinct from an explicit empty array, which
+	// combined with stopWordsReplace disables stop-word filtering entirely.
+	if _, ok := raw["stopWords"]; ok {
+		cfg.StopWords = userCfg.StopWords
+		if cfg.StopWords == nil {
+			cfg.StopWords = []string{}
+		}
+	}
+	if _, ok := raw["stopWordsReplace"]; ok {
+		cfg.StopWordsReplace = userCfg.StopWordsReplace
+	}
+	if _, ok := raw["termBlacklist"]; ok {
+		cfg.TermBlacklist = userCfg.TermBlacklist
+	}
+	if _, ok := raw["splitIdentifiers"]; ok {
+		cfg.SplitIdentifiers = userCfg.SplitIdentifiers
+	}
+	if _, ok := raw["bigrams"]; ok {
+		cfg.Bigrams = userCfg.Bigrams
+	}
+	if _, ok := raw["aggressiveStemming"]; ok {
+		cfg.AggressiveStemming = userCfg.AggressiveStemming
+	}
+	if _, ok := raw["stripCode"]; ok {
+		cfg.StripCode = userCfg.StripCode
+	}
+	if _, ok := raw["tagPatterns"]; ok {
+		cfg.TagPatterns = userCfg.TagPatterns
+	}
+	if _, ok := raw["tfScaling"]; ok {
+		cfg.TFScaling = userCfg.TFScaling
+	}
+	if _, ok := raw["markovOrder"]; ok {
+		cfg.MarkovOrder = userCfg.MarkovOrder
+	}
+	if _, ok := raw["markovDecay"]; ok {
+		cfg.MarkovDecay = userCfg.MarkovDecay
+	}
+	if _, ok := raw["markovSmoothing"]; ok {
+		cfg.MarkovSmoothing = userCfg.MarkovSmoothing
+	}
+	if _, ok := raw["mergeDelta"]; ok {
+		cfg.MergeDelta = userCfg.MergeDelta
+	}
+	if _, ok := raw["maxDepth"]; ok {
+		cfg.MaxDepth = userCfg.MaxDepth
+	}
+	if _, ok := raw["compactThreshold"]; ok {
+		cfg.CompactThreshold = userCfg.CompactThreshold
+	}
+	if _, ok := raw["jaccardFallback"]; ok {
+		cfg.JaccardFallback = userCfg.JaccardFallback
+	}
+	if _, ok := raw["pruneStrategy"]; ok {
+		cfg.PruneStrategy = userCfg.PruneStrategy
+	}
+	if _, ok := raw["maxVectorTerms"]; ok {
+		cfg.MaxVectorTerms = userCfg.MaxVectorTerms
+	}
+	if _, ok := raw["termBoosts"]; ok {
+		cfg.TermBoosts = userCfg.TermBoosts
+	}
+	if _, ok := raw["predictThreshold"]; ok {
+		cfg.PredictThreshold = userCfg.PredictThreshold
+	}
+	if _, ok := raw["predictCount"]; ok {
+		cfg.PredictCount = userCfg.PredictCount
+	}
+	if _, ok := raw["indexAbstractions"]; ok {
+		cfg.IndexAbstractions = userCfg.IndexAbstractions
+	}
+	if _, ok := raw["reinforceThreshold"]; ok {
+		cfg.ReinforceThreshold = userCfg.ReinforceThreshold
+	}
+	if _, ok := raw["compress"]; ok {
+		cfg.Compress = userCfg.Compress
+	}
+	if _, ok := raw["backupCount"]; ok {
+		cfg.BackupCount = userCfg.BackupCount
+	}
+	if _, ok := raw["transcriptFormat"]; ok {
+		cfg.TranscriptFormat = userCfg.TranscriptFormat
+	}
+	if _, ok := raw["guideSummaryLen"]; ok {
+		cfg.GuideSummaryLen = userCfg.GuideSummaryLen
+	}
+	if _, ok := raw["guideMaxAgeHours"]; ok {
+		cfg.GuideMaxAgeHours = userCfg.GuideMaxAgeHours
+	}
+	if _, ok := raw["guideTopicOnly"]; ok {
+		cfg.GuideTopicOnly = userCfg.GuideTopicOnly
+	}
+	if _, ok := raw["guideRenderLimit"]; ok {
+		cfg.GuideRenderLimit = userCfg.GuideRenderLimit
+	}
+	if _, ok := raw["reconcileOnLoad"]; ok {
+		cfg.ReconcileOnLoad = userCfg.ReconcileOnLoad
+	}
+	if _, ok := raw["metrics"]; ok {
+		cfg.Metrics = userCfg.Metrics
+	}
+	if _, ok := raw["dropPureNumbers"]; ok {
+		cfg.DropPureNumbers = userCfg.DropPureNumbers
+	}
+	if _, ok := raw["synonyms"]; ok {
+		cfg.Synonyms = userCfg.Synonyms
+	}
+	if _, ok := raw["archivePruned"]; ok {
+		cfg.ArchivePruned = userCfg.ArchivePruned
+	}
+	if _, ok := raw["similarityMetric"]; ok {
+		cfg.SimilarityMetric = userCfg.SimilarityMetric
+	}
+	if _, ok := raw["markovEnabled"]; ok {
+		cfg.MarkovEnabled = userCfg.MarkovEnabled
+	}
+	if _, ok := raw["bubbleUpTermsByDepth"]; ok {
+		cfg.BubbleUpTermsByDepth = userCfg.BubbleUpTermsByDepth
+	}
+	if _, ok := raw["abstractionSeparator"]; ok {
+		cfg.AbstractionSeparator = userCfg.AbstractionSeparator
+	}
+	if _, ok := raw["abstractionIDF"]; ok {
+		cfg.AbstractionIDF = userCfg.AbstractionIDF
+	}
+	if _, ok := raw["boostMode"]; ok {
+		cfg.BoostMode = userCfg.BoostMode
+	}
+	if _, ok := raw["markovHistorySize"]; ok {
+		cfg.MarkovHistorySize = userCfg.MarkovHistorySize
+	}
+	if _, ok := raw["auditLog"]; ok {
+		cfg.AuditLog = userCfg.AuditLog
+	}
+	if _, ok := raw["auditPromptText"]; ok {
+		cfg.AuditPromptText = userCfg.AuditPromptText
+	}
+	if _, ok := raw["minTokenLen"]; ok {
+		cfg.MinTokenLen = userCfg.MinTokenLen
+	}
+	if _, ok := raw["stemmer"]; ok {
+		cfg.Stemmer = userCfg.Stemmer
+	}
+	if _, ok := raw["maxChildren"]; ok {
+		cfg.MaxChildren = userCfg.MaxChildren
+	}
+	if _, ok := raw["contextTemplate"]; ok {
+		cfg.ContextTemplate = userCfg.ContextTemplate
+	}
+	if _, ok := raw["weightCurve"]; ok {
+		cfg.WeightCurve = userCfg.WeightCurve
+	}
+	if _, ok := raw["recencyWeightedAbstraction"]; ok {
+		cfg.RecencyWeightedAbstraction = userCfg.RecencyWeightedAbstraction
+	}
+	if _, ok := raw["predictPathDepth"]; ok {
+		cfg.PredictPathDepth = userCfg.PredictPathDepth
+	}
+	if _, ok := raw["normalizeScores"]; ok {
+		cfg.NormalizeScores = userCfg.NormalizeScores
+	}
+	if _, ok := raw["workspaceFromCwd"]; ok {
+		cfg.WorkspaceFromCwd = userCfg.WorkspaceFromCwd
+	}
+	// Handle nested "similarity" object.
+	if simRaw, ok := raw["similarity"]; ok {
+		var simMap map[string]json.RawMessage
+		if json.Unmarshal(simRaw, &simMap) == nil {
+			if _, ok := simMap["extend"]; ok {
+				cfg.Similarity.Extend = userCfg.Similarity.Extend
+			}
+			if _, ok := simMap["branch"]; ok {
+				cfg.Similarity.Branch = userCfg.Similarity.Branch
+			}
+			for k := range simMap {
+				userKeys["similarity."+k] = true
+			}
+		}
+	}
+	for k := range raw {
+		if k != "similarity" {
+			userKeys[k] = true
+		}
+	}
+
+	for _, problem := range cfg.Problems() {
+		fmt.Fprintf(os.Stderr, "focus-gate: config: %s\n", problem)
+	}
+	return cfg, userKeys
+}
+
+// Problems describes settings that cannot work as intended, such as a
+// branch threshold that leaves ActionBranch unreachable. LoadConfig logs
+// them without rejecting the config, so a bad value never blocks a prompt.
+func (cfg Config) Problems() []string {
+	var problems []string
+	if cfg.Similarity.Branch >= cfg.Similarity.Extend {
+		problems = append(problems, fmt.Sprintf(
+			"similarity.branch (%g) >= similarity.extend (%g): branch is unreachable, since extend is checked first",
+			cfg.Similarity.Branch, cfg.Similarity.Extend))
+	}
+	if cfg.DecayRate < 0 {
+		problems = append(problems, fmt.Sprintf("decayRate (%g) is negative: old nodes would outscore new ones", cfg.DecayRate))
+	}
+	if cfg.MemorySize < 1 {
+		problems = append(problems, fmt.Sprintf("memorySize (%d) is below 1: every prompt would be pruned", cfg.MemorySize))
+	}
+	if cfg.GuideSize < 0 {
+		problems = append(problems, fmt.Sprintf("guideSize (%d) is negative", cfg.GuideSize))
+	}
+	if cfg.TransitionBoost < 0 {
+		problems = append(problems, fmt.Sprintf("transitionBoost (%g) is negative: predicted topics would be penalized", cfg.TransitionBoost))
+	}
+	if cfg.MaxChildren == 1 {
+		problems = append(problems, "maxChildren (1) is below 2: it is ignored and nodes grow without limit")
+	}
+	switch cfg.WeightCurve {
+	case "", forest.WeightLog2, forest.WeightLinear, forest.WeightSqrt:
+	default:
+		problems = append(problems, fmt.Sprintf("weightCurve %q is unknown: log2 is used", cfg.WeightCurve))
+	}
+	if _, err := gate.ParseContextTemplate(cfg.ContextTemplate); err != nil {
+		problems = append(problems, fmt.Sprintf("contextTemplate does not parse (%v): the built-in format is used", err))
+	}
+	return problems
+}
+
+// GateConfig maps the configuration to the gate's settings.
+func (cfg Config) GateConfig() gate.Config {
+	return gate.Config{
+		ExtendThreshold:      cfg.Similarity.Extend,
+		BranchThreshold:      cfg.Similarity.Branch,
+		BubbleUpTerms:        cfg.BubbleUpTerms,
+		MaxSourcesPerNode:    cfg.MaxSourcesPerNode,
+		MemorySize:           cfg.MemorySize,
+		DecayRate:            cfg.DecayRate,
+		DepthPenalty:         cfg.DepthPenalty,
+		ContextLimit:         cfg.ContextLimit,
+		TransitionBoost:      cfg.TransitionBoost,
+		PredictThreshold:     cfg.PredictThreshold,
+		PredictCount:         cfg.PredictCount,
+		MarkovOrder:          cfg.MarkovOrder,
+		MarkovDecay:          cfg.MarkovDecay,
+		MarkovSmoothing:      cfg.MarkovSmoothing,
+		MarkovEnabled:        cfg.MarkovEnabled,
+		MarkovHistorySize:    cfg.MarkovHistorySize,
+		BubbleUpTermsByDepth: cfg.BubbleUpTermsByDepth,
+		AbstractionSeparator: cfg.AbstractionSeparator,
+		AbstractionIDF:       cfg.AbstractionIDF,
+		BoostMode:            cfg.BoostMode,
+		MergeDelta:           cfg.MergeDelta,
+		MaxDepth:             cfg.MaxDepth,
+		MaxChildren:          cfg.MaxChildren,
+		ContextTemplate:      cfg.ContextTemplate,
+		WeightCurve:          cfg.WeightCurve,
+		CompactThreshold:     cfg.CompactThreshold,
+		JaccardFallback:      cfg.JaccardFallback,
+		SimilarityMetric:     cfg.SimilarityMetric,
+		PruneStrategy:        cfg.PruneStrategy,
+		ArchivePruned:        cfg.ArchivePruned,
+		AuditLog:             cfg.AuditLog,
+		IndexAbstractions:    cfg.IndexAbstractions,
+		ReinforceThreshold:   cfg.ReinforceThreshold,
+		TermBoosts:           cfg.TermBoosts,
+		Tokenizer:            cfg.TokenizerOptions(),
+		Vector: tfidf.Options{
+			Scaling:  cfg.TFScaling,
+			MaxTerms: cfg.MaxVectorTerms,
+		},
+		RecencyWeightedAbstraction: cfg.RecencyWeightedAbstraction,
+		PredictPathDepth:           cfg.PredictPathDepth,
+		NormalizeScores:            cfg.NormalizeScores,
+	}
+}
+
+// ScoreParams maps the configuration to node scoring parameters.
+func (cfg Config) ScoreParams() forest.ScoreParams {
+	return cfg.GateConfig().ScoreParams()
+}
+
+// TokenizerOptions maps the configuration to the tokenizer's options.
+func (cfg Config) TokenizerOptions() text.Options {
+	return text.Options{
+		StopWords:          cfg.StopWords,
+		ReplaceStopWords:   cfg.StopWordsReplace,
+		TermBlacklist:      cfg.TermBlacklist,
+		SplitIdentifiers:   cfg.SplitIdentifiers,
+		Bigrams:            cfg.Bigrams,
+		AggressiveStemming: cfg.AggressiveStemming,
+		StripCode:          cfg.StripCode,
+		TagPatterns:        cfg.TagPatterns,
+		DropPureNumbers:    cfg.DropPureNumbers,
+		Synonyms:           cfg.Synonyms,
+		// Values below 1 are clamped so a configured 0 keeps every token
+		// rather than falling back to the tokenizer's default.
+		MinTokenLen: max(cfg.MinTokenLen, 1),
+		Stemmer:     cfg.Stemmer,
+	}
+}
@@ -0,0 +1,146 @@
+package focusgate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kuandriy/focus-gate/internal/persist"
+)
+
+// Files locates the state files in one data directory.
+type Files struct {
+	Dir      string
+	Intent   string
+	Engine   string
+	Guide    string
+	Markov   string
+	VecCache string
+	Journal  string
+	Metrics  string
+	Archive  string
+	Lock     string
+
+	// Decisions is the audit log of classified prompts.
+	Decisions string
+}
+
+// FilesIn lays out the state files in dataDir, in plain JSON storage.
+func FilesIn(dataDir string) Files {
+	return Files{
+		Dir:       dataDir,
+		Intent:    filepath.Join(dataDir, "intent.json"),
+		Engine:    filepath.Join(dataDir, "engine.json"),
+		Guide:     filepath.Join(dataDir, "guide.json"),
+		Markov:    filepath.Join(dataDir, "markov.json"),
+		VecCache:  filepath.Join(dataDir, "veccache.json"),
+		Journal:   filepath.Join(dataDir, "journal.json"),
+		Metrics:   filepath.Join(dataDir, "metrics.json"),
+		Archive:   filepath.Join(dataDir, "archive.jsonl"),
+		Decisions: filepath.Join(dataDir, "decisions.jsonl"),
+		Lock:      filepath.Join(dataDir, ".lock"),
+	}
+}
+
+// StateFiles lists every persisted state file.
+func (f Files) StateFiles() []string {
+	return []string{f.Intent, f.Engine, f.Guide, f.Markov, f.VecCache, f.Journal, f.Metrics}
+}
+
+// BackedUpFiles lists the state files that keep rotated backups. The vector
+// cache and undo journal are derived from them and, like metrics, are not
+// backed up.
+func (f Files) BackedUpFiles() []string {
+	return []string{f.Intent, f.Engine, f.Guide, f.Markov}
+}
+
+// Compressed returns the files with gzip storage selected for state files.
+func (f Files) Compressed() Files {
+	f.Intent += persist.GzipExt
+	f.Engine += persist.GzipExt
+	f.Guide += persist.GzipExt
+	f.Markov += persist.GzipExt
+	f.VecCache += persist.GzipExt
+	f.Journal += persist.GzipExt
+	f.Metrics += persist.GzipExt
+	return f
+}
+
+// Prepare selects the storage format cfg asks for, recovers .tmp files left
+// by interrupted saves in both formats, then adopts files saved in the other
+// format. It returns the files to load and save from then on, and should run
+// under the state lock before any state is loaded.
+func (f Files) Prepare(cfg Config) Files {
+	if cfg.Compress {
+		f = f.Compressed()
+	}
+	for _, path := range f.StateFiles() {
+		persist.RecoverTmpFiles(path, Alternate(path))
+	}
+	f.migrate()
+	return f
+}
+
+// Alternate returns a state file's name in the other storage format.
+func Alternate(path string) string {
+	if strings.HasSuffix(path, persist.GzipExt) {
+		return strings.TrimSuffix(path, persist.GzipExt)
+	}
+	return path + persist.GzipExt
+}
+
+// migrate renames state files saved in the other storage format to the
+// current one after "compress" is toggled. persist.Load detects gzip by
+// content, so the renamed file loads as-is and is rewritten in the new format
+// on the next save.
+func (f Files) migrate() {
+	for _, path := range f.StateFiles() {
+		other := Alternate(path)
+		if persist.Exists(path) || !persist.Exists(other) {
+			continue
+		}
+		if err := os.Rename(other, path); err != nil {
+			fmt.Fprintf(os.Stderr, "focus-gate: migrate %s: %v\n", other, err)
+		}
+	}
+}
+
+// SaveState writes v to path atomically, keeping cfg.BackupCount rotated
+// backups of the previous contents.
+func SaveState(cfg Config, path string, v any) error {
+	return persist.SaveAtomicWithBackup(path, v, cfg.BackupCount)
+}
+
+// LogLoadErr logs non-nil persist.Load errors to stderr. Errors are logged
+// rather than returned because a corrupt file should not block the user's
+// prompt — the system continues with empty/default state and the user can
+// --reset if needed.
+func LogLoadErr(name string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: load %s: %v\n", name, err)
+	}
+}
+
+// LoadState loads a state file into v, logging problems via LogLoadErr. A
+// file that fails its checksum is moved aside to <file>.corrupt before the
+// next save can overwrite it, so the data can still be inspected or recovered.
+// A file without a checksum (saved by an older version) loads with a warning;
+// the checksum is added on the next save.
+func LoadState(name, path string, v any) {
+	err := persist.Load(path, v)
+	switch {
+	case errors.Is(err, persist.ErrNoChecksum):
+		fmt.Fprintf(os.Stderr, "focus-gate: load %s: no checksum, will be added on next save\n", name)
+	case errors.Is(err, persist.ErrCorrupt):
+		LogLoadErr(name, err)
+		if bak, berr := persist.BackupCorrupt(path); berr != nil {
+			fmt.Fprintf(os.Stderr, "focus-gate: back up %s: %v\n", name, berr)
+		} else {
+			fmt.Fprintf(os.Stderr, "focus-gate: corrupt %s moved to %s\n", name, bak)
+		}
+	default:
+		LogLoadErr(name, err)
+	}
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/guide"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// SchemaVersion identifies the archive layout. Bump it whenever a change to
+// the bundled structures would make older archives unsafe to import.
+const SchemaVersion = 1
+
+// Archive bundles the complete persisted state into one portable document,
+// so a session can be moved between machines or attached to a bug report.
+type Archive struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Config        json.RawMessage `json:"config,omitempty"`
+	Intent        *forest.Forest  `json:"intent"`
+	Engine        *tfidf.Engine   `json:"engine"`
+	Guide         *guide.Guide    `json:"guide"`
+	Markov        *markov.Chain   `json:"markov"`
+}
+
+// Files names the state files an archive is restored into. An empty Config
+// path leaves the config file untouched. Backup is the number of rotated
+// backups to keep of each replaced state file.
+type Files struct {
+	Intent string
+	Engine string
+	Guide  string
+	Markov string
+	Config string
+	Backup int
+}
+
+// Export stamps the archive with the current SchemaVersion and writes it
+// atomically to path.
+func Export(path string, a *Archive) error {
+	a.SchemaVersion = SchemaVersion
+	return persist.SaveAtomic(path, a)
+}
+
+// Import reads an archive from path and validates it. An archive written by a
+// different schema version, or missing any of the state structures, is
+// rejected rather than partially applied.
+func Import(path string) (*Archive, error) {
+	if !persist.Exists(path) {
+		return nil, fmt.Errorf("archive %s not found", path)
+	}
+	var a Archive
+	// Archives exported before checksums were added still import.
+	if err := persist.Load(path, &a); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	if a.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("archive schema version %d, want %d", a.SchemaVersion, SchemaVersion)
+	}
+	switch {
+	case a.Intent == nil:
+		return nil, fmt.Errorf("archive is missing intent")
+	case a.Engine == nil:
+		return nil, fmt.Errorf("archive is missing engine")
+	case a.Guide == nil:
+		return nil, fmt.Errorf("archive is missing guide")
+	case a.Markov == nil:
+		return nil, fmt.Errorf("archive is missing markov")
+	}
+	return &a, nil
+}
+
+// Restore writes each bundled structure to its state file with
+// persist.SaveAtomicWithBackup. It stops at the first failure.
+func (a *Archive) Restore(files Files) error {
+	if err := persist.SaveAtomicWithBackup(files.Intent, a.Intent, files.Backup); err != nil {
+		return fmt.Errorf("save intent: %w", err)
+	}
+	if err := persist.SaveAtomicWithBackup(files.Engine, a.Engine, files.Backup); err != nil {
+		return fmt.Errorf("save engine: %w", err)
+	}
+	if err := persist.SaveAtomicWithBackup(files.Guide, a.Guide, files.Backup); err != nil {
+		return fmt.Errorf("save guide: %w", err)
+	}
+	if err := persist.SaveAtomicWithBackup(files.Markov, a.Markov, files.Backup); err != nil {
+		return fmt.Errorf("save markov: %w", err)
+	}
+	if files.Config != "" && len(a.Config) > 0 {
+		// The config stays plain JSON without a checksum so it can be hand-edited.
+		data, err := json.MarshalIndent(a.Config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+		if err := persist.WriteAtomic(files.Config, data); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+	return nil
+}
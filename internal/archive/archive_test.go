@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/guide"
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// populated builds an archive from a gate that has seen a few prompts.
+func populated() *Archive {
+	g := gate.New(forest.NewForest(), tfidf.NewEngine(), gate.DefaultConfig())
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p3")
+
+	gd := guide.New(5)
+	gd.Add("Added token refresh to the auth middleware", g.Forest.Trees[0].RootID, nil)
+
+	return &Archive{
+		Config: json.RawMessage(`{"memorySize":50}`),
+		Intent: g.Forest,
+		Engine: g.Engine,
+		Guide:  gd,
+		Markov: g.Chain,
+	}
+}
+
+// sameJSON fails the test unless a and b marshal to identical JSON.
+func sameJSON(t *testing.T, name string, a, b any) {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ja) != string(jb) {
+		t.Errorf("%s differs after round trip:\n got %s\nwant %s", name, jb, ja)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	orig := populated()
+
+	if err := Export(path, orig); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	got, err := Import(path)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	if got.SchemaVersion != SchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", got.SchemaVersion, SchemaVersion)
+	}
+	sameJSON(t, "config", orig.Config, got.Config)
+	sameJSON(t, "intent", orig.Intent, got.Intent)
+	sameJSON(t, "engine", orig.Engine, got.Engine)
+	sameJSON(t, "guide", orig.Guide, got.Guide)
+	sameJSON(t, "markov", orig.Markov, got.Markov)
+}
+
+func TestRestoreWritesStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := Files{
+		Intent: filepath.Join(dir, "data", "intent.json"),
+		Engine: filepath.Join(dir, "data", "engine.json"),
+		Guide:  filepath.Join(dir, "data", "guide.json"),
+		Markov: filepath.Join(dir, "data", "markov.json"),
+		Config: filepath.Join(dir, "config.json"),
+	}
+	orig := populated()
+	if err := orig.Restore(files); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	f := forest.NewForest()
+	if err := persist.Load(files.Intent, f); err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, "intent", orig.Intent, f)
+
+	e := tfidf.NewEngine()
+	if err := persist.Load(files.Engine, e); err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, "engine", orig.Engine, e)
+
+	// The config is written without a checksum so it stays hand-editable.
+	var cfg map[string]int
+	if err := persist.Load(files.Config, &cfg); !errors.Is(err, persist.ErrNoChecksum) {
+		t.Fatalf("config load err = %v, want ErrNoChecksum", err)
+	}
+	if cfg["memorySize"] != 50 {
+		t.Errorf("config memorySize = %d, want 50", cfg["memorySize"])
+	}
+}
+
+func TestImportRejectsMismatchedVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	a := populated()
+	a.SchemaVersion = SchemaVersion + 1
+	if err := persist.SaveAtomic(path, a); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Import(path)
+	if err == nil || !strings.Contains(err.Error(), "schema version") {
+		t.Errorf("Import of version %d: err = %v, want schema version error", a.SchemaVersion, err)
+	}
+}
+
+func TestImportRejectsIncompleteArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	data := []byte(`{"schemaVersion":1,"intent":{"trees":[]},"engine":{}}`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Import(path); err == nil {
+		t.Error("Import should reject an archive missing guide and markov")
+	}
+	if _, err := Import(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Import should reject a missing file")
+	}
+}
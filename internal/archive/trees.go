@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+)
+
+// TreeRecord is one pruned tree in the append-only tree archive, a JSON Lines
+// file with one record per archived tree.
+type TreeRecord struct {
+	ID         string       `json:"id"`
+	ArchivedAt int64        `json:"archivedAt"`
+	Tree       *forest.Tree `json:"tree"`
+}
+
+// AppendTrees archives trees at path, one line each, creating the file if
+// needed. Records are IDed by tree ID and archive time, so a tree that is
+// restored and pruned again gets a second, distinct record.
+func AppendTrees(path string, trees []*forest.Tree, now int64) ([]TreeRecord, error) {
+	if len(trees) == 0 {
+		return nil, nil
+	}
+	var buf []byte
+	records := make([]TreeRecord, len(trees))
+	for i, t := range trees {
+		records[i] = TreeRecord{
+			ID:         t.ID + "-" + strconv.FormatInt(now, 36),
+			ArchivedAt: now,
+			Tree:       t,
+		}
+		line, err := json.Marshal(records[i])
+		if err != nil {
+			return nil, fmt.Errorf("marshal tree %s: %w", t.ID, err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return records, file.Close()
+}
+
+// ReadTrees returns every record in the tree archive at path, oldest first.
+// A missing file is an empty archive. If a line fails to parse, for example
+// one cut short by a crash mid-append, the records before it are returned
+// along with the error.
+func ReadTrees(path string) ([]TreeRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []TreeRecord
+	dec := json.NewDecoder(file)
+	for {
+		var r TreeRecord
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("read tree archive: %w", err)
+		}
+		records = append(records, r)
+	}
+}
+
+// FindTreeRecord resolves an archive ID, or a prefix matching exactly one
+// record, to its record. Returns nil if nothing or several records match.
+func FindTreeRecord(records []TreeRecord, ref string) *TreeRecord {
+	for i := range records {
+		if records[i].ID == ref {
+			return &records[i]
+		}
+	}
+	if ref == "" {
+		return nil
+	}
+	var match *TreeRecord
+	for i := range records {
+		if strings.HasPrefix(records[i].ID, ref) {
+			if match != nil {
+				return nil
+			}
+			match = &records[i]
+		}
+	}
+	return match
+}
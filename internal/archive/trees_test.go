@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+func TestPrunedTreeArchiveRoundTrip(t *testing.T) {
+	cfg := gate.DefaultConfig()
+	cfg.PruneStrategy = gate.PruneTree
+	cfg.ArchivePruned = true
+	g := gate.New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	g.ProcessPrompt("fix the database migration schema error", "p3")
+	g.ProcessPrompt("style the frontend react component", "p4")
+	docs := fmt.Sprint(g.Engine.DocFreq)
+
+	g.Prune(g.Forest.NodeCount() - 1)
+	if len(g.PrunedTrees) == 0 {
+		t.Fatal("expected a pruned tree")
+	}
+	g.PrunedTrees = g.PrunedTrees[:1]
+	pruned := g.PrunedTrees[0]
+
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	if _, err := AppendTrees(path, g.PrunedTrees, 1000); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadTrees(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Tree.ID != pruned.ID {
+		t.Fatalf("archive should hold the pruned tree %s, got %+v", pruned.ID, records)
+	}
+	sameJSON(t, "archived tree", pruned.Nodes, records[0].Tree.Nodes)
+
+	r := FindTreeRecord(records, records[0].ID[:len(pruned.ID)])
+	if r == nil {
+		t.Fatal("FindTreeRecord should resolve a unique prefix")
+	}
+	if err := g.RestoreTree(r.Tree); err != nil {
+		t.Fatal(err)
+	}
+	if restored := g.Forest.TreeByID(pruned.ID); restored == nil || restored.NodeCount() != pruned.NodeCount() {
+		t.Fatalf("restored tree missing or incomplete")
+	}
+	if got := fmt.Sprint(g.Engine.DocFreq); got != docs {
+		t.Errorf("engine documents not restored:\n got %s\nwant %s", got, docs)
+	}
+}
+
+func TestReadTreesKeepsRecordsBeforeTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	if records, err := ReadTrees(path); err != nil || records != nil {
+		t.Fatalf("missing archive: %v, %v", records, err)
+	}
+
+	trees := []*forest.Tree{forest.NewTree("one", ""), forest.NewTree("two", "")}
+	if _, err := AppendTrees(path, trees, 1000); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":"cut`)
+	file.Close()
+
+	records, err := ReadTrees(path)
+	if err == nil {
+		t.Error("a truncated line should be reported")
+	}
+	if len(records) != 2 {
+		t.Errorf("expected the 2 intact records, got %d", len(records))
+	}
+}
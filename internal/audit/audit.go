@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Decision is one record in the decision log, an append-only JSON Lines file
+// with a line per classified prompt. Prompt holds the text, or
+// is empty with PromptHash set when prompts are logged by hash.
+type Decision struct {
+	Time       int64   `json:"time"`
+	Prompt     string  `json:"prompt,omitempty"`
+	PromptHash string  `json:"promptHash,omitempty"`
+	Action     string  `json:"action"`
+	TreeID     string  `json:"treeId"`
+	Score      float64 `json:"score"`
+
+	// Pruned is how many nodes pruning removed after the prompt.
+	Pruned int `json:"pruned,omitempty"`
+}
+
+// Hash returns the hex SHA-256 of a prompt, so logs can tell repeated
+// prompts apart without storing their text.
+func Hash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Append adds decisions to the log at path, one line each, creating the file
+// if needed. Unless keepPrompts is set, each prompt is replaced by its Hash.
+func Append(path string, decisions []Decision, keepPrompts bool) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, d := range decisions {
+		if !keepPrompts && d.Prompt != "" {
+			d.PromptHash = Hash(d.Prompt)
+			d.Prompt = ""
+		}
+		line, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("marshal decision: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read returns every decision in the log at path, oldest first. A missing
+// file is an empty log. If a line fails to parse, the decisions before it
+// are returned along with the error.
+func Read(path string) ([]Decision, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var decisions []Decision
+	dec := json.NewDecoder(file)
+	for {
+		var d Decision
+		err := dec.Decode(&d)
+		if err == io.EOF {
+			return decisions, nil
+		}
+		if err != nil {
+			return decisions, fmt.Errorf("read decision log: %w", err)
+		}
+		decisions = append(decisions, d)
+	}
+}
+
+// Summary counts the decisions made from Since onwards.
+type Summary struct {
+	Since     int64          `json:"since,omitempty"`
+	Decisions int            `json:"decisions"`
+	Actions   map[string]int `json:"actions"`
+
+	// PrunedPrompts is how many prompts triggered pruning, and PrunedNodes
+	// how many nodes it removed in total.
+	PrunedPrompts int `json:"prunedPrompts"`
+	PrunedNodes   int `json:"prunedNodes"`
+
+	First int64 `json:"first,omitempty"`
+	Last  int64 `json:"last,omitempty"`
+}
+
+// Summarize counts the decisions made at or after since (Unix ms; zero
+// counts all).
+func Summarize(decisions []Decision, since int64) Summary {
+	s := Summary{Since: since, Actions: make(map[string]int)}
+	for _, d := range decisions {
+		if d.Time < since {
+			continue
+		}
+		if s.Decisions == 0 || d.Time < s.First {
+			s.First = d.Time
+		}
+		s.Last = max(s.Last, d.Time)
+		s.Decisions++
+		s.Actions[d.Action]++
+		if d.Pruned > 0 {
+			s.PrunedPrompts++
+			s.PrunedNodes += d.Pruned
+		}
+	}
+	return s
+}
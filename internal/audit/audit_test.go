@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendHashesPrompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	first := []Decision{
+		{Time: 1000, Prompt: "add JWT auth", Action: "new", TreeID: "t1", Score: 0},
+		{Time: 2000, Prompt: "fix JWT expiry", Action: "extend", TreeID: "t1", Score: 0.7, Pruned: 2},
+	}
+	if err := Append(path, first, false); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := Append(path, []Decision{{Time: 3000, Prompt: "migrate db", Action: "branch", TreeID: "t1", Score: 0.3}}, true); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", lines, data)
+	}
+	if strings.Contains(string(data), "add JWT auth") {
+		t.Error("hashed prompt text written to the log")
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("read %d decisions, want 3", len(got))
+	}
+	if got[0].Prompt != "" || got[0].PromptHash != Hash("add JWT auth") {
+		t.Errorf("first decision = %+v, want the prompt hashed", got[0])
+	}
+	if got[2].Prompt != "migrate db" || got[2].PromptHash != "" {
+		t.Errorf("third decision = %+v, want the prompt kept", got[2])
+	}
+	if got[1].Pruned != 2 || got[1].Score != 0.7 {
+		t.Errorf("second decision = %+v", got[1])
+	}
+}
+
+func TestReadMissingLog(t *testing.T) {
+	got, err := Read(filepath.Join(t.TempDir(), "none.jsonl"))
+	if err != nil || got != nil {
+		t.Errorf("Read missing = %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestSummarizeSince(t *testing.T) {
+	decisions := []Decision{
+		{Time: 1000, Action: "new"},
+		{Time: 2000, Action: "extend", Pruned: 3},
+		{Time: 3000, Action: "extend"},
+		{Time: 4000, Action: "branch", Pruned: 1},
+	}
+	s := Summarize(decisions, 0)
+	if s.Decisions != 4 || s.Actions["extend"] != 2 || s.PrunedPrompts != 2 || s.PrunedNodes != 4 {
+		t.Errorf("Summarize all = %+v", s)
+	}
+	if s.First != 1000 || s.Last != 4000 {
+		t.Errorf("range = %d..%d, want 1000..4000", s.First, s.Last)
+	}
+
+	s = Summarize(decisions, 2500)
+	if s.Decisions != 2 || s.Actions["new"] != 0 || s.PrunedNodes != 1 || s.First != 3000 {
+		t.Errorf("Summarize since 2500 = %+v", s)
+	}
+}
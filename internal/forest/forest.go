@@ -2,6 +2,10 @@ package forest
 
 import (
 	"container/heap"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,16 +16,27 @@ type Meta struct {
 	LastUpdate   int64 `json:"lastUpdate"`
 }
 
+// SchemaVersion is the current on-disk layout of Forest. Bump it and register
+// a persist migration whenever a change would misload older files.
+const SchemaVersion = 1
+
 // Forest is a collection of topic trees with scoring, pruning, and metadata.
 type Forest struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	Trees []*Tree `json:"trees"`
 	Meta  Meta    `json:"meta"`
+
+	// Bridges counts prompts that scored close to two trees at once, keyed
+	// by BridgeKey. Repeated bridges suggest the two topics are converging.
+	Bridges map[string]int `json:"bridges,omitempty"`
 }
 
 // NewForest creates an empty forest.
 func NewForest() *Forest {
 	now := time.Now().UnixMilli()
 	return &Forest{
+		SchemaVersion: SchemaVersion,
 		Meta: Meta{
 			Created:    now,
 			LastUpdate: now,
@@ -29,6 +44,9 @@ func NewForest() *Forest {
 	}
 }
 
+// CurrentSchema reports SchemaVersion for persist.Load migrations.
+func (f *Forest) CurrentSchema() int { return SchemaVersion }
+
 // NodeCount returns the total number of nodes across all trees.
 func (f *Forest) NodeCount() int {
 	count := 0
@@ -38,9 +56,9 @@ func (f *Forest) NodeCount() int {
 	return count
 }
 
-// AllLeaves returns all leaf nodes across all trees with their tree index.
-// decayRate controls the exponential time-decay applied to each node's score.
-func (f *Forest) AllLeaves(decayRate float64) []LeafEntry {
+// AllLeaves returns all leaf nodes across all trees with their tree index,
+// scored with p and each tree's decay override.
+func (f *Forest) AllLeaves(p ScoreParams) []LeafEntry {
 	var entries []LeafEntry
 	now := time.Now().UnixMilli()
 	for i, t := range f.Trees {
@@ -52,7 +70,7 @@ func (f *Forest) AllLeaves(decayRate float64) []LeafEntry {
 			entries = append(entries, LeafEntry{
 				Node:    n,
 				TreeIdx: i,
-				Score:   n.Score(now, decayRate),
+				Score:   n.Score(now, t.Params(p)),
 			})
 		}
 	}
@@ -60,75 +78,356 @@ func (f *Forest) AllLeaves(decayRate float64) []LeafEntry {
 }
 
 // Prune removes the lowest-scoring leaves until the forest fits within memorySize.
-// Uses a min-heap for O(log n) extraction per step. Returns the content of pruned
-// nodes that were indexed in the TF-IDF engine, so the caller can RemoveDocument
-// them. Non-indexed nodes (synthetic bubble-up abstractions) are excluded from
-// the returned list to prevent document-frequency drift.
-func (f *Forest) Prune(memorySize int, decayRate float64) []string {
-	var removedContents []string
+// Nodes are scored with p and their tree's decay override.
+// The min-heap of non-root leaves is built once; when removing a leaf turns its
+// parent into a leaf, only that parent is pushed. This keeps bulk pruning at
+// O(n log n) instead of rebuilding the heap on every step. Returns the pruned
+// nodes that were indexed in the TF-IDF engine, so the caller can
+// RemoveDocument their tokens. Non-indexed nodes (synthetic bubble-up
+// abstractions) are excluded from the returned list to prevent
+// document-frequency drift.
+//
+// Pinned trees are skipped entirely. If only pinned trees remain and the forest
+// is still over budget, Prune stops and leaves it oversized.
+func (f *Forest) Prune(memorySize int, p ScoreParams) []*Node {
+	var removed []*Node
 
-	for f.NodeCount() > memorySize {
-		now := time.Now().UnixMilli()
+	count := f.NodeCount()
+	if count <= memorySize {
+		return nil
+	}
+	now := time.Now().UnixMilli()
 
-		// Build min-heap of all non-root leaves
-		h := &LeafHeap{}
-		for i, t := range f.Trees {
-			for _, n := range t.GetLeaves() {
-				if n.ID == t.RootID {
-					continue
-				}
-				heap.Push(h, LeafEntry{
-					Node:    n,
-					TreeIdx: i,
-					Score:   n.Score(now, decayRate),
-				})
+	// Build min-heap of all non-root leaves
+	h := &LeafHeap{}
+	for i, t := range f.Trees {
+		if t.Pinned {
+			continue
+		}
+		for _, n := range t.GetLeaves() {
+			if n.ID == t.RootID {
+				continue
 			}
+			*h = append(*h, LeafEntry{Node: n, TreeIdx: i, Tree: t, Score: n.Score(now, t.Params(p))})
 		}
+	}
+	heap.Init(h)
 
+	for count > memorySize {
 		if h.Len() == 0 {
-			// No removable leaves — remove the lowest-scoring entire tree
-			if len(f.Trees) == 0 {
-				break
-			}
-			worstIdx := 0
-			worstScore := f.Trees[0].Root().Score(now, decayRate)
-			for i := 1; i < len(f.Trees); i++ {
-				s := f.Trees[i].Root().Score(now, decayRate)
-				if s < worstScore {
+			// No removable leaves — remove the lowest-scoring unpinned tree
+			worstIdx := -1
+			worstScore := 0.0
+			for i, t := range f.Trees {
+				if t.Pinned {
+					continue
+				}
+				s := t.Root().Score(now, t.Params(p))
+				if worstIdx < 0 || s < worstScore {
 					worstScore = s
 					worstIdx = i
 				}
 			}
+			if worstIdx < 0 {
+				break
+			}
 			// Only return content from indexed nodes for TF-IDF cleanup.
 			for _, n := range f.Trees[worstIdx].Nodes {
 				if n.Indexed {
-					removedContents = append(removedContents, n.Content)
+					removed = append(removed, n)
 				}
 			}
+			count -= f.Trees[worstIdx].NodeCount()
 			f.Trees = append(f.Trees[:worstIdx], f.Trees[worstIdx+1:]...)
 			continue
 		}
 
-		// Pop the lowest-scoring leaf
+		// Pop the lowest-scoring leaf, skipping entries whose node is gone.
 		entry := heap.Pop(h).(LeafEntry)
-		tree := f.Trees[entry.TreeIdx]
+		tree := entry.Tree
+		if tree.Nodes[entry.Node.ID] != entry.Node {
+			continue
+		}
 		if entry.Node.Indexed {
-			removedContents = append(removedContents, entry.Node.Content)
+			removed = append(removed, entry.Node)
 		}
+		parentID := entry.Node.ParentID
 		tree.RemoveNode(entry.Node.ID)
+		count--
 
 		// If the tree has only the root left (or is empty), remove the tree
 		if tree.NodeCount() <= 1 {
 			for _, n := range tree.Nodes {
 				if n.Indexed {
-					removedContents = append(removedContents, n.Content)
+					removed = append(removed, n)
 				}
 			}
-			f.Trees = append(f.Trees[:entry.TreeIdx], f.Trees[entry.TreeIdx+1:]...)
+			count -= tree.NodeCount()
+			f.removeTreePtr(tree)
+			continue
+		}
+
+		// The parent may have just become a removable leaf.
+		if parent := tree.Nodes[parentID]; parent != nil && parent.ID != tree.RootID && parent.IsLeaf() {
+			heap.Push(h, LeafEntry{Node: parent, Tree: tree, Score: parent.Score(now, tree.Params(p))})
 		}
 	}
 
-	return removedContents
+	return removed
+}
+
+// NoPruneCutoff is returned by PruneCutoff when the next prompt would not
+// trigger a prune, or when every tree is pinned. Scores are never negative.
+const NoPruneCutoff = -1.0
+
+// PruneCutoff returns the score at now of the node Prune would remove next:
+// the weakest non-root leaf of an unpinned tree, or, if no unpinned tree has
+// one, the weakest unpinned root. Anything scoring below it is pruned before
+// anything above it. Returns NoPruneCutoff while the forest is under
+// memorySize, since adding one more node would not prune anything.
+func (f *Forest) PruneCutoff(now int64, memorySize int, p ScoreParams) float64 {
+	if f.NodeCount() < memorySize {
+		return NoPruneCutoff
+	}
+	leaf, root := NoPruneCutoff, NoPruneCutoff
+	for _, t := range f.Trees {
+		if t.Pinned || t.Root() == nil {
+			continue
+		}
+		tp := t.Params(p)
+		if s := t.Root().Score(now, tp); root < 0 || s < root {
+			root = s
+		}
+		for _, n := range t.GetLeaves() {
+			if s := n.Score(now, tp); n.ID != t.RootID && (leaf < 0 || s < leaf) {
+				leaf = s
+			}
+		}
+	}
+	if leaf >= 0 {
+		return leaf
+	}
+	return root
+}
+
+// Score is the aggregate score PruneTrees ranks trees by: the highest
+// score of any node in the tree, so a tree is as strong as its most active
+// part and a large tree does not outlive a small one by size alone.
+func (t *Tree) Score(now int64, p ScoreParams) float64 {
+	best := 0.0
+	p = t.Params(p)
+	for _, n := range t.Nodes {
+		if s := n.Score(now, p); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// PruneTrees is the whole-tree prune strategy: instead of trimming leaves
+// across all trees, it removes the unpinned tree with the lowest Tree.Score
+// until the forest fits within memorySize, so surviving topics stay intact.
+// Once a single unpinned tree is left it falls back to Prune, rather than
+// discarding the only remaining topic. Like Prune, it returns the removed
+// nodes that were indexed.
+func (f *Forest) PruneTrees(memorySize int, p ScoreParams) []*Node {
+	var removed []*Node
+	now := time.Now().UnixMilli()
+
+	for f.NodeCount() > memorySize {
+		worst, unpinned := -1, 0
+		worstScore := 0.0
+		for i, t := range f.Trees {
+			if t.Pinned {
+				continue
+			}
+			unpinned++
+			if s := t.Score(now, p); worst < 0 || s < worstScore {
+				worst, worstScore = i, s
+			}
+		}
+		if unpinned <= 1 {
+			return append(removed, f.Prune(memorySize, p)...)
+		}
+		for _, n := range f.Trees[worst].Nodes {
+			if n.Indexed {
+				removed = append(removed, n)
+			}
+		}
+		f.RemoveTree(worst)
+	}
+	return removed
+}
+
+// removeTreePtr removes the given tree from the forest, if present.
+func (f *Forest) removeTreePtr(t *Tree) {
+	for i, ft := range f.Trees {
+		if ft == t {
+			f.Trees = append(f.Trees[:i], f.Trees[i+1:]...)
+			return
+		}
+	}
+}
+
+// TreeByID returns the tree with the given ID, or nil.
+func (f *Forest) TreeByID(id string) *Tree {
+	for _, t := range f.Trees {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// FindTree resolves a tree by ID, or by its index in Trees as shown by
+// --inspect. Returns nil if nothing matches.
+func (f *Forest) FindTree(ref string) *Tree {
+	if t := f.TreeByID(ref); t != nil {
+		return t
+	}
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(f.Trees) {
+		return f.Trees[i]
+	}
+	return nil
+}
+
+// NodeRef locates a node within the forest. TreeIdx is the tree's index in
+// Trees, as shown by --inspect.
+type NodeRef struct {
+	TreeIdx int
+	Tree    *Tree
+	Node    *Node
+}
+
+// FindNode resolves a node by exact ID, or by an ID prefix that matches
+// exactly one node across all trees. Returns nils if nothing matches or the
+// prefix is ambiguous.
+func (f *Forest) FindNode(id string) (*Tree, *Node) {
+	if id == "" {
+		return nil, nil
+	}
+	var tree *Tree
+	var node *Node
+	matches := 0
+	for _, t := range f.Trees {
+		if n := t.Nodes[id]; n != nil {
+			return t, n
+		}
+		for nid, n := range t.Nodes {
+			if strings.HasPrefix(nid, id) {
+				tree, node = t, n
+				matches++
+			}
+		}
+	}
+	if matches != 1 {
+		return nil, nil
+	}
+	return tree, node
+}
+
+// FindNodesByContent returns every node whose content contains substr,
+// ignoring case, ordered by tree then by depth and ID.
+func (f *Forest) FindNodesByContent(substr string) []NodeRef {
+	if substr == "" {
+		return nil
+	}
+	needle := strings.ToLower(substr)
+	var refs []NodeRef
+	for i, t := range f.Trees {
+		start := len(refs)
+		for _, n := range t.Nodes {
+			if strings.Contains(strings.ToLower(n.Content), needle) {
+				refs = append(refs, NodeRef{TreeIdx: i, Tree: t, Node: n})
+			}
+		}
+		found := refs[start:]
+		sort.Slice(found, func(a, b int) bool {
+			if found[a].Node.Depth != found[b].Node.Depth {
+				return found[a].Node.Depth < found[b].Node.Depth
+			}
+			return found[a].Node.ID < found[b].Node.ID
+		})
+	}
+	return refs
+}
+
+// bridgeSep joins two tree IDs into a bridge key. IDs are base36/hex, so the
+// separator cannot occur inside an ID.
+const bridgeSep = "|"
+
+// BridgeKey returns the order-independent key for a pair of trees.
+func BridgeKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + bridgeSep + b
+}
+
+// RecordBridge counts a prompt that bridged trees a and b and returns the
+// new count for the pair.
+func (f *Forest) RecordBridge(a, b string) int {
+	if a == "" || b == "" || a == b {
+		return 0
+	}
+	if f.Bridges == nil {
+		f.Bridges = make(map[string]int)
+	}
+	key := BridgeKey(a, b)
+	f.Bridges[key]++
+	return f.Bridges[key]
+}
+
+// UnrecordBridge reverses one RecordBridge(a, b).
+func (f *Forest) UnrecordBridge(a, b string) {
+	key := BridgeKey(a, b)
+	if f.Bridges[key] <= 1 {
+		delete(f.Bridges, key)
+		return
+	}
+	f.Bridges[key]--
+}
+
+// ForgetBridges drops every bridge involving the given tree, e.g. after it
+// has been pruned.
+func (f *Forest) ForgetBridges(treeID string) {
+	for key := range f.Bridges {
+		pair := strings.SplitN(key, bridgeSep, 2)
+		if pair[0] == treeID || pair[1] == treeID {
+			delete(f.Bridges, key)
+		}
+	}
+}
+
+// MergeBridges moves every bridge involving the tree from over to into, as
+// when from is merged into into. A bridge between the two is dropped.
+func (f *Forest) MergeBridges(from, into string) {
+	for key, n := range f.Bridges {
+		pair := strings.SplitN(key, bridgeSep, 2)
+		if pair[0] != from && pair[1] != from {
+			continue
+		}
+		delete(f.Bridges, key)
+		other := pair[0]
+		if other == from {
+			other = pair[1]
+		}
+		if other != into {
+			f.Bridges[BridgeKey(into, other)] += n
+		}
+	}
+}
+
+// Clone returns a deep copy of the forest, for simulations that must not
+// touch the original.
+func (f *Forest) Clone() *Forest {
+	c := *f
+	c.Trees = make([]*Tree, len(f.Trees))
+	for i, t := range f.Trees {
+		c.Trees[i] = t.Clone()
+	}
+	c.Bridges = maps.Clone(f.Bridges)
+	return &c
 }
 
 // AddTree appends a new tree to the forest.
@@ -1,9 +1,19 @@
 package forest
 
 import (
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
+// testParams are the default scoring parameters.
+var testParams = ScoreParams{DecayRate: 0.05, DepthPenalty: DefaultDepthPenalty}
+
 func TestNewNode(t *testing.T) {
 	n := NewNode("test content", 0, "src1")
 	if n.Content != "test content" {
@@ -30,7 +40,7 @@ func TestNodeTouch(t *testing.T) {
 	n := NewNode("test", 0, "")
 	origWeight := n.Weight
 
-	n.Touch(20, "src2")
+	n.Touch(20, "src2", "")
 	if n.Frequency != 2 {
 		t.Errorf("Frequency after touch = %d, want 2", n.Frequency)
 	}
@@ -42,19 +52,42 @@ func TestNodeTouch(t *testing.T) {
 	}
 }
 
+func TestTouchWeightCurves(t *testing.T) {
+	weights := make(map[string]float64)
+	for _, curve := range []string{WeightLog2, WeightLinear, WeightSqrt, ""} {
+		if w := CurveWeight(curve, 1); w != 1 || NewNode("test", 0, "").Weight != w {
+			t.Errorf("%q: weight at frequency 1 = %v, want 1 like a new node", curve, w)
+		}
+		n := NewNode("test", 0, "")
+		for i := 0; i < 7; i++ {
+			n.Touch(20, "", curve)
+		}
+		weights[curve] = n.Weight
+	}
+	if weights[WeightLinear] != 8 || weights[WeightLog2] != math.Log2(9) || weights[""] != weights[WeightLog2] {
+		t.Errorf("weights after 8 visits = %v, want linear 8 and log2 (the default) log2(9)", weights)
+	}
+	if weights[WeightLinear] <= weights[WeightSqrt] {
+		t.Errorf("weights after 8 visits = %v, want linear above sqrt", weights)
+	}
+	if CurveWeight(WeightSqrt, 32) <= CurveWeight(WeightLog2, 32) {
+		t.Error("sqrt should outgrow log2 for frequently revisited nodes")
+	}
+}
+
 func TestNodeScore(t *testing.T) {
 	n := NewNode("test", 0, "")
 	now := n.Created
 
 	// Score at creation time: weight=1.0, recency=1.0, depthFactor=1.0
-	score := n.Score(now, 0.05)
+	score := n.Score(now, testParams)
 	if score != 1.0 {
 		t.Errorf("Score at creation = %f, want 1.0", score)
 	}
 
 	// Score should decay over time
 	oneHourLater := now + 3600000
-	scoreDecayed := n.Score(oneHourLater, 0.05)
+	scoreDecayed := n.Score(oneHourLater, testParams)
 	if scoreDecayed >= score {
 		t.Errorf("Score should decay: at creation=%f, after 1h=%f", score, scoreDecayed)
 	}
@@ -63,12 +96,62 @@ func TestNodeScore(t *testing.T) {
 	deep := NewNode("test", 3, "")
 	deep.Created = n.Created
 	deep.LastAccessed = n.LastAccessed
-	deepScore := deep.Score(now, 0.05)
+	deepScore := deep.Score(now, testParams)
 	if deepScore >= score {
 		t.Errorf("Deeper node should score lower: depth0=%f, depth3=%f", score, deepScore)
 	}
 }
 
+func TestTreeAncestors(t *testing.T) {
+	tree := NewTree("root", "")
+	mid := tree.AddChild(tree.RootID, "mid", "")
+	leaf := tree.AddChild(mid.ID, "leaf", "p0")
+
+	chain := tree.Ancestors(leaf.ID)
+	if len(chain) != 2 || chain[0].ID != tree.RootID || chain[1].ID != mid.ID {
+		t.Fatalf("Ancestors(leaf) = %v, want [root mid]", chain)
+	}
+	if got := tree.Ancestors(tree.RootID); len(got) != 0 {
+		t.Errorf("Ancestors(root) = %v, want none", got)
+	}
+	if got := tree.Ancestors("missing"); got != nil {
+		t.Errorf("Ancestors(missing) = %v, want nil", got)
+	}
+}
+
+func TestNodeSourcesCapped(t *testing.T) {
+	n := NewNode("test", 0, "p0")
+	for i := 1; i <= 7; i++ {
+		n.Touch(3, fmt.Sprintf("p%d", i), "")
+	}
+	if got := strings.Join(n.Sources, ","); got != "p5,p6,p7" {
+		t.Errorf("Sources = %s, want the newest 3: p5,p6,p7", got)
+	}
+
+	n.AddSources(3, "p8", "", "p9")
+	if got := strings.Join(n.Sources, ","); got != "p7,p8,p9" {
+		t.Errorf("Sources = %s, want p7,p8,p9", got)
+	}
+	n.AddSources(0, "p10")
+	if len(n.Sources) != 3 || n.Sources[2] != "p9" {
+		t.Errorf("maxSources 0 should record nothing, got %v", n.Sources)
+	}
+}
+
+func TestNodeScoreFactors(t *testing.T) {
+	n := NewNode("test", 2, "")
+	n.Touch(5, "", "")
+	now := n.LastAccessed + 2*3600000
+
+	f := n.ScoreFactors(now, testParams)
+	if f.AgeHours != 2 {
+		t.Errorf("AgeHours = %f, want 2", f.AgeHours)
+	}
+	if got, want := f.Weight*f.Recency*f.DepthFactor, n.Score(now, testParams); got != want {
+		t.Errorf("factor product = %f, Score = %f", got, want)
+	}
+}
+
 func TestTreeAddChild(t *testing.T) {
 	tree := NewTree("root content", "src1")
 	root := tree.Root()
@@ -172,7 +255,7 @@ func TestForestPrune(t *testing.T) {
 	}
 
 	// Prune to limit of 4
-	removed := f.Prune(4, 0.05)
+	removed := f.Prune(4, testParams)
 
 	if f.NodeCount() > 4 {
 		t.Errorf("after prune: NodeCount = %d, want <= 4", f.NodeCount())
@@ -191,13 +274,93 @@ func TestForestPruneRemovesEmptyTrees(t *testing.T) {
 	f.AddTree(tree)
 
 	// Prune to 0 — should remove everything
-	f.Prune(0, 0.05)
+	f.Prune(0, testParams)
 
 	if len(f.Trees) != 0 {
 		t.Errorf("after pruning to 0: %d trees remain, want 0", len(f.Trees))
 	}
 }
 
+func TestForestPrunePinnedTreeSurvives(t *testing.T) {
+	f := buildPruneForest(200)
+	pinned := f.Trees[3]
+	pinned.Pinned = true
+	pinnedNodes := pinned.NodeCount()
+
+	f.Prune(pinnedNodes+5, testParams)
+
+	if f.FindTree(pinned.ID) != pinned {
+		t.Fatal("pinned tree was removed")
+	}
+	if pinned.NodeCount() != pinnedNodes {
+		t.Errorf("pinned tree lost nodes: %d, want %d", pinned.NodeCount(), pinnedNodes)
+	}
+	if f.NodeCount() > pinnedNodes+5 {
+		t.Errorf("NodeCount = %d, want <= %d", f.NodeCount(), pinnedNodes+5)
+	}
+	if len(f.Trees) >= 20 {
+		t.Errorf("unpinned trees should have been removed, %d remain", len(f.Trees))
+	}
+}
+
+func TestForestPruneLeavesOversizedWhenAllPinned(t *testing.T) {
+	f := buildPruneForest(60)
+	for _, tree := range f.Trees {
+		tree.Pinned = true
+	}
+
+	removed := f.Prune(0, testParams)
+
+	if len(removed) != 0 || f.NodeCount() != 60 {
+		t.Errorf("all-pinned prune removed %d contents, NodeCount = %d, want 0 and 60", len(removed), f.NodeCount())
+	}
+}
+
+func TestForestFindTree(t *testing.T) {
+	f := buildPruneForest(20)
+	if got := f.FindTree("t5"); got != f.Trees[5] {
+		t.Errorf("FindTree by ID = %v", got)
+	}
+	if got := f.FindTree("2"); got != f.Trees[2] {
+		t.Errorf("FindTree by index = %v", got)
+	}
+	for _, ref := range []string{"20", "-1", "nope"} {
+		if got := f.FindTree(ref); got != nil {
+			t.Errorf("FindTree(%q) = %v, want nil", ref, got)
+		}
+	}
+}
+
+func TestGenerateIDNoCollisions(t *testing.T) {
+	const n = 20000
+	seen := make(map[string]bool, n)
+	for i := 0; i < n; i++ {
+		id := NewNode("x", 0, "").ID
+		if seen[id] {
+			t.Fatalf("duplicate ID %q after %d nodes", id, i)
+		}
+		seen[id] = true
+	}
+}
+
+func TestForestBridges(t *testing.T) {
+	f := NewForest()
+	if f.RecordBridge("a", "b") != 1 || f.RecordBridge("b", "a") != 2 {
+		t.Errorf("bridge counts should be order-independent: %v", f.Bridges)
+	}
+	f.RecordBridge("a", "c")
+	f.RecordBridge("a", "a") // self-bridge is ignored
+
+	f.UnrecordBridge("a", "b")
+	if f.Bridges[BridgeKey("a", "b")] != 1 {
+		t.Errorf("UnrecordBridge: %v", f.Bridges)
+	}
+	f.ForgetBridges("c")
+	if len(f.Bridges) != 1 {
+		t.Errorf("ForgetBridges(c): %v", f.Bridges)
+	}
+}
+
 func TestTreeAddChildInvalidParent(t *testing.T) {
 	tree := NewTree("root", "")
 	child := tree.AddChild("nonexistent", "child", "")
@@ -206,6 +369,18 @@ func TestTreeAddChildInvalidParent(t *testing.T) {
 	}
 }
 
+func TestTreeAddChildBlankContent(t *testing.T) {
+	tree := NewTree("root", "")
+	for _, content := range []string{"", "   ", "\t\n"} {
+		if child := tree.AddChild(tree.RootID, content, ""); child != nil {
+			t.Errorf("AddChild(%q) should return nil", content)
+		}
+	}
+	if tree.NodeCount() != 1 || len(tree.Root().ChildIDs) != 0 {
+		t.Errorf("blank AddChild changed the tree: %d nodes, children %v", tree.NodeCount(), tree.Root().ChildIDs)
+	}
+}
+
 func TestTreeRemoveNodeNonexistent(t *testing.T) {
 	tree := NewTree("root", "")
 	// Should not panic
@@ -214,3 +389,462 @@ func TestTreeRemoveNodeNonexistent(t *testing.T) {
 		t.Error("removing nonexistent node should not change tree")
 	}
 }
+
+// contents lists the content of each node.
+func contents(nodes []*Node) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Content
+	}
+	return out
+}
+
+// pruneNaive is the original Prune, which rebuilt the heap from every leaf on
+// each iteration. Kept as a reference for equivalence testing.
+func pruneNaive(f *Forest, memorySize int, p ScoreParams) []string {
+	var removedContents []string
+	for f.NodeCount() > memorySize {
+		now := time.Now().UnixMilli()
+		h := &LeafHeap{}
+		for i, t := range f.Trees {
+			for _, n := range t.GetLeaves() {
+				if n.ID == t.RootID {
+					continue
+				}
+				heap.Push(h, LeafEntry{Node: n, TreeIdx: i, Score: n.Score(now, p)})
+			}
+		}
+		if h.Len() == 0 {
+			if len(f.Trees) == 0 {
+				break
+			}
+			worstIdx := 0
+			worstScore := f.Trees[0].Root().Score(now, p)
+			for i := 1; i < len(f.Trees); i++ {
+				if s := f.Trees[i].Root().Score(now, p); s < worstScore {
+					worstScore = s
+					worstIdx = i
+				}
+			}
+			for _, n := range f.Trees[worstIdx].Nodes {
+				if n.Indexed {
+					removedContents = append(removedContents, n.Content)
+				}
+			}
+			f.Trees = append(f.Trees[:worstIdx], f.Trees[worstIdx+1:]...)
+			continue
+		}
+		entry := heap.Pop(h).(LeafEntry)
+		tree := f.Trees[entry.TreeIdx]
+		if entry.Node.Indexed {
+			removedContents = append(removedContents, entry.Node.Content)
+		}
+		tree.RemoveNode(entry.Node.ID)
+		if tree.NodeCount() <= 1 {
+			for _, n := range tree.Nodes {
+				if n.Indexed {
+					removedContents = append(removedContents, n.Content)
+				}
+			}
+			f.Trees = append(f.Trees[:entry.TreeIdx], f.Trees[entry.TreeIdx+1:]...)
+		}
+	}
+	return removedContents
+}
+
+// buildPruneForest builds a deterministic forest of n nodes with distinct
+// scores: 20 trees, each a root with children and grandchildren. Nodes are
+// constructed directly with sequential IDs so the structure is identical
+// across calls.
+func buildPruneForest(n int) *Forest {
+	f := NewForest()
+	base := time.Now().UnixMilli()
+	newNode := func(seq, depth int, parentID string) *Node {
+		return &Node{
+			ID:           fmt.Sprintf("n%d", seq),
+			Content:      fmt.Sprintf("node %d", seq),
+			Depth:        depth,
+			Weight:       1.0,
+			Frequency:    1,
+			LastAccessed: base - int64((seq*7919)%n)*60000,
+			ParentID:     parentID,
+			Indexed:      true,
+		}
+	}
+	for t := 0; t < 20; t++ {
+		root := newNode(t, 0, "")
+		f.AddTree(&Tree{ID: fmt.Sprintf("t%d", t), RootID: root.ID, Nodes: map[string]*Node{root.ID: root}})
+	}
+	for seq := 20; seq < n; seq++ {
+		tree := f.Trees[seq%20]
+		parent := tree.Root()
+		// Every third node nests under the most recent child.
+		if seq%3 == 0 && len(parent.ChildIDs) > 0 {
+			parent = tree.Nodes[parent.ChildIDs[len(parent.ChildIDs)-1]]
+		}
+		child := newNode(seq, parent.Depth+1, parent.ID)
+		parent.ChildIDs = append(parent.ChildIDs, child.ID)
+		tree.Nodes[child.ID] = child
+	}
+	return f
+}
+
+func survivors(f *Forest) []string {
+	var contents []string
+	for _, t := range f.Trees {
+		for _, n := range t.Nodes {
+			contents = append(contents, n.Content)
+		}
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func TestForestPruneMatchesNaive(t *testing.T) {
+	fast := buildPruneForest(500)
+	naive := buildPruneForest(500)
+
+	removedFast := contents(fast.Prune(50, testParams))
+	removedNaive := pruneNaive(naive, 50, testParams)
+
+	got, want := survivors(fast), survivors(naive)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("survivors differ:\n  got  %v\n  want %v", got, want)
+	}
+	sort.Strings(removedFast)
+	sort.Strings(removedNaive)
+	if fmt.Sprint(removedFast) != fmt.Sprint(removedNaive) {
+		t.Errorf("removed contents differ: got %d, want %d", len(removedFast), len(removedNaive))
+	}
+	if fast.NodeCount() > 50 {
+		t.Errorf("NodeCount = %d, want <= 50", fast.NodeCount())
+	}
+}
+
+func BenchmarkPrune(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		f := buildPruneForest(2000)
+		b.StartTimer()
+		f.Prune(100, testParams)
+	}
+}
+
+// buildFindForest builds two trees with fixed node IDs and content.
+func buildFindForest() *Forest {
+	f := NewForest()
+	add := func(treeID string, nodes ...*Node) {
+		t := &Tree{ID: treeID, RootID: nodes[0].ID, Nodes: map[string]*Node{}}
+		for _, n := range nodes {
+			t.Nodes[n.ID] = n
+		}
+		f.AddTree(t)
+	}
+	add("t1",
+		&Node{ID: "abc123", Content: "auth | login"},
+		&Node{ID: "abd456", Content: "Fix the LOGIN bug", Depth: 1, ParentID: "abc123"},
+	)
+	add("t2",
+		&Node{ID: "xyz789", Content: "login page styling"},
+		&Node{ID: "xyq000", Content: "database schema", Depth: 1, ParentID: "xyz789"},
+	)
+	return f
+}
+
+func TestFindNode(t *testing.T) {
+	f := buildFindForest()
+
+	if tree, n := f.FindNode("abd456"); n == nil || n.ID != "abd456" || tree.ID != "t1" {
+		t.Errorf("exact ID lookup = %v, %v", tree, n)
+	}
+	if tree, n := f.FindNode("xyq"); n == nil || n.ID != "xyq000" || tree.ID != "t2" {
+		t.Errorf("unique prefix lookup = %v, %v", tree, n)
+	}
+	if _, n := f.FindNode("ab"); n != nil {
+		t.Errorf("ambiguous prefix should not resolve, got %s", n.ID)
+	}
+	if _, n := f.FindNode("nope"); n != nil {
+		t.Errorf("unknown ID should not resolve, got %s", n.ID)
+	}
+	if _, n := f.FindNode(""); n != nil {
+		t.Error("empty ID should not resolve")
+	}
+}
+
+func TestFindNodesByContent(t *testing.T) {
+	f := buildFindForest()
+
+	refs := f.FindNodesByContent("Login")
+	var got []string
+	for _, r := range refs {
+		got = append(got, fmt.Sprintf("%d:%s", r.TreeIdx, r.Node.ID))
+	}
+	want := []string{"0:abc123", "0:abd456", "1:xyz789"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	if refs := f.FindNodesByContent("kubernetes"); len(refs) != 0 {
+		t.Errorf("unexpected matches: %v", refs)
+	}
+}
+
+func TestDepthPenalty(t *testing.T) {
+	n := NewNode("test", 3, "")
+	now := n.LastAccessed
+	strict := ScoreParams{DecayRate: 0.05, DepthPenalty: 0.5}
+	if n.Score(now, strict) >= n.Score(now, testParams) {
+		t.Errorf("higher penalty should lower a depth-3 score: %f vs %f",
+			n.Score(now, strict), n.Score(now, testParams))
+	}
+	if got := n.Score(now, ScoreParams{DecayRate: 0.05}); got != 1.0 {
+		t.Errorf("zero penalty score = %f, want 1.0", got)
+	}
+}
+
+func TestDepthPenaltyChangesPruneOrder(t *testing.T) {
+	// A shallow leaf touched six hours ago and a fresh leaf at depth 3.
+	build := func() (*Forest, *Node, *Node) {
+		f := NewForest()
+		tree := NewTree("root", "")
+		f.AddTree(tree)
+		shallow := tree.AddChild(tree.RootID, "shallow", "")
+		shallow.LastAccessed -= 6 * 3600000
+		mid := tree.AddChild(tree.RootID, "mid", "")
+		mid = tree.AddChild(mid.ID, "mid2", "")
+		deep := tree.AddChild(mid.ID, "deep", "")
+		return f, shallow, deep
+	}
+
+	f, shallow, deep := build()
+	f.Prune(f.NodeCount()-1, testParams)
+	if f.Trees[0].Nodes[shallow.ID] != nil || f.Trees[0].Nodes[deep.ID] == nil {
+		t.Error("default penalty should prune the stale shallow leaf first")
+	}
+
+	f, shallow, deep = build()
+	f.Prune(f.NodeCount()-1, ScoreParams{DecayRate: 0.05, DepthPenalty: 1.0})
+	if f.Trees[0].Nodes[deep.ID] != nil || f.Trees[0].Nodes[shallow.ID] == nil {
+		t.Error("a high penalty should prune the deep leaf first")
+	}
+}
+
+// buildStrategyForest builds a noisy tree with a fresh root and six day-old
+// leaves, and a quiet tree whose root and two leaves were all touched six
+// hours ago. Leaves are indexed; roots are abstractions.
+func buildStrategyForest() (f *Forest, noisy, quiet *Tree) {
+	f = NewForest()
+	now := time.Now().UnixMilli()
+	noisy = NewTree("noisy", "")
+	for i := 0; i < 6; i++ {
+		n := noisy.AddChild(noisy.RootID, fmt.Sprintf("noisy leaf %d", i), "")
+		n.LastAccessed = now - 24*3600000
+		n.Indexed = true
+	}
+	quiet = NewTree("quiet", "")
+	quiet.Root().LastAccessed = now - 6*3600000
+	for i := 0; i < 2; i++ {
+		n := quiet.AddChild(quiet.RootID, fmt.Sprintf("quiet leaf %d", i), "")
+		n.LastAccessed = now - 6*3600000
+		n.Indexed = true
+	}
+	f.AddTree(noisy)
+	f.AddTree(quiet)
+	return f, noisy, quiet
+}
+
+func TestPruneStrategiesSurvivors(t *testing.T) {
+	// Leaf strategy: the stale noisy leaves go first, both topics survive.
+	f, noisy, quiet := buildStrategyForest()
+	f.Prune(7, testParams)
+	if len(f.Trees) != 2 {
+		t.Fatalf("leaf strategy kept %d trees, want 2", len(f.Trees))
+	}
+	if noisy.NodeCount() != 4 || quiet.NodeCount() != 3 {
+		t.Errorf("leaf strategy: noisy %d nodes, quiet %d; want 4 and 3", noisy.NodeCount(), quiet.NodeCount())
+	}
+
+	// Tree strategy: the quiet tree scores lowest as a whole and is removed
+	// intact, leaving the noisy tree untouched.
+	f, noisy, _ = buildStrategyForest()
+	removed := contents(f.PruneTrees(7, testParams))
+	if len(f.Trees) != 1 || f.Trees[0] != noisy || noisy.NodeCount() != 7 {
+		t.Errorf("tree strategy should keep only the whole noisy tree, got %d trees", len(f.Trees))
+	}
+	sort.Strings(removed)
+	if fmt.Sprint(removed) != "[quiet leaf 0 quiet leaf 1]" {
+		t.Errorf("removed = %v, want only the quiet tree's indexed leaves", removed)
+	}
+}
+
+func TestPruneTreesKeepsLastTree(t *testing.T) {
+	f, noisy, _ := buildStrategyForest()
+	f.PruneTrees(3, testParams)
+	if len(f.Trees) != 1 || f.Trees[0] != noisy {
+		t.Fatal("the last unpinned tree should not be removed whole")
+	}
+	if f.NodeCount() > 3 {
+		t.Errorf("NodeCount = %d, want <= 3 after falling back to leaf pruning", f.NodeCount())
+	}
+}
+
+func TestPruneCutoff(t *testing.T) {
+	f, noisy, quiet := buildStrategyForest()
+	now := time.Now().UnixMilli()
+
+	// At capacity: the next prompt prunes the weakest non-root leaf.
+	want := math.Inf(1)
+	for _, e := range f.AllLeaves(testParams) {
+		want = math.Min(want, e.Score)
+	}
+	got := f.PruneCutoff(now, f.NodeCount(), testParams)
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("PruneCutoff at capacity = %.6f, want the min leaf score %.6f", got, want)
+	}
+
+	// Under budget nothing would be pruned.
+	if got := f.PruneCutoff(now, f.NodeCount()+1, testParams); got != NoPruneCutoff {
+		t.Errorf("PruneCutoff under budget = %v, want NoPruneCutoff", got)
+	}
+
+	// Pinned trees are never pruned, so neither sets the cutoff.
+	noisy.Pinned = true
+	if got := f.PruneCutoff(now, 0, testParams); got != quiet.Nodes[quiet.Root().ChildIDs[0]].Score(now, testParams) {
+		t.Errorf("PruneCutoff with noisy pinned = %v, want a quiet leaf's score", got)
+	}
+	quiet.Pinned = true
+	if got := f.PruneCutoff(now, 0, testParams); got != NoPruneCutoff {
+		t.Errorf("PruneCutoff with every tree pinned = %v, want NoPruneCutoff", got)
+	}
+}
+
+func TestTreeDecayOverrideResistsPruning(t *testing.T) {
+	f := NewForest()
+	stale := time.Now().UnixMilli() - 48*3600000
+	for i := 0; i < 3; i++ {
+		tree := NewTree(fmt.Sprintf("topic %d", i), "")
+		tree.Root().LastAccessed = stale
+		for j := 0; j < 4; j++ {
+			tree.AddChild(tree.RootID, fmt.Sprintf("topic %d leaf %d", i, j), "").LastAccessed = stale
+		}
+		f.AddTree(tree)
+	}
+	evergreen := f.Trees[0]
+	rate := 0.001
+	evergreen.DecayRate = &rate
+
+	var evergreenMin, siblingMax float64 = 1, 0
+	for _, e := range f.AllLeaves(testParams) {
+		if e.TreeIdx == 0 {
+			evergreenMin = math.Min(evergreenMin, e.Score)
+		} else {
+			siblingMax = math.Max(siblingMax, e.Score)
+		}
+	}
+	if evergreenMin <= siblingMax {
+		t.Errorf("AllLeaves: evergreen leaves score %.3f, siblings up to %.3f", evergreenMin, siblingMax)
+	}
+
+	// Siblings under the global rate lose every leaf before the evergreen
+	// tree loses any.
+	for budget := 14; budget >= 6; budget-- {
+		f.Prune(budget, testParams)
+		if evergreen.NodeCount() != 5 {
+			t.Fatalf("budget %d: evergreen tree pruned to %d nodes while siblings remain", budget, evergreen.NodeCount())
+		}
+	}
+	if len(f.Trees) != 1 || f.Trees[0] != evergreen {
+		t.Fatalf("want only the evergreen tree left, got %d trees", len(f.Trees))
+	}
+
+	// Clearing the override restores the global rate.
+	evergreen.DecayRate = nil
+	if p := evergreen.Params(testParams); p.DecayRate != testParams.DecayRate {
+		t.Errorf("nil override: DecayRate = %v, want %v", p.DecayRate, testParams.DecayRate)
+	}
+}
+
+func TestForestCloneIsIndependent(t *testing.T) {
+	f := NewForest()
+	tree := NewTree("auth and sessions", "p1")
+	leaf := tree.AddChild(tree.RootID, "refresh the auth token", "p2")
+	rate := 0.01
+	tree.DecayRate = &rate
+	f.AddTree(tree)
+	f.RecordBridge("a", "b")
+
+	c := f.Clone()
+	ct := c.Trees[0]
+	ct.Nodes[leaf.ID].Content = "changed"
+	ct.Nodes[leaf.ID].AddSources(5, "p3")
+	ct.Root().ChildIDs = append(ct.Root().ChildIDs, "extra")
+	ct.AddChild(ct.RootID, "log out idle sessions", "p4")
+	*ct.DecayRate = 0.5
+	c.RecordBridge("a", "b")
+	c.AddTree(NewTree("database migration", "p5"))
+
+	if leaf.Content != "refresh the auth token" || len(leaf.Sources) != 1 {
+		t.Errorf("original leaf changed: %q %v", leaf.Content, leaf.Sources)
+	}
+	if tree.NodeCount() != 2 || len(tree.Root().ChildIDs) != 1 {
+		t.Errorf("original tree changed: %d nodes, children %v", tree.NodeCount(), tree.Root().ChildIDs)
+	}
+	if *tree.DecayRate != 0.01 {
+		t.Errorf("original decay rate = %v", *tree.DecayRate)
+	}
+	if len(f.Trees) != 1 || f.Bridges[BridgeKey("a", "b")] != 1 {
+		t.Errorf("original forest changed: %d trees, bridges %v", len(f.Trees), f.Bridges)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint([]string{"jwt", "auth", "token"})
+	if a == "" || len(a) != 16 {
+		t.Fatalf("Fingerprint = %q, want 16 hex digits", a)
+	}
+	if b := Fingerprint([]string{"token", "jwt", "auth", "jwt"}); b != a {
+		t.Errorf("order or duplicates changed the fingerprint: %q vs %q", b, a)
+	}
+	if c := Fingerprint([]string{"jwt", "auth", "session"}); c == a {
+		t.Error("different terms share a fingerprint")
+	}
+	if Fingerprint(nil) != "" {
+		t.Error("no terms should have no fingerprint")
+	}
+}
+
+func TestTreeGroup(t *testing.T) {
+	tree := NewTree("root", "")
+	root := tree.Root()
+	a := tree.AddChild(root.ID, "a", "")
+	b := tree.AddChild(root.ID, "b", "")
+	c := tree.AddChild(root.ID, "c", "")
+	grand := tree.AddChild(b.ID, "b child", "")
+	a.LastAccessed, b.LastAccessed = 100, 200
+
+	group := tree.Group(root.ID, []string{a.ID, b.ID})
+	if group == nil {
+		t.Fatal("Group returned nil")
+	}
+	if want := []string{c.ID, group.ID}; !slices.Equal(root.ChildIDs, want) {
+		t.Errorf("root ChildIDs = %v, want %v", root.ChildIDs, want)
+	}
+	if !slices.Equal(group.ChildIDs, []string{a.ID, b.ID}) || a.ParentID != group.ID || b.ParentID != group.ID {
+		t.Errorf("group children = %v, want [%s %s] parented to the group", group.ChildIDs, a.ID, b.ID)
+	}
+	if group.Depth != 1 || a.Depth != 2 || grand.Depth != 3 {
+		t.Errorf("depths group/a/grandchild = %d/%d/%d, want 1/2/3", group.Depth, a.Depth, grand.Depth)
+	}
+	if group.LastAccessed != 200 {
+		t.Errorf("group LastAccessed = %d, want 200 (its most recent child)", group.LastAccessed)
+	}
+	if h := tree.Height(root.ID); h != 3 {
+		t.Errorf("Height(root) = %d, want 3", h)
+	}
+
+	if tree.Group(root.ID, []string{grand.ID}) != nil {
+		t.Error("Group accepted a node that is not a child of the parent")
+	}
+	if tree.Reparent(group.ID, grand.ID) {
+		t.Error("Reparent moved a node under its own descendant")
+	}
+}
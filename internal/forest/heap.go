@@ -5,6 +5,10 @@ type LeafEntry struct {
 	Node    *Node
 	TreeIdx int
 	Score   float64
+
+	// Tree is the owning tree. Prune keys on the pointer rather than TreeIdx
+	// because indices shift as trees are removed mid-prune.
+	Tree *Tree
 }
 
 // LeafHeap implements container/heap.Interface as a min-heap ordered by Score.
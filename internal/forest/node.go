@@ -1,9 +1,13 @@
 package forest
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"math"
-	"math/rand"
+	"slices"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,6 +31,12 @@ type Node struct {
 	// RemoveDocument — calling it on non-indexed content would decrement document
 	// frequencies for terms that were never added, corrupting IDF over time.
 	Indexed bool `json:"indexed,omitempty"`
+
+	// Tokens is the document registered in the TF-IDF engine for an indexed
+	// node, kept so it can be removed exactly as it was added even if the
+	// tokenizer has changed since. Nodes indexed before it was recorded
+	// leave it empty and are re-tokenized instead.
+	Tokens []string `json:"tokens,omitempty"`
 }
 
 // NewNode creates a node with a unique ID and initial values.
@@ -48,36 +58,105 @@ func NewNode(content string, depth int, source string) *Node {
 	}
 }
 
+// DefaultDepthPenalty is the depth coefficient in Score's depthFactor.
+const DefaultDepthPenalty = 0.15
+
+// ScoreParams holds the tunables of Score.
+type ScoreParams struct {
+	DecayRate    float64 // per-hour exponential decay of recency
+	DepthPenalty float64 // how strongly deeper nodes are devalued
+}
+
 // Score computes the survival priority for pruning.
 //
 //	score = weight × recency × depthFactor
 //
 // where:
 //
-//	weight     = log2(frequency + 1)
-//	recency    = e^(-decayRate × ageHours)
-//	depthFactor = 1 / (1 + depth × 0.15)
-func (n *Node) Score(now int64, decayRate float64) float64 {
+//	weight     = CurveWeight(curve, frequency), log2(frequency + 1) by default
+//	recency    = e^(-DecayRate × ageHours)
+//	depthFactor = 1 / (1 + depth × DepthPenalty)
+func (n *Node) Score(now int64, p ScoreParams) float64 {
+	f := n.ScoreFactors(now, p)
+	return f.Weight * f.Recency * f.DepthFactor
+}
+
+// ScoreFactors holds the terms of Score, for explaining a node's score.
+type ScoreFactors struct {
+	Weight      float64
+	Recency     float64
+	DepthFactor float64
+	AgeHours    float64 // hours since last access, the input to Recency
+}
+
+// ScoreFactors returns the factors whose product is n.Score(now, p).
+func (n *Node) ScoreFactors(now int64, p ScoreParams) ScoreFactors {
 	ageHours := float64(now-n.LastAccessed) / 3600000.0
 	if ageHours < 0 {
 		ageHours = 0
 	}
-	recency := math.Exp(-decayRate * ageHours)
-	depthFactor := 1.0 / (1.0 + float64(n.Depth)*0.15)
-	return n.Weight * recency * depthFactor
+	return ScoreFactors{
+		Weight:      n.Weight,
+		Recency:     math.Exp(-p.DecayRate * ageHours),
+		DepthFactor: 1.0 / (1.0 + float64(n.Depth)*p.DepthPenalty),
+		AgeHours:    ageHours,
+	}
+}
+
+// Weight curves for Node.Touch, mapping Frequency to Weight. Every curve
+// gives a new node, seen once, a Weight of 1.
+const (
+	WeightLog2   = "log2"   // log2(frequency + 1): repeats matter less and less
+	WeightLinear = "linear" // frequency: every repeat counts the same
+	WeightSqrt   = "sqrt"   // √frequency: overtakes log2 past 16 repeats
+)
+
+// CurveWeight returns the Weight of a node seen frequency times under the
+// named curve. An empty or unknown curve is WeightLog2.
+func CurveWeight(curve string, frequency int) float64 {
+	f := float64(frequency)
+	switch curve {
+	case WeightLinear:
+		return f
+	case WeightSqrt:
+		return math.Sqrt(f)
+	default:
+		return math.Log2(f + 1)
+	}
 }
 
-// Touch increments the frequency and updates weight and last accessed time.
-func (n *Node) Touch(maxSources int, source string) {
+// Touch increments the frequency and updates weight, with CurveWeight, and
+// last accessed time, recording source as AddSources does.
+func (n *Node) Touch(maxSources int, source, curve string) {
 	n.Frequency++
-	n.Weight = math.Log2(float64(n.Frequency) + 1)
+	n.Weight = CurveWeight(curve, n.Frequency)
 	n.LastAccessed = time.Now().UnixMilli()
-	if source != "" && maxSources > 0 {
-		n.Sources = append(n.Sources, source)
-		if len(n.Sources) > maxSources {
-			n.Sources = n.Sources[len(n.Sources)-maxSources:]
+	n.AddSources(maxSources, source)
+}
+
+// AddSources appends the non-empty sources and keeps only the newest
+// maxSources. A maxSources of zero or less records nothing.
+func (n *Node) AddSources(maxSources int, sources ...string) {
+	if maxSources <= 0 {
+		return
+	}
+	for _, s := range sources {
+		if s != "" {
+			n.Sources = append(n.Sources, s)
 		}
 	}
+	if len(n.Sources) > maxSources {
+		n.Sources = n.Sources[len(n.Sources)-maxSources:]
+	}
+}
+
+// Clone returns a deep copy of the node.
+func (n *Node) Clone() *Node {
+	c := *n
+	c.Sources = slices.Clone(n.Sources)
+	c.ChildIDs = slices.Clone(n.ChildIDs)
+	c.Tokens = slices.Clone(n.Tokens)
+	return &c
 }
 
 // IsLeaf returns true if the node has no children.
@@ -85,7 +164,17 @@ func (n *Node) IsLeaf() bool {
 	return len(n.ChildIDs) == 0
 }
 
-// generateID creates a unique ID from timestamp base36 + random suffix.
+// idCounter backs generateID if crypto/rand is unavailable.
+var idCounter atomic.Uint64
+
+// generateID creates a unique ID from timestamp base36 + 8 random hex chars.
+// The suffix comes from crypto/rand, so IDs created in the same millisecond,
+// or by separate hook processes, do not collide. IDs are opaque strings, so
+// older persisted IDs in the shorter format still load unchanged.
 func generateID(now int64) string {
-	return strconv.FormatInt(now, 36) + strconv.FormatInt(rand.Int63n(1000), 36)
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return strconv.FormatInt(now, 36) + fmt.Sprintf("%08x", idCounter.Add(1))
+	}
+	return strconv.FormatInt(now, 36) + hex.EncodeToString(buf[:])
 }
@@ -1,6 +1,12 @@
 package forest
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Tree is a rooted hierarchy of Nodes. The root holds an abstracted summary
 // of its children (via bubble-up). Leaf nodes hold actual prompt text.
@@ -11,6 +17,32 @@ type Tree struct {
 	Nodes        map[string]*Node `json:"nodes"`
 	Created      int64            `json:"created"`
 	LastAccessed int64            `json:"lastAccessed"`
+
+	// Pinned trees are never pruned, neither leaf by leaf nor as a whole.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// DecayRate overrides the global decay rate when scoring this tree's
+	// nodes, so an evergreen topic can fade slower than ephemeral ones. Nil
+	// uses the global rate.
+	DecayRate *float64 `json:"decayRate,omitempty"`
+
+	// Fingerprint identifies the tree's topic by its top terms (see
+	// Fingerprint), so the same topic can be recognized across trees with
+	// different IDs, such as before and after a reset. Empty until the
+	// gate computes it.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Fingerprint returns a stable identifier for a set of terms: the first 16
+// hex digits of the SHA-256 of the sorted, de-duplicated terms. The order of
+// terms doesn't matter. It returns "" for no terms.
+func Fingerprint(terms []string) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	sorted := slices.Compact(slices.Sorted(slices.Values(terms)))
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\x00")))
+	return hex.EncodeToString(sum[:8])
 }
 
 // NewTree creates a tree with a single root node containing the given content.
@@ -26,15 +58,26 @@ func NewTree(content string, source string) *Tree {
 	}
 }
 
+// Params returns p with the tree's DecayRate override applied, if any.
+// Every score of a node in t should use these parameters.
+func (t *Tree) Params(p ScoreParams) ScoreParams {
+	if t.DecayRate != nil {
+		p.DecayRate = *t.DecayRate
+	}
+	return p
+}
+
 // Root returns the root node of the tree.
 func (t *Tree) Root() *Node {
 	return t.Nodes[t.RootID]
 }
 
 // AddChild creates a new child node under the given parent and returns it.
+// It returns nil, adding nothing, if the parent does not exist or content is
+// blank: an empty node has no vector and would only be a dead leaf.
 func (t *Tree) AddChild(parentID string, content string, source string) *Node {
 	parent := t.Nodes[parentID]
-	if parent == nil {
+	if parent == nil || strings.TrimSpace(content) == "" {
 		return nil
 	}
 	child := NewNode(content, parent.Depth+1, source)
@@ -45,6 +88,112 @@ func (t *Tree) AddChild(parentID string, content string, source string) *Node {
 	return child
 }
 
+// Reparent moves the node id, with its descendants, under parentID, shifting
+// their depths to match. It returns false, changing nothing, if either node
+// is missing, id is the root, or parentID is id or one of its descendants.
+func (t *Tree) Reparent(id, parentID string) bool {
+	node, parent := t.Nodes[id], t.Nodes[parentID]
+	if node == nil || parent == nil || node.ParentID == "" {
+		return false
+	}
+	for _, a := range append(t.Ancestors(parentID), parent) {
+		if a.ID == id {
+			return false
+		}
+	}
+
+	if old := t.Nodes[node.ParentID]; old != nil {
+		old.ChildIDs = slices.DeleteFunc(old.ChildIDs, func(cid string) bool { return cid == id })
+	}
+	node.ParentID = parentID
+	parent.ChildIDs = append(parent.ChildIDs, id)
+
+	shift := parent.Depth + 1 - node.Depth
+	stack := []string{id}
+	for len(stack) > 0 {
+		n := t.Nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if n != nil {
+			n.Depth += shift
+			stack = append(stack, n.ChildIDs...)
+		}
+	}
+	return true
+}
+
+// Group inserts a new interior node under parentID and moves the children
+// ids, which must be children of parentID, beneath it. The node's content is
+// left empty for bubble-up to fill in, and it takes the most recent access
+// time of the nodes it groups. It returns nil, changing nothing, if the
+// parent is missing or any id is not its child.
+func (t *Tree) Group(parentID string, ids []string) *Node {
+	parent := t.Nodes[parentID]
+	if parent == nil {
+		return nil
+	}
+	for _, id := range ids {
+		if !slices.Contains(parent.ChildIDs, id) {
+			return nil
+		}
+	}
+
+	group := NewNode("", parent.Depth+1, "")
+	group.ParentID = parentID
+	group.LastAccessed = 0
+	parent.ChildIDs = append(parent.ChildIDs, group.ID)
+	t.Nodes[group.ID] = group
+	for _, id := range ids {
+		t.Reparent(id, group.ID)
+		group.LastAccessed = max(group.LastAccessed, t.Nodes[id].LastAccessed)
+	}
+	return group
+}
+
+// Graft moves the node id, with its descendants, out of src and under
+// parentID in t, shifting their depths to match. Grafting src's root empties
+// src. It returns false, changing nothing, if id or parentID is missing or t
+// is src.
+func (t *Tree) Graft(src *Tree, id, parentID string) bool {
+	node, parent := src.Nodes[id], t.Nodes[parentID]
+	if t == src || node == nil || parent == nil {
+		return false
+	}
+	if old := src.Nodes[node.ParentID]; old != nil {
+		old.ChildIDs = slices.DeleteFunc(old.ChildIDs, func(cid string) bool { return cid == id })
+	}
+	node.ParentID = parentID
+	parent.ChildIDs = append(parent.ChildIDs, id)
+
+	shift := parent.Depth + 1 - node.Depth
+	stack := []string{id}
+	for len(stack) > 0 {
+		n := src.Nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
+		delete(src.Nodes, n.ID)
+		t.Nodes[n.ID] = n
+		n.Depth += shift
+		stack = append(stack, n.ChildIDs...)
+	}
+	return true
+}
+
+// Height returns how many levels lie below the node id: 0 for a leaf or a
+// missing node.
+func (t *Tree) Height(id string) int {
+	n := t.Nodes[id]
+	if n == nil {
+		return 0
+	}
+	h := 0
+	for _, cid := range n.ChildIDs {
+		h = max(h, t.Height(cid)+1)
+	}
+	return h
+}
+
 // RemoveNode removes a node and all its descendants using iterative DFS.
 // It also cleans up the parent's childIds reference.
 func (t *Tree) RemoveNode(id string) {
@@ -79,6 +228,28 @@ func (t *Tree) RemoveNode(id string) {
 	}
 }
 
+// Ancestors returns the nodes from the root down to the parent of id, or nil
+// for the root or an unknown node.
+func (t *Tree) Ancestors(id string) []*Node {
+	node := t.Nodes[id]
+	if node == nil {
+		return nil
+	}
+	var chain []*Node
+	for pid := node.ParentID; pid != ""; {
+		parent := t.Nodes[pid]
+		if parent == nil {
+			break
+		}
+		chain = append(chain, parent)
+		pid = parent.ParentID
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
 // GetLeaves returns all leaf nodes (nodes with no children).
 func (t *Tree) GetLeaves() []*Node {
 	var leaves []*Node
@@ -105,6 +276,20 @@ func (t *Tree) GetChildren(nodeID string) []*Node {
 	return children
 }
 
+// Clone returns a deep copy of the tree.
+func (t *Tree) Clone() *Tree {
+	c := *t
+	c.Nodes = make(map[string]*Node, len(t.Nodes))
+	for id, n := range t.Nodes {
+		c.Nodes[id] = n.Clone()
+	}
+	if t.DecayRate != nil {
+		rate := *t.DecayRate
+		c.DecayRate = &rate
+	}
+	return &c
+}
+
 // NodeCount returns the total number of nodes in this tree.
 func (t *Tree) NodeCount() int {
 	return len(t.Nodes)
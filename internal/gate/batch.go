@@ -0,0 +1,65 @@
+package gate
+
+import "fmt"
+
+// BatchResult reports what ProcessBatch did with one prompt. Skipped prompts
+// were empty after cleaning or contained only stop words; Action and TreeID
+// are empty for them.
+type BatchResult struct {
+	Prompt  string `json:"prompt"`
+	Action  string `json:"action,omitempty"`
+	TreeID  string `json:"treeId,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// ProcessBatch runs raw prompts through ProcessPrompt in order, cleaning each
+// with CleanPrompt first as the hook path does. Because one gate handles
+// every prompt, Markov transitions chain from each prompt to the next exactly
+// as they would across separate hook invocations. It returns the context
+// block after the last processed prompt (empty if all were skipped) and one
+// result per input prompt. LastJournal describes only the last prompt.
+func (g *Gate) ProcessBatch(prompts []string) (string, []BatchResult) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ctx := ""
+	results := make([]BatchResult, len(prompts))
+	for i, raw := range prompts {
+		prompt := g.tokenizer.CleanPrompt(raw)
+		results[i].Prompt = prompt
+		if prompt == "" {
+			results[i].Skipped = true
+			continue
+		}
+		out := g.processPrompt(prompt, fmt.Sprintf("p%d", g.Forest.Meta.TotalPrompts))
+		if out == "" {
+			results[i].Skipped = true
+			continue
+		}
+		ctx = out
+		results[i].Action = g.LastJournal.Action
+		results[i].TreeID = g.LastJournal.TreeID
+	}
+	return ctx, results
+}
+
+// Clone returns a gate over deep copies of g's forest, engine and chain, so
+// prompts processed through it leave g untouched. Cached vectors carry over;
+// metrics, the journal and pruned trees do not.
+func (g *Gate) Clone() *Gate {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := NewWithChain(g.Forest.Clone(), g.Engine.Clone(), g.Chain.Clone(), g.Config)
+	for id, v := range g.vecCache {
+		c.vecCache[id] = v
+	}
+	return c
+}
+
+// Simulate runs prompts through ProcessBatch on a clone of g and returns the
+// clone, holding the state the prompts would produce, with the per-prompt
+// results. g itself is not modified.
+func (g *Gate) Simulate(prompts []string) (*Gate, []BatchResult) {
+	sim := g.Clone()
+	_, results := sim.ProcessBatch(prompts)
+	return sim, results
+}
@@ -0,0 +1,92 @@
+package gate
+
+import (
+	"math"
+	"sort"
+)
+
+// Spread summarizes a set of similarity scores.
+type Spread struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+}
+
+// Calibration compares how similar leaves are to their own tree's root
+// (Intra) with how similar they are to the roots of other trees (Inter), and
+// suggests thresholds that separate the two: Extend at the intra-topic
+// median, Branch at the inter-topic 90th percentile. Scores use the
+// configured metric. Suggestions are zero when either side has no samples.
+type Calibration struct {
+	Metric string  `json:"metric"`
+	Intra  Spread  `json:"intra"`
+	Inter  Spread  `json:"inter"`
+	Extend float64 `json:"extend"`
+	Branch float64 `json:"branch"`
+}
+
+// Calibrate scores every leaf below a root against every tree root in the
+// forest. A single-node tree contributes only as a root. Nothing is mutated
+// beyond the vector cache.
+func (g *Gate) Calibrate() Calibration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var intra, inter []float64
+	for _, tree := range g.Forest.Trees {
+		for _, leaf := range tree.GetLeaves() {
+			if leaf.ID == tree.RootID {
+				continue
+			}
+			leafVec := g.nodeVec(leaf.ID, leaf.Content)
+			for _, other := range g.Forest.Trees {
+				root := other.Root()
+				if root == nil {
+					continue
+				}
+				sim := g.similarity(leafVec, g.nodeVec(root.ID, root.Content))
+				if other == tree {
+					intra = append(intra, sim)
+				} else {
+					inter = append(inter, sim)
+				}
+			}
+		}
+	}
+
+	c := Calibration{
+		Metric: g.Config.metric(),
+		Intra:  spreadOf(intra),
+		Inter:  spreadOf(inter),
+	}
+	if c.Intra.Count > 0 && c.Inter.Count > 0 {
+		c.Extend = c.Intra.Median
+		c.Branch = c.Inter.P90
+	}
+	return c
+}
+
+// spreadOf sorts scores in place and summarizes them.
+func spreadOf(scores []float64) Spread {
+	if len(scores) == 0 {
+		return Spread{}
+	}
+	sort.Float64s(scores)
+	return Spread{
+		Count:  len(scores),
+		Min:    scores[0],
+		Median: percentile(scores, 0.5),
+		P90:    percentile(scores, 0.9),
+		Max:    scores[len(scores)-1],
+	}
+}
+
+// percentile returns the q-th quantile (0–1) of sorted, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
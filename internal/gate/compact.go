@@ -0,0 +1,92 @@
+package gate
+
+import (
+	"sort"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// Compact merges sibling leaves of tree whose cosine similarity reaches
+// Config.CompactThreshold, so near-duplicate prompts stop taking a memory
+// slot each. Siblings are compared in creation order and each leaf folds
+// into the first earlier sibling it matches: frequencies are summed, sources
+// unioned (keeping the newest MaxSourcesPerNode), and the later LastAccessed
+// kept. The absorbed leaf is removed from the tree and, if indexed, from the
+// TF-IDF corpus, and the tree's abstractions are regenerated. Returns the
+// number of leaves removed.
+func (g *Gate) Compact(tree *forest.Tree) int {
+	threshold := g.Config.CompactThreshold
+	if threshold <= 0 {
+		return 0
+	}
+
+	var parents []*forest.Node
+	for _, n := range tree.Nodes {
+		if !n.IsLeaf() {
+			parents = append(parents, n)
+		}
+	}
+	sort.Slice(parents, func(i, j int) bool { return parents[i].ID < parents[j].ID })
+
+	var absorbed []*forest.Node
+	for _, parent := range parents {
+		var kept []*forest.Node
+		for _, id := range parent.ChildIDs {
+			leaf := tree.Nodes[id]
+			if leaf == nil || !leaf.IsLeaf() {
+				continue
+			}
+			vec := g.nodeVec(leaf.ID, leaf.Content)
+			var into *forest.Node
+			for _, k := range kept {
+				if tfidf.CosineSimilarity(vec, g.nodeVec(k.ID, k.Content)) >= threshold {
+					into = k
+					break
+				}
+			}
+			if into == nil {
+				kept = append(kept, leaf)
+				continue
+			}
+			g.merge(into, leaf)
+			absorbed = append(absorbed, leaf)
+		}
+	}
+	if len(absorbed) == 0 {
+		return 0
+	}
+
+	for _, n := range absorbed {
+		if n.Indexed {
+			g.Engine.RemoveDocument(g.docTokens(n))
+		}
+		tree.RemoveNode(n.ID)
+	}
+	g.bubbleUp(tree, tree.RootID)
+	// RemoveDocument shifts IDF, so cached vectors are stale.
+	g.vecCache = make(map[string]cachedVec)
+	return len(absorbed)
+}
+
+// merge folds leaf's usage into into.
+func (g *Gate) merge(into, leaf *forest.Node) {
+	into.Frequency += leaf.Frequency
+	into.Weight = forest.CurveWeight(g.Config.WeightCurve, into.Frequency)
+	if leaf.LastAccessed > into.LastAccessed {
+		into.LastAccessed = leaf.LastAccessed
+	}
+
+	seen := make(map[string]bool, len(into.Sources))
+	for _, s := range into.Sources {
+		seen[s] = true
+	}
+	var fresh []string
+	for _, s := range leaf.Sources {
+		if !seen[s] {
+			seen[s] = true
+			fresh = append(fresh, s)
+		}
+	}
+	into.AddSources(g.Config.MaxSourcesPerNode, fresh...)
+}
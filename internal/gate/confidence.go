@@ -0,0 +1,75 @@
+package gate
+
+// Confidence labels, from ConfidenceLabel.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// ConfidenceLabel buckets a 0–1 confidence into high (>= 0.6), medium
+// (>= 0.3) or low.
+func ConfidenceLabel(c float64) string {
+	switch {
+	case c >= 0.6:
+		return ConfidenceHigh
+	case c >= 0.3:
+		return ConfidenceMedium
+	default:
+		return ConfidenceLow
+	}
+}
+
+// confidence rates how decisive a classification was, from 0 to 1. It is
+// the margin between score and the nearest threshold, normalized by the
+// width of the action's band: [ExtendThreshold, 1] for extend, half of
+// [BranchThreshold, ExtendThreshold) for branch (whichever edge is closer),
+// and [0, BranchThreshold) for new. For extend and branch, a rival tree
+// scoring close behind makes the choice of tree uncertain too, so the margin
+// is scaled by the lead over rival, measured in units of the gap between the
+// two thresholds.
+func (g *Gate) confidence(action Action, score, rival float64) float64 {
+	ext, br := g.Config.ExtendThreshold, g.Config.BranchThreshold
+
+	var margin float64
+	switch action {
+	case ActionExtend:
+		margin = ratio(score-ext, 1-ext)
+	case ActionBranch:
+		margin = ratio(min(score-br, ext-score), (ext-br)/2)
+	default:
+		return ratio(br-score, br)
+	}
+
+	unit := ext - br
+	if unit <= 0 {
+		unit = ext
+	}
+	return margin * ratio(score-rival, unit)
+}
+
+// rivalScore returns the best score among trees other than best.
+func rivalScore(treeBest []float64, best int) float64 {
+	rival := 0.0
+	for i, s := range treeBest {
+		if i != best && s > rival {
+			rival = s
+		}
+	}
+	return rival
+}
+
+// ratio returns num/den clamped to [0, 1], or 1 when den is not positive.
+func ratio(num, den float64) float64 {
+	if den <= 0 {
+		return 1
+	}
+	r := num / den
+	if r < 0 {
+		return 0
+	}
+	if r > 1 {
+		return 1
+	}
+	return r
+}
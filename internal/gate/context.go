@@ -0,0 +1,228 @@
+package gate
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ContextTree is one ranked topic in the context summary. Score is the root's
+// decay score times the Markov transition boost; Leaves are the most recently
+// accessed leaves, newest first, with their full content.
+type ContextTree struct {
+	TreeID string   `json:"treeId"`
+	Score  float64  `json:"score"`
+	Root   string   `json:"root"`
+	Leaves []string `json:"leaves,omitempty"`
+}
+
+// ContextPrediction is a likely next topic from the Markov chain. Name is the
+// tree's root content, or empty if the topic is no longer in the forest.
+type ContextPrediction struct {
+	TopicID     string  `json:"topicId"`
+	Name        string  `json:"name,omitempty"`
+	Probability float64 `json:"probability"`
+}
+
+// ContextSummary is the structured form of the context block. GenerateContext
+// renders it as text and GenerateContextJSON marshals it, so both outputs
+// always agree on ranking and predictions.
+type ContextSummary struct {
+	TotalPrompts int                 `json:"totalPrompts"`
+	NodeCount    int                 `json:"nodeCount"`
+	MemorySize   int                 `json:"memorySize"`
+	TreeCount    int                 `json:"treeCount"`
+	Trees        []ContextTree       `json:"trees"`
+	Next         []ContextPrediction `json:"next,omitempty"`
+
+	// Path is the most likely sequence of next topics, in order, when
+	// PredictPathDepth is set. Each probability is that of the step from
+	// the topic before it.
+	Path []ContextPrediction `json:"path,omitempty"`
+}
+
+// normalize replaces each tree's score with its focus intensity.
+func (s *ContextSummary) normalize() {
+	scores := make([]float64, len(s.Trees))
+	for i, ct := range s.Trees {
+		scores[i] = ct.Score
+	}
+	for i, v := range NormalizeScores(scores) {
+		s.Trees[i].Score = v
+	}
+}
+
+// GenerateContextJSON returns the context summary as JSON, for tooling that
+// wants focus state without scraping the text block.
+func (g *Gate) GenerateContextJSON() ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return json.MarshalIndent(g.contextSummary(), "", "  ")
+}
+
+// prediction names a predicted topic after its tree's root, if the tree is
+// still in the forest.
+func (g *Gate) prediction(topicID string, probability float64) ContextPrediction {
+	p := ContextPrediction{TopicID: topicID, Probability: probability}
+	if tree := g.Forest.TreeByID(topicID); tree != nil && tree.Root() != nil {
+		p.Name = tree.Root().Content
+	}
+	return p
+}
+
+// Topic is one tree as ranked for the context block. Index is its position
+// in Forest.Trees, as --inspect numbers trees.
+type Topic struct {
+	Index        int     `json:"index"`
+	TreeID       string  `json:"treeId"`
+	Root         string  `json:"root"`
+	Nodes        int     `json:"nodes"`
+	Score        float64 `json:"score"`
+	LastAccessed int64   `json:"lastAccessed"`
+	Pinned       bool    `json:"pinned,omitempty"`
+	Fingerprint  string  `json:"fingerprint,omitempty"`
+
+	// Intensity is Score as a 0–100 share of the top topic's score (see
+	// NormalizeScores), for human views.
+	Intensity float64 `json:"intensity"`
+}
+
+// Topics ranks every tree by its root's decay score at now, boosted by the
+// Markov transition probability from the current topic, highest first. This
+// is the order the context block lists topics in; ties keep forest order.
+func (g *Gate) Topics(now int64) []Topic {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.topics(now)
+}
+
+// topics is Topics without the lock.
+func (g *Gate) topics(now int64) []Topic {
+	topics := make([]Topic, 0, len(g.Forest.Trees))
+	alpha := g.transitionBoost()
+	for i, t := range g.Forest.Trees {
+		root := t.Root()
+		if root == nil {
+			continue
+		}
+		score := root.Score(now, t.Params(g.Config.ScoreParams()))
+		// Boost by transition probability from current topic
+		if alpha > 0 && g.Chain.LastTopic != "" {
+			score *= 1 + alpha*g.transitionProb(t.ID)
+		}
+		// Touches such as guide reinforcement don't update the tree's own
+		// timestamp, so take the most recent of any node.
+		last := t.LastAccessed
+		for _, n := range t.Nodes {
+			last = max(last, n.LastAccessed)
+		}
+		topics = append(topics, Topic{
+			Index:        i,
+			TreeID:       t.ID,
+			Root:         root.Content,
+			Nodes:        t.NodeCount(),
+			Score:        score,
+			LastAccessed: last,
+			Pinned:       t.Pinned,
+			Fingerprint:  t.Fingerprint,
+		})
+	}
+	sort.SliceStable(topics, func(i, j int) bool {
+		return topics[i].Score > topics[j].Score
+	})
+	scores := make([]float64, len(topics))
+	for i, t := range topics {
+		scores[i] = t.Score
+	}
+	for i, v := range NormalizeScores(scores) {
+		topics[i].Intensity = v
+	}
+	return topics
+}
+
+// NormalizeScores maps scores to a 0–100 "focus intensity" relative to the
+// highest: the top score becomes 100 and one half as high becomes 50, so a
+// single score is always 100. Raw scores have no fixed upper bound once the
+// Markov boost is applied. If no score is positive, all are 0.
+func NormalizeScores(scores []float64) []float64 {
+	top := 0.0
+	for _, s := range scores {
+		top = max(top, s)
+	}
+	out := make([]float64, len(scores))
+	if top <= 0 {
+		return out
+	}
+	for i, s := range scores {
+		out[i] = 100 * s / top
+	}
+	return out
+}
+
+// contextSummary ranks trees by root score with the Markov transition boost,
+// keeps the top 5 with up to 3 recent leaves each, and adds up to
+// Config.PredictCount next-topic predictions when the strongest transition is
+// at least Config.PredictThreshold likely.
+func (g *Gate) contextSummary() ContextSummary {
+	sum := ContextSummary{
+		TotalPrompts: g.Forest.Meta.TotalPrompts,
+		NodeCount:    g.Forest.NodeCount(),
+		MemorySize:   g.Config.MemorySize,
+		TreeCount:    len(g.Forest.Trees),
+		Trees:        []ContextTree{},
+	}
+
+	// Sort trees by root score descending, with Markov transition boost
+	topics := g.topics(time.Now().UnixMilli())
+	scored := make([]ContextTree, 0, len(topics))
+	for _, t := range topics {
+		scored = append(scored, ContextTree{TreeID: t.TreeID, Score: t.Score, Root: t.Root})
+	}
+
+	// Limit to top 5 trees
+	if len(scored) > 5 {
+		scored = scored[:5]
+	}
+
+	for i := range scored {
+		tree := g.Forest.TreeByID(scored[i].TreeID)
+
+		// Show up to 3 recent leaves
+		leaves := tree.GetLeaves()
+		sort.Slice(leaves, func(i, j int) bool {
+			return leaves[i].LastAccessed > leaves[j].LastAccessed
+		})
+		if len(leaves) > 3 {
+			leaves = leaves[:3]
+		}
+		for _, leaf := range leaves {
+			if leaf.ID == tree.RootID {
+				continue // Don't re-show root
+			}
+			scored[i].Leaves = append(scored[i].Leaves, leaf.Content)
+		}
+	}
+	sum.Trees = scored
+
+	// Predictions: likely next topics if transition data exists
+	if g.Config.MarkovEnabled && g.Chain.LastTopic != "" && g.Config.PredictCount > 0 {
+		top := g.topTransitions(g.Config.PredictCount)
+		if len(top) > 0 && top[0].Probability >= g.Config.PredictThreshold {
+			for _, t := range top {
+				sum.Next = append(sum.Next, g.prediction(t.TopicID, t.Probability))
+			}
+		}
+	}
+	if g.Config.MarkovEnabled && g.Chain.LastTopic != "" && g.Config.PredictPathDepth >= 2 {
+		path := g.Chain.MostLikelyPath(g.Chain.LastTopic, g.Config.PredictPathDepth)
+		from := g.Chain.LastTopic
+		if len(path) >= 2 && g.Chain.Probability(from, path[0]) >= g.Config.PredictThreshold {
+			for _, id := range path {
+				sum.Path = append(sum.Path, g.prediction(id, g.Chain.Probability(from, id)))
+				from = id
+			}
+		}
+	}
+
+	return sum
+}
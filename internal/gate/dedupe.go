@@ -0,0 +1,88 @@
+package gate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+)
+
+// DedupeTrees merges every tree that duplicates an earlier one into it with
+// MergeTrees. Two identical prompts far enough apart for IDF to shift can
+// each start a tree; trees count as duplicates only when their root content
+// is the same up to case and spacing, or their fingerprints (top terms) are,
+// so merely similar topics are left alone. Returns the number of trees
+// removed.
+func (g *Gate) DedupeTrees() int {
+	removed := 0
+	for i := 0; i < len(g.Forest.Trees); i++ {
+		for j := len(g.Forest.Trees) - 1; j > i; j-- {
+			if duplicateTrees(g.Forest.Trees[i], g.Forest.Trees[j]) && g.MergeTrees(i, j) == nil {
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// duplicateTrees reports whether a and b hold the same topic.
+func duplicateTrees(a, b *forest.Tree) bool {
+	ra, rb := a.Root(), b.Root()
+	if ra == nil || rb == nil {
+		return false
+	}
+	if a.Fingerprint != "" && a.Fingerprint == b.Fingerprint {
+		return true
+	}
+	norm := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	return norm(ra.Content) != "" && norm(ra.Content) == norm(rb.Content)
+}
+
+// MergeTrees folds the tree at index from into the tree at index into and
+// removes it from the forest. Two single-prompt trees become one node, as
+// Compact merges leaves, and the absorbed prompt leaves the TF-IDF corpus.
+// Otherwise from's root prompt, or the subtrees under its root abstraction,
+// move under into's root keeping their node IDs, and into's abstractions are
+// regenerated. Markov transitions and bridges involving from move to into,
+// and into stays pinned if either tree was.
+func (g *Gate) MergeTrees(into, from int) error {
+	n := len(g.Forest.Trees)
+	if into < 0 || into >= n || from < 0 || from >= n || into == from {
+		return fmt.Errorf("cannot merge tree %d into tree %d", from, into)
+	}
+	dst, src := g.Forest.Trees[into], g.Forest.Trees[from]
+	dstRoot, srcRoot := dst.Root(), src.Root()
+	if dstRoot == nil || srcRoot == nil {
+		return fmt.Errorf("cannot merge tree %s into tree %s: missing root", src.ID, dst.ID)
+	}
+
+	if dstRoot.IsLeaf() && srcRoot.IsLeaf() {
+		g.merge(dstRoot, srcRoot)
+		if srcRoot.Indexed {
+			g.Engine.RemoveDocument(g.docTokens(srcRoot))
+		}
+	} else {
+		g.preserveRoot(dst)
+		if srcRoot.IsLeaf() {
+			dst.Graft(src, srcRoot.ID, dst.RootID)
+		} else {
+			if srcRoot.Indexed {
+				g.Engine.RemoveDocument(g.docTokens(srcRoot))
+			}
+			for _, id := range slices.Clone(srcRoot.ChildIDs) {
+				dst.Graft(src, id, dst.RootID)
+			}
+		}
+		g.bubbleUp(dst, dst.RootID)
+	}
+	dst.Pinned = dst.Pinned || src.Pinned
+	dst.LastAccessed = max(dst.LastAccessed, src.LastAccessed)
+
+	g.Forest.RemoveTree(from)
+	g.Forest.MergeBridges(src.ID, dst.ID)
+	g.Chain.MergeTopic(src.ID, dst.ID)
+	// The corpus and abstractions changed, so cached vectors can be stale.
+	g.vecCache = make(map[string]cachedVec)
+	return nil
+}
@@ -0,0 +1,85 @@
+package gate
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/text"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// digestTrees is how many of the highest-ranked trees Digest draws on, the
+// same number the context block lists.
+const digestTrees = 5
+
+// DigestPrefix starts every non-empty Digest.
+const DigestPrefix = "You've been working on: "
+
+// Digest summarizes current focus as one line listing the maxTerms terms
+// that weigh most across the highest-ranked trees. Returns "" for an empty
+// forest or a maxTerms <= 0.
+func (g *Gate) Digest(maxTerms int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	terms := g.digestTerms(maxTerms)
+	if len(terms) == 0 {
+		return ""
+	}
+	words := make([]string, len(terms))
+	for i, t := range terms {
+		words[i] = t.Word
+	}
+	return DigestPrefix + strings.Join(words, ", ")
+}
+
+// DigestTerms returns the terms behind Digest, heaviest first. Each of the
+// top trees, ranked as Topics ranks them, contributes the TF-IDF vectors of
+// its leaves scaled by its score, so a term weighs more the more prompts use
+// it and the more active their topics are. Bigrams are left out; ties keep
+// the alphabetically first term.
+func (g *Gate) DigestTerms(maxTerms int) []tfidf.Term {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.digestTerms(maxTerms)
+}
+
+// digestTerms is DigestTerms without the lock.
+func (g *Gate) digestTerms(maxTerms int) []tfidf.Term {
+	if maxTerms <= 0 {
+		return nil
+	}
+	topics := g.topics(time.Now().UnixMilli())
+	if len(topics) > digestTrees {
+		topics = topics[:digestTrees]
+	}
+
+	weights := make(map[string]float64)
+	for _, t := range topics {
+		if t.Score <= 0 {
+			continue
+		}
+		for _, leaf := range g.Forest.Trees[t.Index].GetLeaves() {
+			for _, term := range g.nodeVec(leaf.ID, leaf.Content) {
+				if !text.IsBigram(term.Word) {
+					weights[term.Word] += term.Weight * t.Score
+				}
+			}
+		}
+	}
+
+	terms := make([]tfidf.Term, 0, len(weights))
+	for w, wt := range weights {
+		terms = append(terms, tfidf.Term{Word: w, Weight: wt})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Word < terms[j].Word
+	})
+	if len(terms) > maxTerms {
+		terms = terms[:maxTerms]
+	}
+	return terms
+}
@@ -1,7 +1,6 @@
 package gate
 
 import (
-	"github.com/kuandriy/focus-gate/internal/text"
 	"github.com/kuandriy/focus-gate/internal/tfidf"
 )
 
@@ -12,20 +11,34 @@ type VectorTerm struct {
 	Weight float64 `json:"weight"`
 }
 
-// LeafScore holds per-leaf cosine similarity details. Cosine is the raw
-// dot-product score; Boosted is after applying the multiplicative Markov factor.
+// TermContribution is one shared term's share of a cosine score: the
+// product of its weights in the prompt and node vectors, before the division
+// by both norms. It mirrors tfidf.Contribution with JSON-friendly names.
+type TermContribution struct {
+	Term    string  `json:"term"`
+	Product float64 `json:"product"`
+}
+
+// LeafScore holds per-leaf similarity details. Cosine is the raw score in
+// the configured metric (cosine unless Config.SimilarityMetric says
+// otherwise); Boosted is after applying the Markov boost.
+// Contributions lists the shared terms behind Cosine, largest first. It is
+// only filled under the cosine metric, where the products sum to the score
+// before normalization; Jaccard and Dice scores have no per-term split.
 type LeafScore struct {
-	LeafID  string  `json:"leafId"`
-	Content string  `json:"content"`
-	Cosine  float64 `json:"cosine"`
-	Boosted float64 `json:"boosted"`
+	LeafID        string             `json:"leafId"`
+	Content       string             `json:"content"`
+	Cosine        float64            `json:"cosine"`
+	Boosted       float64            `json:"boosted"`
+	Contributions []TermContribution `json:"contributions,omitempty"`
 }
 
 // TreeScore holds per-tree classification scoring details. For each tree we
-// compute the raw cosine similarity between the prompt vector and the root
-// vector, then multiply by the Markov transition boost factor. Leaf scores
-// follow the same formula. The classifier picks the single highest boosted
-// score across all roots and leaves.
+// compute the raw similarity, in the configured metric, between the prompt
+// vector and the root vector, then apply the Markov transition boost:
+// multiply by BoostFactor, or in additive mode add it. Leaf scores follow
+// the same formula. The classifier picks the single highest boosted score
+// across all roots and leaves.
 type TreeScore struct {
 	TreeIdx     int         `json:"treeIdx"`
 	TreeID      string      `json:"treeId"`
@@ -34,13 +47,18 @@ type TreeScore struct {
 	RootCosine  float64     `json:"rootCosine"`
 	RootBoosted float64     `json:"rootBoosted"`
 	BoostFactor float64     `json:"boostFactor"`
+	Pinned      bool        `json:"pinned,omitempty"`
 	LeafScores  []LeafScore `json:"leafScores,omitempty"`
+
+	// RootContributions lists the shared terms behind RootCosine, like
+	// LeafScore.Contributions, and only under the cosine metric.
+	RootContributions []TermContribution `json:"rootContributions,omitempty"`
 }
 
 // DryRunResult contains the full classification trace for a prompt. All scoring
 // is computed exactly as ProcessPrompt would — same tokenization, same TF-IDF
-// vectors, same multiplicative Markov boost — but no state is mutated. This
-// lets the user verify the classifier's behaviour before committing a prompt.
+// vectors, same Markov boost — but no state is mutated. This lets the user
+// verify the classifier's behaviour before committing a prompt.
 type DryRunResult struct {
 	Prompt     string       `json:"prompt"`
 	Tokens     []string     `json:"tokens"`
@@ -50,17 +68,39 @@ type DryRunResult struct {
 	BestScore  float64      `json:"bestScore"`
 	BestTree   int          `json:"bestTree"`
 	BestLeaf   string       `json:"bestLeaf,omitempty"`
+
+	// SecondTree is a runner-up tree close enough to BestScore that the
+	// prompt bridges two topics (see Config.MergeDelta), or -1.
+	SecondTree  int     `json:"secondTree"`
+	SecondScore float64 `json:"secondScore,omitempty"`
+
+	// Confidence is Classification.Confidence for this prompt.
+	Confidence float64 `json:"confidence"`
+
+	// Jaccard is Classification.Jaccard: non-zero when the Jaccard fallback
+	// turned a new topic into a branch.
+	Jaccard float64 `json:"jaccard,omitempty"`
+
+	// Metric is the similarity metric behind every Cosine and RootCosine
+	// score: tfidf.MetricCosine, MetricJaccard or MetricDice.
+	Metric string `json:"metric"`
+
+	// BoostMode is how each TreeScore.BoostFactor was applied:
+	// BoostMultiplicative or BoostAdditive.
+	BoostMode string `json:"boostMode"`
 }
 
 // DryRun classifies a prompt against the current forest state and returns
 // detailed per-tree scoring without mutating any state. This mirrors the
-// classify() logic exactly — same cosine similarity, same multiplicative
-// Markov boost — so the result accurately predicts what ProcessPrompt would do.
+// classify() logic exactly — same similarity metric, same Markov boost — so
+// the result accurately predicts what ProcessPrompt would do.
 //
 // The caller should apply text.CleanPrompt before passing the prompt here,
 // matching the pre-processing that handlePrompt performs in the hook path.
 func (g *Gate) DryRun(prompt string) DryRunResult {
-	tokens := text.Tokenize(prompt)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tokens := g.Tokenize(prompt)
 	vec := g.Engine.VectorizeTokens(tokens)
 
 	// Convert the TF-IDF vector to a display-friendly format.
@@ -70,19 +110,28 @@ func (g *Gate) DryRun(prompt string) DryRunResult {
 	}
 
 	result := DryRunResult{
-		Prompt: prompt,
-		Tokens: tokens,
-		Vector: vecTerms,
+		Prompt:     prompt,
+		Tokens:     tokens,
+		Vector:     vecTerms,
+		SecondTree: -1,
+		Metric:     g.Config.metric(),
+		BoostMode:  BoostMultiplicative,
+	}
+	if g.Config.BoostMode == BoostAdditive {
+		result.BoostMode = BoostAdditive
 	}
 
-	// Empty forest or empty vector → automatic ActionNew.
-	if len(g.Forest.Trees) == 0 || vec == nil {
+	// Empty forest, or empty vector with no Jaccard fallback → automatic
+	// ActionNew.
+	if len(g.Forest.Trees) == 0 || (vec == nil && g.Config.JaccardFallback <= 0) {
 		result.BestAction = ActionNew.String()
+		result.Confidence = 1
 		return result
 	}
 
 	best := Classification{Action: ActionNew, Score: 0}
-	alpha := g.Config.TransitionBoost
+	alpha := g.transitionBoost()
+	treeBest := make([]float64, len(g.Forest.Trees))
 
 	for i, tree := range g.Forest.Trees {
 		root := tree.Root()
@@ -90,16 +139,12 @@ func (g *Gate) DryRun(prompt string) DryRunResult {
 			continue
 		}
 
-		// Markov boost factor: neutral (1.0) when no transition data exists,
-		// scaled up to (1 + α) for high-probability transitions.
-		boostFactor := 1.0
-		if alpha > 0 && g.Chain.LastTopic != "" {
-			boostFactor = 1.0 + alpha*g.Chain.Probability(g.Chain.LastTopic, tree.ID)
-		}
+		boostFactor := g.treeBoost(alpha, tree.ID)
 
 		rootVec := g.nodeVec(root.ID, root.Content)
-		rootCosine := tfidf.CosineSimilarity(vec, rootVec)
-		rootBoosted := rootCosine * boostFactor
+		rootCosine := g.similarity(vec, rootVec)
+		rootBoosted := g.boosted(rootCosine, boostFactor)
+		treeBest[i] = rootBoosted
 
 		ts := TreeScore{
 			TreeIdx:     i,
@@ -109,6 +154,9 @@ func (g *Gate) DryRun(prompt string) DryRunResult {
 			RootCosine:  rootCosine,
 			RootBoosted: rootBoosted,
 			BoostFactor: boostFactor,
+			Pinned:      tree.Pinned,
+
+			RootContributions: g.contributions(vec, rootVec),
 		}
 
 		if rootBoosted > best.Score {
@@ -120,14 +168,18 @@ func (g *Gate) DryRun(prompt string) DryRunResult {
 		// Score each leaf — leaves hold the actual user prompt text.
 		for _, leaf := range tree.GetLeaves() {
 			leafVec := g.nodeVec(leaf.ID, leaf.Content)
-			leafCosine := tfidf.CosineSimilarity(vec, leafVec)
-			leafBoosted := leafCosine * boostFactor
+			leafCosine := g.similarity(vec, leafVec)
+			leafBoosted := g.boosted(leafCosine, boostFactor)
+			if leafBoosted > treeBest[i] {
+				treeBest[i] = leafBoosted
+			}
 
 			ts.LeafScores = append(ts.LeafScores, LeafScore{
-				LeafID:  leaf.ID,
-				Content: leaf.Content,
-				Cosine:  leafCosine,
-				Boosted: leafBoosted,
+				LeafID:        leaf.ID,
+				Content:       leaf.Content,
+				Cosine:        leafCosine,
+				Boosted:       leafBoosted,
+				Contributions: g.contributions(vec, leafVec),
 			})
 
 			if leafBoosted > best.Score {
@@ -148,11 +200,30 @@ func (g *Gate) DryRun(prompt string) DryRunResult {
 	} else {
 		best.Action = ActionNew
 	}
+	g.jaccardFallback(&best, tokens)
 
 	result.BestAction = best.Action.String()
 	result.BestScore = best.Score
 	result.BestTree = best.TreeIdx
 	result.BestLeaf = best.LeafID
+	result.SecondTree, result.SecondScore = g.runnerUp(treeBest, best)
+	result.Confidence = g.confidence(best.Action, best.Score, rivalScore(treeBest, best.TreeIdx))
+	result.Jaccard = best.Jaccard
 
 	return result
 }
+
+// contributions explains the cosine score of a against b as the shared
+// terms' products, in display form. It returns nil under any other metric,
+// whose scores the products would not add up to.
+func (g *Gate) contributions(a, b tfidf.Vector) []TermContribution {
+	if g.Config.metric() != tfidf.MetricCosine {
+		return nil
+	}
+	_, cs := tfidf.CosineSimilarityExplained(a, b)
+	var out []TermContribution
+	for _, c := range cs {
+		out = append(out, TermContribution{Term: c.Word, Product: c.Product})
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package gate
+
+import "sort"
+
+// TreeForecast is one tree's score now and at the forecast time. Below is
+// set when its root would score under the forecast's Cutoff; LeavesBelow
+// counts its non-root leaves that would.
+// Pinned trees are never pruned and never marked Below.
+type TreeForecast struct {
+	Index       int     `json:"index"`
+	TreeID      string  `json:"treeId"`
+	Root        string  `json:"root"`
+	Pinned      bool    `json:"pinned,omitempty"`
+	Score       float64 `json:"score"`
+	ScoreAt     float64 `json:"scoreAt"`
+	Leaves      int     `json:"leaves"`
+	LeavesBelow int     `json:"leavesBelow"`
+	Below       bool    `json:"below"`
+}
+
+// Forecast previews node scores Hours from now, with no new prompts in
+// between. Cutoff is today's prune line: the current score of the node the
+// next prune would remove first, the weakest unpinned non-root leaf (or
+// root, if no tree has leaves). A node that decays below it is weaker then
+// than anything pruning would take now. Headroom is how many prompts still
+// fit before pruning starts at all. Trees are ordered first-to-prune first:
+// lowest ScoreAt, with pinned trees last.
+type Forecast struct {
+	Hours      float64        `json:"hours"`
+	At         int64          `json:"at"`
+	Cutoff     float64        `json:"cutoff"`
+	NodeCount  int            `json:"nodeCount"`
+	MemorySize int            `json:"memorySize"`
+	Headroom   int            `json:"headroom"`
+	Trees      []TreeForecast `json:"trees"`
+}
+
+// Forecast scores every tree's root and leaves at now plus hours with
+// Node.Score, without changing any state.
+func (g *Gate) Forecast(now int64, hours float64) Forecast {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	at := now + int64(hours*3600000)
+	params := g.Config.ScoreParams()
+	fc := Forecast{
+		Hours:      hours,
+		At:         at,
+		Cutoff:     g.pruneLine(now),
+		NodeCount:  g.Forest.NodeCount(),
+		MemorySize: g.Config.MemorySize,
+		Trees:      make([]TreeForecast, 0, len(g.Forest.Trees)),
+	}
+	fc.Headroom = max(fc.MemorySize-fc.NodeCount, 0)
+
+	for i, t := range g.Forest.Trees {
+		root := t.Root()
+		if root == nil {
+			continue
+		}
+		p := t.Params(params)
+		tf := TreeForecast{
+			Index:   i,
+			TreeID:  t.ID,
+			Root:    root.Content,
+			Pinned:  t.Pinned,
+			Score:   root.Score(now, p),
+			ScoreAt: root.Score(at, p),
+		}
+		for _, leaf := range t.GetLeaves() {
+			if leaf.ID == t.RootID {
+				continue
+			}
+			tf.Leaves++
+			if !t.Pinned && leaf.Score(at, p) < fc.Cutoff {
+				tf.LeavesBelow++
+			}
+		}
+		tf.Below = !t.Pinned && tf.ScoreAt < fc.Cutoff
+		fc.Trees = append(fc.Trees, tf)
+	}
+	sort.SliceStable(fc.Trees, func(i, j int) bool {
+		a, b := fc.Trees[i], fc.Trees[j]
+		if a.Pinned != b.Pinned {
+			return b.Pinned
+		}
+		return a.ScoreAt < b.ScoreAt
+	})
+	return fc
+}
+
+// pruneLine is Forest.PruneCutoff regardless of the memory budget, or 0 when
+// every tree is pinned.
+func (g *Gate) pruneLine(now int64) float64 {
+	return max(g.Forest.PruneCutoff(now, 0, g.Config.ScoreParams()), 0)
+}
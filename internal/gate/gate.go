@@ -2,9 +2,13 @@ package gate
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/kuandriy/focus-gate/internal/audit"
 	"github.com/kuandriy/focus-gate/internal/forest"
 	"github.com/kuandriy/focus-gate/internal/guide"
 	"github.com/kuandriy/focus-gate/internal/markov"
@@ -20,8 +24,163 @@ type Config struct {
 	MaxSourcesPerNode int     `json:"maxSourcesPerNode"`
 	MemorySize        int     `json:"memorySize"`
 	DecayRate         float64 `json:"decayRate"`
-	ContextLimit      int     `json:"contextLimit"`
+	DepthPenalty      float64 `json:"depthPenalty"` // depthFactor coefficient in Node.Score
+	ContextLimit      int     `json:"contextLimit"` // 0 = unlimited; raised to MinContextLimit
 	TransitionBoost   float64 `json:"transitionBoost"`
+
+	// MarkovOrder selects first-order (1, default) or second-order (2)
+	// transition modelling. Second order falls back to first order when the
+	// two-step history has not been observed.
+	MarkovOrder int `json:"markovOrder"`
+
+	// MarkovDecay fades transition counts by this fraction on every prompt
+	// (counts *= 1 - MarkovDecay), so recent workflow patterns outweigh old
+	// ones. Zero disables decay.
+	MarkovDecay float64 `json:"markovDecay"`
+
+	// MarkovSmoothing is the add-k constant for transition probabilities, so
+	// unobserved topic jumps get a small boost instead of none. Zero disables
+	// smoothing.
+	MarkovSmoothing float64 `json:"markovSmoothing"`
+
+	// BoostMode selects how the Markov transition boost combines with
+	// similarity in classify and DryRun: BoostMultiplicative (the default,
+	// also used when empty) scales it by 1 + α·P, so zero similarity stays
+	// zero; BoostAdditive adds α·P, clamped to 1, so a strongly predicted
+	// tree can win a near-tie or even a prompt it shares no terms with.
+	BoostMode string `json:"boostMode,omitempty"`
+
+	// MarkovHistorySize keeps the last this many topic visits in the chain's
+	// History for debugging predictions. Zero keeps none.
+	MarkovHistorySize int `json:"markovHistorySize,omitempty"`
+
+	// MarkovEnabled turns topic-transition modelling on. When false no
+	// transitions are recorded or pruned, classification and context ranking
+	// use pure similarity, and no predictions are shown. The chain still
+	// tracks the current topic.
+	MarkovEnabled bool `json:"markovEnabled"`
+
+	// MergeDelta is how close (in boosted score) the second-best tree must be
+	// to the best for a prompt to count as bridging the two. The runner-up
+	// must also reach BranchThreshold. Zero disables bridge detection.
+	MergeDelta float64 `json:"mergeDelta"`
+
+	// PredictThreshold is the probability the most likely next topic must
+	// reach for the context block to show predictions; PredictCount caps how
+	// many are shown. A PredictCount of zero suppresses predictions.
+	PredictThreshold float64 `json:"predictThreshold"`
+	PredictCount     int     `json:"predictCount"`
+
+	// PredictPathDepth, when 2 or more, adds the most likely sequence of up
+	// to this many topics from the current one (Chain.MostLikelyPath) to the
+	// context block, under the same threshold as the predictions. The path
+	// follows first-order transitions whatever MarkovOrder is.
+	PredictPathDepth int `json:"predictPathDepth,omitempty"`
+
+	// NormalizeScores makes DisplayContext show each tree's focus intensity
+	// (0–100, see NormalizeScores) instead of its raw score. The context
+	// block given to the model always carries raw scores.
+	NormalizeScores bool `json:"normalizeScores,omitempty"`
+
+	// ContextTemplate is a text/template that GenerateContextTemplated
+	// renders the context block with, in place of the built-in bracketed
+	// format; see ParseContextTemplate for the data it is given. Empty uses
+	// the built-in format.
+	ContextTemplate string `json:"contextTemplate,omitempty"`
+
+	// IndexAbstractions registers bubble-up abstractions in the TF-IDF corpus,
+	// replacing a node's old abstraction document whenever it is regenerated,
+	// so abstraction terms carry IDF weight when prompts are compared against
+	// parent nodes. Off by default: abstractions are not indexed.
+	IndexAbstractions bool `json:"indexAbstractions"`
+
+	// PruneStrategy selects how Prune frees memory: PruneLeaf (the default,
+	// also used when empty) trims the weakest leaves across all trees;
+	// PruneTree removes the weakest whole trees.
+	PruneStrategy string `json:"pruneStrategy"`
+
+	// AuditLog records every ProcessPrompt outcome in Decisions.
+	AuditLog bool `json:"auditLog,omitempty"`
+
+	// ArchivePruned keeps whole trees removed by Prune in PrunedTrees, so
+	// the caller can archive them instead of losing the topic. Leaves pruned
+	// from surviving trees are not kept.
+	ArchivePruned bool `json:"archivePruned"`
+
+	// MaxDepth caps node depth. An extend whose new child would sit deeper is
+	// attached to the nearest ancestor that keeps it at MaxDepth, so deep
+	// chains grow sideways instead. Zero means unlimited.
+	MaxDepth int `json:"maxDepth"`
+
+	// MaxChildren caps how many children a node holds. A branch or extend
+	// into a node at the cap first groups its two most similar children
+	// under a new interior node, which bubble-up abstracts like any other
+	// parent, so wide trees grow a level instead. Values below 2 mean
+	// unlimited.
+	MaxChildren int `json:"maxChildren,omitempty"`
+
+	// WeightCurve names the forest.CurveWeight curve a node's weight follows
+	// as it is touched or merged: forest.WeightLog2 (the default when
+	// empty), forest.WeightLinear or forest.WeightSqrt. Weight scales the
+	// score pruning ranks by, so steeper curves keep repeated topics longer.
+	WeightCurve string `json:"weightCurve,omitempty"`
+
+	// ReinforceThreshold is the cosine similarity a guide summary must reach
+	// against a tree root before ReinforceFromGuide touches that tree. Zero
+	// uses BranchThreshold, which it was tied to before it was configurable.
+	ReinforceThreshold float64 `json:"reinforceThreshold"`
+
+	// CompactThreshold is the cosine similarity at which Compact merges two
+	// sibling leaves. Zero disables compaction.
+	CompactThreshold float64 `json:"compactThreshold"`
+	// JaccardFallback rescues prompts the cosine scores would start a new
+	// tree for: if the prompt's token set overlaps a root's or leaf's by at
+	// least this Jaccard index, the prompt branches into that tree. It helps
+	// while the corpus is too small for IDF to be informative. Zero disables
+	// the fallback.
+	JaccardFallback float64 `json:"jaccardFallback"`
+
+	// SimilarityMetric selects how prompt and node vectors are compared in
+	// classify, DryRun and ReinforceFromGuide: tfidf.MetricCosine (the
+	// default, also used when empty), MetricJaccard or MetricDice. The
+	// thresholds are read on the chosen metric's 0–1 scale. Search, Compact
+	// and SplitTree always use cosine.
+	SimilarityMetric string `json:"similarityMetric,omitempty"`
+
+	// BubbleUpTermsByDepth overrides BubbleUpTerms per depth of the node
+	// being abstracted: index 0 applies to roots, 1 to their interior
+	// children, and deeper nodes use the last entry. Empty uses
+	// BubbleUpTerms everywhere.
+	BubbleUpTermsByDepth []int `json:"bubbleUpTermsByDepth,omitempty"`
+
+	// AbstractionIDF ranks abstraction terms by their frequency among the
+	// children times their IDF in the engine, instead of by frequency alone,
+	// so a term every prompt shares doesn't crowd out distinctive ones.
+	AbstractionIDF bool `json:"abstractionIDF,omitempty"`
+
+	// RecencyWeightedAbstraction scales each child's term counts by the
+	// child's decayed score, so recent prompts shape the abstraction more
+	// than equally frequent old ones and an evolving topic is summarized by
+	// where it is now.
+	RecencyWeightedAbstraction bool `json:"recencyWeightedAbstraction,omitempty"`
+
+	// AbstractionSeparator joins the terms of an abstraction. Empty uses
+	// DefaultAbstractionSeparator.
+	AbstractionSeparator string `json:"abstractionSeparator,omitempty"`
+
+	// Tokenizer configures how prompts and node content are tokenized. The
+	// same tokenizer is used for corpus documents and query vectors.
+	Tokenizer text.Options `json:"tokenizer"`
+
+	// Vector configures TF-IDF weighting. It is applied to the engine when the
+	// gate is constructed, so classify, dry-run and reinforcement agree.
+	Vector tfidf.Options `json:"vector"`
+
+	// TermBoosts multiplies the weight of the given words in every vector.
+	// Keys are plain words; they are run through the gate's tokenizer when
+	// the gate is constructed, so "billing" boosts the stem "bill" that
+	// prompts produce. The result replaces Vector.Boosts.
+	TermBoosts map[string]float64 `json:"termBoosts,omitempty"`
 }
 
 // DefaultConfig returns sensible defaults.
@@ -33,8 +192,66 @@ func DefaultConfig() Config {
 		MaxSourcesPerNode: 20,
 		MemorySize:        100,
 		DecayRate:         0.05,
+		DepthPenalty:      forest.DefaultDepthPenalty,
 		ContextLimit:      600,
 		TransitionBoost:   0.2,
+		MarkovOrder:       1,
+		MarkovEnabled:     true,
+		MergeDelta:        0.05,
+		PredictThreshold:  0.3,
+		PredictCount:      3,
+		CompactThreshold:  0.8,
+	}
+}
+
+// Prune strategies for Config.PruneStrategy.
+const (
+	PruneLeaf = "leaf"
+	PruneTree = "tree"
+)
+
+// Boost modes for Config.BoostMode.
+const (
+	BoostMultiplicative = "multiplicative"
+	BoostAdditive       = "additive"
+)
+
+// ScoreParams returns the node scoring parameters for pruning and ranking.
+func (c Config) ScoreParams() forest.ScoreParams {
+	return forest.ScoreParams{DecayRate: c.DecayRate, DepthPenalty: c.DepthPenalty}
+}
+
+// DefaultAbstractionSeparator joins abstraction terms unless
+// Config.AbstractionSeparator is set.
+const DefaultAbstractionSeparator = " | "
+
+// bubbleUpTerms returns how many terms an abstraction at depth keeps.
+func (c Config) bubbleUpTerms(depth int) int {
+	if len(c.BubbleUpTermsByDepth) == 0 {
+		return c.BubbleUpTerms
+	}
+	if depth >= len(c.BubbleUpTermsByDepth) {
+		depth = len(c.BubbleUpTermsByDepth) - 1
+	}
+	return c.BubbleUpTermsByDepth[depth]
+}
+
+// separator returns the string abstraction terms are joined with.
+func (c Config) separator() string {
+	if c.AbstractionSeparator == "" {
+		return DefaultAbstractionSeparator
+	}
+	return c.AbstractionSeparator
+}
+
+// metric returns the name of the similarity metric in use, resolving empty
+// and unknown values to cosine as tfidf.Similarity does.
+func (c Config) metric() string {
+	switch c.SimilarityMetric {
+	case tfidf.MetricJaccard, tfidf.MetricDice:
+		return c.SimilarityMetric
+	default:
+		return tfidf.MetricCosine
 	}
 }
 
@@ -59,12 +276,33 @@ func (a Action) String() string {
 	return "unknown"
 }
 
+// ContextFooter closes every context block.
+const ContextFooter = "[/Focus]\n"
+
+// MinContextLimit is the smallest ContextLimit that still fits the header line
+// and the footer. Positive limits below it are raised to it; the header and
+// footer are never truncated, so tiny limits yield a block with no body.
+const MinContextLimit = 64
+
 // Classification holds the result of classifying a prompt against the forest.
 type Classification struct {
 	Action  Action
 	TreeIdx int
 	LeafID  string // For extend: the matching leaf
 	Score   float64
+
+	// SecondTree is the index of a runner-up tree whose best score is within
+	// Config.MergeDelta of Score, marking a prompt that bridges two topics.
+	// It is -1 when no tree is that close.
+	SecondTree  int
+	SecondScore float64
+
+	// Confidence rates how decisive the classification was, from 0 (a
+	// coin-flip at a threshold or between trees) to 1. See ConfidenceLabel.
+	Confidence float64
+	// Jaccard is the token overlap that made this a branch when the cosine
+	// score alone was too low (see Config.JaccardFallback); zero otherwise.
+	Jaccard float64
 }
 
 // Gate is the Focus Gate classifier. It classifies prompts, mutates the forest,
@@ -75,47 +313,210 @@ type Gate struct {
 	Chain  *markov.Chain
 	Config Config
 
+	// LastJournal describes what the latest ProcessPrompt changed, for Undo.
+	// It is nil until a prompt has been processed.
+	LastJournal *Journal
+
+	// Metrics, when set, accumulates ProcessPrompt's stage timings. Nil
+	// disables timing entirely.
+	Metrics *Metrics
+
+	// PrunedTrees collects the whole trees Prune removed while
+	// Config.ArchivePruned is set, with the nodes they had when removed.
+	PrunedTrees []*forest.Tree
+
+	// Decisions collects how each prompt was classified while
+	// Config.AuditLog is set, for the caller to append to the decision log.
+	Decisions []audit.Decision
+
+	// Log receives problems the gate recovers from, such as a context
+	// template that fails to render. Nil logs to stderr.
+	Log io.Writer
+
 	// vecCache stores pre-computed TF-IDF vectors keyed by node ID. classify()
 	// would otherwise re-tokenize and re-vectorize every node on every prompt.
 	// Entries are lazily populated on first access and invalidated when a node's
-	// content changes (bubbleUp). The cache is transient — not persisted — because
-	// IDF weights shift as documents are added or removed between sessions.
-	vecCache map[string]tfidf.Vector
+	// content changes (bubbleUp). Each entry records the content it was built
+	// from, so an entry for since-changed content is never reused. The cache
+	// can be persisted with SaveVecCache and reloaded with LoadVecCache while
+	// the engine's corpus version is unchanged.
+	vecCache map[string]cachedVec
+
+	// vecMisses counts vectors nodeVec computed rather than found cached.
+	vecMisses int
+
+	// tokenizer is built once from Config.Tokenizer.
+	tokenizer *text.Tokenizer
+
+	// similarity is the Config.SimilarityMetric function.
+	similarity tfidf.SimilarityFunc
+
+	// mu serializes the methods that may run alongside a prompt:
+	// ProcessPrompt, ProcessBatch, DryRun, ReinforceFromGuide, Clone, the
+	// context generators, Topics, Digest, Search, Calibrate, Forecast and
+	// the vector cache's load, save and stats. Even the read-only ones fill
+	// vecCache, so it is a plain mutex rather than a RWMutex. Maintenance
+	// methods such as Prune, Compact or MoveNode are not guarded; they are
+	// for a gate nothing else is using.
+	mu sync.Mutex
 }
 
 // New creates a Gate from existing forest and engine state.
 func New(f *forest.Forest, e *tfidf.Engine, cfg Config) *Gate {
-	return &Gate{Forest: f, Engine: e, Chain: markov.New(), Config: cfg, vecCache: make(map[string]tfidf.Vector)}
+	return NewWithChain(f, e, markov.New(), cfg)
 }
 
 // NewWithChain creates a Gate with an existing Markov chain.
 func NewWithChain(f *forest.Forest, e *tfidf.Engine, c *markov.Chain, cfg Config) *Gate {
-	return &Gate{Forest: f, Engine: e, Chain: c, Config: cfg, vecCache: make(map[string]tfidf.Vector)}
+	c.Smoothing = cfg.MarkovSmoothing
+	g := &Gate{
+		Forest:     f,
+		Engine:     e,
+		Chain:      c,
+		Config:     cfg,
+		vecCache:   make(map[string]cachedVec),
+		tokenizer:  text.NewTokenizer(cfg.Tokenizer),
+		similarity: tfidf.Similarity(cfg.SimilarityMetric),
+	}
+	e.Options = cfg.Vector
+	if len(cfg.TermBoosts) > 0 {
+		e.Options.Boosts = g.stemBoosts(cfg.TermBoosts)
+	}
+	return g
+}
+
+// stemBoosts keys term boosts by the tokens their words produce. Words that
+// tokenize to nothing, such as stop words, are dropped.
+func (g *Gate) stemBoosts(boosts map[string]float64) map[string]float64 {
+	stemmed := make(map[string]float64, len(boosts))
+	for word, factor := range boosts {
+		for _, tok := range g.Tokenize(word) {
+			if !text.IsBigram(tok) {
+				stemmed[tok] = factor
+			}
+		}
+	}
+	return stemmed
+}
+
+// Tokenize tokenizes text with the gate's configured tokenizer.
+func (g *Gate) Tokenize(s string) []string {
+	return g.tokenizer.Tokenize(s)
 }
 
 // nodeVec returns the TF-IDF vector for a node, caching the result.
 // Reduces classify() cost from O(nodes × tokenize) to O(nodes × dot_product)
 // after initial computation. Cache entries are invalidated in bubbleUp.
 func (g *Gate) nodeVec(nodeID string, content string) tfidf.Vector {
-	if v, ok := g.vecCache[nodeID]; ok {
-		return v
+	if c, ok := g.vecCache[nodeID]; ok && c.Content == content {
+		return c.Vector
 	}
-	v := g.Engine.Vectorize(content)
-	g.vecCache[nodeID] = v
+	v := g.Engine.VectorizeTokens(g.Tokenize(content))
+	g.vecCache[nodeID] = cachedVec{Content: content, Vector: v}
+	g.vecMisses++
 	return v
 }
 
+// docTokens returns the document an indexed node registered in the corpus:
+// the tokens recorded when it was indexed, or its content re-tokenized for
+// nodes indexed before tokens were recorded.
+func (g *Gate) docTokens(n *forest.Node) []string {
+	if n.Tokens != nil {
+		return n.Tokens
+	}
+	return g.Tokenize(n.Content)
+}
+
+// transitionProb returns the probability of moving from the current topic to
+// the given tree, honouring Config.MarkovOrder.
+func (g *Gate) transitionProb(treeID string) float64 {
+	if g.Config.MarkovOrder >= 2 {
+		return g.Chain.ProbabilityGiven(g.Chain.PrevTopic, g.Chain.LastTopic, treeID)
+	}
+	return g.Chain.Probability(g.Chain.LastTopic, treeID)
+}
+
+// transitionBoost returns the Markov boost coefficient α, or 0 when Markov
+// modelling is disabled.
+func (g *Gate) transitionBoost() float64 {
+	if !g.Config.MarkovEnabled {
+		return 0
+	}
+	return g.Config.TransitionBoost
+}
+
+// treeBoost returns the Markov boost for a tree given α: the factor its
+// similarities are multiplied by, or in additive mode the amount added to
+// them. It is neutral (1 or 0) when there is no current topic.
+func (g *Gate) treeBoost(alpha float64, treeID string) float64 {
+	additive := g.Config.BoostMode == BoostAdditive
+	if alpha <= 0 || g.Chain.LastTopic == "" {
+		if additive {
+			return 0
+		}
+		return 1
+	}
+	if additive {
+		return alpha * g.transitionProb(treeID)
+	}
+	return 1 + alpha*g.transitionProb(treeID)
+}
+
+// boosted applies a treeBoost result to a similarity score.
+func (g *Gate) boosted(sim, boost float64) float64 {
+	if g.Config.BoostMode == BoostAdditive {
+		return min(sim+boost, 1)
+	}
+	return sim * boost
+}
+
+// topTransitions returns the n most likely next topics from the current
+// topic, honouring Config.MarkovOrder.
+func (g *Gate) topTransitions(n int) []markov.Transition {
+	if g.Config.MarkovOrder >= 2 {
+		return g.Chain.TopTransitionsGiven(g.Chain.PrevTopic, g.Chain.LastTopic, n)
+	}
+	return g.Chain.TopTransitions(g.Chain.LastTopic, n)
+}
+
 // ProcessPrompt classifies a prompt, applies it to the forest, and returns context.
+// It is safe to call from several goroutines.
 func (g *Gate) ProcessPrompt(prompt string, source string) string {
-	tokens := text.Tokenize(prompt)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.processPrompt(prompt, source)
+}
+
+// processPrompt is ProcessPrompt without the lock.
+func (g *Gate) processPrompt(prompt string, source string) string {
+	tokens := g.Tokenize(prompt)
 	if len(tokens) == 0 {
 		return ""
 	}
 
 	vec := g.Engine.VectorizeTokens(tokens)
 
-	cls := g.classify(vec)
+	start := g.startTimer()
+	cls := g.classify(vec, tokens)
+	g.observe(StageClassify, start)
+
+	j := &Journal{
+		Action:     cls.Action.String(),
+		Tokens:     tokens,
+		LastTopic:  g.Chain.LastTopic,
+		PrevTopic:  g.Chain.PrevTopic,
+		LastUpdate: g.Forest.Meta.LastUpdate,
+	}
+	var before map[string]NodeState
+	if cls.Action != ActionNew {
+		tree := g.Forest.Trees[cls.TreeIdx]
+		j.TreeLastAccessed = tree.LastAccessed
+		before = nodeStates(tree)
+	}
+
+	start = g.startTimer()
 	g.apply(cls, prompt, source, tokens)
+	g.observe(StageApply, start)
 
 	// Determine the tree ID that this prompt was classified into
 	currentTreeID := ""
@@ -129,9 +530,34 @@ func (g *Gate) ProcessPrompt(prompt string, source string) string {
 	}
 
 	// Record Markov transition
-	g.Chain.Record(g.Chain.LastTopic, currentTreeID)
+	if g.Config.MarkovEnabled {
+		if g.Config.MarkovDecay > 0 {
+			g.Chain.Decay(1 - g.Config.MarkovDecay)
+		}
+		if g.Config.MarkovOrder >= 2 {
+			g.Chain.RecordHistory(g.Chain.PrevTopic, g.Chain.LastTopic, currentTreeID)
+		} else {
+			g.Chain.Record(g.Chain.LastTopic, currentTreeID)
+		}
+		g.Chain.Visit(currentTreeID, g.Config.MarkovHistorySize)
+	}
+	g.Chain.PrevTopic = g.Chain.LastTopic
 	g.Chain.LastTopic = currentTreeID
 
+	if cls.SecondTree >= 0 {
+		j.Bridge = g.Forest.Trees[cls.SecondTree].ID
+		g.Forest.RecordBridge(currentTreeID, j.Bridge)
+	}
+
+	j.TreeID = currentTreeID
+	j.History = g.Config.MarkovOrder >= 2 && j.PrevTopic != "" && j.LastTopic != ""
+	j.NoTransition = !g.Config.MarkovEnabled
+	j.Visited = g.Config.MarkovEnabled && g.Config.MarkovHistorySize > 0 && currentTreeID != ""
+	if before != nil {
+		j.diffTree(g.Forest.Trees[cls.TreeIdx], before)
+	}
+	g.LastJournal = j
+
 	g.Forest.Meta.TotalPrompts++
 	g.Forest.Meta.LastUpdate = g.Forest.Trees[len(g.Forest.Trees)-1].LastAccessed
 
@@ -140,36 +566,84 @@ func (g *Gate) ProcessPrompt(prompt string, source string) string {
 
 	// Reset vector cache — AddDocument shifts IDF globally (TotalDocs increased),
 	// so all previously cached vectors are stale.
-	g.vecCache = make(map[string]tfidf.Vector)
+	g.vecCache = make(map[string]cachedVec)
 
-	// Prune if needed — track which trees existed before pruning
+	// Prune if needed
+	pruned := 0
 	if g.Forest.NodeCount() > g.Config.MemorySize {
-		treeIDs := make(map[string]bool, len(g.Forest.Trees))
-		for _, t := range g.Forest.Trees {
-			treeIDs[t.ID] = true
-		}
+		pruned = g.Prune(g.Config.MemorySize).Nodes
+	}
+	if g.Config.AuditLog {
+		g.Decisions = append(g.Decisions, audit.Decision{
+			Time:   time.Now().UnixMilli(),
+			Prompt: prompt,
+			Action: cls.Action.String(),
+			TreeID: currentTreeID,
+			Score:  cls.Score,
+			Pruned: pruned,
+		})
+	}
 
-		removed := g.Forest.Prune(g.Config.MemorySize, g.Config.DecayRate)
-		for _, content := range removed {
-			g.Engine.RemoveDocument(text.Tokenize(content))
-		}
+	start = g.startTimer()
+	ctx := g.contextTemplated()
+	g.observe(StageContext, start)
+	return ctx
+}
 
-		// Sync Markov chain: prune topics for trees that were removed
-		for id := range treeIDs {
-			found := false
-			for _, t := range g.Forest.Trees {
-				if t.ID == id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				g.Chain.PruneTopic(id)
+// PruneResult reports what a Prune call removed.
+type PruneResult struct {
+	Nodes int // nodes removed from the forest
+	Trees int // whole trees removed
+}
+
+// Prune trims the forest to memorySize nodes with Config.PruneStrategy and
+// keeps the engine and chain consistent with it: pruned indexed content is
+// removed from the TF-IDF corpus, and trees that disappeared entirely are
+// pruned from the Markov chain.
+func (g *Gate) Prune(memorySize int) PruneResult {
+	nodesBefore := g.Forest.NodeCount()
+	treesBefore := append([]*forest.Tree(nil), g.Forest.Trees...)
+	treeIDs := make(map[string]bool, len(g.Forest.Trees))
+	for _, t := range g.Forest.Trees {
+		treeIDs[t.ID] = true
+	}
+
+	var removed []*forest.Node
+	if g.Config.PruneStrategy == PruneTree {
+		removed = g.Forest.PruneTrees(memorySize, g.Config.ScoreParams())
+	} else {
+		removed = g.Forest.Prune(memorySize, g.Config.ScoreParams())
+	}
+	for _, n := range removed {
+		g.Engine.RemoveDocument(g.docTokens(n))
+	}
+	if len(removed) > 0 {
+		// RemoveDocument shifts IDF, so cached vectors are stale.
+		g.vecCache = make(map[string]cachedVec)
+	}
+
+	// Sync Markov chain: prune topics for trees that were removed
+	for _, t := range g.Forest.Trees {
+		delete(treeIDs, t.ID)
+	}
+	for id := range treeIDs {
+		if g.Config.MarkovEnabled {
+			g.Chain.PruneTopic(id)
+		}
+		g.Forest.ForgetBridges(id)
+	}
+	if g.Config.ArchivePruned {
+		for _, t := range treesBefore {
+			if treeIDs[t.ID] {
+				g.PrunedTrees = append(g.PrunedTrees, t)
 			}
 		}
 	}
 
-	return g.GenerateContext()
+	return PruneResult{
+		Nodes: nodesBefore - g.Forest.NodeCount(),
+		Trees: len(treeIDs),
+	}
 }
 
 // classify compares the prompt vector against all tree roots and leaves,
@@ -179,13 +653,15 @@ func (g *Gate) ProcessPrompt(prompt string, source string) string {
 // where P is the transition probability from the last topic to this tree.
 // Multiplicative form ensures zero cosine stays zero — Markov history cannot
 // force a match with unrelated content, only amplify existing similarity.
-func (g *Gate) classify(vec tfidf.Vector) Classification {
-	if len(g.Forest.Trees) == 0 || vec == nil {
-		return Classification{Action: ActionNew, Score: 0}
+// Config.BoostMode can trade that guarantee for an additive α*P nudge.
+func (g *Gate) classify(vec tfidf.Vector, tokens []string) Classification {
+	if len(g.Forest.Trees) == 0 || (vec == nil && g.Config.JaccardFallback <= 0) {
+		return Classification{Action: ActionNew, Score: 0, SecondTree: -1, Confidence: 1}
 	}
 
 	best := Classification{Action: ActionNew, Score: 0}
-	alpha := g.Config.TransitionBoost
+	alpha := g.transitionBoost()
+	treeBest := make([]float64, len(g.Forest.Trees))
 
 	for i, tree := range g.Forest.Trees {
 		root := tree.Root()
@@ -193,16 +669,14 @@ func (g *Gate) classify(vec tfidf.Vector) Classification {
 			continue
 		}
 
-		// Markov boost factor: neutral (1.0) when no transition data exists,
-		// scaled up to (1 + α) for high-probability transitions.
-		boostFactor := 1.0
-		if alpha > 0 && g.Chain.LastTopic != "" {
-			boostFactor = 1.0 + alpha*g.Chain.Probability(g.Chain.LastTopic, tree.ID)
-		}
+		// Markov boost: neutral when no transition data exists, up to α
+		// for high-probability transitions.
+		boost := g.treeBoost(alpha, tree.ID)
 
 		// Compare against root
 		rootVec := g.nodeVec(root.ID, root.Content)
-		rootSim := tfidf.CosineSimilarity(vec, rootVec) * boostFactor
+		rootSim := g.boosted(g.similarity(vec, rootVec), boost)
+		treeBest[i] = rootSim
 		if rootSim > best.Score {
 			best.Score = rootSim
 			best.TreeIdx = i
@@ -212,7 +686,10 @@ func (g *Gate) classify(vec tfidf.Vector) Classification {
 		// Compare against each leaf
 		for _, leaf := range tree.GetLeaves() {
 			leafVec := g.nodeVec(leaf.ID, leaf.Content)
-			leafSim := tfidf.CosineSimilarity(vec, leafVec) * boostFactor
+			leafSim := g.boosted(g.similarity(vec, leafVec), boost)
+			if leafSim > treeBest[i] {
+				treeBest[i] = leafSim
+			}
 			if leafSim > best.Score {
 				best.Score = leafSim
 				best.TreeIdx = i
@@ -228,37 +705,63 @@ func (g *Gate) classify(vec tfidf.Vector) Classification {
 	} else {
 		best.Action = ActionNew
 	}
+	g.jaccardFallback(&best, tokens)
+	best.SecondTree, best.SecondScore = g.runnerUp(treeBest, best)
+	best.Confidence = g.confidence(best.Action, best.Score, rivalScore(treeBest, best.TreeIdx))
 
 	return best
 }
 
+// runnerUp returns the index and score of the best tree other than best's,
+// if it is close enough to count as a bridge: within MergeDelta of the best
+// score and at least BranchThreshold. Returns -1 otherwise.
+func (g *Gate) runnerUp(treeBest []float64, best Classification) (int, float64) {
+	if g.Config.MergeDelta <= 0 || best.Action == ActionNew {
+		return -1, 0
+	}
+	second, secondScore := -1, 0.0
+	for i, s := range treeBest {
+		if i != best.TreeIdx && s > secondScore {
+			second, secondScore = i, s
+		}
+	}
+	if second < 0 || secondScore < g.Config.BranchThreshold || best.Score-secondScore > g.Config.MergeDelta {
+		return -1, 0
+	}
+	return second, secondScore
+}
+
 // apply mutates the forest based on the classification.
 func (g *Gate) apply(cls Classification, content string, source string, tokens []string) {
 	switch cls.Action {
 	case ActionNew:
 		tree := forest.NewTree(content, source)
 		tree.Root().Indexed = true // real user prompt — register in TF-IDF
+		tree.Root().Tokens = tokens
+		tree.Fingerprint = forest.Fingerprint(g.topTerms(termFreq(tokens), g.Config.bubbleUpTerms(0)))
 		g.Forest.AddTree(tree)
 
 	case ActionBranch:
 		tree := g.Forest.Trees[cls.TreeIdx]
 		g.preserveRoot(tree)
+		g.makeRoom(tree, tree.RootID)
 		child := tree.AddChild(tree.RootID, content, source)
-		if child != nil {
-			child.Indexed = true
+		if child == nil {
+			return // blank content: nothing to index or bubble up
 		}
+		child.Indexed = true
+		child.Tokens = tokens
 		g.bubbleUp(tree, tree.RootID)
 
 	case ActionExtend:
 		tree := g.Forest.Trees[cls.TreeIdx]
 		leaf := tree.Nodes[cls.LeafID]
+		var child *forest.Node
 		if leaf == nil {
 			// Fallback to branch
 			g.preserveRoot(tree)
-			child := tree.AddChild(tree.RootID, content, source)
-			if child != nil {
-				child.Indexed = true
-			}
+			g.makeRoom(tree, tree.RootID)
+			child = tree.AddChild(tree.RootID, content, source)
 		} else {
 			parentID := leaf.ParentID
 			if parentID == "" {
@@ -266,15 +769,67 @@ func (g *Gate) apply(cls Classification, content string, source string, tokens [
 				g.preserveRoot(tree)
 				parentID = tree.RootID
 			}
-			child := tree.AddChild(parentID, content, source)
-			if child != nil {
-				child.Indexed = true
-			}
+			parentID = g.capDepth(tree, parentID)
+			g.makeRoom(tree, parentID)
+			child = tree.AddChild(parentID, content, source)
+		}
+		if child == nil {
+			return
 		}
+		child.Indexed = true
+		child.Tokens = tokens
 		g.bubbleUp(tree, tree.RootID)
 	}
 }
 
+// capDepth returns the node a new child of parentID should be attached to so
+// that the child's depth stays within Config.MaxDepth: parentID itself, or
+// the deepest ancestor that is shallow enough.
+func (g *Gate) capDepth(tree *forest.Tree, parentID string) string {
+	if g.Config.MaxDepth <= 0 {
+		return parentID
+	}
+	parent := tree.Nodes[parentID]
+	for parent != nil && parent.Depth >= g.Config.MaxDepth && parent.ParentID != "" {
+		parentID = parent.ParentID
+		parent = tree.Nodes[parentID]
+	}
+	return parentID
+}
+
+// makeRoom keeps parentID within Config.MaxChildren before a child is added
+// to it: at the cap, its two most similar children are grouped under a new
+// interior node for bubbleUp to abstract. Pairs whose subtrees would be
+// pushed past Config.MaxDepth are skipped; if none fits, the node is left to
+// grow past the cap.
+func (g *Gate) makeRoom(tree *forest.Tree, parentID string) {
+	parent := tree.Nodes[parentID]
+	if g.Config.MaxChildren < 2 || parent == nil || len(parent.ChildIDs) < g.Config.MaxChildren {
+		return
+	}
+
+	var pair []string
+	best := -1.0
+	for i, a := range parent.ChildIDs {
+		for _, b := range parent.ChildIDs[i+1:] {
+			na, nb := tree.Nodes[a], tree.Nodes[b]
+			if na == nil || nb == nil {
+				continue
+			}
+			deepest := na.Depth + max(tree.Height(a), tree.Height(b)) + 1
+			if g.Config.MaxDepth > 0 && deepest > g.Config.MaxDepth {
+				continue
+			}
+			if sim := g.similarity(g.nodeVec(a, na.Content), g.nodeVec(b, nb.Content)); sim > best {
+				best, pair = sim, []string{a, b}
+			}
+		}
+	}
+	if pair != nil {
+		tree.Group(parentID, pair)
+	}
+}
+
 // preserveRoot handles the root preservation edge case: when a single-node tree
 // gets its first branch, the root content must be copied to a child before
 // bubble-up overwrites it with an abstraction.
@@ -286,13 +841,16 @@ func (g *Gate) preserveRoot(tree *forest.Tree) {
 	// Root is a leaf (single-node tree). Preserve its content as a child.
 	child := tree.AddChild(root.ID, root.Content, "")
 	if child != nil {
-		child.Sources = append(child.Sources, root.Sources...)
+		child.AddSources(g.Config.MaxSourcesPerNode, root.Sources...)
 		child.Frequency = root.Frequency
 		child.Weight = root.Weight
 		child.Created = root.Created
 		child.LastAccessed = root.LastAccessed
 		// Inherit the index flag — the child now owns the original prompt content.
 		child.Indexed = root.Indexed
+		child.Tokens = root.Tokens
+		root.Indexed = false
+		root.Tokens = nil
 	}
 }
 
@@ -313,168 +871,244 @@ func (g *Gate) bubbleUp(tree *forest.Tree, nodeID string) {
 		return
 	}
 
-	// Clear indexed flag — bubbleUp replaces content with a synthetic abstraction
-	// that was never added to the TF-IDF corpus.
+	// An indexed parent holds an abstraction registered by an earlier pass
+	// (preserveRoot hands a prompt root's document to its child). Withdraw it
+	// before the content is replaced; with IndexAbstractions the new
+	// abstraction is registered below.
+	if node.Indexed {
+		g.Engine.RemoveDocument(g.docTokens(node))
+	}
 	node.Indexed = false
+	node.Tokens = nil
 
 	// Collect all children content, tokenize, count frequencies
-	freq := make(map[string]int)
+	now := time.Now().UnixMilli()
+	params := tree.Params(g.Config.ScoreParams())
+	freq := make(map[string]float64)
 	for _, childID := range node.ChildIDs {
 		child := tree.Nodes[childID]
 		if child == nil {
 			continue
 		}
-		tokens := text.Tokenize(child.Content)
-		for _, t := range tokens {
+		w := 1.0
+		if g.Config.RecencyWeightedAbstraction {
+			w = child.Score(now, params)
+		}
+		for t, c := range termFreq(g.Tokenize(child.Content)) {
+			freq[t] += c * w
+		}
+	}
+
+	terms := g.topTerms(freq, g.Config.bubbleUpTerms(node.Depth))
+	node.Content = strings.Join(terms, g.Config.separator())
+	if nodeID == tree.RootID {
+		tree.Fingerprint = forest.Fingerprint(terms)
+	}
+	if g.Config.IndexAbstractions {
+		node.Tokens = g.Tokenize(node.Content)
+		g.Engine.AddDocument(node.Tokens)
+		node.Indexed = true
+	}
+
+	// Invalidate cached vector — content just changed. Callers reset the
+	// whole cache after bubbleUp when abstractions are indexed, since the
+	// corpus changed too.
+	delete(g.vecCache, nodeID)
+}
+
+// termFreq counts tokens, skipping bigrams: they are a matching aid, not
+// readable abstraction terms.
+func termFreq(tokens []string) map[string]float64 {
+	freq := make(map[string]float64, len(tokens))
+	for _, t := range tokens {
+		if !text.IsBigram(t) {
 			freq[t]++
 		}
 	}
+	return freq
+}
 
-	// Extract top N terms by frequency
+// topTerms returns the n highest-weighted terms of freq, ties broken
+// alphabetically so the result is deterministic.
+func (g *Gate) topTerms(freq map[string]float64, n int) []string {
+	// Rank by frequency, or by frequency × IDF with AbstractionIDF so terms
+	// common to the whole corpus give way to distinctive ones. Terms the
+	// corpus doesn't know keep their frequency.
 	type termCount struct {
-		term  string
-		count int
+		term   string
+		weight float64
 	}
 	sorted := make([]termCount, 0, len(freq))
-	for t, c := range freq {
-		sorted = append(sorted, termCount{t, c})
+	for t, w := range freq {
+		if g.Config.AbstractionIDF {
+			if idf := g.Engine.IDF(t); idf > 0 {
+				w *= idf
+			}
+		}
+		sorted = append(sorted, termCount{t, w})
 	}
 	sort.Slice(sorted, func(i, j int) bool {
-		if sorted[i].count != sorted[j].count {
-			return sorted[i].count > sorted[j].count
+		if sorted[i].weight != sorted[j].weight {
+			return sorted[i].weight > sorted[j].weight
 		}
 		return sorted[i].term < sorted[j].term
 	})
 
-	n := g.Config.BubbleUpTerms
-	if n > len(sorted) {
-		n = len(sorted)
-	}
+	n = min(n, len(sorted))
 	terms := make([]string, n)
 	for i := 0; i < n; i++ {
 		terms[i] = sorted[i].term
 	}
+	return terms
+}
 
-	node.Content = strings.Join(terms, " | ")
+// StatusContext returns the current context block without classifying
+// anything: GenerateContextTemplated, or a bare header when the forest is
+// empty. It is what --status prints, and what the hook emits for input that
+// cleans to nothing (a prompt wholly inside IDE tags), so the user still sees
+// state. No Markov transition is recorded and TotalPrompts is unchanged.
+func (g *Gate) StatusContext() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.statusContext()
+}
 
-	// Invalidate cached vector — content just changed.
-	delete(g.vecCache, nodeID)
+// statusContext is StatusContext without the lock.
+func (g *Gate) statusContext() string {
+	if ctx := g.contextTemplated(); ctx != "" {
+		return ctx
+	}
+	return fmt.Sprintf("[Focus | %d prompts | %d/%d mem | %d trees]\n[/Focus]\n",
+		g.Forest.Meta.TotalPrompts, g.Forest.NodeCount(), g.Config.MemorySize, len(g.Forest.Trees))
 }
 
-// GenerateContext formats the forest state as a compact context block.
-func (g *Gate) GenerateContext() string {
+// DisplayContext is StatusContext for a person reading --status. With
+// NormalizeScores, trees are labelled with their focus intensity rather than
+// a raw score that the Markov boost can push above 1.
+func (g *Gate) DisplayContext() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	if len(g.Forest.Trees) == 0 {
-		return ""
+		return g.statusContext()
 	}
+	return g.generateContext(g.Config.NormalizeScores)
+}
 
-	var b strings.Builder
+// GenerateContext formats the forest state as a compact context block.
+func (g *Gate) GenerateContext() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.generateContext(false)
+}
 
-	// Header
-	fmt.Fprintf(&b, "[Focus | %d prompts | %d/%d mem | %d trees]\n",
-		g.Forest.Meta.TotalPrompts,
-		g.Forest.NodeCount(),
-		g.Config.MemorySize,
-		len(g.Forest.Trees))
-
-	// Sort trees by root score descending, with Markov transition boost
-	type scoredTree struct {
-		tree  *forest.Tree
-		score float64
-	}
-	scored := make([]scoredTree, len(g.Forest.Trees))
-	now := g.Forest.Trees[0].LastAccessed
-	alpha := g.Config.TransitionBoost
-	for i, t := range g.Forest.Trees {
-		decayScore := t.Root().Score(now, g.Config.DecayRate)
-		// Boost by transition probability from current topic
-		if alpha > 0 && g.Chain.LastTopic != "" {
-			tp := g.Chain.Probability(g.Chain.LastTopic, t.ID)
-			decayScore *= (1 + alpha*tp)
-		}
-		scored[i] = scoredTree{t, decayScore}
+// generateContext renders the context block, labelling trees with their
+// intensity instead of their raw score when intensity is set.
+func (g *Gate) generateContext(intensity bool) string {
+	if len(g.Forest.Trees) == 0 {
+		return ""
 	}
-	sort.Slice(scored, func(i, j int) bool {
-		return scored[i].score > scored[j].score
-	})
 
-	// Limit to top 5 trees
-	limit := 5
-	if limit > len(scored) {
-		limit = len(scored)
+	sum := g.contextSummary()
+	scoreFormat := "%.2f"
+	if intensity {
+		sum.normalize()
+		scoreFormat = "%3.0f"
 	}
 
-	for _, st := range scored[:limit] {
-		fmt.Fprintf(&b, "  [%.2f] %s\n", st.score, st.tree.Root().Content)
-
-		// Show up to 3 recent leaves
-		leaves := st.tree.GetLeaves()
-		sort.Slice(leaves, func(i, j int) bool {
-			return leaves[i].LastAccessed > leaves[j].LastAccessed
-		})
-		leafLimit := 3
-		if leafLimit > len(leaves) {
-			leafLimit = len(leaves)
-		}
-		for _, leaf := range leaves[:leafLimit] {
-			if leaf.ID == st.tree.RootID {
-				continue // Don't re-show root
-			}
-			content := leaf.Content
+	// Header
+	header := fmt.Sprintf("[Focus | %d prompts | %d/%d mem | %d trees]\n",
+		sum.TotalPrompts, sum.NodeCount, sum.MemorySize, sum.TreeCount)
+
+	// Each tree is rendered as one block so the limit can drop whole trees.
+	blocks := make([]string, 0, len(sum.Trees))
+	for _, ct := range sum.Trees {
+		var b strings.Builder
+		fmt.Fprintf(&b, "  ["+scoreFormat+"] %s\n", ct.Score, ct.Root)
+		for _, content := range ct.Leaves {
 			if len(content) > 80 {
 				content = content[:80] + "..."
 			}
 			fmt.Fprintf(&b, "    - %s\n", content)
 		}
+		blocks = append(blocks, b.String())
 	}
 
 	// Prediction line: show likely next topics if transition data exists
-	if g.Chain.LastTopic != "" {
-		top := g.Chain.TopTransitions(g.Chain.LastTopic, 3)
-		if len(top) > 0 && top[0].Probability >= 0.3 {
-			b.WriteString("  -> next:")
-			for i, t := range top {
-				// Find tree name for this topic ID
-				name := t.TopicID[:8] // fallback: truncated ID
-				for _, tree := range g.Forest.Trees {
-					if tree.ID == t.TopicID {
-						root := tree.Root()
-						if root != nil {
-							name = root.Content
-							if len(name) > 30 {
-								name = name[:30]
-							}
-						}
-						break
-					}
-				}
-				if i > 0 {
-					b.WriteString(",")
-				}
-				fmt.Fprintf(&b, " %s (%.0f%%)", name, t.Probability*100)
+	var next strings.Builder
+	if len(sum.Next) > 0 {
+		next.WriteString("  -> next:")
+		for i, p := range sum.Next {
+			if i > 0 {
+				next.WriteString(",")
 			}
-			b.WriteString("\n")
+			fmt.Fprintf(&next, " %s (%.0f%%)", predictionName(p), p.Probability*100)
 		}
+		next.WriteString("\n")
+	}
+	if len(sum.Path) > 0 {
+		next.WriteString("  -> path:")
+		for i, p := range sum.Path {
+			if i > 0 {
+				next.WriteString(" ->")
+			}
+			fmt.Fprintf(&next, " %s (%.0f%%)", predictionName(p), p.Probability*100)
+		}
+		next.WriteString("\n")
 	}
 
-	result := b.String()
-
-	// Enforce context limit
-	if g.Config.ContextLimit > 0 && len(result) > g.Config.ContextLimit {
-		result = result[:g.Config.ContextLimit]
-		// Trim to last complete line
-		if idx := strings.LastIndex(result, "\n"); idx > 0 {
-			result = result[:idx+1]
+	body := strings.Join(blocks, "") + next.String()
+	if limit := g.Config.ContextLimit; limit > 0 {
+		if limit < MinContextLimit {
+			limit = MinContextLimit
 		}
+		body = fitContext(blocks, next.String(), limit-len(header)-len(ContextFooter))
+	}
+
+	return header + body + ContextFooter
+}
+
+// predictionName is how the context block names a predicted topic: its root
+// content cut to 30 bytes, or its short ID once the tree is gone.
+func predictionName(p ContextPrediction) string {
+	if p.Name == "" {
+		return p.TopicID[:min(8, len(p.TopicID))]
+	}
+	if len(p.Name) > 30 {
+		return p.Name[:30]
+	}
+	return p.Name
+}
+
+// fitContext builds a context body of at most n bytes. Header and footer are
+// always emitted around it, so only the body is trimmed: the prediction line
+// is dropped first, then whole tree blocks from the lowest-ranked up, so the
+// output never ends in a tree cut off from its leaves.
+func fitContext(blocks []string, next string, n int) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		b.WriteString(block)
+	}
+	if b.Len()+len(next) <= n {
+		return b.String() + next
 	}
 
-	return result + "[/Focus]\n"
+	b.Reset()
+	for _, block := range blocks {
+		if b.Len()+len(block) > n {
+			break
+		}
+		b.WriteString(block)
+	}
+	return b.String()
 }
 
 // ReinforceFromGuide processes unreinforced guide entries against the forest.
 // When an AI responds about a topic, that response is evidence the topic is
 // actively being worked on. We find the best-matching tree by cosine similarity
-// and Touch its root, increasing its weight and recency (making it stickier
-// and harder to prune).
+// against tree roots, then Touch the node within that tree the response
+// matches best — the root or one of its leaves — increasing its weight and
+// recency (making it stickier and harder to prune). A response about one
+// subtopic thus keeps that leaf alive, since leaves are what pruning removes.
 //
 // Only Touch is applied — no new nodes or content changes. AI responses confirm
 // existing topics rather than defining new ones. Markov boost is excluded because
@@ -482,23 +1116,36 @@ func (g *Gate) GenerateContext() string {
 //
 // Returns the number of entries reinforced, for diagnostic logging.
 func (g *Gate) ReinforceFromGuide(gd *guide.Guide) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	unreinforced := gd.UnreinforcedEntries()
 	if len(unreinforced) == 0 {
 		return 0
 	}
 
 	reinforced := 0
+	threshold := g.Config.ReinforceThreshold
+	if threshold <= 0 {
+		threshold = g.Config.BranchThreshold
+	}
+
+	// Repeated summaries (the same reply captured twice) share one vector.
+	vecs := make(map[string]tfidf.Vector, len(unreinforced))
 
 	for _, entry := range unreinforced {
-		tokens := text.Tokenize(entry.Summary)
+		tokens := g.Tokenize(entry.Summary)
 		if len(tokens) == 0 {
 			entry.Reinforced = true
 			continue
 		}
 
-		responseVec := g.Engine.Vectorize(strings.Join(tokens, " "))
+		responseVec, ok := vecs[entry.Summary]
+		if !ok {
+			responseVec = g.Engine.VectorizeTokens(tokens)
+			vecs[entry.Summary] = responseVec
+		}
 
-		// Find the best-matching tree root by pure cosine similarity.
+		// Find the best-matching tree root by unboosted similarity.
 		bestScore := 0.0
 		bestTreeIdx := -1
 
@@ -508,21 +1155,26 @@ func (g *Gate) ReinforceFromGuide(gd *guide.Guide) int {
 				continue
 			}
 			rootVec := g.nodeVec(root.ID, root.Content)
-			score := tfidf.CosineSimilarity(responseVec, rootVec)
+			score := g.similarity(responseVec, rootVec)
 			if score > bestScore {
 				bestScore = score
 				bestTreeIdx = i
 			}
 		}
 
-		// Only reinforce above the branch threshold — generic responses
+		// Only reinforce above the threshold — generic responses
 		// (e.g. "Sure, here's the code:") shouldn't boost any tree.
-		if bestTreeIdx >= 0 && bestScore >= g.Config.BranchThreshold {
-			root := g.Forest.Trees[bestTreeIdx].Root()
-			if root != nil {
-				root.Touch(g.Config.MaxSourcesPerNode, "guide-reinforce")
-				reinforced++
+		if bestTreeIdx >= 0 && bestScore >= threshold {
+			tree := g.Forest.Trees[bestTreeIdx]
+			node := tree.Root()
+			for _, leaf := range tree.GetLeaves() {
+				if score := g.similarity(responseVec, g.nodeVec(leaf.ID, leaf.Content)); score > bestScore {
+					bestScore = score
+					node = leaf
+				}
 			}
+			node.Touch(g.Config.MaxSourcesPerNode, "guide-reinforce", g.Config.WeightCurve)
+			reinforced++
 		}
 
 		entry.Reinforced = true
@@ -1,12 +1,21 @@
 package gate
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/guide"
 	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/text"
 	"github.com/kuandriy/focus-gate/internal/tfidf"
 )
 
@@ -109,6 +118,103 @@ func TestBubbleUpGeneratesAbstraction(t *testing.T) {
 	}
 }
 
+func TestBubbleUpRecencyWeighted(t *testing.T) {
+	abstract := func(weighted bool) string {
+		cfg := DefaultConfig()
+		cfg.BubbleUpTerms = 3
+		cfg.RecencyWeightedAbstraction = weighted
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+		tree := forest.NewTree("placeholder", "")
+		root := tree.Root()
+		old := time.Now().Add(-72 * time.Hour).UnixMilli()
+		for _, c := range []string{"setup install config", "setup install config"} {
+			tree.AddChild(root.ID, c, "").LastAccessed = old
+		}
+		for _, c := range []string{"optimize cache latency", "optimize cache latency"} {
+			tree.AddChild(root.ID, c, "")
+		}
+		g.Forest.AddTree(tree)
+		g.bubbleUp(tree, tree.RootID)
+		return root.Content
+	}
+
+	// Every term appears twice, so uniform counting falls back to
+	// alphabetical order and mixes old and new vocabulary.
+	if got := abstract(false); got != "cache | config | install" {
+		t.Errorf("uniform abstraction = %q", got)
+	}
+	want := strings.Join(newTestGate().Tokenize("cache latency optimize"), " | ")
+	if got := abstract(true); got != want {
+		t.Errorf("recency-weighted abstraction = %q, want the recent terms %q", got, want)
+	}
+}
+
+func TestBubbleUpSeparatorAndDepthTerms(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AbstractionSeparator = " / "
+	cfg.BubbleUpTermsByDepth = []int{4, 2}
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	tree := forest.NewTree("placeholder", "")
+	root := tree.Root()
+	mid := tree.AddChild(root.ID, "placeholder", "")
+	deep := tree.AddChild(mid.ID, "placeholder", "")
+	for _, c := range []string{"add JWT authentication token", "fix JWT token expiry bug", "refresh JWT token rotation"} {
+		tree.AddChild(deep.ID, c, "")
+	}
+	tree.AddChild(root.ID, "database migration schema version rollback", "")
+	g.Forest.AddTree(tree)
+
+	g.nodeVec(deep.ID, deep.Content)
+	g.bubbleUp(tree, tree.RootID)
+
+	terms := func(n *forest.Node) []string { return strings.Split(n.Content, " / ") }
+	if strings.Contains(root.Content, "|") || len(terms(root)) != 4 {
+		t.Errorf("root = %q, want 4 terms joined by \" / \"", root.Content)
+	}
+	if len(terms(mid)) != 2 {
+		t.Errorf("depth 1 = %q, want 2 terms", mid.Content)
+	}
+	// Depth 2 is past the list and uses its last entry.
+	if len(terms(deep)) != 2 {
+		t.Errorf("depth 2 = %q, want 2 terms", deep.Content)
+	}
+	if _, ok := g.vecCache[deep.ID]; ok {
+		t.Error("rewritten abstraction left a stale cached vector")
+	}
+}
+
+func TestAbstractionIDFPrefersDistinctiveTerms(t *testing.T) {
+	build := func(idf bool) string {
+		cfg := DefaultConfig()
+		cfg.AbstractionIDF = idf
+		cfg.BubbleUpTerms = 1
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		// "fix" is in every document; "jwt" only in two.
+		for _, doc := range []string{"fix JWT expiry", "fix JWT refresh", "fix database migration", "fix CSS layout", "fix flaky test"} {
+			g.Engine.AddDocument(g.Tokenize(doc))
+		}
+
+		tree := forest.NewTree("placeholder", "")
+		tree.AddChild(tree.RootID, "fix JWT expiry", "")
+		tree.AddChild(tree.RootID, "fix JWT refresh", "")
+		tree.AddChild(tree.RootID, "fix session cookie", "")
+		g.Forest.AddTree(tree)
+		g.bubbleUp(tree, tree.RootID)
+		return tree.Root().Content
+	}
+
+	tok := newTestGate().Tokenize
+	fix, jwt := tok("fix")[0], tok("jwt")[0]
+	if got := build(false); got != fix {
+		t.Errorf("by frequency: abstraction = %q, want %q", got, fix)
+	}
+	if got := build(true); got != jwt {
+		t.Errorf("by IDF: abstraction = %q, want %q", got, jwt)
+	}
+}
+
 func TestContextFormat(t *testing.T) {
 	g := newTestGate()
 	g.ProcessPrompt("add authentication to the app", "p1")
@@ -220,7 +326,7 @@ func TestMarkovTiebreaker(t *testing.T) {
 	// Verify the Markov tiebreaker actually changes the classification outcome.
 	// Both trees share "server" and "endpoint" for near-equal cosine similarity,
 	// but the recorded tree1→tree2 transitions should tip the result to tree2.
-	cls := g.classify(e.Vectorize("server endpoint"))
+	cls := g.classify(e.Vectorize("server endpoint"), nil)
 	if cls.TreeIdx != 1 {
 		t.Errorf("Markov tiebreaker failed: TreeIdx=%d, Score=%.3f, Action=%s (expected TreeIdx=1 due to Markov boost from tree1→tree2)",
 			cls.TreeIdx, cls.Score, cls.Action)
@@ -241,6 +347,111 @@ func TestMarkovNoBoostWhenDisabled(t *testing.T) {
 	}
 }
 
+func TestBoostModeAdditive(t *testing.T) {
+	// tree2 is the certain next topic but shares no terms with the prompt.
+	const prompt = "billing invoice totals"
+	newGate := func(mode string) (*Gate, *forest.Tree) {
+		f := forest.NewForest()
+		e := tfidf.NewEngine()
+		c := markov.New()
+		tree1 := forest.NewTree("server API endpoint handler", "p1")
+		tree2 := forest.NewTree("database schema migration", "p2")
+		f.AddTree(tree1)
+		f.AddTree(tree2)
+		e.AddDocument([]string{"server", "api", "endpoint", "handler"})
+		e.AddDocument([]string{"database", "schema", "migration"})
+		c.Record(tree1.ID, tree2.ID)
+		c.LastTopic = tree1.ID
+
+		cfg := DefaultConfig()
+		cfg.TransitionBoost = 0.3
+		cfg.BoostMode = mode
+		g := NewWithChain(f, e, c, cfg)
+		// The prompt's terms are known from an earlier, since-pruned topic.
+		e.AddDocument(g.Tokenize(prompt))
+		return g, tree2
+	}
+
+	mult, _ := newGate(BoostMultiplicative)
+	cls := mult.classify(mult.Engine.Vectorize(prompt), nil)
+	if cls.Action != ActionNew || cls.Score != 0 {
+		t.Errorf("multiplicative: %s at %.3f, want new at 0", cls.Action, cls.Score)
+	}
+	ts := mult.DryRun(prompt).TreeScores[1]
+	if ts.BoostFactor != 1.3 || ts.RootBoosted != 0 {
+		t.Errorf("multiplicative dry run: factor %.3f, boosted %.3f", ts.BoostFactor, ts.RootBoosted)
+	}
+
+	add, tree2 := newGate(BoostAdditive)
+	cls = add.classify(add.Engine.Vectorize(prompt), nil)
+	if cls.Action != ActionBranch || add.Forest.Trees[cls.TreeIdx] != tree2 {
+		t.Errorf("additive: %s into tree %d, want branch into the predicted tree", cls.Action, cls.TreeIdx)
+	}
+	if math.Abs(cls.Score-0.3) > 1e-9 {
+		t.Errorf("additive score = %.4f, want α·P = 0.3", cls.Score)
+	}
+	dr := add.DryRun(prompt)
+	ts = dr.TreeScores[1]
+	if dr.BoostMode != BoostAdditive || ts.BoostFactor != 0.3 || ts.RootBoosted != 0.3 {
+		t.Errorf("additive dry run: mode %s, boost %.3f, boosted %.3f", dr.BoostMode, ts.BoostFactor, ts.RootBoosted)
+	}
+	if dr.BestAction != cls.Action.String() || dr.BestScore != cls.Score {
+		t.Errorf("dry run %s %.3f disagrees with classify", dr.BestAction, dr.BestScore)
+	}
+	// Boosted scores are clamped to 1.
+	if got := add.boosted(0.9, 0.3); got != 1 {
+		t.Errorf("boosted(0.9, 0.3) = %v, want 1", got)
+	}
+}
+
+func TestMarkovEnabledFalse(t *testing.T) {
+	f := forest.NewForest()
+	e := tfidf.NewEngine()
+	c := markov.New()
+
+	tree1 := forest.NewTree("server API endpoint handler", "p1")
+	tree2 := forest.NewTree("server backend endpoint routing", "p2")
+	f.AddTree(tree1)
+	f.AddTree(tree2)
+	e.AddDocument([]string{"server", "api", "endpoint", "handler"})
+	e.AddDocument([]string{"server", "backend", "endpoint", "routing"})
+
+	// The same pattern that tips TestMarkovTiebreaker to tree2.
+	c.Record(tree1.ID, tree2.ID)
+	c.Record(tree1.ID, tree2.ID)
+	c.Record(tree1.ID, tree2.ID)
+	c.LastTopic = tree1.ID
+	f.Meta.TotalPrompts = 5
+
+	cfg := DefaultConfig()
+	cfg.TransitionBoost = 0.3
+	cfg.MarkovEnabled = false
+	g := NewWithChain(f, e, c, cfg)
+
+	vec := e.Vectorize("server endpoint")
+	cls := g.classify(vec, nil)
+	want := math.Max(
+		g.similarity(vec, g.nodeVec(tree1.RootID, tree1.Root().Content)),
+		g.similarity(vec, g.nodeVec(tree2.RootID, tree2.Root().Content)))
+	if math.Abs(cls.Score-want) > 1e-9 {
+		t.Errorf("classify score = %.4f, want unboosted %.4f", cls.Score, want)
+	}
+
+	if ctx := g.GenerateContext(); strings.Contains(ctx, "-> next:") {
+		t.Errorf("prediction line shown with Markov disabled:\n%s", ctx)
+	}
+
+	before := c.TransitionCount()
+	g.ProcessPrompt("add JWT authentication to the API", "p6")
+	g.ProcessPrompt("fix JWT token expiry", "p7")
+	if got := c.TransitionCount(); got != before {
+		t.Errorf("transitions recorded with Markov disabled: %d -> %d", before, got)
+	}
+	if c.LastTopic == "" {
+		t.Error("the current topic should still be tracked")
+	}
+}
+
 func TestMarkovColdStart(t *testing.T) {
 	g := newTestGate()
 
@@ -320,6 +531,2133 @@ func TestMarkovNoPredictionWhenWeak(t *testing.T) {
 	}
 }
 
-// Ensure fmt and markov are used
-var _ = fmt.Sprintf
-var _ = markov.New
+func TestPredictThresholdAndCount(t *testing.T) {
+	build := func(cfg Config) *Gate {
+		f := forest.NewForest()
+		c := markov.New()
+		var trees []*forest.Tree
+		for i, name := range []string{"authentication", "database", "frontend", "deployment"} {
+			tree := forest.NewTree(name, fmt.Sprintf("p%d", i))
+			f.AddTree(tree)
+			trees = append(trees, tree)
+		}
+		// Even 25% spread: below the default threshold.
+		for _, to := range trees {
+			c.Record(trees[0].ID, to.ID)
+		}
+		c.LastTopic = trees[0].ID
+		f.Meta.TotalPrompts = 5
+		return NewWithChain(f, tfidf.NewEngine(), c, cfg)
+	}
+
+	cfg := DefaultConfig()
+	if ctx := build(cfg).GenerateContext(); strings.Contains(ctx, "-> next:") {
+		t.Fatal("default threshold should hide a 25% prediction")
+	}
+
+	cfg.PredictThreshold = 0.2
+	cfg.PredictCount = 2
+	g := build(cfg)
+	if ctx := g.GenerateContext(); !strings.Contains(ctx, "-> next:") {
+		t.Errorf("lowered threshold should show the prediction:\n%s", ctx)
+	}
+	if n := len(g.contextSummary().Next); n != 2 {
+		t.Errorf("predictions = %d, want predictCount 2", n)
+	}
+
+	cfg.PredictCount = 0
+	if ctx := build(cfg).GenerateContext(); strings.Contains(ctx, "-> next:") {
+		t.Error("predictCount 0 should remove the prediction line")
+	}
+}
+
+func TestPredictPathInContext(t *testing.T) {
+	f := forest.NewForest()
+	c := markov.New()
+	var trees []*forest.Tree
+	for i, name := range []string{"authentication", "database", "frontend"} {
+		tree := forest.NewTree(name, fmt.Sprintf("p%d", i))
+		f.AddTree(tree)
+		trees = append(trees, tree)
+	}
+	auth, db, frontend := trees[0].ID, trees[1].ID, trees[2].ID
+	for range 9 {
+		c.Record(auth, db)
+		c.Record(db, frontend)
+	}
+	c.Record(auth, frontend)
+	c.Record(db, auth)
+	c.LastTopic = auth
+	f.Meta.TotalPrompts = 20
+
+	cfg := DefaultConfig()
+	g := NewWithChain(f, tfidf.NewEngine(), c, cfg)
+	if ctx := g.GenerateContext(); strings.Contains(ctx, "-> path:") {
+		t.Errorf("path shown without predictPathDepth:\n%s", ctx)
+	}
+
+	g.Config.PredictPathDepth = 2
+	path := g.contextSummary().Path
+	if len(path) != 2 || path[0].TopicID != db || path[1].TopicID != frontend {
+		t.Fatalf("path = %+v, want database then frontend", path)
+	}
+	if path[0].Probability != 0.9 || path[1].Probability != 0.9 {
+		t.Errorf("step probabilities = %v, %v; want 0.9 each", path[0].Probability, path[1].Probability)
+	}
+	if ctx := g.GenerateContext(); !strings.Contains(ctx, "-> path: database (90%) -> frontend (90%)") {
+		t.Errorf("context missing the path line:\n%s", ctx)
+	}
+}
+
+func TestNormalizeScores(t *testing.T) {
+	got := NormalizeScores([]float64{1.42, 0.71, 0})
+	if got[0] != 100 || got[1] != 50 || got[2] != 0 {
+		t.Errorf("NormalizeScores = %v, want [100 50 0]", got)
+	}
+	if got := NormalizeScores([]float64{0.03}); got[0] != 100 {
+		t.Errorf("single score = %v, want 100", got[0])
+	}
+	if got := NormalizeScores([]float64{0, 0}); got[0] != 0 || got[1] != 0 {
+		t.Errorf("all-zero scores = %v, want zeros", got)
+	}
+
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	if topics := g.Topics(time.Now().UnixMilli()); topics[0].Intensity != 100 {
+		t.Errorf("single-tree intensity = %v, want 100", topics[0].Intensity)
+	}
+	g.Config.NormalizeScores = true
+	if ctx := g.DisplayContext(); !strings.Contains(ctx, "[100] ") {
+		t.Errorf("display context should show intensity:\n%s", ctx)
+	}
+	if ctx := g.GenerateContext(); strings.Contains(ctx, "[100] ") {
+		t.Errorf("model context should keep raw scores:\n%s", ctx)
+	}
+}
+
+func TestBigramsRewardPhraseOverlap(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tokenizer.Bigrams = true
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	query := "rotate the access token"
+	phrase := "refresh access token daily"
+	shuffled := "token refresh daily access"
+	for _, doc := range []string{query, phrase, shuffled, "database migration schema"} {
+		g.Engine.AddDocument(g.Tokenize(doc))
+	}
+
+	qv := g.Engine.VectorizeTokens(g.Tokenize(query))
+	phraseSim := tfidf.CosineSimilarity(qv, g.Engine.VectorizeTokens(g.Tokenize(phrase)))
+	shuffledSim := tfidf.CosineSimilarity(qv, g.Engine.VectorizeTokens(g.Tokenize(shuffled)))
+
+	if phraseSim <= shuffledSim {
+		t.Errorf("shared phrase should score higher: phrase=%.4f shuffled=%.4f", phraseSim, shuffledSim)
+	}
+}
+
+func TestSynonymsShareTree(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tokenizer.Synonyms = map[string][]string{"kubernetes": {"k8s"}}
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	g.ProcessPrompt("k8s deployment", "p1")
+	g.ProcessPrompt("database migration schema", "p2")
+	g.ProcessPrompt("kubernetes deployment", "p3")
+
+	if len(g.Forest.Trees) != 2 {
+		t.Fatalf("expected 2 trees, got %d", len(g.Forest.Trees))
+	}
+	if g.LastJournal.TreeID != g.Forest.Trees[0].ID {
+		t.Errorf("kubernetes prompt should join the k8s tree, went to %s", g.LastJournal.TreeID)
+	}
+	if g.Engine.DocFreq["k8s"] != 0 {
+		t.Errorf("alias should never reach the corpus, df(k8s)=%d", g.Engine.DocFreq["k8s"])
+	}
+}
+
+func TestTermBlacklistNeverIndexed(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tokenizer.TermBlacklist = []string{"jira"}
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	g.ProcessPrompt("jira ticket: fix the login redirect", "p1")
+	g.ProcessPrompt("Jira: style the settings page", "p2")
+
+	if g.Engine.DocFreq["jira"] != 0 {
+		t.Errorf("blacklisted term reached the corpus, df(jira)=%d", g.Engine.DocFreq["jira"])
+	}
+	for _, term := range g.Engine.VectorizeTokens(g.Tokenize("jira login redirect")) {
+		if term.Word == "jira" {
+			t.Errorf("blacklisted term in vector: %v", term)
+		}
+	}
+	if len(g.Forest.Trees) != 2 {
+		t.Errorf("unrelated prompts sharing only the blacklisted term should not cluster: %d trees", len(g.Forest.Trees))
+	}
+}
+
+func TestClassifyUsesSimilarityMetric(t *testing.T) {
+	prompt := "fix JWT authentication token expiry"
+	scores := make(map[string]float64)
+	for _, metric := range []string{tfidf.MetricCosine, tfidf.MetricJaccard, tfidf.MetricDice} {
+		cfg := DefaultConfig()
+		cfg.TransitionBoost = 0
+		cfg.SimilarityMetric = metric
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("add JWT authentication to the API", "p1")
+
+		tokens := g.Tokenize(prompt)
+		vec := g.Engine.VectorizeTokens(tokens)
+		root := g.Forest.Trees[0].Root()
+		want := tfidf.Similarity(metric)(vec, g.Engine.VectorizeTokens(g.Tokenize(root.Content)))
+
+		cls := g.classify(vec, tokens)
+		if math.Abs(cls.Score-want) > 1e-9 {
+			t.Errorf("%s: classify score = %f, want %f", metric, cls.Score, want)
+		}
+		if dr := g.DryRun(prompt); math.Abs(dr.TreeScores[0].RootCosine-want) > 1e-9 || dr.Metric != metric {
+			t.Errorf("%s: dry-run root score = %f (%s), want %f", metric, dr.TreeScores[0].RootCosine, dr.Metric, want)
+		}
+		scores[metric] = want
+	}
+	if scores[tfidf.MetricCosine] == scores[tfidf.MetricJaccard] || scores[tfidf.MetricJaccard] == scores[tfidf.MetricDice] {
+		t.Errorf("metrics should disagree on this pair: %v", scores)
+	}
+}
+
+func TestBigramsExcludedFromAbstraction(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tokenizer.Bigrams = true
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	g.ProcessPrompt("add jwt token authentication", "p1")
+	g.ProcessPrompt("fix jwt token expiry", "p2")
+
+	root := g.Forest.Trees[0].Root()
+	if strings.Contains(root.Content, "jwt token") {
+		t.Errorf("abstraction should not contain bigrams, got %q", root.Content)
+	}
+}
+
+func TestVecCacheReusedAtSameVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "veccache.json")
+
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	root := g.Forest.Trees[0].Root()
+
+	// Plant a sentinel vector so reuse is observable.
+	sentinel := tfidf.Vector{{Word: "sentinel", Weight: 1}}
+	g.vecCache[root.ID] = cachedVec{Content: root.Content, Vector: sentinel}
+	if err := g.SaveVecCache(path); err != nil {
+		t.Fatalf("SaveVecCache: %v", err)
+	}
+
+	reloaded := NewWithChain(g.Forest, g.Engine, g.Chain, g.Config)
+	if err := reloaded.LoadVecCache(path); err != nil {
+		t.Fatalf("LoadVecCache: %v", err)
+	}
+	if v := reloaded.nodeVec(root.ID, root.Content); len(v) != 1 || v[0].Word != "sentinel" {
+		t.Errorf("matching version should reuse cached vector, got %v", v)
+	}
+
+	// Bumping the corpus version invalidates the file.
+	g.Engine.AddDocument([]string{"database"})
+	stale := NewWithChain(g.Forest, g.Engine, g.Chain, g.Config)
+	if err := stale.LoadVecCache(path); err != nil {
+		t.Fatalf("LoadVecCache: %v", err)
+	}
+	if v := stale.nodeVec(root.ID, root.Content); len(v) == 1 && v[0].Word == "sentinel" {
+		t.Error("bumped version should discard cached vectors")
+	}
+}
+
+func TestSecondOrderMarkovThreadsHistory(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MarkovOrder = 2
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("style the frontend react component", "p3")
+
+	auth, db, ui := g.Forest.Trees[0].ID, g.Forest.Trees[1].ID, g.Forest.Trees[2].ID
+	if g.Chain.PrevTopic != db || g.Chain.LastTopic != ui {
+		t.Errorf("history = (%s, %s), want (%s, %s)", g.Chain.PrevTopic, g.Chain.LastTopic, db, ui)
+	}
+	if g.Chain.Counts[markov.HistoryKey(auth, db)][ui] != 1 {
+		t.Errorf("second-order transition auth→db→ui not recorded: %v", g.Chain.Counts)
+	}
+}
+
+func TestMarkovDecayAppliedPerPrompt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MarkovDecay = 0.5
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	first := g.Chain.LastTopic
+	g.ProcessPrompt("style the frontend react component", "p3")
+
+	// The first transition (auth → db) was halved when the second was recorded.
+	auth := g.Forest.Trees[0].ID
+	if got := g.Chain.Counts[auth][first]; !approxEq(got, 0.5) {
+		t.Errorf("decayed count = %f, want 0.5", got)
+	}
+}
+
+func approxEq(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestPruneKeepsStateConsistent(t *testing.T) {
+	g := newTestGate()
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT authentication token expiry",
+		"fix the database migration schema error",
+		"add an index to the database users table",
+		"style the frontend react component",
+		"write unit tests for the payment service",
+		"deploy the kubernetes cluster with helm",
+	}
+	for i, p := range prompts {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+	}
+	nodesBefore, treesBefore := g.Forest.NodeCount(), len(g.Forest.Trees)
+
+	res := g.Prune(3)
+
+	if g.Forest.NodeCount() > 3 {
+		t.Errorf("NodeCount = %d after Prune(3)", g.Forest.NodeCount())
+	}
+	if res.Nodes != nodesBefore-g.Forest.NodeCount() {
+		t.Errorf("PruneResult.Nodes = %d, want %d", res.Nodes, nodesBefore-g.Forest.NodeCount())
+	}
+	if res.Trees != treesBefore-len(g.Forest.Trees) || res.Trees == 0 {
+		t.Errorf("PruneResult.Trees = %d, want %d (> 0)", res.Trees, treesBefore-len(g.Forest.Trees))
+	}
+
+	// Engine corpus matches the indexed nodes still in the forest.
+	indexed := 0
+	live := make(map[string]bool)
+	for _, tree := range g.Forest.Trees {
+		live[tree.ID] = true
+		for _, n := range tree.Nodes {
+			if n.Indexed {
+				indexed++
+			}
+		}
+	}
+	if g.Engine.TotalDocs != indexed {
+		t.Errorf("Engine.TotalDocs = %d, want %d indexed nodes", g.Engine.TotalDocs, indexed)
+	}
+
+	// Chain only references surviving trees.
+	for from, row := range g.Chain.Counts {
+		if !live[from] {
+			t.Errorf("chain row for pruned tree %s", from)
+		}
+		for to := range row {
+			if !live[to] {
+				t.Errorf("chain transition %s → pruned tree %s", from, to)
+			}
+		}
+	}
+	if g.Chain.LastTopic != "" && !live[g.Chain.LastTopic] {
+		t.Errorf("LastTopic %s was pruned", g.Chain.LastTopic)
+	}
+}
+
+func TestPruneTreeStrategyRemovesWholeTrees(t *testing.T) {
+	g := newTestGate()
+	g.Config.PruneStrategy = PruneTree
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT authentication token expiry",
+		"fix the database migration schema error",
+		"add an index to the database users table",
+		"style the frontend react component",
+	}
+	for i, p := range prompts {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+	}
+	sizes := make(map[string]int)
+	for _, tree := range g.Forest.Trees {
+		sizes[tree.ID] = tree.NodeCount()
+	}
+
+	res := g.Prune(g.Forest.NodeCount() - 1)
+
+	if res.Trees == 0 {
+		t.Fatal("tree strategy should remove at least one whole tree")
+	}
+	// Every surviving tree is untouched.
+	for _, tree := range g.Forest.Trees {
+		if tree.NodeCount() != sizes[tree.ID] {
+			t.Errorf("tree %s shrank from %d to %d nodes", tree.ID, sizes[tree.ID], tree.NodeCount())
+		}
+	}
+	indexed := 0
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Indexed {
+				indexed++
+			}
+		}
+	}
+	if g.Engine.TotalDocs != indexed {
+		t.Errorf("Engine.TotalDocs = %d, want %d indexed nodes", g.Engine.TotalDocs, indexed)
+	}
+}
+
+func TestApplyIgnoresBlankContent(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	tree := g.Forest.Trees[0]
+	nodes, root := tree.NodeCount(), tree.Root().Content
+
+	g.apply(Classification{Action: ActionBranch, TreeIdx: 0}, "  ", "p3", nil)
+	g.apply(Classification{Action: ActionExtend, TreeIdx: 0, LeafID: "missing"}, "", "p3", nil)
+
+	if tree.NodeCount() != nodes || tree.Root().Content != root {
+		t.Errorf("blank content changed the tree: %d nodes (want %d), root %q (want %q)",
+			tree.NodeCount(), nodes, tree.Root().Content, root)
+	}
+}
+
+func TestArchivePrunedKeepsTreesForRestore(t *testing.T) {
+	g := newTestGate()
+	g.Config.PruneStrategy = PruneTree
+	g.Config.ArchivePruned = true
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT authentication token expiry",
+		"fix the database migration schema error",
+		"style the frontend react component",
+	}
+	for i, p := range prompts {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+	}
+	nodes, docs := g.Forest.NodeCount(), g.Engine.TotalDocs
+
+	res := g.Prune(g.Forest.NodeCount() - 1)
+	if res.Trees == 0 || len(g.PrunedTrees) != res.Trees {
+		t.Fatalf("PrunedTrees = %d, want the %d removed trees", len(g.PrunedTrees), res.Trees)
+	}
+
+	for _, tree := range g.PrunedTrees {
+		if err := g.RestoreTree(tree); err != nil {
+			t.Fatalf("RestoreTree(%s): %v", tree.ID, err)
+		}
+	}
+	if g.Forest.NodeCount() != nodes || g.Engine.TotalDocs != docs {
+		t.Errorf("after restore: %d nodes, %d docs; want %d, %d",
+			g.Forest.NodeCount(), g.Engine.TotalDocs, nodes, docs)
+	}
+	checkCorpus(t, g, "after restore")
+
+	if err := g.RestoreTree(g.PrunedTrees[0]); err == nil {
+		t.Error("restoring a tree already in the forest should fail")
+	}
+}
+
+func TestGenerateContextRanksAgainstWallClock(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TransitionBoost = 0
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	if len(g.Forest.Trees) != 2 {
+		t.Fatalf("expected 2 trees, got %d", len(g.Forest.Trees))
+	}
+
+	// Trees[0] was last touched a week ago; Trees[1] just now.
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour).UnixMilli()
+	stale, fresh := g.Forest.Trees[0], g.Forest.Trees[1]
+	stale.LastAccessed = weekAgo
+	stale.Root().LastAccessed = weekAgo
+	stale.Root().Weight = fresh.Root().Weight
+
+	ctx := g.GenerateContext()
+	iStale := strings.Index(ctx, stale.Root().Content)
+	iFresh := strings.Index(ctx, fresh.Root().Content)
+	if iStale < 0 || iFresh < 0 {
+		t.Fatalf("context missing a tree:\n%s", ctx)
+	}
+	if iFresh > iStale {
+		t.Errorf("recently touched tree should outrank the stale Trees[0]:\n%s", ctx)
+	}
+}
+
+func TestContextLimitKeepsHeaderAndFooter(t *testing.T) {
+	for _, limit := range []int{20, 50, 0} {
+		cfg := DefaultConfig()
+		cfg.ContextLimit = limit
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("add JWT authentication to the API", "p1")
+		g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+		g.ProcessPrompt("fix the database migration schema error", "p3")
+
+		ctx := g.GenerateContext()
+		if !strings.HasPrefix(ctx, "[Focus |") || !strings.Contains(ctx, "trees]\n") {
+			t.Errorf("limit %d: header missing or cut: %q", limit, ctx)
+		}
+		if !strings.HasSuffix(ctx, ContextFooter) {
+			t.Errorf("limit %d: footer missing: %q", limit, ctx)
+		}
+		if limit > 0 && len(ctx) > MinContextLimit {
+			t.Errorf("limit %d: len = %d, want <= %d", limit, len(ctx), MinContextLimit)
+		}
+		for _, line := range strings.SplitAfter(ctx, "\n") {
+			if line != "" && !strings.HasSuffix(line, "\n") {
+				t.Errorf("limit %d: partial line %q", limit, line)
+			}
+		}
+		if limit == 0 && !strings.Contains(ctx, "database") {
+			t.Errorf("limit 0 should not truncate: %q", ctx)
+		}
+	}
+}
+
+func TestContextLimitDropsWholeTrees(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("style the frontend react component", "p3")
+	g.ProcessPrompt("add JWT authentication to the API", "p4")
+
+	g.Config.ContextLimit = 0
+	full := g.GenerateContext()
+	if !strings.Contains(full, "-> next:") {
+		t.Fatalf("setup: no prediction line:\n%s", full)
+	}
+	// Split the unlimited body into header, tree blocks and prediction.
+	lines := strings.SplitAfter(strings.TrimSuffix(full, ContextFooter), "\n")
+	header := lines[0]
+	var blocks []string
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "  ["):
+			blocks = append(blocks, line)
+		case strings.HasPrefix(line, "    - "):
+			blocks[len(blocks)-1] += line
+		}
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("setup: want 3 trees, got %d:\n%s", len(blocks), full)
+	}
+
+	// Room for two trees plus most of the third, but not the prediction.
+	g.Config.ContextLimit = len(header) + len(blocks[0]) + len(blocks[1]) + len(blocks[2]) - 1 + len(ContextFooter)
+	ctx := g.GenerateContext()
+	want := header + blocks[0] + blocks[1] + ContextFooter
+	if ctx != want {
+		t.Errorf("context = %q\nwant       %q", ctx, want)
+	}
+	if strings.Contains(ctx, strings.SplitN(blocks[2], "\n", 2)[0]) {
+		t.Errorf("partial third tree emitted:\n%s", ctx)
+	}
+
+	// With room for all trees but not the prediction, only the prediction goes.
+	g.Config.ContextLimit = len(header) + len(blocks[0]) + len(blocks[1]) + len(blocks[2]) + len(ContextFooter)
+	if ctx := g.GenerateContext(); ctx != header+strings.Join(blocks, "")+ContextFooter {
+		t.Errorf("prediction line should be dropped first:\n%s", ctx)
+	}
+}
+
+func TestContextTemplateMarkdown(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.Config.ContextTemplate = "## Focus ({{.TotalPrompts}} prompts)\n" +
+		"{{range .Trees}}- **{{.Root}}**\n{{range .Leaves}}  - {{.}}\n{{end}}{{end}}"
+
+	ctx := g.GenerateContextTemplated()
+	want := "## Focus (2 prompts)\n"
+	for _, ct := range g.contextSummary().Trees {
+		want += "- **" + ct.Root + "**\n"
+	}
+	if ctx != want {
+		t.Errorf("templated context = %q\nwant                %q", ctx, want)
+	}
+	if out := g.ProcessPrompt("style the frontend react component", "p3"); !strings.HasPrefix(out, "## Focus (3 prompts)\n- **") {
+		t.Errorf("ProcessPrompt should render with the template, got:\n%s", out)
+	}
+
+	// The limit drops the lowest-ranked trees rather than cutting a line.
+	full := g.GenerateContextTemplated()
+	g.Config.ContextLimit = len(full) - 1
+	ctx = g.GenerateContextTemplated()
+	lines := strings.SplitAfter(full, "\n")
+	if want := strings.Join(lines[:3], ""); ctx != want {
+		t.Errorf("limited context = %q, want the top two trees %q", ctx, want)
+	}
+}
+
+func TestContextTemplateInvalidFallsBack(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	want := g.GenerateContext()
+
+	for _, tmpl := range []string{"{{range .Trees}}", "{{.NoSuchField}}"} {
+		var log strings.Builder
+		g.Log = &log
+		g.Config.ContextTemplate = tmpl
+		if ctx := g.GenerateContextTemplated(); ctx != want {
+			t.Errorf("template %q: context = %q, want the built-in block %q", tmpl, ctx, want)
+		}
+		if !strings.HasPrefix(log.String(), "focus-gate: contextTemplate: ") {
+			t.Errorf("template %q: logged %q, want a contextTemplate error", tmpl, log.String())
+		}
+	}
+
+	g.Config.ContextTemplate = ""
+	if ctx := g.GenerateContextTemplated(); ctx != want {
+		t.Errorf("empty template: context = %q, want the built-in block", ctx)
+	}
+}
+
+func TestGenerateContextJSON(t *testing.T) {
+	g := newTestGate()
+	auth := "add JWT authentication to the API"
+	db := "fix the database migration schema error"
+	// Alternate topics so auth → db becomes a strong transition, ending on auth.
+	for i := 0; i < 3; i++ {
+		g.ProcessPrompt(auth, fmt.Sprintf("a%d", i))
+		g.ProcessPrompt(db, fmt.Sprintf("d%d", i))
+	}
+	g.ProcessPrompt(auth, "a3")
+
+	data, err := g.GenerateContextJSON()
+	if err != nil {
+		t.Fatalf("GenerateContextJSON: %v", err)
+	}
+	var sum ContextSummary
+	if err := json.Unmarshal(data, &sum); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, data)
+	}
+
+	if len(sum.Trees) == 0 {
+		t.Fatalf("no trees in JSON: %s", data)
+	}
+	// The text block shows the same top tree and score.
+	top := sum.Trees[0]
+	ctx := g.GenerateContext()
+	if !strings.Contains(ctx, fmt.Sprintf("  [%.2f] %s\n", top.Score, top.Root)) {
+		t.Errorf("text context lacks top tree [%.2f] %s:\n%s", top.Score, top.Root, ctx)
+	}
+
+	if len(sum.Next) == 0 {
+		t.Fatalf("expected next-topic predictions: %s", data)
+	}
+	if sum.Next[0].Probability < 0.3 || sum.Next[0].Name == "" {
+		t.Errorf("prediction = %+v, want probability >= 0.3 and a name", sum.Next[0])
+	}
+	if !strings.Contains(ctx, "-> next:") {
+		t.Errorf("text context should include the prediction line:\n%s", ctx)
+	}
+}
+
+func TestPruneRemovesRecordedTokens(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.Forest.Trees[0].Pinned = true
+	docFreq, docs := maps.Clone(g.Engine.DocFreq), g.Engine.TotalDocs
+
+	g.ProcessPrompt("speed up the image loaders and parsers", "p2")
+	g.ProcessPrompt("cache decoded image loaders", "p3")
+	if len(g.Forest.Trees) != 2 {
+		t.Fatalf("setup: %d trees, want 2", len(g.Forest.Trees))
+	}
+
+	// A later run stems differently, so re-tokenizing the stored prompts
+	// would no longer match what was added to the corpus.
+	cfg := g.Config
+	cfg.Tokenizer.AggressiveStemming = true
+	later := NewWithChain(g.Forest, g.Engine, g.Chain, cfg)
+	leaf := g.Forest.Trees[1].GetLeaves()[0]
+	if slices.Equal(later.Tokenize(leaf.Content), leaf.Tokens) {
+		t.Fatalf("tokenizer change should alter %q's tokens", leaf.Content)
+	}
+
+	later.Prune(1)
+	if len(g.Forest.Trees) != 1 {
+		t.Fatalf("prune left %d trees, want the pinned one", len(g.Forest.Trees))
+	}
+	if !maps.Equal(g.Engine.DocFreq, docFreq) || g.Engine.TotalDocs != docs {
+		t.Errorf("corpus after prune = %v (%d docs), want %v (%d docs)", g.Engine.DocFreq, g.Engine.TotalDocs, docFreq, docs)
+	}
+}
+
+func TestUndoNewRemovesTreeAndDocument(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	docs := g.Engine.TotalDocs
+	firstTree := g.Forest.Trees[0].ID
+
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	if len(g.Forest.Trees) != 2 || g.LastJournal.Action != "new" {
+		t.Fatalf("setup: %d trees, action %q", len(g.Forest.Trees), g.LastJournal.Action)
+	}
+
+	if err := g.Undo(g.LastJournal); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if len(g.Forest.Trees) != 1 || g.Forest.Trees[0].ID != firstTree {
+		t.Errorf("undo should remove the new tree, %d trees remain", len(g.Forest.Trees))
+	}
+	if g.Engine.TotalDocs != docs {
+		t.Errorf("TotalDocs = %d, want %d", g.Engine.TotalDocs, docs)
+	}
+	if _, ok := g.Engine.DocFreq["schema"]; ok {
+		t.Error("undone prompt's terms should leave the corpus")
+	}
+	if g.Forest.Meta.TotalPrompts != 1 {
+		t.Errorf("TotalPrompts = %d, want 1", g.Forest.Meta.TotalPrompts)
+	}
+	if g.Chain.LastTopic != firstTree || g.Chain.TransitionCount() != 0 {
+		t.Errorf("chain not rolled back: last=%s transitions=%d", g.Chain.LastTopic, g.Chain.TransitionCount())
+	}
+}
+
+func TestMarkovHistoryFollowsPrompts(t *testing.T) {
+	g := newTestGate()
+	g.Config.MarkovHistorySize = 10
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("refresh the JWT authentication token", "p3")
+	if len(g.Forest.Trees) != 2 {
+		t.Fatalf("setup: %d trees, want 2", len(g.Forest.Trees))
+	}
+	auth, db := g.Forest.Trees[0].ID, g.Forest.Trees[1].ID
+	if want := []string{auth, db, auth}; !slices.Equal(g.Chain.History, want) {
+		t.Errorf("History = %v, want %v", g.Chain.History, want)
+	}
+
+	if err := g.Undo(g.LastJournal); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if want := []string{auth, db}; !slices.Equal(g.Chain.History, want) {
+		t.Errorf("History after undo = %v, want %v", g.Chain.History, want)
+	}
+}
+
+func TestUndoExtendRemovesOnlyAddedChild(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	tree := g.Forest.Trees[0]
+	nodes := tree.NodeCount()
+	root := tree.Root().Content
+	docs := g.Engine.TotalDocs
+
+	g.ProcessPrompt("JWT authentication token refresh for the API", "p3")
+	if len(g.Forest.Trees) != 1 || g.LastJournal.Action == "new" {
+		t.Fatalf("setup: expected a prompt into the existing tree, got %q", g.LastJournal.Action)
+	}
+	if len(g.LastJournal.Added) != 1 {
+		t.Fatalf("journal added %v, want one child", g.LastJournal.Added)
+	}
+	added := g.LastJournal.Added[0]
+
+	if err := g.Undo(g.LastJournal); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if tree.NodeCount() != nodes || tree.Nodes[added] != nil {
+		t.Errorf("NodeCount = %d, want %d without %s", tree.NodeCount(), nodes, added)
+	}
+	if tree.Root().Content != root {
+		t.Errorf("root content = %q, want %q", tree.Root().Content, root)
+	}
+	if g.Engine.TotalDocs != docs {
+		t.Errorf("TotalDocs = %d, want %d", g.Engine.TotalDocs, docs)
+	}
+}
+
+func TestBridgingPromptReportsSecondTree(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MergeDelta = 0.1
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("style the frontend react component", "p3")
+
+	bridge := g.DryRun("JWT authentication for the database migration")
+	if bridge.SecondTree < 0 || bridge.SecondTree == bridge.BestTree {
+		t.Fatalf("bridging prompt: SecondTree = %d (best %d)", bridge.SecondTree, bridge.BestTree)
+	}
+	if bridge.BestScore-bridge.SecondScore > cfg.MergeDelta {
+		t.Errorf("runner-up %.3f not within %.2f of best %.3f", bridge.SecondScore, cfg.MergeDelta, bridge.BestScore)
+	}
+
+	single := g.DryRun("fix JWT authentication token expiry")
+	if single.SecondTree != -1 {
+		t.Errorf("single-topic prompt: SecondTree = %d, want -1", single.SecondTree)
+	}
+
+	// Processing bridging prompts counts them per tree pair.
+	g.ProcessPrompt("JWT authentication for the database migration", "p4")
+	auth, db := g.Forest.Trees[0].ID, g.Forest.Trees[1].ID
+	if got := g.Forest.Bridges[forest.BridgeKey(auth, db)]; got != 1 {
+		t.Errorf("bridge count = %d, want 1 (%v)", got, g.Forest.Bridges)
+	}
+}
+
+// Ensure fmt and markov are used
+var _ = fmt.Sprintf
+var _ = markov.New
+
+func TestSearchRanksMatchingLeafFirst(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+	g.ProcessPrompt("refresh JWT authentication token expiry", "p3")
+	g.ProcessPrompt("style the frontend react component", "p4")
+
+	before, _ := json.Marshal(g.Forest)
+	docs, version := g.Engine.TotalDocs, g.Engine.Version
+
+	hits := g.Search("token expiry", nil, 5)
+	if len(hits) == 0 {
+		t.Fatal("expected search hits")
+	}
+	top := hits[0]
+	tree := g.Forest.TreeByID(top.TreeID)
+	if tree == nil || tree.Nodes[top.NodeID] == nil {
+		t.Fatalf("top hit %+v does not resolve to a node", top)
+	}
+	if top.Content != "refresh JWT authentication token expiry" {
+		t.Errorf("top hit = %q, want the token expiry leaf", top.Content)
+	}
+	if !tree.Nodes[top.NodeID].IsLeaf() {
+		t.Errorf("top hit %s should be a leaf", top.NodeID)
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score > hits[i-1].Score {
+			t.Errorf("hits not sorted by score: %v", hits)
+		}
+	}
+
+	after, _ := json.Marshal(g.Forest)
+	if string(before) != string(after) || g.Engine.TotalDocs != docs || g.Engine.Version != version {
+		t.Error("Search must not mutate the forest or engine")
+	}
+}
+
+func TestSearchUnrelatedQueryScoresLow(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+
+	for _, h := range g.Search("kubernetes helm chart rollout", nil, 10) {
+		if h.Score > 0.1 {
+			t.Errorf("unrelated query matched %q with score %.3f", h.Content, h.Score)
+		}
+	}
+}
+
+func TestSearchIncludesGuideSummaries(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix the database migration schema error", "p2")
+
+	gd := guide.New(5)
+	root := g.Forest.Trees[1].RootID
+	gd.Add("Rewrote the schema migration rollback script", root, nil)
+
+	var found bool
+	for _, h := range g.Search("schema rollback", gd, 10) {
+		if h.Kind == "guide" {
+			found = true
+			if h.TreeID != g.Forest.Trees[1].ID {
+				t.Errorf("guide hit tree = %s, want %s", h.TreeID, g.Forest.Trees[1].ID)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a guide summary hit")
+	}
+	for _, h := range g.Search("schema rollback", nil, 10) {
+		if h.Kind == "guide" {
+			t.Error("guide summaries should only be searched when a guide is given")
+		}
+	}
+}
+
+// deepChain builds a single tree whose nodes form a chain of the given depth
+// and returns the gate and the deepest node's ID.
+func deepChain(t *testing.T, cfg Config, depth int) (*Gate, string) {
+	t.Helper()
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	tree := forest.NewTree("auth root", "p0")
+	g.Forest.AddTree(tree)
+	id := tree.RootID
+	for d := 1; d <= depth; d++ {
+		id = tree.AddChild(id, fmt.Sprintf("auth level %d", d), "").ID
+	}
+	return g, id
+}
+
+func TestMaxDepthFlattensExtend(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxDepth = 2
+	g, leafID := deepChain(t, cfg, 5)
+	tree := g.Forest.Trees[0]
+	before := tree.NodeCount()
+
+	var added []*forest.Node
+	for i := 0; i < 3; i++ {
+		ids := make(map[string]bool, len(tree.Nodes))
+		for id := range tree.Nodes {
+			ids[id] = true
+		}
+		g.apply(Classification{Action: ActionExtend, TreeIdx: 0, LeafID: leafID}, fmt.Sprintf("refresh token rotation %d", i), "p", nil)
+		for id, n := range tree.Nodes {
+			if !ids[id] {
+				added = append(added, n)
+				leafID = id // extend the newest node next, as a deepening chain would
+			}
+		}
+	}
+
+	if got := tree.NodeCount(); got != before+3 {
+		t.Fatalf("node count = %d, want %d", got, before+3)
+	}
+	parent := added[0].ParentID
+	for _, n := range added {
+		if n.Depth > cfg.MaxDepth {
+			t.Errorf("node %q at depth %d, want <= %d", n.Content, n.Depth, cfg.MaxDepth)
+		}
+		if n.ParentID != parent {
+			t.Errorf("capped nodes should share a parent, got %s and %s", n.ParentID, parent)
+		}
+	}
+
+	// The re-targeted parent is regenerated from its new children.
+	if p := tree.Nodes[parent]; !strings.Contains(p.Content, "refresh") {
+		t.Errorf("parent abstraction %q should include the new children's terms", p.Content)
+	}
+}
+
+func TestMaxDepthZeroIsUnlimited(t *testing.T) {
+	g, leafID := deepChain(t, DefaultConfig(), 5)
+	tree := g.Forest.Trees[0]
+	g.apply(Classification{Action: ActionExtend, TreeIdx: 0, LeafID: leafID}, "refresh token rotation", "p", nil)
+
+	for _, n := range tree.Nodes {
+		if n.Content == "refresh token rotation" && n.Depth != 5 {
+			t.Errorf("uncapped extend depth = %d, want 5 (sibling of the deepest leaf)", n.Depth)
+		}
+	}
+}
+
+// maxChildrenGate returns a gate that branches every prompt sharing a term
+// with its one tree, capped at three children per node.
+func maxChildrenGate() *Gate {
+	cfg := DefaultConfig()
+	cfg.ExtendThreshold = 2
+	cfg.BranchThreshold = 0.01
+	cfg.MaxChildren = 3
+	return New(forest.NewForest(), tfidf.NewEngine(), cfg)
+}
+
+func TestMaxChildrenGroupsSimilarChildren(t *testing.T) {
+	g := maxChildrenGate()
+	g.ProcessPrompt("JWT auth token expiry in the billing service", "p1")
+	g.ProcessPrompt("database migration schema for the billing service", "p2")
+	g.ProcessPrompt("JWT auth token refresh in the billing service", "p3")
+	tree := g.Forest.Trees[0]
+	if n := len(tree.Root().ChildIDs); n != 3 {
+		t.Fatalf("setup: root has %d children, want 3", n)
+	}
+
+	g.ProcessPrompt("frontend react component for the billing service", "p4")
+	if len(g.Forest.Trees) != 1 {
+		t.Fatalf("setup: expected every prompt in one tree, got %d trees", len(g.Forest.Trees))
+	}
+	root := tree.Root()
+	if n := len(root.ChildIDs); n != 3 {
+		t.Errorf("root has %d children, want 3 (the cap)", n)
+	}
+
+	var group *forest.Node
+	for _, id := range root.ChildIDs {
+		if n := tree.Nodes[id]; !n.IsLeaf() {
+			group = n
+		}
+	}
+	if group == nil {
+		t.Fatal("no intermediate node under the root: children fanned out flat")
+	}
+	var grouped []string
+	for _, c := range tree.GetChildren(group.ID) {
+		grouped = append(grouped, c.Content)
+		if c.Depth != group.Depth+1 {
+			t.Errorf("grouped node %q at depth %d, want %d", c.Content, c.Depth, group.Depth+1)
+		}
+	}
+	slices.Sort(grouped)
+	want := []string{"JWT auth token expiry in the billing service", "JWT auth token refresh in the billing service"}
+	if !slices.Equal(grouped, want) {
+		t.Errorf("grouped %q, want the two JWT prompts", grouped)
+	}
+	if !strings.Contains(group.Content, "jwt") {
+		t.Errorf("group abstraction %q should be regenerated from its children", group.Content)
+	}
+}
+
+func TestMaxChildrenRespectsMaxDepth(t *testing.T) {
+	g := maxChildrenGate()
+	g.Config.MaxDepth = 1
+	for i, p := range []string{
+		"JWT auth token expiry in the billing service",
+		"database migration schema for the billing service",
+		"JWT auth token refresh in the billing service",
+		"frontend react component for the billing service",
+	} {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+	}
+	for _, n := range g.Forest.Trees[0].Nodes {
+		if n.Depth > 1 {
+			t.Errorf("node %q at depth %d: grouping must not break MaxDepth", n.Content, n.Depth)
+		}
+	}
+}
+
+func TestUndoUngroupsChildren(t *testing.T) {
+	g := maxChildrenGate()
+	g.ProcessPrompt("JWT auth token expiry in the billing service", "p1")
+	g.ProcessPrompt("database migration schema for the billing service", "p2")
+	g.ProcessPrompt("JWT auth token refresh in the billing service", "p3")
+	tree := g.Forest.Trees[0]
+	nodes := tree.NodeCount()
+	children := slices.Clone(tree.Root().ChildIDs)
+	docs := g.Engine.TotalDocs
+
+	g.ProcessPrompt("frontend react component for the billing service", "p4")
+	if len(g.LastJournal.Added) != 2 {
+		t.Fatalf("setup: journal added %v, want the prompt and a group node", g.LastJournal.Added)
+	}
+	if err := g.Undo(g.LastJournal); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	if tree.NodeCount() != nodes {
+		t.Errorf("NodeCount = %d, want %d", tree.NodeCount(), nodes)
+	}
+	got := slices.Clone(tree.Root().ChildIDs)
+	slices.Sort(got)
+	slices.Sort(children)
+	if !slices.Equal(got, children) {
+		t.Errorf("root children = %v, want %v", got, children)
+	}
+	for _, id := range children {
+		if d := tree.Nodes[id].Depth; d != 1 {
+			t.Errorf("restored child %s at depth %d, want 1", id, d)
+		}
+	}
+	if g.Engine.TotalDocs != docs {
+		t.Errorf("TotalDocs = %d, want %d", g.Engine.TotalDocs, docs)
+	}
+}
+
+func TestCompactMergesNearDuplicateLeaves(t *testing.T) {
+	g := newTestGate()
+	tree := forest.NewTree("login work", "p0")
+	g.Forest.AddTree(tree)
+
+	prompts := []string{"fix the login bug", "fix login bug", "login bug fix", "style the frontend react component"}
+	var leaves []*forest.Node
+	for i, p := range prompts {
+		n := tree.AddChild(tree.RootID, p, fmt.Sprintf("p%d", i+1))
+		n.Indexed = true
+		n.Frequency = i + 1
+		n.LastAccessed = int64(1000 * (i + 1))
+		g.Engine.AddDocument(g.Tokenize(p))
+		leaves = append(leaves, n)
+	}
+	g.bubbleUp(tree, tree.RootID)
+	docs := g.Engine.TotalDocs
+
+	if merged := g.Compact(tree); merged != 2 {
+		t.Fatalf("Compact merged %d leaves, want 2", merged)
+	}
+
+	survivor := tree.Nodes[leaves[0].ID]
+	if survivor == nil || tree.Nodes[leaves[1].ID] != nil || tree.Nodes[leaves[2].ID] != nil {
+		t.Fatal("the duplicates should fold into the first leaf")
+	}
+	if survivor.Frequency != 1+2+3 {
+		t.Errorf("Frequency = %d, want 6", survivor.Frequency)
+	}
+	if survivor.LastAccessed != 3000 {
+		t.Errorf("LastAccessed = %d, want the newest (3000)", survivor.LastAccessed)
+	}
+	if len(survivor.Sources) != 3 {
+		t.Errorf("Sources = %v, want the union of all three", survivor.Sources)
+	}
+	if tree.Nodes[leaves[3].ID] == nil {
+		t.Error("an unrelated sibling should not be merged")
+	}
+
+	if g.Engine.TotalDocs != docs-2 {
+		t.Errorf("TotalDocs = %d, want %d", g.Engine.TotalDocs, docs-2)
+	}
+	if df := g.Engine.DocFreq["login"]; df != 1 {
+		t.Errorf("DocFreq[login] = %d, want 1", df)
+	}
+	if df := g.Engine.DocFreq["react"]; df != 1 {
+		t.Errorf("DocFreq[react] = %d, want 1 (untouched)", df)
+	}
+	if !strings.Contains(tree.Root().Content, "login") {
+		t.Errorf("root abstraction %q should be regenerated", tree.Root().Content)
+	}
+}
+
+// topicTree adds a tree with root content root and one indexed leaf per
+// prompt to g's forest.
+func topicTree(g *Gate, root string, prompts ...string) *forest.Tree {
+	tree := forest.NewTree(root, "")
+	for i, p := range prompts {
+		n := tree.AddChild(tree.RootID, p, fmt.Sprintf("p%d", i))
+		n.Indexed = true
+		n.Tokens = g.Tokenize(p)
+		g.Engine.AddDocument(n.Tokens)
+	}
+	g.Forest.AddTree(tree)
+	return tree
+}
+
+func TestDedupeTreesMergesIdenticalRoots(t *testing.T) {
+	g := newTestGate()
+	first := topicTree(g, "jwt | authent | token", "add JWT authentication to the API", "fix JWT token expiry")
+	other := topicTree(g, "databas | migrat | schema", "fix the database migration schema error")
+	dup := topicTree(g, "JWT |  authent | token", "refresh the JWT authentication token", "JWT auth middleware tests")
+	var leaves []string
+	for _, tree := range []*forest.Tree{first, dup} {
+		for _, leaf := range tree.GetLeaves() {
+			leaves = append(leaves, leaf.ID)
+		}
+	}
+	g.Chain.Record(first.ID, dup.ID)
+	g.Chain.Record(dup.ID, other.ID)
+	g.Chain.LastTopic = dup.ID
+	g.Forest.RecordBridge(dup.ID, other.ID)
+	docs := g.Engine.TotalDocs
+
+	if n := g.DedupeTrees(); n != 1 {
+		t.Fatalf("DedupeTrees = %d, want 1", n)
+	}
+	if len(g.Forest.Trees) != 2 || g.Forest.Trees[0] != first || g.Forest.Trees[1] != other {
+		t.Fatalf("want the duplicate folded into the first tree, leaving 2 trees")
+	}
+	for _, id := range leaves {
+		if n := first.Nodes[id]; n == nil || !n.IsLeaf() || n.Depth != 1 {
+			t.Errorf("leaf %s should be kept under the merged root", id)
+		}
+	}
+	if !strings.Contains(first.Root().Content, "jwt") {
+		t.Errorf("merged root %q should be regenerated from all four prompts", first.Root().Content)
+	}
+	if g.Engine.TotalDocs != docs {
+		t.Errorf("TotalDocs = %d, want %d: every prompt survives", g.Engine.TotalDocs, docs)
+	}
+	if g.Chain.Counts[first.ID][first.ID] != 1 || g.Chain.Counts[first.ID][other.ID] != 1 || g.Chain.LastTopic != first.ID {
+		t.Errorf("transitions not consolidated: %v, LastTopic %q", g.Chain.Counts, g.Chain.LastTopic)
+	}
+	if g.Forest.Bridges[forest.BridgeKey(first.ID, other.ID)] != 1 {
+		t.Errorf("bridges not consolidated: %v", g.Forest.Bridges)
+	}
+}
+
+func TestDedupeTreesMergesRepeatedPrompt(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("fix the login bug", "p1")
+	g.ProcessPrompt("style the frontend react component", "p2")
+	g.Forest.AddTree(forest.NewTree("Fix the  login bug", "p3"))
+	root := g.Forest.Trees[2].Root()
+	root.Indexed = true
+	root.Tokens = g.Tokenize(root.Content)
+	g.Engine.AddDocument(root.Tokens)
+	docs := g.Engine.TotalDocs
+
+	if n := g.DedupeTrees(); n != 1 || len(g.Forest.Trees) != 2 {
+		t.Fatalf("DedupeTrees = %d leaving %d trees, want 1 and 2", n, len(g.Forest.Trees))
+	}
+	merged := g.Forest.Trees[0].Root()
+	if !merged.IsLeaf() || merged.Frequency != 2 || !slices.Equal(merged.Sources, []string{"p1", "p3"}) {
+		t.Errorf("merged prompt: leaf=%v frequency=%d sources=%v, want one node seen twice",
+			merged.IsLeaf(), merged.Frequency, merged.Sources)
+	}
+	if g.Engine.TotalDocs != docs-1 {
+		t.Errorf("TotalDocs = %d, want %d: the absorbed prompt leaves the corpus", g.Engine.TotalDocs, docs-1)
+	}
+}
+
+func TestDedupeTreesLeavesSimilarTrees(t *testing.T) {
+	g := newTestGate()
+	topicTree(g, "jwt | authent | token", "add JWT authentication to the API")
+	topicTree(g, "jwt | authent | session", "JWT authentication session cookies")
+	g.ProcessPrompt("fix the login bug", "p1")
+	g.ProcessPrompt("fix the logout bug", "p2")
+	trees := len(g.Forest.Trees)
+
+	if n := g.DedupeTrees(); n != 0 || len(g.Forest.Trees) != trees {
+		t.Errorf("DedupeTrees = %d leaving %d trees, want similar trees left alone (%d)", n, len(g.Forest.Trees), trees)
+	}
+}
+
+func TestMoveNodeReclassifiesLeaf(t *testing.T) {
+	g := newTestGate()
+	auth := topicTree(g, "jwt | authent | token", "add JWT authentication to the API", "fix JWT token expiry")
+	db := topicTree(g, "databas | migrat | schema", "fix the database migration schema error", "add a users table")
+	stray := db.Nodes[db.Root().ChildIDs[1]]
+	// Nest the stray prompt under an abstraction so the move shifts its depth.
+	group := db.Group(db.RootID, []string{stray.ID})
+	docs, df := g.Engine.TotalDocs, maps.Clone(g.Engine.DocFreq)
+
+	if err := g.MoveNode(stray.ID, 0); err != nil {
+		t.Fatalf("MoveNode: %v", err)
+	}
+	if auth.Nodes[stray.ID] != stray || db.Nodes[stray.ID] != nil {
+		t.Fatal("the node should move from the database tree to the auth tree")
+	}
+	if stray.ParentID != auth.RootID || stray.Depth != 1 {
+		t.Errorf("moved node parent=%s depth=%d, want the auth root at depth 1", stray.ParentID, stray.Depth)
+	}
+	if auth.NodeCount() != 4 || db.NodeCount() != 2 || db.Nodes[group.ID] != nil {
+		t.Errorf("auth %d nodes, db %d nodes; want 4 and 2 with the emptied group dropped", auth.NodeCount(), db.NodeCount())
+	}
+	if !strings.Contains(db.Root().Content, "databas") || strings.Contains(db.Root().Content, "user") {
+		t.Errorf("db root %q should be regenerated without the moved prompt", db.Root().Content)
+	}
+	if g.Engine.TotalDocs != docs || !maps.Equal(g.Engine.DocFreq, df) {
+		t.Error("moving a prompt should leave the TF-IDF corpus unchanged")
+	}
+
+	// Moving the last prompt out removes the source tree.
+	g.Chain.Record(auth.ID, db.ID)
+	if err := g.MoveNode(db.Root().ChildIDs[0], 0); err != nil {
+		t.Fatalf("MoveNode: %v", err)
+	}
+	if len(g.Forest.Trees) != 1 || auth.NodeCount() != 5 {
+		t.Errorf("want the emptied tree removed, leaving the auth tree with 5 nodes; got %d trees", len(g.Forest.Trees))
+	}
+	if g.Chain.Counts[auth.ID][auth.ID] != 1 {
+		t.Errorf("transitions into the removed tree should move to the target: %v", g.Chain.Counts)
+	}
+	if err := g.MoveNode(stray.ID, 0); err == nil {
+		t.Error("moving a node into its own tree should fail")
+	}
+
+	// A single-prompt tree's root moves as a prompt of its own, not merged.
+	g.ProcessPrompt("style the frontend react component", "p9")
+	single := g.Forest.Trees[1].Root()
+	if err := g.MoveNode(single.ID, 0); err != nil {
+		t.Fatalf("MoveNode: %v", err)
+	}
+	if len(g.Forest.Trees) != 1 || auth.Nodes[single.ID] != single || single.Depth != 1 || single.Frequency != 1 {
+		t.Errorf("single-prompt root should become a depth-1 leaf of the auth tree, got %d trees", len(g.Forest.Trees))
+	}
+}
+
+func TestReinforceThreshold(t *testing.T) {
+	setup := func(reinforce float64) (*Gate, *guide.Guide) {
+		cfg := DefaultConfig()
+		cfg.ReinforceThreshold = reinforce
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("add JWT authentication to the API", "p1")
+		g.ProcessPrompt("fix the database migration schema error", "p2")
+		gd := guide.New(5)
+		gd.Add("Updated the API docs and JWT examples for the new database", "", nil)
+		gd.Add("Sure, here's the code:", "", nil)
+		return g, gd
+	}
+
+	// Find the borderline summary's best root score to pick thresholds
+	// either side of it.
+	g, gd := setup(0)
+	vec := g.Engine.VectorizeTokens(g.Tokenize(gd.Entries[0].Summary))
+	best := 0.0
+	for _, tree := range g.Forest.Trees {
+		if s := tfidf.CosineSimilarity(vec, g.nodeVec(tree.RootID, tree.Root().Content)); s > best {
+			best = s
+		}
+	}
+	if best < g.Config.BranchThreshold || best > 0.9 {
+		t.Fatalf("summary score %.3f is not borderline for this test", best)
+	}
+
+	// Zero falls back to the branch threshold, as before the knob existed.
+	if n := g.ReinforceFromGuide(gd); n != 1 {
+		t.Errorf("coupled threshold reinforced %d entries, want 1", n)
+	}
+
+	g, gd = setup(best + 0.05)
+	if n := g.ReinforceFromGuide(gd); n != 0 {
+		t.Errorf("strict threshold reinforced %d entries, want 0", n)
+	}
+	for _, e := range gd.Entries {
+		if !e.Reinforced {
+			t.Errorf("entry %q should be marked processed even when not reinforced", e.Summary)
+		}
+	}
+}
+
+// checkCorpus fails the test unless the engine's document frequencies are
+// exactly those of the indexed nodes in the forest.
+func checkCorpus(t *testing.T, g *Gate, when string) {
+	t.Helper()
+	want := tfidf.NewEngine()
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Indexed {
+				want.AddDocument(g.Tokenize(n.Content))
+			}
+		}
+	}
+	if g.Engine.TotalDocs != want.TotalDocs {
+		t.Errorf("%s: TotalDocs = %d, want %d", when, g.Engine.TotalDocs, want.TotalDocs)
+	}
+	if fmt.Sprint(g.Engine.DocFreq) != fmt.Sprint(want.DocFreq) {
+		t.Errorf("%s: DocFreq = %v, want %v", when, g.Engine.DocFreq, want.DocFreq)
+	}
+}
+
+func TestIndexAbstractionsWeightsAbstractionTerms(t *testing.T) {
+	// "nationalization" stems to "national", which stems again to "nat":
+	// the abstraction's own token never occurs in a prompt document.
+	build := func(index bool) *Gate {
+		cfg := DefaultConfig()
+		cfg.IndexAbstractions = index
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("nationalization of the railways", "p1")
+		g.ProcessPrompt("nationalization of the banks", "p2")
+		if len(g.Forest.Trees) != 1 || g.Forest.Trees[0].NodeCount() < 3 {
+			t.Fatalf("setup: want one tree with an abstraction root")
+		}
+		return g
+	}
+	score := func(g *Gate) float64 {
+		root := g.Forest.Trees[0].Root()
+		prompt := g.Engine.VectorizeTokens(g.Tokenize("national"))
+		return tfidf.CosineSimilarity(prompt, g.nodeVec(root.ID, root.Content))
+	}
+
+	if s := score(build(false)); s != 0 {
+		t.Errorf("without indexing: abstraction match = %.3f, want 0", s)
+	}
+	g := build(true)
+	if s := score(g); s <= 0 {
+		t.Errorf("with indexAbstractions: abstraction match = %.3f, want > 0", s)
+	}
+	if !g.Forest.Trees[0].Root().Indexed {
+		t.Error("abstraction root should be marked indexed")
+	}
+}
+
+func TestIndexAbstractionsKeepsDocFreqBalanced(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.IndexAbstractions = true
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT authentication token expiry",
+		"JWT authentication token refresh for the API",
+		"fix the database migration schema error",
+		"database migration rollback",
+		"rotate the JWT authentication signing keys",
+	}
+	for i, p := range prompts {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+		checkCorpus(t, g, fmt.Sprintf("after prompt %d", i))
+	}
+
+	if err := g.Undo(g.LastJournal); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	checkCorpus(t, g, "after undo")
+
+	g.Prune(4)
+	checkCorpus(t, g, "after prune")
+}
+
+func TestConfidenceHighForDecisiveExtend(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("style the frontend react component", "p2")
+
+	res := g.DryRun("add JWT authentication to the API")
+	if res.BestAction != "extend" || res.BestScore < 0.9 {
+		t.Fatalf("setup: got %s at %.3f, want a near-exact extend", res.BestAction, res.BestScore)
+	}
+	if label := ConfidenceLabel(res.Confidence); label != ConfidenceHigh {
+		t.Errorf("confidence = %.3f (%s), want high", res.Confidence, label)
+	}
+	if cls := g.classify(g.Engine.VectorizeTokens(g.Tokenize(res.Prompt)), nil); cls.Confidence != res.Confidence {
+		t.Errorf("classify confidence %.3f != DryRun %.3f", cls.Confidence, res.Confidence)
+	}
+}
+
+func TestConfidenceLowNearThreshold(t *testing.T) {
+	g := newTestGate()
+	br, ext := g.Config.BranchThreshold, g.Config.ExtendThreshold
+
+	if c := g.confidence(ActionBranch, br+0.01, 0); ConfidenceLabel(c) != ConfidenceLow {
+		t.Errorf("branch just over threshold: confidence %.3f, want low", c)
+	}
+	if c := g.confidence(ActionExtend, ext+0.01, 0); ConfidenceLabel(c) != ConfidenceLow {
+		t.Errorf("extend just over threshold: confidence %.3f, want low", c)
+	}
+	// A rival tree scoring right behind makes even a strong match uncertain.
+	if c := g.confidence(ActionExtend, 0.95, 0.94); ConfidenceLabel(c) != ConfidenceLow {
+		t.Errorf("close runner-up: confidence %.3f, want low", c)
+	}
+	if c := g.confidence(ActionNew, 0, 0); c != 1 {
+		t.Errorf("no similarity at all: confidence %.3f, want 1", c)
+	}
+}
+
+// treeShape summarizes a forest as root content and node count per tree.
+func treeShape(f *forest.Forest) []string {
+	var shape []string
+	for _, t := range f.Trees {
+		shape = append(shape, fmt.Sprintf("%s (%d)", t.Root().Content, t.NodeCount()))
+	}
+	return shape
+}
+
+func TestProcessBatchMatchesIndividualPrompts(t *testing.T) {
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix the database migration schema error",
+		"fix JWT authentication token expiry",
+		"database migration rollback",
+		"JWT authentication token refresh for the API",
+	}
+
+	// One prompt per hook invocation: state is reloaded each time.
+	f, e, c := forest.NewForest(), tfidf.NewEngine(), markov.New()
+	for _, p := range prompts {
+		g := NewWithChain(f, e, c, DefaultConfig())
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", f.Meta.TotalPrompts))
+	}
+
+	b := newTestGate()
+	ctx, results := b.ProcessBatch(append([]string{"<system-reminder>x</system-reminder>", "the and of"}, prompts...))
+
+	if ctx == "" {
+		t.Fatal("batch returned no context")
+	}
+	if !results[0].Skipped || !results[1].Skipped {
+		t.Errorf("empty and stop-word-only prompts should be skipped: %+v", results[:2])
+	}
+	for i, r := range results[2:] {
+		if r.Skipped || r.Action == "" || b.Forest.TreeByID(r.TreeID) == nil {
+			t.Errorf("prompt %d: result %+v", i, r)
+		}
+	}
+	if got, want := fmt.Sprint(treeShape(b.Forest)), fmt.Sprint(treeShape(f)); got != want {
+		t.Errorf("batch trees = %s, want %s", got, want)
+	}
+	if b.Chain.TransitionCount() != c.TransitionCount() || b.Chain.TransitionCount() != len(prompts)-1 {
+		t.Errorf("transitions: batch %d, individual %d, want %d",
+			b.Chain.TransitionCount(), c.TransitionCount(), len(prompts)-1)
+	}
+	if b.Forest.Meta.TotalPrompts != len(prompts) {
+		t.Errorf("TotalPrompts = %d, want %d", b.Forest.Meta.TotalPrompts, len(prompts))
+	}
+}
+
+func TestReinforceTouchesBestMatchingLeaf(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	g.ProcessPrompt("JWT authentication token refresh for the API", "p3")
+	tree := g.Forest.Trees[0]
+
+	var refresh *forest.Node
+	freq := make(map[string]int)
+	for _, n := range tree.Nodes {
+		freq[n.ID] = n.Frequency
+		if strings.Contains(n.Content, "refresh") && n.IsLeaf() {
+			refresh = n
+		}
+	}
+	if refresh == nil || len(g.Forest.Trees) != 1 {
+		t.Fatal("setup: want one tree with a token refresh leaf")
+	}
+
+	gd := guide.New(5)
+	gd.Add("Implemented JWT token refresh in the API authentication layer", "", nil)
+	if n := g.ReinforceFromGuide(gd); n != 1 {
+		t.Fatalf("reinforced %d entries, want 1", n)
+	}
+
+	for _, n := range tree.Nodes {
+		want := freq[n.ID]
+		if n == refresh {
+			want++
+		}
+		if n.Frequency != want {
+			t.Errorf("node %q frequency = %d, want %d", n.Content, n.Frequency, want)
+		}
+	}
+	if src := refresh.Sources[len(refresh.Sources)-1]; src != "guide-reinforce" {
+		t.Errorf("refresh leaf last source = %q, want guide-reinforce", src)
+	}
+
+	// The entry is reinforced only once.
+	if n := g.ReinforceFromGuide(gd); n != 0 {
+		t.Errorf("second pass reinforced %d entries, want 0", n)
+	}
+}
+
+func TestTermBoostPullsClassification(t *testing.T) {
+	build := func(boosts map[string]float64) *Gate {
+		cfg := DefaultConfig()
+		cfg.TermBoosts = boosts
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("billing invoice totals are wrong", "p1")
+		g.ProcessPrompt("database schema migration for the users table", "p2")
+		g.ProcessPrompt("kubernetes deployment rollout", "p3")
+		if len(g.Forest.Trees) != 3 {
+			t.Fatalf("setup: want 3 trees, got %d", len(g.Forest.Trees))
+		}
+		return g
+	}
+	prompt := "billing export from the users table schema"
+
+	plain := build(nil).DryRun(prompt)
+	if plain.BestTree != 1 {
+		t.Fatalf("setup: unboosted prompt should lean to the database tree, got tree %d", plain.BestTree)
+	}
+
+	g := build(map[string]float64{"billing": 4})
+	boosted := g.DryRun(prompt)
+	if boosted.BestTree != 0 {
+		t.Errorf("boosted prompt classified into tree %d, want the billing tree", boosted.BestTree)
+	}
+	if cls := g.classify(g.Engine.VectorizeTokens(g.Tokenize(prompt)), nil); cls.TreeIdx != boosted.BestTree || cls.Score != boosted.BestScore {
+		t.Errorf("classify (tree %d, %.4f) disagrees with dry run (tree %d, %.4f)",
+			cls.TreeIdx, cls.Score, boosted.BestTree, boosted.BestScore)
+	}
+	if _, ok := g.Engine.Options.Boosts["billing"]; ok {
+		t.Error("boost keys should be stemmed")
+	}
+}
+
+func TestMaxVectorTermsAppliesToDryRunAndClassify(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Vector.MaxTerms = 3
+	g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+	g.ProcessPrompt("add JWT authentication to the API gateway service layer", "p1")
+	g.ProcessPrompt("fix the database migration schema error in production", "p2")
+
+	prompt := "JWT authentication for the API gateway and database schema"
+	res := g.DryRun(prompt)
+	if len(res.Vector) != 3 {
+		t.Errorf("dry-run vector has %d terms, want 3", len(res.Vector))
+	}
+	cls := g.classify(g.Engine.VectorizeTokens(g.Tokenize(prompt)), nil)
+	if cls.TreeIdx != res.BestTree || cls.Score != res.BestScore {
+		t.Errorf("classify (tree %d, %.4f) disagrees with dry run (tree %d, %.4f)",
+			cls.TreeIdx, cls.Score, res.BestTree, res.BestScore)
+	}
+}
+
+func TestDryRunContributions(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("style the frontend react component", "p2")
+
+	res := g.DryRun("JWT authentication for the database")
+	var ts *TreeScore
+	for i := range res.TreeScores {
+		if len(res.TreeScores[i].RootContributions) > 0 {
+			ts = &res.TreeScores[i]
+		}
+	}
+	if ts == nil {
+		t.Fatal("no tree reported root contributions")
+	}
+	sum := 0.0
+	for i, c := range ts.RootContributions {
+		if i > 0 && c.Product > ts.RootContributions[i-1].Product {
+			t.Errorf("contributions not sorted: %+v", ts.RootContributions)
+		}
+		if c.Term == "databas" || c.Term == "database" {
+			t.Errorf("unshared term %q reported", c.Term)
+		}
+		sum += c.Product
+	}
+	if sum <= 0 {
+		t.Errorf("contributions sum %.4f, want positive", sum)
+	}
+	for _, other := range res.TreeScores {
+		if other.RootCosine == 0 && len(other.RootContributions) != 0 {
+			t.Errorf("tree %s: zero cosine but contributions %+v", other.TreeID, other.RootContributions)
+		}
+	}
+}
+
+func TestDryRunContributionsOnlyForCosine(t *testing.T) {
+	for _, metric := range []string{tfidf.MetricJaccard, tfidf.MetricDice} {
+		cfg := DefaultConfig()
+		cfg.SimilarityMetric = metric
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		g.ProcessPrompt("add JWT authentication to the API", "p1")
+		g.ProcessPrompt("fix JWT token expiry in the API", "p2")
+
+		res := g.DryRun("JWT authentication for the API")
+		if res.Metric != metric || len(res.TreeScores) == 0 || res.TreeScores[0].RootCosine <= 0 {
+			t.Fatalf("%s: dry run = %+v, want a scored tree", metric, res)
+		}
+		for _, ts := range res.TreeScores {
+			if len(ts.RootContributions) != 0 {
+				t.Errorf("%s: root contributions %+v, want none", metric, ts.RootContributions)
+			}
+			for _, ls := range ts.LeafScores {
+				if ls.Cosine > 0 && len(ls.Contributions) != 0 {
+					t.Errorf("%s: leaf %s contributions %+v, want none", metric, ls.LeafID, ls.Contributions)
+				}
+			}
+		}
+	}
+}
+
+func TestStatusContextForTagOnlyPrompt(t *testing.T) {
+	g := newTestGate()
+	if got := g.StatusContext(); !strings.HasPrefix(got, "[Focus | 0 prompts |") {
+		t.Errorf("empty forest status = %q, want a bare header", got)
+	}
+
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("style the frontend react component", "p2")
+	prompts := g.Forest.Meta.TotalPrompts
+	totals := fmt.Sprint(g.Chain.Totals)
+	last := g.Chain.LastTopic
+
+	raw := "<ide_opened_file>auth.go</ide_opened_file><ide_selection>func Login()</ide_selection>"
+	if cleaned := g.tokenizer.CleanPrompt(raw); cleaned != "" {
+		t.Fatalf("setup: CleanPrompt(%q) = %q, want empty", raw, cleaned)
+	}
+
+	ctx := g.StatusContext()
+	if ctx != g.GenerateContext() {
+		t.Errorf("StatusContext differs from GenerateContext:\n%s", ctx)
+	}
+	if !strings.Contains(ctx, "[Focus | 2 prompts |") {
+		t.Errorf("status context missing state header:\n%s", ctx)
+	}
+	if g.Forest.Meta.TotalPrompts != prompts {
+		t.Errorf("TotalPrompts = %d, want %d", g.Forest.Meta.TotalPrompts, prompts)
+	}
+	if got := fmt.Sprint(g.Chain.Totals); got != totals || g.Chain.LastTopic != last {
+		t.Errorf("markov changed: totals %s->%s, last %q->%q", totals, got, last, g.Chain.LastTopic)
+	}
+}
+
+func TestSplitTreeSeparatesClusters(t *testing.T) {
+	g := newTestGate()
+	tree := forest.NewTree("placeholder", "p0")
+	g.Forest.AddTree(tree)
+
+	auth := []string{"add JWT authentication to the API", "JWT token authentication expiry", "refresh the JWT authentication token"}
+	style := []string{"style the frontend react component", "react component frontend styling"}
+
+	// The style prompts sit under an intermediate node that the split must
+	// leave behind empty and drop.
+	mid := tree.AddChild(tree.RootID, "mid", "")
+	var authIDs, styleIDs []string
+	add := func(parentID, p string, i int) string {
+		n := tree.AddChild(parentID, p, fmt.Sprintf("p%d", i))
+		n.Indexed = true
+		n.Created = int64(1000 * i)
+		n.LastAccessed = int64(1000 * i)
+		g.Engine.AddDocument(g.Tokenize(p))
+		return n.ID
+	}
+	for i, p := range auth {
+		authIDs = append(authIDs, add(tree.RootID, p, i+1))
+	}
+	for i, p := range style {
+		styleIDs = append(styleIDs, add(mid.ID, p, len(auth)+i+1))
+	}
+	g.bubbleUp(tree, tree.RootID)
+	g.Chain.Record(tree.ID, tree.ID)
+	g.Chain.LastTopic = tree.ID
+	docs, df := g.Engine.TotalDocs, fmt.Sprint(g.Engine.DocFreq)
+
+	split, err := g.SplitTree(0)
+	if err != nil {
+		t.Fatalf("SplitTree: %v", err)
+	}
+	if len(g.Forest.Trees) != 2 || g.Forest.Trees[1] != split {
+		t.Fatalf("want the new tree appended, got %d trees", len(g.Forest.Trees))
+	}
+
+	for _, id := range authIDs {
+		if tree.Nodes[id] == nil || split.Nodes[id] != nil {
+			t.Errorf("auth leaf %s should stay in the original tree", id)
+		}
+	}
+	for _, id := range styleIDs {
+		n := split.Nodes[id]
+		if n == nil || tree.Nodes[id] != nil {
+			t.Fatalf("style leaf %s should move to the new tree", id)
+		}
+		if !n.Indexed || n.ParentID != split.RootID || n.Depth != 1 {
+			t.Errorf("moved leaf %s: indexed=%v parent=%s depth=%d", id, n.Indexed, n.ParentID, n.Depth)
+		}
+	}
+	if tree.Nodes[mid.ID] != nil {
+		t.Error("emptied intermediate node should be removed")
+	}
+	if !strings.Contains(split.Root().Content, "react") || strings.Contains(tree.Root().Content, "react") {
+		t.Errorf("abstractions not regenerated: %q / %q", tree.Root().Content, split.Root().Content)
+	}
+	if g.Engine.TotalDocs != docs || fmt.Sprint(g.Engine.DocFreq) != df {
+		t.Error("splitting should leave the TF-IDF corpus unchanged")
+	}
+
+	// Two of the five prompts moved, so the new topic gets 40% of the
+	// transitions, and the latest prompt was a style one.
+	if p := g.Chain.Counts[tree.ID][split.ID] + g.Chain.Counts[split.ID][split.ID]; math.Abs(p-0.4) > 1e-9 {
+		t.Errorf("transitions into new topic = %.3f, want 0.4", p)
+	}
+	if g.Chain.LastTopic != split.ID {
+		t.Errorf("LastTopic = %q, want the new tree", g.Chain.LastTopic)
+	}
+
+	if _, err := g.SplitTree(5); err == nil {
+		t.Error("out-of-range index should fail")
+	}
+}
+
+func TestReconcileRestoresCorpus(t *testing.T) {
+	g := newTestGate()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	g.ProcessPrompt("fix the database migration schema error", "p3")
+
+	if r := g.Reconcile(); r.Drifted() {
+		t.Fatalf("in-sync corpus reported drift: %+v", r)
+	}
+
+	// Simulate a lost engine save: one prompt missing, a stale term left over.
+	docs, version := g.Engine.TotalDocs, g.Engine.Version
+	g.Engine.RemoveDocument(g.Tokenize("fix the database migration schema error"))
+	g.Engine.DocFreq["stale"] = 4
+	g.Engine.TotalDocs = -1
+
+	r := g.Reconcile()
+	if !r.Drifted() || r.DocsAfter != docs || r.TermsFixed == 0 {
+		t.Errorf("Reconcile = %+v, want drift back to %d docs", r, docs)
+	}
+	checkCorpus(t, g, "after reconcile")
+	if g.Engine.Version <= version {
+		t.Error("Reconcile should bump the corpus version")
+	}
+}
+
+func TestSyncTokenizerReindexes(t *testing.T) {
+	g := newTestGate()
+	if _, changed := g.SyncTokenizer(); changed {
+		t.Fatal("empty corpus should only be stamped")
+	}
+	g.ProcessPrompt("running the database migrations", "p1")
+	g.ProcessPrompt("optimization of running queries", "p2")
+	if g.Engine.Stemmer != text.StemmerLight || g.Engine.DocFreq["runn"] == 0 {
+		t.Fatalf("light corpus: stemmer %q, terms %v", g.Engine.Stemmer, g.Engine.DocFreq)
+	}
+
+	cfg := g.Config
+	cfg.Tokenizer.Stemmer = text.StemmerPorter
+	porter := New(g.Forest, g.Engine, cfg)
+	from, changed := porter.SyncTokenizer()
+	if !changed || from != text.StemmerLight {
+		t.Fatalf("SyncTokenizer = %q, %v; want light, true", from, changed)
+	}
+	if g.Engine.Stemmer != text.StemmerPorter || g.Engine.DocFreq["runn"] != 0 || g.Engine.DocFreq["run"] != 2 {
+		t.Errorf("porter corpus: stemmer %q, terms %v", g.Engine.Stemmer, g.Engine.DocFreq)
+	}
+	checkCorpus(t, porter, "after restemming")
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Indexed && !slices.Equal(n.Tokens, porter.Tokenize(n.Content)) {
+				t.Errorf("node %s tokens %v not restemmed", n.ID, n.Tokens)
+			}
+		}
+	}
+
+	if _, changed := porter.SyncTokenizer(); changed {
+		t.Error("second SyncTokenizer should be a no-op")
+	}
+
+	// Options other than the stemmer change stored terms too.
+	cfg = porter.Config
+	cfg.Tokenizer.Bigrams = true
+	cfg.Tokenizer.Synonyms = map[string][]string{"database": {"db"}}
+	bigrams := New(g.Forest, g.Engine, cfg)
+	if from, changed := bigrams.SyncTokenizer(); !changed || from != text.StemmerPorter {
+		t.Fatalf("SyncTokenizer after bigrams = %q, %v; want porter, true", from, changed)
+	}
+	if g.Engine.DocFreq["databas migrat"] == 0 {
+		t.Errorf("bigram corpus: terms %v", g.Engine.DocFreq)
+	}
+	checkCorpus(t, bigrams, "after enabling bigrams")
+
+	// A corpus saved before fingerprints were recorded is re-indexed once.
+	g.Engine.Tokenizer = ""
+	if _, changed := bigrams.SyncTokenizer(); !changed || g.Engine.Tokenizer != bigrams.tokenizer.Fingerprint() {
+		t.Errorf("unrecorded fingerprint: changed %v, stamp %q", changed, g.Engine.Tokenizer)
+	}
+}
+
+func TestTreeFingerprint(t *testing.T) {
+	// Two forests built independently, with different wording, arrive at the
+	// same top terms and so the same fingerprint under different IDs.
+	build := func(prompts ...string) *forest.Tree {
+		g := newTestGate()
+		for i, p := range prompts {
+			g.ProcessPrompt(p, fmt.Sprintf("p%d", i))
+		}
+		if len(g.Forest.Trees) != 1 {
+			t.Fatalf("%q: want one tree, got %d", prompts, len(g.Forest.Trees))
+		}
+		return g.Forest.Trees[0]
+	}
+	a := build("fix jwt token expiry", "jwt token refresh fails")
+	b := build("jwt token refresh fails", "fix jwt token expiry")
+	if a.ID == b.ID || a.Fingerprint == "" || a.Fingerprint != b.Fingerprint {
+		t.Errorf("fingerprints %q (%s) and %q (%s), want equal and set", a.Fingerprint, a.ID, b.Fingerprint, b.ID)
+	}
+
+	g := newTestGate()
+	g.ProcessPrompt("fix jwt token expiry", "p1")
+	tree := g.Forest.Trees[0]
+	single := tree.Fingerprint
+	if single == "" {
+		t.Fatal("a new tree should have a fingerprint")
+	}
+	g.ProcessPrompt("jwt token refresh fails", "p2")
+	if tree.Root().IsLeaf() || tree.Fingerprint == single {
+		t.Errorf("fingerprint %q should change with the abstraction %q", tree.Fingerprint, tree.Root().Content)
+	}
+	want := forest.Fingerprint(strings.Split(tree.Root().Content, g.Config.separator()))
+	if tree.Fingerprint != want {
+		t.Errorf("fingerprint %q, want the root terms' %q", tree.Fingerprint, want)
+	}
+}
+
+func TestJaccardFallbackColdStart(t *testing.T) {
+	// The engine lost its corpus (cold start), so every term has zero IDF
+	// and both prompts vectorize to nothing.
+	build := func(threshold float64) *Gate {
+		cfg := DefaultConfig()
+		cfg.JaccardFallback = threshold
+		g := New(forest.NewForest(), tfidf.NewEngine(), cfg)
+		tree := forest.NewTree("kubernetes helm chart rollout", "p1")
+		tree.Root().Indexed = true
+		g.Forest.AddTree(tree)
+		return g
+	}
+	prompt := "kubernetes helm chart rollback"
+
+	off := build(0)
+	if vec := off.Engine.VectorizeTokens(off.Tokenize(prompt)); vec != nil {
+		t.Fatalf("setup: want a degenerate vector, got %v", vec)
+	}
+	off.ProcessPrompt(prompt, "p2")
+	if len(off.Forest.Trees) != 2 {
+		t.Errorf("fallback off: %d trees, want a new tree", len(off.Forest.Trees))
+	}
+
+	on := build(0.5)
+	if res := on.DryRun(prompt); res.BestAction != "branch" || res.Jaccard < 0.5 {
+		t.Errorf("dry run = %s (jaccard %.2f), want a Jaccard branch", res.BestAction, res.Jaccard)
+	}
+	on.ProcessPrompt(prompt, "p2")
+	if len(on.Forest.Trees) != 1 || on.Forest.Trees[0].NodeCount() != 3 {
+		t.Errorf("fallback on: %d trees, want both prompts in one tree", len(on.Forest.Trees))
+	}
+	if on.LastJournal.Action != "branch" {
+		t.Errorf("action = %s, want branch", on.LastJournal.Action)
+	}
+
+	// Unrelated prompts still start their own tree.
+	on.ProcessPrompt("postgres vacuum tuning", "p3")
+	if len(on.Forest.Trees) != 2 {
+		t.Errorf("unrelated prompt joined a tree: %d trees", len(on.Forest.Trees))
+	}
+}
+
+func TestMetricsAccumulate(t *testing.T) {
+	g := newTestGate()
+	g.Metrics = NewMetrics()
+	g.ProcessPrompt("add JWT authentication to the API", "p1")
+	g.ProcessPrompt("fix JWT authentication token expiry", "p2")
+	g.ProcessPrompt("fix the database migration schema error", "p3")
+
+	for _, stage := range []string{StageClassify, StageApply, StageContext} {
+		s := g.Metrics.Stages[stage]
+		if s == nil || s.Count != 3 {
+			t.Fatalf("%s: %+v, want 3 samples", stage, s)
+		}
+		if s.MeanMs <= 0 || s.MaxMs < s.MeanMs {
+			t.Errorf("%s: mean %.6f max %.6f, want positive timings", stage, s.MeanMs, s.MaxMs)
+		}
+	}
+	if names := g.Metrics.StageNames(); strings.Join(names, ",") != "classify,apply,context" {
+		t.Errorf("StageNames = %v", names)
+	}
+
+	// With metrics off nothing is timed; processing must still work.
+	off := newTestGate()
+	off.ProcessPrompt("add JWT authentication to the API", "p1")
+	if off.Metrics != nil {
+		t.Error("metrics should stay disabled")
+	}
+}
+
+func TestMetricsRunningMean(t *testing.T) {
+	m := NewMetrics()
+	for _, ms := range []int{1, 2, 6} {
+		m.Record(StageApply, time.Duration(ms)*time.Millisecond)
+	}
+	s := m.Stages[StageApply]
+	if s.Count != 3 || math.Abs(s.MeanMs-3) > 1e-9 || s.LastMs != 6 || s.MaxMs != 6 {
+		t.Errorf("timing = %+v, want count 3, mean 3, last 6, max 6", s)
+	}
+}
+
+func TestCalibrateSeparatesClusters(t *testing.T) {
+	f := forest.NewForest()
+	e := tfidf.NewEngine()
+	g := NewWithChain(f, e, markov.New(), DefaultConfig())
+	clusters := [][]string{
+		{"auth token session", "refresh the auth token", "expire the auth session", "auth token login session"},
+		{"database schema migration", "migrate the database schema", "rollback the schema migration", "database migration index"},
+		{"css layout theme", "fix the css grid layout", "dark theme css colours", "responsive layout theme"},
+	}
+	for _, cl := range clusters {
+		tree := forest.NewTree(cl[0], "")
+		e.AddDocument(g.Tokenize(cl[0]))
+		for _, leaf := range cl[1:] {
+			tree.AddChild(tree.RootID, leaf, "")
+			e.AddDocument(g.Tokenize(leaf))
+		}
+		f.AddTree(tree)
+	}
+	f.AddTree(forest.NewTree("lonely single node topic", ""))
+
+	c := g.Calibrate()
+	if c.Intra.Count != 9 || c.Inter.Count != 9*3 {
+		t.Fatalf("samples: %d intra, %d inter, want 9 and 27", c.Intra.Count, c.Inter.Count)
+	}
+	if c.Extend <= c.Inter.Max || c.Extend < c.Intra.Min || c.Extend > c.Intra.Max {
+		t.Errorf("extend %.3f should sit above inter-topic [%.3f, %.3f] and within intra-topic [%.3f, %.3f]",
+			c.Extend, c.Inter.Min, c.Inter.Max, c.Intra.Min, c.Intra.Max)
+	}
+	if c.Branch >= c.Extend {
+		t.Errorf("branch %.3f should be below extend %.3f", c.Branch, c.Extend)
+	}
+
+	if empty := NewWithChain(forest.NewForest(), tfidf.NewEngine(), markov.New(), DefaultConfig()).Calibrate(); empty.Extend != 0 || empty.Branch != 0 {
+		t.Errorf("empty forest suggested %+v", empty)
+	}
+}
+
+func TestDigestFavoursDominantTopic(t *testing.T) {
+	g := newTestGate()
+	if d := g.Digest(5); d != "" {
+		t.Errorf("empty forest digest = %q, want \"\"", d)
+	}
+
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT token expiry in authentication",
+		"refresh the JWT token after login",
+		"JWT authentication fails for expired token",
+		"migrate the database schema",
+	}
+	for i, p := range prompts {
+		g.ProcessPrompt(p, fmt.Sprintf("p%d", i+1))
+	}
+
+	terms := g.DigestTerms(3)
+	if len(terms) != 3 {
+		t.Fatalf("DigestTerms(3) = %v, want 3 terms", terms)
+	}
+	for i := 1; i < len(terms); i++ {
+		if terms[i].Weight > terms[i-1].Weight {
+			t.Errorf("terms not ordered by weight: %v", terms)
+		}
+	}
+	auth := make(map[string]bool)
+	for _, tok := range g.Tokenize(strings.Join(prompts[:4], " ")) {
+		auth[tok] = true
+	}
+	for _, tok := range g.Tokenize(prompts[4]) {
+		delete(auth, tok)
+	}
+	for _, term := range terms {
+		if !auth[term.Word] {
+			t.Errorf("top terms %v include %q, not from the auth prompts", terms, term.Word)
+		}
+	}
+
+	d := g.Digest(3)
+	jwt := g.Tokenize("JWT")[0]
+	if !strings.HasPrefix(d, DigestPrefix) || !strings.Contains(d, jwt) {
+		t.Errorf("Digest = %q, want %q listing %q", d, DigestPrefix, jwt)
+	}
+}
+
+func TestSimulateMatchesProcessing(t *testing.T) {
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix JWT token expiry",
+		"fix the database migration",
+		"add an index to the database migration",
+		"refresh JWT tokens on login",
+	}
+	g := newTestGate()
+	g.ProcessPrompt("set up the CI pipeline", "p0")
+	before := treeShape(g.Forest)
+	docs, chain := g.Engine.TotalDocs, g.Chain.TransitionCount()
+
+	sim, results := g.Simulate(prompts)
+	if len(results) != len(prompts) {
+		t.Fatalf("got %d results, want %d", len(results), len(prompts))
+	}
+	if got := treeShape(g.Forest); strings.Join(got, "\n") != strings.Join(before, "\n") {
+		t.Errorf("Simulate changed the original forest:\n%v\nwant\n%v", got, before)
+	}
+	if g.Engine.TotalDocs != docs || g.Chain.TransitionCount() != chain {
+		t.Error("Simulate changed the original engine or chain")
+	}
+
+	g.ProcessBatch(prompts)
+	want, got := treeShape(g.Forest), treeShape(sim.Forest)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("simulated forest:\n%s\nreal forest:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if sim.Engine.TotalDocs != g.Engine.TotalDocs {
+		t.Errorf("simulated corpus has %d docs, real %d", sim.Engine.TotalDocs, g.Engine.TotalDocs)
+	}
+}
+
+// Run with -race: the gate's lock must serialize prompts, dry runs and
+// context generation from many goroutines.
+func TestConcurrentProcessPromptAndDryRun(t *testing.T) {
+	g := newTestGate()
+	prompts := []string{
+		"add JWT authentication to the API",
+		"fix the database migration schema error",
+		"style the frontend react component",
+		"refresh the JWT authentication token",
+		"add an index to the users table migration",
+		"react component unit tests",
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i, p := range prompts {
+				g.ProcessPrompt(fmt.Sprintf("%s %d", p, w), fmt.Sprintf("w%dp%d", w, i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for _, p := range prompts {
+				g.DryRun(p)
+				g.GenerateContext()
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := 4 * len(prompts)
+	if g.Forest.Meta.TotalPrompts != want || g.Engine.TotalDocs != want {
+		t.Errorf("TotalPrompts = %d, TotalDocs = %d, want %d", g.Forest.Meta.TotalPrompts, g.Engine.TotalDocs, want)
+	}
+	indexed := 0
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Indexed {
+				indexed++
+			}
+		}
+	}
+	if indexed != want {
+		t.Errorf("%d indexed nodes, want one per prompt (%d) of %d nodes", indexed, want, g.Forest.NodeCount())
+	}
+}
+
+func TestForecastFlagsFirstToPrune(t *testing.T) {
+	g := newTestGate()
+	now := time.Now().UnixMilli()
+	hour := int64(time.Hour / time.Millisecond)
+
+	// stale: one old prompt. busy: the same age, but touched often since.
+	// fresh: recent.
+	stale := topicTree(g, "stale topic", "old prompt about the stale topic")
+	busy := topicTree(g, "busy topic", "prompt about the busy topic")
+	fresh := topicTree(g, "fresh topic", "prompt about the fresh topic")
+	for _, n := range stale.Nodes {
+		n.LastAccessed = now - 48*hour
+	}
+	for _, n := range busy.Nodes {
+		n.LastAccessed = now - 48*hour
+		for i := 0; i < 20; i++ {
+			n.Touch(g.Config.MaxSourcesPerNode, "", "")
+		}
+		n.LastAccessed = now - 48*hour
+	}
+	for _, n := range fresh.Nodes {
+		n.LastAccessed = now
+	}
+	nodes := g.Forest.NodeCount()
+
+	fc := g.Forecast(now, 24)
+	if fc.Trees[0].TreeID != stale.ID || !fc.Trees[0].Below || fc.Trees[0].LeavesBelow != 1 {
+		t.Errorf("first to prune = %+v, want the stale tree below the cutoff", fc.Trees[0])
+	}
+	if fc.Headroom != g.Config.MemorySize-nodes || g.Forest.NodeCount() != nodes {
+		t.Errorf("Headroom = %d, want %d with the forest unchanged", fc.Headroom, g.Config.MemorySize-nodes)
+	}
+
+	// The busy tree is as old as the stale one but outlasts it; far enough
+	// ahead it falls below too.
+	below := func(fc Forecast, id string) bool {
+		for _, tf := range fc.Trees {
+			if tf.TreeID == id {
+				return tf.Below
+			}
+		}
+		t.Fatalf("tree %s missing from forecast", id)
+		return false
+	}
+	if below(fc, busy.ID) || below(fc, fresh.ID) {
+		t.Errorf("busy and fresh trees should survive a day: %+v", fc.Trees)
+	}
+	if !below(g.Forecast(now, 24*30), busy.ID) {
+		t.Error("after a month the busy tree should fall below the cutoff too")
+	}
+
+	// Pinned trees are never at risk and are listed last.
+	stale.Pinned = true
+	fc = g.Forecast(now, 24)
+	if last := fc.Trees[len(fc.Trees)-1]; last.TreeID != stale.ID || last.Below || last.LeavesBelow != 0 {
+		t.Errorf("pinned tree = %+v, want it last and not at risk", last)
+	}
+}
@@ -0,0 +1,56 @@
+package gate
+
+// jaccardFallback turns a new-topic classification into a branch when the
+// prompt's tokens overlap some node's tokens by at least
+// Config.JaccardFallback (Jaccard index of the two token sets). Cosine scores
+// can miss such prompts while the corpus is cold: terms the engine has not
+// seen carry no IDF, so a follow-up in fresh vocabulary can have an empty or
+// orthogonal vector. Disabled when the threshold is zero.
+func (g *Gate) jaccardFallback(cls *Classification, tokens []string) {
+	if g.Config.JaccardFallback <= 0 || cls.Action != ActionNew || len(tokens) == 0 {
+		return
+	}
+	prompt := tokenSet(tokens)
+	bestIdx, bestScore := -1, 0.0
+	for i, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if !n.IsLeaf() && n.ID != tree.RootID {
+				continue
+			}
+			if s := jaccard(prompt, tokenSet(g.Tokenize(n.Content))); s > bestScore {
+				bestIdx, bestScore = i, s
+			}
+		}
+	}
+	if bestIdx < 0 || bestScore < g.Config.JaccardFallback {
+		return
+	}
+	cls.Action = ActionBranch
+	cls.TreeIdx = bestIdx
+	cls.LeafID = ""
+	cls.Jaccard = bestScore
+}
+
+// tokenSet returns the distinct tokens of tokens.
+func tokenSet(tokens []string) map[string]bool {
+	set := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		set[t] = true
+	}
+	return set
+}
+
+// jaccard returns |a ∩ b| / |a ∪ b|, or 0 when both are empty.
+func jaccard(a, b map[string]bool) float64 {
+	inter := 0
+	for t := range a {
+		if b[t] {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
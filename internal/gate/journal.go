@@ -0,0 +1,181 @@
+package gate
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/markov"
+)
+
+// NodeState is the part of a node that apply can rewrite in place: bubbleUp
+// replaces parent content and sets the indexed flag to whether the new
+// abstraction is in the corpus.
+type NodeState struct {
+	Content string   `json:"content"`
+	Indexed bool     `json:"indexed,omitempty"`
+	Tokens  []string `json:"tokens,omitempty"`
+}
+
+// Journal records what the most recent ProcessPrompt changed, so Undo can
+// reverse it. Only a single level of undo is kept.
+type Journal struct {
+	Action string `json:"action"`
+	TreeID string `json:"treeId"`
+
+	// Added lists nodes created by the prompt, including a root preserved as
+	// a child. Rewritten holds the prior state of nodes bubbleUp changed.
+	Added     []string             `json:"added,omitempty"`
+	Rewritten map[string]NodeState `json:"rewritten,omitempty"`
+
+	TreeLastAccessed int64 `json:"treeLastAccessed,omitempty"`
+	LastUpdate       int64 `json:"lastUpdate"`
+
+	// Tokens is the document the prompt added to the TF-IDF corpus.
+	Tokens []string `json:"tokens"`
+
+	// Chain state before the prompt; the recorded transition is
+	// LastTopic → TreeID, plus PrevTopic → LastTopic → TreeID when History.
+	// NoTransition is set when Markov modelling was disabled, so nothing was
+	// recorded.
+	LastTopic    string `json:"lastTopic,omitempty"`
+	PrevTopic    string `json:"prevTopic,omitempty"`
+	History      bool   `json:"history,omitempty"`
+	NoTransition bool   `json:"noTransition,omitempty"`
+
+	// Visited is set when TreeID was appended to the chain's visit history.
+	Visited bool `json:"visited,omitempty"`
+
+	// Bridge is the runner-up tree if the prompt bridged two topics.
+	Bridge string `json:"bridge,omitempty"`
+}
+
+// nodeStates captures the rewritable state of every node in a tree.
+func nodeStates(tree *forest.Tree) map[string]NodeState {
+	states := make(map[string]NodeState, len(tree.Nodes))
+	for id, n := range tree.Nodes {
+		states[id] = NodeState{Content: n.Content, Indexed: n.Indexed, Tokens: n.Tokens}
+	}
+	return states
+}
+
+// diffTree fills Added and Rewritten by comparing a tree against the states
+// captured before the prompt was applied.
+func (j *Journal) diffTree(tree *forest.Tree, before map[string]NodeState) {
+	for id, n := range tree.Nodes {
+		prev, existed := before[id]
+		if !existed {
+			j.Added = append(j.Added, id)
+			continue
+		}
+		if prev.Content != n.Content || prev.Indexed != n.Indexed {
+			if j.Rewritten == nil {
+				j.Rewritten = make(map[string]NodeState)
+			}
+			j.Rewritten[id] = prev
+		}
+	}
+}
+
+// Undo reverses the prompt recorded in j: it removes the tree or nodes the
+// prompt added, restores rewritten node content, removes the prompt's
+// document from the TF-IDF corpus, and rolls back the Markov transition and
+// topic history. Pruning triggered by that prompt and Markov decay are not
+// reversed. If the prompt's nodes have since been pruned, Undo returns an
+// error and leaves all state unchanged.
+func (g *Gate) Undo(j *Journal) error {
+	tree := g.Forest.TreeByID(j.TreeID)
+	if tree == nil {
+		return fmt.Errorf("tree %s no longer exists", j.TreeID)
+	}
+
+	if j.Action == ActionNew.String() {
+		g.Forest.RemoveTree(g.treeIndex(tree))
+	} else {
+		for _, id := range j.Added {
+			if tree.Nodes[id] == nil {
+				return fmt.Errorf("node %s no longer exists", id)
+			}
+		}
+		added := make(map[string]bool, len(j.Added))
+		for _, id := range j.Added {
+			added[id] = true
+		}
+		for _, id := range j.Added {
+			// A grouping node (Config.MaxChildren) holds existing children:
+			// hand them back to its parent, and withdraw the abstraction
+			// bubbleUp may have indexed for it, before it is removed.
+			n := tree.Nodes[id]
+			if n == nil || n.IsLeaf() {
+				continue
+			}
+			if n.Indexed {
+				g.Engine.RemoveDocument(g.docTokens(n))
+				n.Indexed = false
+			}
+			for _, cid := range slices.Clone(n.ChildIDs) {
+				if !added[cid] {
+					tree.Reparent(cid, n.ParentID)
+				}
+			}
+		}
+		for _, id := range j.Added {
+			tree.RemoveNode(id)
+		}
+		for id, st := range j.Rewritten {
+			n := tree.Nodes[id]
+			if n == nil {
+				continue
+			}
+			// An indexed rewritten node holds an abstraction bubbleUp
+			// registered. A restored indexed parent gets its abstraction back;
+			// a restored indexed leaf is a prompt root whose document was
+			// handed to the preserved child and never left the corpus.
+			if n.Indexed {
+				g.Engine.RemoveDocument(g.docTokens(n))
+			}
+			n.Content = st.Content
+			n.Indexed = st.Indexed
+			n.Tokens = st.Tokens
+			if n.Indexed && !n.IsLeaf() {
+				g.Engine.AddDocument(g.docTokens(n))
+			}
+		}
+		tree.LastAccessed = j.TreeLastAccessed
+	}
+
+	g.Engine.RemoveDocument(j.Tokens)
+	g.vecCache = make(map[string]cachedVec)
+
+	if !j.NoTransition {
+		g.Chain.Unrecord(j.LastTopic, j.TreeID)
+		if j.History {
+			g.Chain.Unrecord(markov.HistoryKey(j.PrevTopic, j.LastTopic), j.TreeID)
+		}
+	}
+	if j.Visited {
+		g.Chain.Unvisit(j.TreeID)
+	}
+	g.Chain.LastTopic = j.LastTopic
+	g.Chain.PrevTopic = j.PrevTopic
+
+	if j.Bridge != "" {
+		g.Forest.UnrecordBridge(j.TreeID, j.Bridge)
+	}
+
+	if g.Forest.Meta.TotalPrompts > 0 {
+		g.Forest.Meta.TotalPrompts--
+	}
+	g.Forest.Meta.LastUpdate = j.LastUpdate
+	return nil
+}
+
+// treeIndex returns the index of tree in the forest, or -1.
+func (g *Gate) treeIndex(tree *forest.Tree) int {
+	for i, t := range g.Forest.Trees {
+		if t == tree {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,90 @@
+package gate
+
+import (
+	"sort"
+	"time"
+)
+
+// Stages timed by Metrics.
+const (
+	StageClassify = "classify"
+	StageApply    = "apply"
+	StageContext  = "context"
+)
+
+// StageTiming accumulates the durations of one ProcessPrompt stage, in
+// milliseconds.
+type StageTiming struct {
+	Count  int     `json:"count"`
+	MeanMs float64 `json:"meanMs"` // running mean over all Count samples
+	LastMs float64 `json:"lastMs"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// Metrics accumulates how long ProcessPrompt spends classifying, applying
+// and generating context, so a slow hook can be traced to a large forest.
+// It is persisted across invocations and reported by --metrics.
+type Metrics struct {
+	Stages map[string]*StageTiming `json:"stages"`
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{Stages: make(map[string]*StageTiming)}
+}
+
+// Record adds one sample of d for stage.
+func (m *Metrics) Record(stage string, d time.Duration) {
+	if m.Stages == nil {
+		m.Stages = make(map[string]*StageTiming)
+	}
+	s := m.Stages[stage]
+	if s == nil {
+		s = &StageTiming{}
+		m.Stages[stage] = s
+	}
+	ms := float64(d) / float64(time.Millisecond)
+	s.Count++
+	s.MeanMs += (ms - s.MeanMs) / float64(s.Count)
+	s.LastMs = ms
+	s.MaxMs = max(s.MaxMs, ms)
+}
+
+// StageNames returns the recorded stages in pipeline order, followed by any
+// others alphabetically.
+func (m *Metrics) StageNames() []string {
+	order := map[string]int{StageClassify: 0, StageApply: 1, StageContext: 2}
+	names := make([]string, 0, len(m.Stages))
+	for name := range m.Stages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		oi, iKnown := order[names[i]]
+		oj, jKnown := order[names[j]]
+		switch {
+		case iKnown && jKnown:
+			return oi < oj
+		case iKnown != jKnown:
+			return iKnown
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// startTimer returns the current time when metrics are enabled, and the zero
+// time otherwise, so disabled metrics cost no clock reads.
+func (g *Gate) startTimer() time.Time {
+	if g.Metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe records the time since start for stage when metrics are enabled.
+func (g *Gate) observe(stage string, start time.Time) {
+	if g.Metrics == nil {
+		return
+	}
+	g.Metrics.Record(stage, time.Since(start))
+}
@@ -0,0 +1,60 @@
+package gate
+
+import (
+	"fmt"
+	"slices"
+)
+
+// MoveNode reclassifies the node nodeID, found as by Forest.FindNode, with
+// its subtree into the tree at index into, under that tree's root. It is the
+// escape hatch for a prompt the gate put in the wrong topic: node IDs,
+// content and indexed flags are kept, so the TF-IDF corpus is unchanged,
+// depths are shifted to match, and both trees' abstractions are regenerated.
+// Abstractions left without children in the source tree are dropped, and a
+// source tree left without prompts is removed, its bridges and Markov
+// transitions moving to the target. Moving the abstract root of a larger
+// tree moves its whole tree, as MergeTrees does.
+func (g *Gate) MoveNode(nodeID string, into int) error {
+	if into < 0 || into >= len(g.Forest.Trees) {
+		return fmt.Errorf("no tree at index %d", into)
+	}
+	dst := g.Forest.Trees[into]
+	src, node := g.Forest.FindNode(nodeID)
+	if node == nil {
+		return fmt.Errorf("no node %q", nodeID)
+	}
+	if src == dst {
+		return fmt.Errorf("node %s is already in tree %s", node.ID, dst.ID)
+	}
+	from := slices.Index(g.Forest.Trees, src)
+	if node.ID == src.RootID && !node.IsLeaf() {
+		return g.MergeTrees(into, from)
+	}
+	if dst.Root() == nil {
+		return fmt.Errorf("cannot move node %s into tree %s: missing root", node.ID, dst.ID)
+	}
+
+	parentID := node.ParentID
+	g.preserveRoot(dst)
+	g.makeRoom(dst, dst.RootID)
+	dst.Graft(src, node.ID, dst.RootID)
+	g.dropEmptyAncestors(src, parentID)
+	dst.LastAccessed = max(dst.LastAccessed, node.LastAccessed)
+
+	if root := src.Root(); root == nil || root.IsLeaf() {
+		// Nothing but src's abstract root is left; the topic now lives in dst.
+		if root != nil && root.Indexed {
+			g.Engine.RemoveDocument(g.docTokens(root))
+		}
+		g.Forest.RemoveTree(from)
+		g.Forest.MergeBridges(src.ID, dst.ID)
+		g.Chain.MergeTopic(src.ID, dst.ID)
+	} else {
+		g.bubbleUp(src, src.RootID)
+	}
+	g.bubbleUp(dst, dst.RootID)
+	// Regenerated abstractions may have changed the corpus, so cached
+	// vectors can be stale.
+	g.vecCache = make(map[string]cachedVec)
+	return nil
+}
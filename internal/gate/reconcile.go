@@ -0,0 +1,90 @@
+package gate
+
+import (
+	"github.com/kuandriy/focus-gate/internal/text"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// ReconcileResult describes the drift Reconcile corrected.
+type ReconcileResult struct {
+	DocsBefore int // engine TotalDocs before reconciling
+	DocsAfter  int // indexed nodes in the forest
+	TermsFixed int // terms whose document frequency changed
+}
+
+// Drifted reports whether Reconcile had to change the engine.
+func (r ReconcileResult) Drifted() bool {
+	return r.DocsBefore != r.DocsAfter || r.TermsFixed > 0
+}
+
+// Reconcile rebuilds the engine's DocFreq and TotalDocs from the indexed
+// nodes actually present in the forest. Incremental Add/RemoveDocument calls
+// keep the two in step, but a lost save or a crash between writing the
+// forest and the engine can leave them apart, skewing IDF from then on. If
+// anything drifted, the engine's Version is bumped and cached vectors are
+// dropped.
+func (g *Gate) Reconcile() ReconcileResult {
+	want := tfidf.NewEngine()
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Indexed {
+				want.AddDocument(g.docTokens(n))
+			}
+		}
+	}
+
+	r := ReconcileResult{DocsBefore: g.Engine.TotalDocs, DocsAfter: want.TotalDocs}
+	for term, df := range want.DocFreq {
+		if g.Engine.DocFreq[term] != df {
+			r.TermsFixed++
+		}
+	}
+	for term := range g.Engine.DocFreq {
+		if _, ok := want.DocFreq[term]; !ok {
+			r.TermsFixed++
+		}
+	}
+	if !r.Drifted() {
+		return r
+	}
+
+	g.Engine.DocFreq = want.DocFreq
+	g.Engine.TotalDocs = want.TotalDocs
+	g.Engine.Version++
+	g.vecCache = make(map[string]cachedVec)
+	return r
+}
+
+// SyncTokenizer makes the corpus match the tokenizer's options. Terms from
+// one stemmer, stop-word list, synonym map or bigram setting never match
+// query vectors from another, so when the engine records a different
+// tokenizer fingerprint, every indexed node is re-tokenized from its content
+// and the corpus is rebuilt. A corpus without a fingerprint is re-indexed
+// once, since its options are unknown. It returns the stemmer the corpus was
+// built with and whether it re-indexed. An empty corpus is only stamped.
+func (g *Gate) SyncTokenizer() (string, bool) {
+	want := g.tokenizer.Fingerprint()
+	have := g.Engine.Stemmer
+	if have == "" {
+		have = text.StemmerLight
+	}
+	if g.Engine.Tokenizer == want || g.Engine.TotalDocs == 0 && g.Forest.NodeCount() == 0 {
+		g.Engine.Stemmer = g.tokenizer.Stemmer()
+		g.Engine.Tokenizer = want
+		return have, false
+	}
+
+	for _, tree := range g.Forest.Trees {
+		for _, n := range tree.Nodes {
+			if n.Tokens != nil {
+				n.Tokens = g.Tokenize(n.Content)
+			}
+		}
+	}
+	g.Engine.Stemmer = g.tokenizer.Stemmer()
+	g.Engine.Tokenizer = want
+	g.Reconcile()
+	g.Engine.Version++
+	g.vecCache = make(map[string]cachedVec)
+	return have, true
+}
@@ -0,0 +1,35 @@
+package gate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+)
+
+// RestoreTree returns an archived tree to the forest and re-indexes its
+// indexed nodes in the TF-IDF corpus, undoing what Prune removed. The root is
+// touched so the restored topic is not the first thing pruned again. Its
+// Markov transitions were dropped when it was pruned and are not restored.
+func (g *Gate) RestoreTree(t *forest.Tree) error {
+	if t == nil || t.Root() == nil {
+		return fmt.Errorf("archived tree has no root")
+	}
+	if g.Forest.TreeByID(t.ID) != nil {
+		return fmt.Errorf("tree %s is already in the forest", t.ID)
+	}
+
+	now := time.Now().UnixMilli()
+	t.LastAccessed = now
+	t.Root().LastAccessed = now
+	g.Forest.AddTree(t)
+
+	for _, n := range t.Nodes {
+		if n.Indexed {
+			g.Engine.AddDocument(g.docTokens(n))
+		}
+	}
+	// AddDocument shifts IDF, so cached vectors are stale.
+	g.vecCache = make(map[string]cachedVec)
+	return nil
+}
@@ -0,0 +1,83 @@
+package gate
+
+import (
+	"sort"
+
+	"github.com/kuandriy/focus-gate/internal/guide"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// SearchHit is one node or guide summary matching a search query. Kind is
+// "node" or "guide". For guide hits NodeID is the linked intent node, and
+// TreeIdx is -1 if that node has since been pruned.
+type SearchHit struct {
+	Kind    string  `json:"kind"`
+	TreeIdx int     `json:"treeIdx"`
+	TreeID  string  `json:"treeId,omitempty"`
+	NodeID  string  `json:"nodeId,omitempty"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// Search ranks every node in the forest, and every guide summary when gd is
+// non-nil, by cosine similarity to query and returns up to limit hits with a
+// positive score, best first. Unlike DryRun it scores existing content
+// rather than classifying a new prompt, so no Markov boost is applied.
+// Search does not mutate the forest, engine, chain or guide.
+func (g *Gate) Search(query string, gd *guide.Guide, limit int) []SearchHit {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	vec := g.Engine.VectorizeTokens(g.Tokenize(query))
+	if vec == nil {
+		return nil
+	}
+
+	var hits []SearchHit
+	for i, tree := range g.Forest.Trees {
+		for id, n := range tree.Nodes {
+			score := tfidf.CosineSimilarity(vec, g.nodeVec(id, n.Content))
+			if score <= 0 {
+				continue
+			}
+			hits = append(hits, SearchHit{
+				Kind:    "node",
+				TreeIdx: i,
+				TreeID:  tree.ID,
+				NodeID:  id,
+				Content: n.Content,
+				Score:   score,
+			})
+		}
+	}
+
+	if gd != nil {
+		for _, entry := range gd.Entries {
+			score := tfidf.CosineSimilarity(vec, g.Engine.VectorizeTokens(g.Tokenize(entry.Summary)))
+			if score <= 0 {
+				continue
+			}
+			hit := SearchHit{Kind: "guide", TreeIdx: -1, NodeID: entry.IntentID, Content: entry.Summary, Score: score}
+			for i, tree := range g.Forest.Trees {
+				if tree.Nodes[entry.IntentID] != nil {
+					hit.TreeIdx, hit.TreeID = i, tree.ID
+					break
+				}
+			}
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].TreeIdx != hits[j].TreeIdx {
+			return hits[i].TreeIdx < hits[j].TreeIdx
+		}
+		return hits[i].NodeID < hits[j].NodeID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
@@ -0,0 +1,170 @@
+package gate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// maxSplitIterations bounds the 2-means refinement in SplitTree.
+const maxSplitIterations = 10
+
+// SplitTree divides the tree at idx in two when its leaves have drifted into
+// separate subtopics. Leaves are clustered by a 2-means over their TF-IDF
+// vectors, seeded with the least similar pair of leaves. The smaller cluster
+// (on a tie, the one without the tree's oldest leaf) moves under the root of
+// a new tree appended to the forest, keeping node IDs and indexed flags;
+// abstractions left without children are dropped. Both trees' abstractions
+// are regenerated, and the new tree takes a share of the original topic's
+// Markov transitions equal to its share of the leaves' frequency. Returns the
+// new tree.
+func (g *Gate) SplitTree(idx int) (*forest.Tree, error) {
+	if idx < 0 || idx >= len(g.Forest.Trees) {
+		return nil, fmt.Errorf("no tree at index %d", idx)
+	}
+	tree := g.Forest.Trees[idx]
+
+	leaves := tree.GetLeaves()
+	if len(leaves) < 2 {
+		return nil, fmt.Errorf("tree %s has fewer than two leaves", tree.ID)
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].Created != leaves[j].Created {
+			return leaves[i].Created < leaves[j].Created
+		}
+		return leaves[i].ID < leaves[j].ID
+	})
+
+	vecs := make([]tfidf.Vector, len(leaves))
+	for i, leaf := range leaves {
+		vecs[i] = g.nodeVec(leaf.ID, leaf.Content)
+	}
+	assign := twoMeans(vecs)
+
+	size := 0
+	for _, a := range assign {
+		size += a
+	}
+	if size == 0 || size == len(leaves) {
+		return nil, fmt.Errorf("tree %s does not separate into two clusters", tree.ID)
+	}
+	minority := 1
+	if 2*size > len(leaves) || (2*size == len(leaves) && assign[0] == 1) {
+		minority = 0
+	}
+
+	split := forest.NewTree("", "")
+	split.Pinned = tree.Pinned
+	if tree.DecayRate != nil {
+		rate := *tree.DecayRate
+		split.DecayRate = &rate
+	}
+	root := split.Root()
+
+	var lastAccessed int64
+	movedFreq, totalFreq := 0, 0
+	for i, leaf := range leaves {
+		totalFreq += leaf.Frequency
+		if assign[i] != minority {
+			continue
+		}
+		movedFreq += leaf.Frequency
+		parentID := leaf.ParentID
+		tree.RemoveNode(leaf.ID)
+		g.dropEmptyAncestors(tree, parentID)
+
+		leaf.ParentID = root.ID
+		leaf.Depth = 1
+		root.ChildIDs = append(root.ChildIDs, leaf.ID)
+		split.Nodes[leaf.ID] = leaf
+		lastAccessed = max(lastAccessed, leaf.LastAccessed)
+	}
+	split.LastAccessed = lastAccessed
+	root.LastAccessed = lastAccessed
+
+	g.bubbleUp(tree, tree.RootID)
+	g.bubbleUp(split, split.RootID)
+	g.Forest.AddTree(split)
+	// Regenerated abstractions may have changed the corpus, so cached
+	// vectors can be stale.
+	g.vecCache = make(map[string]cachedVec)
+
+	if g.Config.MarkovEnabled && totalFreq > 0 {
+		g.Chain.SplitTopic(tree.ID, split.ID, float64(movedFreq)/float64(totalFreq))
+	}
+	// If the latest prompt moved, the user is now in the new topic.
+	if g.Chain.LastTopic == tree.ID && assign[len(leaves)-1] == minority {
+		g.Chain.LastTopic = split.ID
+	}
+	return split, nil
+}
+
+// dropEmptyAncestors removes the abstraction nodes, starting at nodeID and
+// walking up, that were left without children by a leaf moving out. The root
+// is always kept.
+func (g *Gate) dropEmptyAncestors(tree *forest.Tree, nodeID string) {
+	for nodeID != "" && nodeID != tree.RootID {
+		node := tree.Nodes[nodeID]
+		if node == nil || !node.IsLeaf() {
+			return
+		}
+		if node.Indexed {
+			g.Engine.RemoveDocument(g.docTokens(node))
+		}
+		nodeID = node.ParentID
+		tree.RemoveNode(node.ID)
+	}
+}
+
+// twoMeans clusters vecs into two groups by cosine similarity and returns
+// each vector's group, 0 or 1. The least similar pair seeds the groups, then
+// vectors are reassigned to the nearer centroid until nothing moves. Ties go
+// to group 0, so identical vectors all land there.
+func twoMeans(vecs []tfidf.Vector) []int {
+	seedA, seedB, lowest := 0, 1, 2.0
+	for i := range vecs {
+		for j := i + 1; j < len(vecs); j++ {
+			if s := tfidf.CosineSimilarity(vecs[i], vecs[j]); s < lowest {
+				seedA, seedB, lowest = i, j, s
+			}
+		}
+	}
+
+	assign := make([]int, len(vecs))
+	centroids := [2]tfidf.Vector{vecs[seedA], vecs[seedB]}
+	for iter := 0; iter < maxSplitIterations; iter++ {
+		changed := iter == 0
+		for i, v := range vecs {
+			group := 0
+			if tfidf.CosineSimilarity(v, centroids[1]) > tfidf.CosineSimilarity(v, centroids[0]) {
+				group = 1
+			}
+			if assign[i] != group {
+				assign[i] = group
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		centroids = [2]tfidf.Vector{centroid(vecs, assign, 0), centroid(vecs, assign, 1)}
+	}
+	return assign
+}
+
+// centroid sums the vectors assigned to group. Cosine similarity ignores
+// magnitude, so the sum serves as the mean.
+func centroid(vecs []tfidf.Vector, assign []int, group int) tfidf.Vector {
+	sum := make(map[string]float64)
+	for i, v := range vecs {
+		if assign[i] != group {
+			continue
+		}
+		for _, t := range v {
+			sum[t.Word] += t.Weight
+		}
+	}
+	return tfidf.NewVector(sum)
+}
@@ -0,0 +1,87 @@
+package gate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// ParseContextTemplate parses a Config.ContextTemplate. The template is
+// executed with a ContextSummary: .Trees ranks the topics, each with its
+// .Root, .Score and recent .Leaves, and .Next and .Path hold the predictions,
+// each with its .Name (possibly empty), .TopicID and .Probability. The
+// header counts are .TotalPrompts, .NodeCount, .MemorySize and .TreeCount.
+func ParseContextTemplate(s string) (*template.Template, error) {
+	return template.New("contextTemplate").Parse(s)
+}
+
+// GenerateContextTemplated renders the context block with
+// Config.ContextTemplate, or returns GenerateContext when no template is set.
+// A template that fails to parse or execute is logged and the built-in
+// format is used instead, so a bad template never loses the context block.
+// With ContextLimit, the predictions and then the lowest-ranked trees are
+// left out of the data until the output fits, as in the built-in format.
+func (g *Gate) GenerateContextTemplated() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.contextTemplated()
+}
+
+// contextTemplated is GenerateContextTemplated without the lock.
+func (g *Gate) contextTemplated() string {
+	if g.Config.ContextTemplate == "" || len(g.Forest.Trees) == 0 {
+		return g.generateContext(false)
+	}
+	tmpl, err := ParseContextTemplate(g.Config.ContextTemplate)
+	if err != nil {
+		g.logf("contextTemplate: %v", err)
+		return g.generateContext(false)
+	}
+
+	sum := g.contextSummary()
+	out, err := renderTemplate(tmpl, sum)
+	if err != nil {
+		g.logf("contextTemplate: %v", err)
+		return g.generateContext(false)
+	}
+	limit := g.Config.ContextLimit
+	if limit <= 0 {
+		return out
+	}
+	limit = max(limit, MinContextLimit)
+
+	// Drop the predictions, then trees from the lowest-ranked up, until the
+	// output fits. Text in the template itself is never cut.
+	for len(out) > limit && len(sum.Next)+len(sum.Path)+len(sum.Trees) > 0 {
+		if len(sum.Next)+len(sum.Path) > 0 {
+			sum.Next, sum.Path = nil, nil
+		} else {
+			sum.Trees = sum.Trees[:len(sum.Trees)-1]
+		}
+		if out, err = renderTemplate(tmpl, sum); err != nil {
+			g.logf("contextTemplate: %v", err)
+			return g.generateContext(false)
+		}
+	}
+	return out
+}
+
+// renderTemplate executes tmpl with sum.
+func renderTemplate(tmpl *template.Template, sum ContextSummary) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, sum); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// logf reports a problem the gate recovered from to g.Log.
+func (g *Gate) logf(format string, args ...any) {
+	var w io.Writer = os.Stderr
+	if g.Log != nil {
+		w = g.Log
+	}
+	fmt.Fprintf(w, "focus-gate: "+format+"\n", args...)
+}
@@ -0,0 +1,93 @@
+package gate
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// cachedVec is a node vector together with the content it was computed from.
+type cachedVec struct {
+	Content string       `json:"content"`
+	Vector  tfidf.Vector `json:"vector"`
+}
+
+// vecCacheFile is the persisted form of the vector cache. Vectors depend on
+// IDF (captured by the engine's corpus Version) and on tokenizer and weighting
+// options (captured by Options), so the file is only reused when both match.
+type vecCacheFile struct {
+	Version int                  `json:"version"`
+	Options string               `json:"options"`
+	Entries map[string]cachedVec `json:"entries"`
+}
+
+// optionsKey fingerprints the settings that affect vectorization. The
+// engine's options are used rather than Config.Vector so that stemmed term
+// boosts are included.
+func (g *Gate) optionsKey() string {
+	data, _ := json.Marshal(struct {
+		Tokenizer any `json:"tokenizer"`
+		Vector    any `json:"vector"`
+	}{g.Config.Tokenizer, g.Engine.Options})
+	return string(data)
+}
+
+// LoadVecCache loads a vector cache saved by SaveVecCache. If the engine's
+// corpus version or the vectorization options differ from when the cache was
+// saved, the file is ignored and vectors are recomputed on demand.
+func (g *Gate) LoadVecCache(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var file vecCacheFile
+	// A cache without a checksum is from an older version; it is still
+	// guarded by the version and options check below.
+	if err := persist.Load(path, &file); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+		return err
+	}
+	if file.Version != g.Engine.Version || file.Options != g.optionsKey() {
+		return nil
+	}
+	for id, c := range file.Entries {
+		g.vecCache[id] = c
+	}
+	return nil
+}
+
+// SaveVecCache persists a vector for every node in the forest, stamped with
+// the engine's corpus version. A prompt empties the cache when it adds its
+// document, so vectors missing at save time are computed first; the next
+// invocation, prompt or read-only command, then starts with every node
+// cached. Entries for nodes no longer in the forest are dropped.
+func (g *Gate) SaveVecCache(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entries := make(map[string]cachedVec, len(g.vecCache))
+	for _, t := range g.Forest.Trees {
+		for id, n := range t.Nodes {
+			g.nodeVec(id, n.Content)
+			entries[id] = g.vecCache[id]
+		}
+	}
+	g.vecCache = entries
+	return persist.SaveAtomic(path, vecCacheFile{
+		Version: g.Engine.Version,
+		Options: g.optionsKey(),
+		Entries: entries,
+	})
+}
+
+// VecCacheStats reports the vector cache's size and how many vectors this
+// gate has had to compute because they were not cached.
+type VecCacheStats struct {
+	Entries int `json:"entries"`
+	Misses  int `json:"misses"`
+}
+
+// VecCacheStats returns the current VecCacheStats.
+func (g *Gate) VecCacheStats() VecCacheStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return VecCacheStats{Entries: len(g.vecCache), Misses: g.vecMisses}
+}
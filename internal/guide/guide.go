@@ -2,6 +2,7 @@ package guide
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,11 +16,19 @@ type Entry struct {
 	Refs      []string `json:"refs,omitempty"`
 	Timestamp int64    `json:"timestamp"`
 
+	// TopicLabel is the root content of the intent node's tree when the
+	// entry was added. Once the intent node is pruned, the entry still
+	// renders while a tree with that root content survives.
+	TopicLabel string `json:"topicLabel,omitempty"`
+
 	// Reinforced is set after this entry has been used by Gate.ReinforceFromGuide
 	// to Touch the matching tree root. Prevents double-reinforcement across restarts.
 	Reinforced bool `json:"reinforced,omitempty"`
 }
 
+// SchemaVersion is the current on-disk layout of Guide.
+const SchemaVersion = 1
+
 // Guide is a ring buffer of AI response summaries linked to intent nodes.
 //
 // It serves two roles in the feedback loop:
@@ -32,33 +41,79 @@ type Entry struct {
 //
 // Entries are capped at MaxSize. Oldest entries are evicted on overflow.
 type Guide struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	Entries []Entry `json:"entries"`
 	MaxSize int     `json:"maxSize"`
+
+	// RenderLimit caps how many entries Render and RenderForTopic emit,
+	// keeping the newest. Zero renders every valid entry. It is
+	// configuration, not state, so it is not persisted.
+	RenderLimit int `json:"-"`
 }
 
 // New creates a guide with the given capacity.
 func New(maxSize int) *Guide {
 	return &Guide{
-		MaxSize: maxSize,
+		SchemaVersion: SchemaVersion,
+		MaxSize:       maxSize,
 	}
 }
 
+// CurrentSchema reports SchemaVersion for persist.Load migrations.
+func (g *Guide) CurrentSchema() int { return SchemaVersion }
+
+// Clone returns a deep copy of the guide.
+func (g *Guide) Clone() *Guide {
+	c := *g
+	c.Entries = slices.Clone(g.Entries)
+	for i := range c.Entries {
+		c.Entries[i].Refs = slices.Clone(g.Entries[i].Refs)
+	}
+	return &c
+}
+
 // Add appends a response summary. If capacity is exceeded, the oldest entry is dropped.
 func (g *Guide) Add(summary string, intentID string, refs []string) {
+	g.AddForTopic(summary, intentID, "", refs)
+}
+
+// AddForTopic is Add with the entry's TopicLabel set to topicLabel.
+func (g *Guide) AddForTopic(summary, intentID, topicLabel string, refs []string) {
 	if summary == "" {
 		return
 	}
 	g.Entries = append(g.Entries, Entry{
-		Summary:   summary,
-		IntentID:  intentID,
-		Refs:      refs,
-		Timestamp: time.Now().UnixMilli(),
+		Summary:    summary,
+		IntentID:   intentID,
+		Refs:       refs,
+		Timestamp:  time.Now().UnixMilli(),
+		TopicLabel: topicLabel,
 	})
 	if len(g.Entries) > g.MaxSize {
 		g.Entries = g.Entries[len(g.Entries)-g.MaxSize:]
 	}
 }
 
+// Expire drops entries older than maxAgeHours at time now (Unix ms),
+// regardless of how many entries are held, and returns the number dropped.
+// maxAgeHours <= 0 disables expiry.
+func (g *Guide) Expire(now int64, maxAgeHours float64) int {
+	if maxAgeHours <= 0 {
+		return 0
+	}
+	cutoff := now - int64(maxAgeHours*float64(time.Hour/time.Millisecond))
+	kept := g.Entries[:0]
+	for _, e := range g.Entries {
+		if e.Timestamp >= cutoff {
+			kept = append(kept, e)
+		}
+	}
+	dropped := len(g.Entries) - len(kept)
+	g.Entries = kept
+	return dropped
+}
+
 // UnreinforcedEntries returns pointers to entries not yet processed for
 // forest reinforcement. Gate.ReinforceFromGuide uses this to avoid
 // double-touching trees on repeated loads.
@@ -72,34 +127,88 @@ func (g *Guide) UnreinforcedEntries() []*Entry {
 	return entries
 }
 
-// Render formats guide entries whose intentID still exists in the forest.
-// Dead links (pruned intent nodes) are excluded.
+// LinkedTo returns the entries linked to the intent node intentID, oldest
+// first.
+func (g *Guide) LinkedTo(intentID string) []Entry {
+	var linked []Entry
+	for _, e := range g.Entries {
+		if e.IntentID == intentID {
+			linked = append(linked, e)
+		}
+	}
+	return linked
+}
+
+// Render formats guide entries whose intentID still exists in the forest,
+// newest first, up to RenderLimit. Dead links (pruned intent nodes) are
+// excluded unless the entry's TopicLabel is still the root content of a
+// tree.
 func (g *Guide) Render(f *forest.Forest) string {
 	if len(g.Entries) == 0 {
 		return ""
 	}
 
-	// Build a set of valid intent node IDs
+	// Build a set of valid intent node IDs and live topic labels
 	valid := make(map[string]bool)
+	labels := make(map[string]bool, len(f.Trees))
 	for _, tree := range f.Trees {
 		for id := range tree.Nodes {
 			valid[id] = true
 		}
+		if root := tree.Root(); root != nil {
+			labels[root.Content] = true
+		}
+	}
+	return g.render(valid, labels)
+}
+
+// RenderForTopic is Render restricted to entries linked to nodes in the tree
+// currentTreeID, so summaries about other topics don't spend context budget.
+// Entries without an intentID are still always shown. If currentTreeID is
+// empty or no longer in the forest, it falls back to Render.
+func (g *Guide) RenderForTopic(f *forest.Forest, currentTreeID string) string {
+	if len(g.Entries) == 0 {
+		return ""
+	}
+	for _, tree := range f.Trees {
+		if currentTreeID != "" && tree.ID == currentTreeID {
+			valid := make(map[string]bool, len(tree.Nodes))
+			for id := range tree.Nodes {
+				valid[id] = true
+			}
+			labels := make(map[string]bool, 1)
+			if root := tree.Root(); root != nil {
+				labels[root.Content] = true
+			}
+			return g.render(valid, labels)
+		}
 	}
+	return g.Render(f)
+}
 
+// render formats entries whose intentID is in valid or, failing that, whose
+// TopicLabel is in labels, plus legacy entries without an intentID. Entries
+// are emitted most recent first, so the summaries most likely to matter lead
+// the block; whether an entry has been reinforced does not affect its place.
+func (g *Guide) render(valid, labels map[string]bool) string {
 	var b strings.Builder
-	hasContent := false
+	rendered := 0
 
-	for _, e := range g.Entries {
-		// Include if intentID is still valid or if intentID is empty (legacy)
-		if e.IntentID != "" && !valid[e.IntentID] {
+	for i := len(g.Entries) - 1; i >= 0; i-- {
+		e := g.Entries[i]
+		// Include if intentID is still valid or if intentID is empty
+		// (legacy), or if the node is gone but its topic lives on.
+		if e.IntentID != "" && !valid[e.IntentID] && (e.TopicLabel == "" || !labels[e.TopicLabel]) {
 			continue
 		}
-		if !hasContent {
+		if g.RenderLimit > 0 && rendered == g.RenderLimit {
+			break
+		}
+		if rendered == 0 {
 			b.WriteString("Guide:\n")
-			hasContent = true
 		}
 		fmt.Fprintf(&b, "  - %s\n", e.Summary)
+		rendered++
 	}
 
 	return b.String()
@@ -73,6 +73,37 @@ func TestGuideRenderValidLinks(t *testing.T) {
 	}
 }
 
+func TestGuideRenderTopicLabelFallback(t *testing.T) {
+	f := forest.NewForest()
+	tree := forest.NewTree("jwt | auth | token", "")
+	leaf := tree.AddChild(tree.RootID, "fix jwt token expiry", "")
+	f.AddTree(tree)
+
+	g := New(5)
+	g.AddForTopic("rotated the signing keys", leaf.ID, "jwt | auth | token", nil)
+	g.AddForTopic("tuned the connection pool", "pruned-db-leaf", "database | pool", nil)
+	g.AddForTopic("added refresh token tests", "pruned-ui-leaf", "jwt | auth | token", nil)
+
+	// The leaf is pruned; its tree survives with the same root content.
+	tree.RemoveNode(leaf.ID)
+
+	rendered := g.Render(f)
+	for _, want := range []string{"rotated the signing keys", "added refresh token tests"} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("entry %q should render under its surviving topic:\n%s", want, rendered)
+		}
+	}
+	if strings.Contains(rendered, "tuned the connection pool") {
+		t.Errorf("entry with neither a live node nor a live topic should be dropped:\n%s", rendered)
+	}
+	if got := g.RenderForTopic(f, tree.ID); !strings.Contains(got, "rotated the signing keys") {
+		t.Errorf("RenderForTopic should fall back to the label too:\n%s", got)
+	}
+	if g.Entries[0].TopicLabel != "jwt | auth | token" {
+		t.Errorf("TopicLabel = %q", g.Entries[0].TopicLabel)
+	}
+}
+
 func TestGuideRenderEmpty(t *testing.T) {
 	g := New(5)
 	f := forest.NewForest()
@@ -95,3 +126,111 @@ func TestGuideRenderFormat(t *testing.T) {
 		t.Error("should contain formatted entry")
 	}
 }
+
+func TestGuideExpire(t *testing.T) {
+	g := New(10)
+	g.Add("old summary", "n1", nil)
+	g.Add("recent summary", "n2", nil)
+
+	now := g.Entries[1].Timestamp
+	g.Entries[0].Timestamp = now - 48*3600*1000 // two days old
+
+	if dropped := g.Expire(now, 0); dropped != 0 || len(g.Entries) != 2 {
+		t.Fatalf("maxAgeHours 0 should keep all entries, dropped %d", dropped)
+	}
+	if dropped := g.Expire(now, 24); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	if len(g.Entries) != 1 || g.Entries[0].Summary != "recent summary" {
+		t.Errorf("entries after expiry = %+v, want only the recent one", g.Entries)
+	}
+}
+
+func TestGuideExpireUnreinforced(t *testing.T) {
+	g := New(10)
+	g.Add("old unreinforced", "n1", nil)
+	g.Add("recent reinforced", "n2", nil)
+	g.Add("recent unreinforced", "n3", nil)
+
+	now := g.Entries[2].Timestamp
+	g.Entries[0].Timestamp = now - 10*3600*1000
+	g.Entries[1].Reinforced = true
+
+	g.Expire(now, 1)
+
+	un := g.UnreinforcedEntries()
+	if len(un) != 1 || un[0].Summary != "recent unreinforced" {
+		t.Fatalf("unreinforced after expiry = %v, want only the recent one", un)
+	}
+	// Pointers must refer to the surviving entries, not stale slots.
+	un[0].Reinforced = true
+	if !g.Entries[1].Reinforced || g.Entries[1].Summary != "recent unreinforced" {
+		t.Error("UnreinforcedEntries should point into the compacted slice")
+	}
+}
+
+func TestGuideRenderForTopic(t *testing.T) {
+	f := forest.NewForest()
+	a := forest.NewTree("auth topic", "")
+	b := forest.NewTree("database topic", "")
+	f.AddTree(a)
+	f.AddTree(b)
+
+	g := New(5)
+	g.Add("added JWT middleware", a.RootID, nil)
+	g.Add("legacy note", "", nil)
+
+	rendered := g.RenderForTopic(f, a.ID)
+	if !strings.Contains(rendered, "added JWT middleware") {
+		t.Error("entry under tree A should show when A is current")
+	}
+
+	rendered = g.RenderForTopic(f, b.ID)
+	if strings.Contains(rendered, "added JWT middleware") {
+		t.Error("entry under tree A should be hidden when B is current")
+	}
+	if !strings.Contains(rendered, "legacy note") {
+		t.Error("entries without an intentID should always show")
+	}
+
+	if g.RenderForTopic(f, "") != g.Render(f) {
+		t.Error("no current topic should fall back to Render")
+	}
+}
+
+func TestGuideRenderNewestFirst(t *testing.T) {
+	g := New(5)
+	g.Add("first", "", nil)
+	g.Add("second", "", nil)
+	g.Add("third", "", nil)
+	g.Entries[1].Reinforced = true // reinforcement must not change the order
+
+	f := forest.NewForest()
+	want := "Guide:\n  - third\n  - second\n  - first\n"
+	if got := g.Render(f); got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	g.RenderLimit = 2
+	want = "Guide:\n  - third\n  - second\n"
+	if got := g.Render(f); got != want {
+		t.Errorf("limited Render = %q, want %q", got, want)
+	}
+}
+
+func TestGuideCloneIsIndependent(t *testing.T) {
+	g := New(5)
+	g.Add("fixed migration", "node1", []string{"db/migration.sql"})
+
+	c := g.Clone()
+	c.Entries[0].Refs[0] = "changed.sql"
+	c.Entries[0].Reinforced = true
+	c.Add("implemented auth", "node2", nil)
+
+	if len(g.Entries) != 1 || g.Entries[0].Reinforced {
+		t.Errorf("original entries changed: %+v", g.Entries)
+	}
+	if g.Entries[0].Refs[0] != "db/migration.sql" {
+		t.Errorf("original refs changed: %v", g.Entries[0].Refs)
+	}
+}
@@ -0,0 +1,34 @@
+package guide
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultSummaryLen is the summary length used when none is configured.
+const DefaultSummaryLen = 200
+
+// Summarize trims s and shortens it to at most n characters, appending "..."
+// only when something was cut. The cut falls at the last word boundary
+// within the limit so no partial word survives to be re-tokenized into a
+// junk term by Gate.ReinforceFromGuide; a single word longer than n is cut
+// at n. n <= 0 disables truncation.
+func Summarize(s string, n int) string {
+	s = strings.TrimSpace(s)
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+
+	cut := r[:n]
+	if !unicode.IsSpace(r[n]) {
+		// The limit falls inside a word; back up to the space before it.
+		for i := len(cut) - 1; i > 0; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(cut), unicode.IsSpace) + "..."
+}
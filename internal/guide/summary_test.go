@@ -0,0 +1,38 @@
+package guide
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizeShortUntouched(t *testing.T) {
+	s := "Added JWT middleware."
+	if got := Summarize("  "+s+"\n", 200); got != s {
+		t.Errorf("got %q, want %q", got, s)
+	}
+}
+
+func TestSummarizeCutsAtWordBoundary(t *testing.T) {
+	s := "Refactored the authentication middleware to validate tokens"
+	got := Summarize(s, 30) // limit falls inside "middleware"
+	if want := "Refactored the authentication..."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A limit landing exactly on a space keeps the whole preceding word.
+	if got := Summarize(s, 29); got != "Refactored the authentication..." {
+		t.Errorf("got %q at boundary", got)
+	}
+
+	// A single word longer than the limit is cut at the limit.
+	if got := Summarize(strings.Repeat("x", 20), 8); got != "xxxxxxxx..." {
+		t.Errorf("got %q for a long word", got)
+	}
+}
+
+func TestSummarizeZeroIsUnlimited(t *testing.T) {
+	s := strings.Repeat("word ", 100) + "end"
+	if got := Summarize(s, 0); got != s {
+		t.Errorf("n=0 should not truncate, got %d chars", len(got))
+	}
+}
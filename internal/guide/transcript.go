@@ -0,0 +1,201 @@
+package guide
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Transcript formats accepted by ParserFor.
+const (
+	FormatClaude = "claude"
+	FormatOpenAI = "openai"
+)
+
+// MaxTranscriptBytes is how much of a transcript ReadTranscript keeps by
+// default, so a session that has run for days cannot exhaust the hook's
+// memory.
+const MaxTranscriptBytes = 10 << 20
+
+// ReadTranscript reads the transcript at path. A file over limit bytes is
+// read from its last limit bytes, starting at the first full line: the last
+// assistant message sits at the end, so a JSONL transcript still yields it,
+// while a single JSON document cut this way fails to parse. A limit of zero
+// or less reads the whole file.
+func ReadTranscript(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if limit <= 0 || info.Size() <= limit {
+		return io.ReadAll(f)
+	}
+
+	data := make([]byte, limit)
+	if _, err := f.ReadAt(data, info.Size()-limit); err != nil {
+		return nil, err
+	}
+	// The cut almost always lands inside a line; drop the fragment.
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[i+1:], nil
+	}
+	return nil, fmt.Errorf("%s: last line exceeds %d bytes", path, limit)
+}
+
+// TranscriptParser extracts the last assistant message from an assistant's
+// transcript file. It returns "" with a nil error if the transcript holds no
+// assistant text, and an error only if the data is not in its format.
+type TranscriptParser interface {
+	LastAssistantMessage(data []byte) (string, error)
+}
+
+// ParserFor returns the parser for a transcriptFormat config value. An empty
+// format selects the Claude Code parser.
+func ParserFor(format string) (TranscriptParser, error) {
+	switch format {
+	case "", FormatClaude:
+		return ClaudeParser{}, nil
+	case FormatOpenAI:
+		return OpenAIParser{}, nil
+	}
+	return nil, fmt.Errorf("unknown transcript format %q", format)
+}
+
+// ClaudeParser reads Claude Code transcripts, either a JSON array of entries
+// or JSONL with one entry per line. Each entry is {role, message: {content}}
+// (the role may also sit inside message), where content is a plain string or
+// an array of {type, text} blocks.
+type ClaudeParser struct{}
+
+// claudeEntry is one transcript entry in either Claude layout.
+type claudeEntry struct {
+	Role    string `json:"role"`
+	Message struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+func (e claudeEntry) role() string {
+	if e.Role != "" {
+		return e.Role
+	}
+	return e.Message.Role
+}
+
+// LastAssistantMessage implements TranscriptParser.
+func (ClaudeParser) LastAssistantMessage(data []byte) (string, error) {
+	var transcript []claudeEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if transcript = parseJSONL(trimmed); len(transcript) == 0 {
+			return "", fmt.Errorf("no transcript entries")
+		}
+	} else if err := json.Unmarshal(data, &transcript); err != nil {
+		return "", err
+	}
+
+	// Walk backwards to find the last assistant message. A streamed reply is
+	// split over several entries, some holding only tool calls; those have
+	// no text and are passed over.
+	for i := len(transcript) - 1; i >= 0; i-- {
+		if transcript[i].role() != "assistant" {
+			continue
+		}
+		if s := contentText(transcript[i].Message.Content); s != "" {
+			return s, nil
+		}
+	}
+	return "", nil
+}
+
+// parseJSONL decodes one entry per line. Lines that fail to decode, such as
+// a final line truncated while the assistant is still writing, are skipped,
+// as are lines without a role (e.g. session summaries).
+func parseJSONL(data []byte) []claudeEntry {
+	var entries []claudeEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e claudeEntry
+		if json.Unmarshal(line, &e) == nil && e.role() != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// OpenAIParser reads OpenAI-style chat transcripts: {messages: [{role,
+// content}]}, where content is a plain string or an array of
+// {type: "text", text} parts.
+type OpenAIParser struct{}
+
+// LastAssistantMessage implements TranscriptParser.
+func (OpenAIParser) LastAssistantMessage(data []byte) (string, error) {
+	var transcript struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return "", err
+	}
+
+	for i := len(transcript.Messages) - 1; i >= 0; i-- {
+		if transcript.Messages[i].Role != "assistant" {
+			continue
+		}
+		if s := contentText(transcript.Messages[i].Content); s != "" {
+			return s, nil
+		}
+	}
+	return "", nil
+}
+
+// contentText returns message content given either as a plain string or as an
+// array of {type, text} blocks. For blocks, the first non-empty block of type
+// "text" is the assistant's prose and is preferred; tool_use and tool_result
+// blocks can carry text too, but a tool payload is only used when no text
+// block has any.
+func contentText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	// Try content as plain string first, then as array of content blocks.
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &blocks) != nil {
+		return ""
+	}
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			return block.Text
+		}
+	}
+	for _, block := range blocks {
+		if block.Text != "" {
+			return block.Text
+		}
+	}
+	return ""
+}
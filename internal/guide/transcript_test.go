@@ -0,0 +1,174 @@
+package guide
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClaudeParserLastAssistantMessage(t *testing.T) {
+	data := []byte(`[
+		{"role": "user", "message": {"content": "add auth"}},
+		{"role": "assistant", "message": {"content": "Added JWT middleware."}},
+		{"role": "user", "message": {"content": "now refresh tokens"}},
+		{"role": "assistant", "message": {"content": [
+			{"type": "tool_use", "id": "t1"},
+			{"type": "text", "text": "Added a \"refresh\" endpoint."}
+		]}},
+		{"role": "user", "message": {"content": "thanks"}}
+	]`)
+
+	got, err := ClaudeParser{}.LastAssistantMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `Added a "refresh" endpoint.`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestClaudeParserPrefersTextBlocks(t *testing.T) {
+	data := []byte(`[
+		{"role": "user", "message": {"content": "why is login failing?"}},
+		{"role": "assistant", "message": {"content": [
+			{"type": "tool_use", "id": "t1", "text": "grep -rn session auth/"},
+			{"type": "tool_result", "tool_use_id": "t1", "text": "auth/session.go:42: expiry := 0"},
+			{"type": "text", "text": "The session expiry was zero, so every login expired at once."}
+		]}}
+	]`)
+
+	got, err := ClaudeParser{}.LastAssistantMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "The session expiry was zero, so every login expired at once."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// With no text block, a tool payload is better than nothing.
+	data = []byte(`[{"role": "assistant", "message": {"content": [
+		{"type": "tool_use", "id": "t1"},
+		{"type": "tool_result", "tool_use_id": "t1", "text": "3 files changed"}
+	]}}]`)
+	got, err = ClaudeParser{}.LastAssistantMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "3 files changed"; got != want {
+		t.Errorf("fallback: got %q, want %q", got, want)
+	}
+}
+
+func TestOpenAIParserLastAssistantMessage(t *testing.T) {
+	data := []byte(`{"messages": [
+		{"role": "system", "content": "You are helpful."},
+		{"role": "user", "content": "fix the migration"},
+		{"role": "assistant", "content": "Renamed the column in the migration."},
+		{"role": "user", "content": "and the index?"},
+		{"role": "assistant", "content": [{"type": "text", "text": "Added the index too."}]},
+		{"role": "tool", "content": "ok"}
+	]}`)
+
+	got, err := OpenAIParser{}.LastAssistantMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Added the index too."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParserRejectsOtherFormat(t *testing.T) {
+	claude := []byte(`[{"role": "assistant", "message": {"content": "hi"}}]`)
+	openai := []byte(`{"messages": [{"role": "assistant", "content": "hi"}]}`)
+
+	if _, err := (OpenAIParser{}).LastAssistantMessage(claude); err == nil {
+		t.Error("OpenAIParser should reject a Claude transcript")
+	}
+	if _, err := (ClaudeParser{}).LastAssistantMessage(openai); err == nil {
+		t.Error("ClaudeParser should reject an OpenAI transcript")
+	}
+}
+
+func TestParserNoAssistantMessage(t *testing.T) {
+	got, err := ClaudeParser{}.LastAssistantMessage([]byte(`[{"role": "user", "message": {"content": "hi"}}]`))
+	if err != nil || got != "" {
+		t.Errorf("got %q, %v; want empty, nil", got, err)
+	}
+}
+
+func TestParserFor(t *testing.T) {
+	for format, want := range map[string]TranscriptParser{
+		"":           ClaudeParser{},
+		FormatClaude: ClaudeParser{},
+		FormatOpenAI: OpenAIParser{},
+	} {
+		p, err := ParserFor(format)
+		if err != nil || p != want {
+			t.Errorf("ParserFor(%q) = %T, %v", format, p, err)
+		}
+	}
+	if _, err := ParserFor("cursor"); err == nil {
+		t.Error("ParserFor should reject an unknown format")
+	}
+}
+
+func TestClaudeParserJSONLMatchesArray(t *testing.T) {
+	array := []byte(`[
+		{"role": "user", "message": {"content": "add auth"}},
+		{"role": "assistant", "message": {"content": [{"type": "text", "text": "Added JWT middleware."}]}},
+		{"role": "assistant", "message": {"content": [{"type": "tool_use", "id": "t1"}]}}
+	]`)
+	// The same conversation as JSONL, with the role inside message as Claude
+	// Code writes it and a final line cut off mid-write.
+	jsonl := []byte(`{"type": "user", "message": {"role": "user", "content": "add auth"}}
+{"type": "assistant", "message": {"role": "assistant", "content": [{"type": "text", "text": "Added JWT middleware."}]}}
+{"type": "assistant", "message": {"role": "assistant", "content": [{"type": "tool_use", "id": "t1"}]}}
+{"type": "assistant", "message": {"role": "assistant", "content": [{"type": "text", "text": "Now wri`)
+
+	fromArray, err := ClaudeParser{}.LastAssistantMessage(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSONL, err := ClaudeParser{}.LastAssistantMessage(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Added JWT middleware."; fromArray != want || fromJSONL != want {
+		t.Errorf("array = %q, jsonl = %q, want %q", fromArray, fromJSONL, want)
+	}
+}
+
+func TestReadTranscriptKeepsTail(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, `{"role": "user", "message": {"content": "prompt %d with some padding"}}`+"\n", i)
+		fmt.Fprintf(&b, `{"role": "assistant", "message": {"content": "reply %d"}}`+"\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "transcript.jsonl")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const limit = 1000
+	data, err := ReadTranscript(path, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > limit || !strings.HasPrefix(string(data), `{"role"`) {
+		t.Errorf("read %d bytes starting %.20q, want at most %d from a line start", len(data), data, limit)
+	}
+	got, err := ClaudeParser{}.LastAssistantMessage(data)
+	if err != nil || got != "reply 199" {
+		t.Errorf("LastAssistantMessage = %q, %v; want the last reply", got, err)
+	}
+
+	if full, err := ReadTranscript(path, 0); err != nil || len(full) != b.Len() {
+		t.Errorf("limit 0 read %d bytes, %v; want the whole file (%d)", len(full), err, b.Len())
+	}
+	if _, err := ReadTranscript(t.TempDir(), limit); err == nil {
+		t.Error("reading a directory should fail")
+	}
+}
@@ -1,6 +1,12 @@
 package markov
 
-import "sort"
+import (
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
 
 // Transition represents a predicted next topic with its probability.
 type Transition struct {
@@ -8,20 +14,74 @@ type Transition struct {
 	Probability float64
 }
 
+// SchemaVersion is the current on-disk layout of Chain.
+const SchemaVersion = 1
+
 // Chain is a sparse Markov transition matrix over topic (tree) IDs.
 // Counts[from][to] = number of times the user moved from topic "from" to topic "to".
+// Counts are floats so that Decay can fade old transitions smoothly; without
+// decay they hold whole numbers.
+//
+// Second-order rows are stored in the same maps under a composite key built by
+// HistoryKey(prev, from), so Counts["A|B"]["C"] counts the path A → B → C.
 type Chain struct {
-	Counts    map[string]map[string]int `json:"counts"`
-	Totals    map[string]int            `json:"totals"` // row sums for O(1) normalization
-	LastTopic string                    `json:"lastTopic"`
+	SchemaVersion int `json:"schemaVersion"`
+
+	Counts    map[string]map[string]float64 `json:"counts"`
+	Totals    map[string]float64            `json:"totals"` // row sums for O(1) normalization
+	LastTopic string                        `json:"lastTopic"`
+	PrevTopic string                        `json:"prevTopic,omitempty"` // topic before LastTopic
+
+	// History lists the most recent topic visits, oldest first, for auditing
+	// how the counts came about. It is observability only: probabilities are
+	// computed from Counts. See Visit.
+	History []string `json:"history,omitempty"`
+
+	// Smoothing is the add-k constant applied by Probability and
+	// TopTransitions. Zero (the default) leaves probabilities unsmoothed.
+	// It is configuration, not learned state, so it is not persisted.
+	Smoothing float64 `json:"-"`
+}
+
+// historySep joins two topic IDs into a second-order row key. Topic IDs are
+// base36, so the separator cannot occur inside an ID.
+const historySep = "|"
+
+// HistoryKey returns the second-order row key for the path prev → from.
+func HistoryKey(prev, from string) string {
+	return prev + historySep + from
+}
+
+// isHistoryKey reports whether a row key is a second-order composite.
+func isHistoryKey(key string) bool {
+	return strings.Contains(key, historySep)
 }
 
 // New creates an empty chain.
 func New() *Chain {
 	return &Chain{
-		Counts: make(map[string]map[string]int),
-		Totals: make(map[string]int),
+		SchemaVersion: SchemaVersion,
+		Counts:        make(map[string]map[string]float64),
+		Totals:        make(map[string]float64),
+	}
+}
+
+// CurrentSchema reports SchemaVersion for persist.Load migrations.
+func (c *Chain) CurrentSchema() int { return SchemaVersion }
+
+// Clone returns a deep copy of the chain.
+func (c *Chain) Clone() *Chain {
+	cp := *c
+	cp.Counts = make(map[string]map[string]float64, len(c.Counts))
+	for from, row := range c.Counts {
+		cp.Counts[from] = maps.Clone(row)
+	}
+	cp.History = slices.Clone(c.History)
+	cp.Totals = maps.Clone(c.Totals)
+	if cp.Totals == nil {
+		cp.Totals = make(map[string]float64)
 	}
+	return &cp
 }
 
 // Record increments the transition count from → to.
@@ -30,23 +90,117 @@ func (c *Chain) Record(from, to string) {
 		return
 	}
 	if c.Counts[from] == nil {
-		c.Counts[from] = make(map[string]int)
+		c.Counts[from] = make(map[string]float64)
 	}
 	c.Counts[from][to]++
 	c.Totals[from]++
 }
 
+// Visit appends a topic to History, keeping the newest max entries. A max
+// of zero or less turns the history off and clears it.
+func (c *Chain) Visit(topicID string, max int) {
+	if max <= 0 {
+		c.History = nil
+		return
+	}
+	if topicID == "" {
+		return
+	}
+	c.History = append(c.History, topicID)
+	if len(c.History) > max {
+		c.History = slices.Clone(c.History[len(c.History)-max:])
+	}
+}
+
+// Unvisit reverses Visit(topicID, …) if topicID is the newest entry.
+func (c *Chain) Unvisit(topicID string) {
+	if n := len(c.History); n > 0 && c.History[n-1] == topicID {
+		c.History = c.History[:n-1]
+	}
+}
+
+// Unrecord reverses one Record(from, to). A count that drops to zero (or
+// below, after decay) is removed along with its empty row.
+func (c *Chain) Unrecord(from, to string) {
+	row := c.Counts[from]
+	count, ok := row[to]
+	if !ok {
+		return
+	}
+	dec := math.Min(count, 1)
+	if count -= dec; count <= 0 {
+		delete(row, to)
+	} else {
+		row[to] = count
+	}
+	c.Totals[from] -= dec
+	if len(row) == 0 || c.Totals[from] <= 0 {
+		delete(c.Counts, from)
+		delete(c.Totals, from)
+	}
+}
+
+// RecordHistory records the first-order transition from → to and, when prev
+// is known, the second-order transition prev → from → to.
+func (c *Chain) RecordHistory(prev, from, to string) {
+	c.Record(from, to)
+	if prev != "" && from != "" {
+		c.Record(HistoryKey(prev, from), to)
+	}
+}
+
 // Probability returns P(to | from) = counts[from][to] / totals[from].
 // Returns 0 if no data exists.
+//
+// With Smoothing k > 0 it returns (counts[from][to] + k) / (totals[from] + k*V),
+// where V is the number of known topics, so unseen transitions keep a small
+// non-zero probability.
 func (c *Chain) Probability(from, to string) float64 {
 	if from == "" || to == "" {
 		return 0
 	}
+	if c.Smoothing > 0 {
+		return c.smoothed(from, c.Counts[from][to], c.knownTopics())
+	}
 	total := c.Totals[from]
 	if total == 0 {
 		return 0
 	}
-	return float64(c.Counts[from][to]) / float64(total)
+	return c.Counts[from][to] / total
+}
+
+// smoothed applies add-k smoothing to a count in row from, given v known topics.
+func (c *Chain) smoothed(from string, count float64, v int) float64 {
+	denom := c.Totals[from] + c.Smoothing*float64(v)
+	if denom == 0 {
+		return 0
+	}
+	return (count + c.Smoothing) / denom
+}
+
+// knownTopics returns the number of distinct topic IDs that appear in the
+// chain, as a source or a destination. Second-order keys are not topics.
+func (c *Chain) knownTopics() int {
+	seen := make(map[string]bool)
+	for from, row := range c.Counts {
+		if !isHistoryKey(from) {
+			seen[from] = true
+		}
+		for to := range row {
+			seen[to] = true
+		}
+	}
+	return len(seen)
+}
+
+// ProbabilityGiven returns P(to | prev, from) from the second-order rows,
+// falling back to the first-order P(to | from) when the two-step history is
+// absent or was never observed.
+func (c *Chain) ProbabilityGiven(prev, from, to string) float64 {
+	if prev != "" && from != "" && c.Totals[HistoryKey(prev, from)] > 0 {
+		return c.Probability(HistoryKey(prev, from), to)
+	}
+	return c.Probability(from, to)
 }
 
 // Predict returns the most likely next topic from the given topic.
@@ -57,7 +211,7 @@ func (c *Chain) Predict(from string) string {
 		return ""
 	}
 	bestID := ""
-	bestCount := 0
+	bestCount := 0.0
 	for id, count := range row {
 		if count > bestCount {
 			bestCount = count
@@ -68,6 +222,7 @@ func (c *Chain) Predict(from string) string {
 }
 
 // TopTransitions returns the top N transitions from a topic, sorted by probability descending.
+// Only observed destinations are listed; their probabilities honour Smoothing.
 func (c *Chain) TopTransitions(from string, n int) []Transition {
 	row := c.Counts[from]
 	if len(row) == 0 {
@@ -78,11 +233,20 @@ func (c *Chain) TopTransitions(from string, n int) []Transition {
 		return nil
 	}
 
+	v := 0
+	if c.Smoothing > 0 {
+		v = c.knownTopics()
+	}
+
 	ts := make([]Transition, 0, len(row))
 	for id, count := range row {
+		p := count / total
+		if c.Smoothing > 0 {
+			p = c.smoothed(from, count, v)
+		}
 		ts = append(ts, Transition{
 			TopicID:     id,
-			Probability: float64(count) / float64(total),
+			Probability: p,
 		})
 	}
 	sort.Slice(ts, func(i, j int) bool {
@@ -94,6 +258,41 @@ func (c *Chain) TopTransitions(from string, n int) []Transition {
 	return ts[:n]
 }
 
+// MostLikelyPath greedily follows the most frequent transition from from for
+// up to depth steps and returns the topics reached, excluding from. It stops
+// early at a topic with no recorded transitions, or when the next topic is
+// already on the path (from included), so a cycle A→B→A yields [B]. Ties go
+// to the smaller topic ID, so the path is deterministic.
+func (c *Chain) MostLikelyPath(from string, depth int) []string {
+	var path []string
+	seen := map[string]bool{from: true}
+	for cur := from; len(path) < depth; {
+		next := ""
+		best := 0.0
+		for id, count := range c.Counts[cur] {
+			if count > best || (count == best && count > 0 && id < next) {
+				next, best = id, count
+			}
+		}
+		if next == "" || seen[next] {
+			break
+		}
+		seen[next] = true
+		path = append(path, next)
+		cur = next
+	}
+	return path
+}
+
+// TopTransitionsGiven is TopTransitions over the second-order row for
+// prev → from, with the same first-order fallback as ProbabilityGiven.
+func (c *Chain) TopTransitionsGiven(prev, from string, n int) []Transition {
+	if prev != "" && from != "" && c.Totals[HistoryKey(prev, from)] > 0 {
+		return c.TopTransitions(HistoryKey(prev, from), n)
+	}
+	return c.TopTransitions(from, n)
+}
+
 // PruneTopic removes all references to a topic ID (both as source and destination).
 func (c *Chain) PruneTopic(topicID string) {
 	// Remove outgoing transitions
@@ -102,6 +301,18 @@ func (c *Chain) PruneTopic(topicID string) {
 		delete(c.Totals, topicID)
 	}
 
+	// Remove second-order rows whose history includes the topic
+	for key := range c.Counts {
+		if !isHistoryKey(key) {
+			continue
+		}
+		parts := strings.SplitN(key, historySep, 2)
+		if parts[0] == topicID || parts[1] == topicID {
+			delete(c.Counts, key)
+			delete(c.Totals, key)
+		}
+	}
+
 	// Remove incoming transitions from all other rows
 	for from, row := range c.Counts {
 		if count, ok := row[topicID]; ok {
@@ -116,17 +327,177 @@ func (c *Chain) PruneTopic(topicID string) {
 		}
 	}
 
+	c.History = slices.DeleteFunc(c.History, func(id string) bool { return id == topicID })
+
 	// Clear lastTopic if it pointed to the pruned topic
 	if c.LastTopic == topicID {
 		c.LastTopic = ""
 	}
+	if c.PrevTopic == topicID {
+		c.PrevTopic = ""
+	}
+}
+
+// SplitTopic hands a share (0–1) of every transition involving from over to
+// the topic to, as when from's tree is split in two. from's outgoing row is
+// divided between from and to, then in every row, including the new one, each
+// count into from is divided the same way; other row totals are unchanged.
+// Second-order rows keyed by a history through from stay with from. A share
+// outside (0, 1) is a no-op.
+func (c *Chain) SplitTopic(from, to string, share float64) {
+	if share <= 0 || share >= 1 || from == "" || to == "" || from == to {
+		return
+	}
+	if row := c.Counts[from]; row != nil {
+		if c.Counts[to] == nil {
+			c.Counts[to] = make(map[string]float64)
+		}
+		for dest, count := range row {
+			moved := count * share
+			row[dest] = count - moved
+			c.Counts[to][dest] += moved
+		}
+		moved := c.Totals[from] * share
+		c.Totals[from] -= moved
+		c.Totals[to] += moved
+	}
+	for _, row := range c.Counts {
+		if count, ok := row[from]; ok {
+			moved := count * share
+			row[from] = count - moved
+			row[to] += moved
+		}
+	}
+}
+
+// MergeTopic folds every transition involving from into the topic into, as
+// when from's tree is merged into into's. Rows and counts are summed under
+// into, second-order rows whose history passes through from included, so a
+// move between the two topics becomes a self-transition of into. History,
+// LastTopic and PrevTopic are renamed the same way.
+func (c *Chain) MergeTopic(from, into string) {
+	if from == "" || into == "" || from == into {
+		return
+	}
+	rename := func(id string) string {
+		if id == from {
+			return into
+		}
+		return id
+	}
+
+	counts := make(map[string]map[string]float64, len(c.Counts))
+	totals := make(map[string]float64, len(c.Totals))
+	for key, row := range c.Counts {
+		k := rename(key)
+		if isHistoryKey(key) {
+			parts := strings.SplitN(key, historySep, 2)
+			k = HistoryKey(rename(parts[0]), rename(parts[1]))
+		}
+		if counts[k] == nil {
+			counts[k] = make(map[string]float64, len(row))
+		}
+		for to, count := range row {
+			counts[k][rename(to)] += count
+		}
+		totals[k] += c.Totals[key]
+	}
+	c.Counts, c.Totals = counts, totals
+
+	for i, id := range c.History {
+		c.History[i] = rename(id)
+	}
+	c.LastTopic, c.PrevTopic = rename(c.LastTopic), rename(c.PrevTopic)
 }
 
-// TransitionCount returns the total number of recorded transitions.
+// minCount is the weight below which a decayed transition is dropped.
+const minCount = 0.01
+
+// Decay multiplies every transition count by factor (0 < factor < 1), so
+// recent transitions outweigh old ones. Counts that fade below minCount are
+// removed, and each row total is recomputed from its surviving counts so
+// Totals stays consistent. A factor outside (0, 1) is a no-op.
+func (c *Chain) Decay(factor float64) {
+	if factor <= 0 || factor >= 1 {
+		return
+	}
+	for from, row := range c.Counts {
+		total := 0.0
+		for to, count := range row {
+			count *= factor
+			if count < minCount {
+				delete(row, to)
+				continue
+			}
+			row[to] = count
+			total += count
+		}
+		if len(row) == 0 {
+			delete(c.Counts, from)
+			delete(c.Totals, from)
+			continue
+		}
+		c.Totals[from] = total
+	}
+}
+
+// TransitionCount returns the total number of recorded transitions, rounded
+// to the nearest whole number when counts have been decayed.
+// Second-order rows duplicate first-order ones and are not counted.
 func (c *Chain) TransitionCount() int {
-	total := 0
-	for _, t := range c.Totals {
+	total := 0.0
+	for from, t := range c.Totals {
+		if isHistoryKey(from) {
+			continue
+		}
 		total += t
 	}
-	return total
+	return int(math.Round(total))
+}
+
+// Entropy returns the Shannon entropy, in bits, of the observed transitions
+// out of from. 0 means the next topic is certain (a single destination);
+// log2(n) means n destinations are equally likely. Smoothing is not applied.
+// An empty or unknown row has entropy 0.
+func (c *Chain) Entropy(from string) float64 {
+	total := c.Totals[from]
+	if total <= 0 {
+		return 0
+	}
+	h := 0.0
+	for _, count := range c.Counts[from] {
+		if count <= 0 {
+			continue
+		}
+		p := count / total
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Perplexity returns 2^Entropy(from): the effective number of equally likely
+// next topics. It is 1 for a single destination and 0 for an empty row,
+// which predicts nothing.
+func (c *Chain) Perplexity(from string) float64 {
+	if c.Totals[from] <= 0 {
+		return 0
+	}
+	return math.Pow(2, c.Entropy(from))
+}
+
+// AverageEntropy returns the entropy of each first-order row weighted by its
+// total, so frequently left topics dominate. 0 if nothing is recorded.
+func (c *Chain) AverageEntropy() float64 {
+	sum, weight := 0.0, 0.0
+	for from, total := range c.Totals {
+		if isHistoryKey(from) || total <= 0 {
+			continue
+		}
+		sum += c.Entropy(from) * total
+		weight += total
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
 }
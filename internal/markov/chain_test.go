@@ -2,6 +2,7 @@ package markov
 
 import (
 	"math"
+	"slices"
 	"testing"
 )
 
@@ -59,6 +60,44 @@ func TestPredict(t *testing.T) {
 	}
 }
 
+func TestMostLikelyPath(t *testing.T) {
+	c := New()
+	record := func(from, to string, n int) {
+		for range n {
+			c.Record(from, to)
+		}
+	}
+	record("A", "B", 9)
+	record("A", "D", 1)
+	record("B", "C", 9)
+	record("B", "E", 1)
+
+	if got := c.MostLikelyPath("A", 2); !slices.Equal(got, []string{"B", "C"}) {
+		t.Errorf("MostLikelyPath(A, 2) = %v, want [B C]", got)
+	}
+	if got := c.MostLikelyPath("A", 1); !slices.Equal(got, []string{"B"}) {
+		t.Errorf("MostLikelyPath(A, 1) = %v, want [B]", got)
+	}
+	// C is a dead end.
+	if got := c.MostLikelyPath("A", 5); !slices.Equal(got, []string{"B", "C"}) {
+		t.Errorf("MostLikelyPath(A, 5) = %v, want [B C]", got)
+	}
+
+	// C → A closes a cycle: the path stops rather than revisit A.
+	record("C", "A", 1)
+	if got := c.MostLikelyPath("A", 5); !slices.Equal(got, []string{"B", "C"}) {
+		t.Errorf("cyclic MostLikelyPath(A, 5) = %v, want [B C]", got)
+	}
+	record("B", "A", 20)
+	if got := c.MostLikelyPath("A", 5); !slices.Equal(got, []string{"B"}) {
+		t.Errorf("MostLikelyPath(A, 5) with B → A = %v, want [B]", got)
+	}
+
+	if got := c.MostLikelyPath("unknown", 3); got != nil {
+		t.Errorf("MostLikelyPath(unknown) = %v, want nil", got)
+	}
+}
+
 func TestPredictEmpty(t *testing.T) {
 	c := New()
 	if c.Predict("A") != "" {
@@ -108,6 +147,41 @@ func TestPruneTopic(t *testing.T) {
 	}
 }
 
+func TestHistoryRecordsVisitsAndPrunes(t *testing.T) {
+	c := New()
+	last := ""
+	for _, topic := range []string{"A", "B", "A", "C"} {
+		c.Record(last, topic)
+		c.Visit(topic, 10)
+		last = topic
+	}
+	if want := []string{"A", "B", "A", "C"}; !slices.Equal(c.History, want) {
+		t.Fatalf("History = %v, want %v", c.History, want)
+	}
+
+	c.PruneTopic("B")
+	if want := []string{"A", "A", "C"}; !slices.Equal(c.History, want) {
+		t.Errorf("History after pruning B = %v, want %v", c.History, want)
+	}
+	if c.Probability("A", "B") != 0 || !approxEqual(c.Probability("A", "C"), 1) {
+		t.Errorf("counts not adjusted: P(B|A) = %f, P(C|A) = %f", c.Probability("A", "B"), c.Probability("A", "C"))
+	}
+
+	// The cap keeps the newest visits; zero clears the history.
+	c.Visit("D", 2)
+	if want := []string{"C", "D"}; !slices.Equal(c.History, want) {
+		t.Errorf("capped History = %v, want %v", c.History, want)
+	}
+	c.Unvisit("D")
+	if want := []string{"C"}; !slices.Equal(c.History, want) {
+		t.Errorf("History after Unvisit = %v, want %v", c.History, want)
+	}
+	c.Visit("E", 0)
+	if c.History != nil {
+		t.Errorf("History with size 0 = %v, want nil", c.History)
+	}
+}
+
 func TestPruneNonexistent(t *testing.T) {
 	c := New()
 	c.Record("A", "B")
@@ -164,3 +238,302 @@ func TestTransitionCount(t *testing.T) {
 		t.Errorf("TransitionCount = %d, want 3", c.TransitionCount())
 	}
 }
+
+func TestSecondOrderDivergentHistories(t *testing.T) {
+	c := New()
+	// A → B → C and X → B → D, twice each.
+	for i := 0; i < 2; i++ {
+		c.RecordHistory("", "A", "B")
+		c.RecordHistory("A", "B", "C")
+		c.RecordHistory("", "X", "B")
+		c.RecordHistory("X", "B", "D")
+	}
+
+	// First order cannot tell the paths apart.
+	if !approxEqual(c.Probability("B", "C"), 0.5) || !approxEqual(c.Probability("B", "D"), 0.5) {
+		t.Errorf("first-order P(C|B)=%f P(D|B)=%f, want 0.5 each", c.Probability("B", "C"), c.Probability("B", "D"))
+	}
+
+	// Second order follows the history.
+	if !approxEqual(c.ProbabilityGiven("A", "B", "C"), 1.0) {
+		t.Errorf("P(C|A,B) = %f, want 1.0", c.ProbabilityGiven("A", "B", "C"))
+	}
+	if !approxEqual(c.ProbabilityGiven("X", "B", "D"), 1.0) {
+		t.Errorf("P(D|X,B) = %f, want 1.0", c.ProbabilityGiven("X", "B", "D"))
+	}
+	if top := c.TopTransitionsGiven("X", "B", 1); len(top) != 1 || top[0].TopicID != "D" {
+		t.Errorf("TopTransitionsGiven(X, B) = %v, want [D]", top)
+	}
+
+	// Unknown or absent history falls back to first order.
+	if !approxEqual(c.ProbabilityGiven("", "B", "C"), 0.5) {
+		t.Errorf("no history: P = %f, want 0.5", c.ProbabilityGiven("", "B", "C"))
+	}
+	if !approxEqual(c.ProbabilityGiven("Z", "B", "C"), 0.5) {
+		t.Errorf("unseen history: P = %f, want 0.5", c.ProbabilityGiven("Z", "B", "C"))
+	}
+
+	// Composite rows are not double-counted.
+	if c.TransitionCount() != 8 {
+		t.Errorf("TransitionCount = %d, want 8", c.TransitionCount())
+	}
+}
+
+func TestPruneTopicSecondOrder(t *testing.T) {
+	c := New()
+	c.RecordHistory("A", "B", "C")
+	c.RecordHistory("X", "B", "C")
+	c.PrevTopic = "A"
+
+	c.PruneTopic("A")
+
+	if _, ok := c.Counts[HistoryKey("A", "B")]; ok {
+		t.Error("composite row with pruned history should be removed")
+	}
+	if _, ok := c.Counts[HistoryKey("X", "B")]; !ok {
+		t.Error("unrelated composite row should survive")
+	}
+	if c.PrevTopic != "" {
+		t.Errorf("PrevTopic = %q, want cleared", c.PrevTopic)
+	}
+
+	c.PruneTopic("C")
+	if len(c.Counts) != 0 || len(c.Totals) != 0 {
+		t.Errorf("pruning destination should empty all rows, got %v / %v", c.Counts, c.Totals)
+	}
+}
+
+func TestDecayRecentOvertakesOld(t *testing.T) {
+	c := New()
+	for i := 0; i < 5; i++ {
+		c.Record("A", "B")
+	}
+
+	// Each step decays history, then records a fresh A → C.
+	steps := 0
+	for c.Probability("A", "C") <= c.Probability("A", "B") {
+		c.Decay(0.7)
+		c.Record("A", "C")
+		steps++
+		if steps > 10 {
+			t.Fatalf("recent transition never overtook the old one: P(B)=%f P(C)=%f",
+				c.Probability("A", "B"), c.Probability("A", "C"))
+		}
+	}
+	if steps < 2 {
+		t.Errorf("overtook after %d step(s), old pattern should resist at least briefly", steps)
+	}
+
+	// Totals stay consistent with the decayed counts.
+	sum := 0.0
+	for _, count := range c.Counts["A"] {
+		sum += count
+	}
+	if !approxEqual(sum, c.Totals["A"]) {
+		t.Errorf("Totals[A] = %f, want %f", c.Totals["A"], sum)
+	}
+}
+
+func TestDecayDropsFadedTransitions(t *testing.T) {
+	c := New()
+	c.Record("A", "B")
+	for i := 0; i < 20; i++ {
+		c.Decay(0.5)
+	}
+	if len(c.Counts) != 0 || len(c.Totals) != 0 {
+		t.Errorf("faded transitions should be removed, got %v / %v", c.Counts, c.Totals)
+	}
+
+	// Out-of-range factors are no-ops.
+	c.Record("A", "B")
+	c.Decay(0)
+	c.Decay(1)
+	if c.Counts["A"]["B"] != 1 {
+		t.Errorf("Decay outside (0,1) changed counts: %v", c.Counts)
+	}
+}
+
+func TestSmoothingSeenAndUnseen(t *testing.T) {
+	build := func(k float64) *Chain {
+		c := New()
+		c.Smoothing = k
+		c.Record("A", "B")
+		c.Record("A", "B")
+		c.Record("A", "C")
+		c.Record("D", "A")
+		return c
+	}
+	plain, smooth := build(0), build(1)
+
+	// Unsmoothed path is unchanged.
+	if !approxEqual(plain.Probability("A", "B"), 2.0/3.0) {
+		t.Errorf("unsmoothed P(B|A) = %f, want 2/3", plain.Probability("A", "B"))
+	}
+	if plain.Probability("A", "D") != 0 {
+		t.Errorf("unsmoothed P(D|A) = %f, want 0", plain.Probability("A", "D"))
+	}
+
+	// Known topics: A, B, C, D → V = 4; row A total = 3.
+	if got, want := smooth.Probability("A", "B"), 3.0/7.0; !approxEqual(got, want) {
+		t.Errorf("smoothed P(B|A) = %f, want %f", got, want)
+	}
+	if got, want := smooth.Probability("A", "D"), 1.0/7.0; !approxEqual(got, want) {
+		t.Errorf("smoothed P(D|A) = %f, want %f", got, want)
+	}
+	if smooth.Probability("A", "B") >= plain.Probability("A", "B") {
+		t.Error("smoothing should pull seen probabilities down")
+	}
+
+	// Smoothed probabilities over all known topics still sum to 1.
+	sum := 0.0
+	for _, to := range []string{"A", "B", "C", "D"} {
+		sum += smooth.Probability("A", to)
+	}
+	if !approxEqual(sum, 1) {
+		t.Errorf("smoothed row sums to %f, want 1", sum)
+	}
+
+	// TopTransitions reports the same smoothed values.
+	top := smooth.TopTransitions("A", 2)
+	if len(top) != 2 || top[0].TopicID != "B" {
+		t.Fatalf("TopTransitions = %v", top)
+	}
+	for _, tr := range top {
+		if !approxEqual(tr.Probability, smooth.Probability("A", tr.TopicID)) {
+			t.Errorf("TopTransitions P(%s) = %f, Probability = %f",
+				tr.TopicID, tr.Probability, smooth.Probability("A", tr.TopicID))
+		}
+	}
+}
+
+func TestUnrecord(t *testing.T) {
+	c := New()
+	c.Record("A", "B")
+	c.Record("A", "B")
+	c.Record("A", "C")
+
+	c.Unrecord("A", "B")
+	if c.Counts["A"]["B"] != 1 || c.Totals["A"] != 2 {
+		t.Errorf("after one Unrecord: counts %v totals %v", c.Counts["A"], c.Totals["A"])
+	}
+	c.Unrecord("A", "B")
+	c.Unrecord("A", "C")
+	if len(c.Counts) != 0 || len(c.Totals) != 0 {
+		t.Errorf("empty rows should be removed: %v / %v", c.Counts, c.Totals)
+	}
+	c.Unrecord("X", "Y") // unknown transition is a no-op
+}
+
+func TestEntropy(t *testing.T) {
+	c := New()
+	for i := 0; i < 5; i++ {
+		c.Record("A", "B")
+	}
+	for _, to := range []string{"W", "X", "Y", "Z"} {
+		c.Record("C", to)
+		c.Record("C", to)
+	}
+
+	if h := c.Entropy("A"); h != 0 {
+		t.Errorf("deterministic row entropy = %f, want 0", h)
+	}
+	if pp := c.Perplexity("A"); !approxEqual(pp, 1) {
+		t.Errorf("deterministic row perplexity = %f, want 1", pp)
+	}
+	if h := c.Entropy("C"); !approxEqual(h, 2.0) {
+		t.Errorf("four-way row entropy = %f, want 2.0", h)
+	}
+	if pp := c.Perplexity("C"); !approxEqual(pp, 4) {
+		t.Errorf("four-way row perplexity = %f, want 4", pp)
+	}
+	if h, pp := c.Entropy("missing"), c.Perplexity("missing"); h != 0 || pp != 0 {
+		t.Errorf("empty row entropy = %f, perplexity = %f, want 0, 0", h, pp)
+	}
+
+	// Weighted by row totals: (0*5 + 2*8) / 13.
+	if avg := c.AverageEntropy(); !approxEqual(avg, 16.0/13) {
+		t.Errorf("AverageEntropy = %f, want %f", avg, 16.0/13)
+	}
+	if avg := New().AverageEntropy(); avg != 0 {
+		t.Errorf("empty chain AverageEntropy = %f, want 0", avg)
+	}
+}
+
+func TestSplitTopic(t *testing.T) {
+	c := New()
+	for i := 0; i < 4; i++ {
+		c.Record("A", "B")
+		c.Record("C", "A")
+	}
+	c.SplitTopic("A", "A2", 0.25)
+
+	if !approxEqual(c.Counts["A"]["B"], 3) || !approxEqual(c.Counts["A2"]["B"], 1) {
+		t.Errorf("outgoing split: A->B %.2f, A2->B %.2f, want 3 and 1",
+			c.Counts["A"]["B"], c.Counts["A2"]["B"])
+	}
+	if !approxEqual(c.Totals["A"], 3) || !approxEqual(c.Totals["A2"], 1) {
+		t.Errorf("totals: A %.2f, A2 %.2f, want 3 and 1", c.Totals["A"], c.Totals["A2"])
+	}
+	if !approxEqual(c.Counts["C"]["A"], 3) || !approxEqual(c.Counts["C"]["A2"], 1) {
+		t.Errorf("incoming split: C->A %.2f, C->A2 %.2f, want 3 and 1",
+			c.Counts["C"]["A"], c.Counts["C"]["A2"])
+	}
+	if !approxEqual(c.Totals["C"], 4) {
+		t.Errorf("C total = %.2f, want 4 (unchanged)", c.Totals["C"])
+	}
+	if !approxEqual(c.Probability("C", "A")+c.Probability("C", "A2"), 1) {
+		t.Error("split row no longer sums to 1")
+	}
+
+	before := c.TransitionCount()
+	c.SplitTopic("A", "A3", 1)
+	if c.TransitionCount() != before || c.Counts["A3"] != nil {
+		t.Error("share of 1 should be a no-op")
+	}
+}
+
+func TestMergeTopic(t *testing.T) {
+	c := New()
+	c.Record("A", "B")
+	c.Record("B", "A")
+	c.Record("C", "A")
+	c.RecordHistory("C", "A", "B") // also records A -> B
+	c.Visit("A", 10)
+	c.Visit("B", 10)
+	c.LastTopic, c.PrevTopic = "A", "C"
+
+	c.MergeTopic("A", "B")
+	if c.Counts["A"] != nil || c.Totals["A"] != 0 {
+		t.Errorf("row A should be gone: %v", c.Counts["A"])
+	}
+	if !approxEqual(c.Counts["B"]["B"], 3) || !approxEqual(c.Totals["B"], 3) {
+		t.Errorf("B->B = %.2f (total %.2f), want 3: moves between the topics become self-transitions",
+			c.Counts["B"]["B"], c.Totals["B"])
+	}
+	if !approxEqual(c.Counts["C"]["B"], 1) || c.Counts["C"]["A"] != 0 {
+		t.Errorf("C row = %v, want C->B 1", c.Counts["C"])
+	}
+	if !approxEqual(c.Counts[HistoryKey("C", "B")]["B"], 1) {
+		t.Errorf("second-order row not renamed: %v", c.Counts)
+	}
+	if !slices.Equal(c.History, []string{"B", "B"}) || c.LastTopic != "B" || c.PrevTopic != "C" {
+		t.Errorf("History %v, LastTopic %q, PrevTopic %q: want A renamed to B", c.History, c.LastTopic, c.PrevTopic)
+	}
+}
+
+func TestChainCloneIsIndependent(t *testing.T) {
+	c := New()
+	c.Record("A", "B")
+
+	cp := c.Clone()
+	cp.Record("A", "B")
+	cp.Record("B", "C")
+	cp.Counts["A"]["B"] = 10
+
+	if c.Counts["A"]["B"] != 1 || c.Totals["A"] != 1 {
+		t.Errorf("original A→B changed: count %v, total %v", c.Counts["A"]["B"], c.Totals["A"])
+	}
+	if _, ok := c.Counts["B"]; ok {
+		t.Error("original gained a row recorded on the clone")
+	}
+}
@@ -0,0 +1,112 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is reported by AcquireLock when another process held the
+// lock for the whole timeout. Callers should warn and carry on unlocked
+// rather than block the user's prompt.
+var ErrLockTimeout = errors.New("lock timeout")
+
+// StaleLockAge is how old a lock file must be before AcquireLock assumes its
+// holder crashed and reclaims it. A hook invocation holds the lock for
+// milliseconds, so this is far beyond any live holder.
+const StaleLockAge = 30 * time.Second
+
+// lockPoll is how often AcquireLock retries a held lock.
+const lockPoll = 10 * time.Millisecond
+
+// Lock is an advisory lock held by creating a file exclusively. It only
+// serializes processes that take the same lock; the state files themselves
+// are not protected from other writers.
+type Lock struct {
+	path  string
+	token string
+}
+
+// AcquireLock creates the lock file at path, retrying until timeout while
+// another process holds it. A lock file older than StaleLockAge is removed
+// and taken over. If the lock is still held when the timeout expires,
+// AcquireLock returns ErrLockTimeout.
+func AcquireLock(path string, timeout time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	l := &Lock{
+		path:  path,
+		token: fmt.Sprintf("pid=%d t=%d\n", os.Getpid(), time.Now().UnixNano()),
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := l.create()
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if l.reclaimStale() {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// reclaimStale removes the lock file if it is older than StaleLockAge and
+// reports whether it did.
+func (l *Lock) reclaimStale() bool {
+	info, err := os.Stat(l.path)
+	if err != nil || time.Since(info.ModTime()) < StaleLockAge {
+		return false
+	}
+	if err := os.Remove(l.path); err != nil {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "focus-gate: reclaimed stale lock %s\n", l.path)
+	return true
+}
+
+// create makes the lock file, failing with os.ErrExist if it is held.
+func (l *Lock) create() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(l.token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(l.path)
+	}
+	return err
+}
+
+// Release removes the lock file if it still belongs to l. A lock that was
+// reclaimed by another process after going stale is left alone. Release on a
+// nil Lock is a no-op, so callers can defer it after a failed acquire.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if string(data) != l.token {
+		return nil
+	}
+	return Remove(l.path)
+}
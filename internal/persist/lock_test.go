@@ -0,0 +1,128 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockSerializesSaveSequences(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+	path := filepath.Join(dir, "state.json")
+
+	var (
+		mu  sync.Mutex
+		log []string
+		wg  sync.WaitGroup
+	)
+	sequence := func(who string) {
+		defer wg.Done()
+		l, err := AcquireLock(lockPath, 5*time.Second)
+		if err != nil {
+			t.Errorf("%s: AcquireLock: %v", who, err)
+			return
+		}
+		defer l.Release()
+		for i := 0; i < 5; i++ {
+			if err := SaveAtomic(path, testData{Name: who, Value: i}); err != nil {
+				t.Errorf("%s: SaveAtomic: %v", who, err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			var got testData
+			if err := Load(path, &got); err != nil || got.Name != who || got.Value != i {
+				t.Errorf("%s step %d read back %+v (err %v)", who, i, got, err)
+			}
+			mu.Lock()
+			log = append(log, who)
+			mu.Unlock()
+		}
+	}
+	wg.Add(2)
+	go sequence("a")
+	go sequence("b")
+	wg.Wait()
+
+	// Each sequence ran to completion before the other started.
+	switches := 0
+	for i := 1; i < len(log); i++ {
+		if log[i] != log[i-1] {
+			switches++
+		}
+	}
+	if len(log) != 10 || switches != 1 {
+		t.Errorf("save sequences interleaved: %v", log)
+	}
+	if Exists(lockPath) {
+		t.Error("lock file should be removed after both releases")
+	}
+}
+
+func TestLockTimesOutWhileHeld(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+	held, err := AcquireLock(lockPath, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	start := time.Now()
+	if _, err := AcquireLock(lockPath, 30*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("err = %v, want ErrLockTimeout", err)
+	}
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Errorf("gave up after %v, before the timeout", waited)
+	}
+}
+
+func TestLockReclaimsStaleLock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+	// A lock left behind by a process that crashed a while ago.
+	if err := os.WriteFile(lockPath, []byte("pid=1 t=0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * StaleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := AcquireLock(lockPath, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("stale lock not reclaimed: %v", err)
+	}
+	data, _ := os.ReadFile(lockPath)
+	if string(data) != l.token {
+		t.Errorf("lock file = %q, want our token %q", data, l.token)
+	}
+	if err := l.Release(); err != nil || Exists(lockPath) {
+		t.Errorf("Release: err %v, file still exists %v", err, Exists(lockPath))
+	}
+}
+
+func TestReleaseLeavesReclaimedLock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+	l, err := AcquireLock(lockPath, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another process reclaimed the lock after ours went stale.
+	other := fmt.Sprintf("pid=%d t=1\n", os.Getpid()+1)
+	if err := os.WriteFile(lockPath, []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if !Exists(lockPath) {
+		t.Error("Release removed a lock it no longer owns")
+	}
+	var nilLock *Lock
+	if err := nilLock.Release(); err != nil {
+		t.Errorf("nil Release: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Versioned is implemented by persisted types that carry a schemaVersion
+// field. Load migrates older payloads of these types up to CurrentSchema
+// before decoding them.
+type Versioned interface {
+	CurrentSchema() int
+}
+
+// Migration upgrades a decoded payload by one schema version, editing its
+// top-level fields in place. It does not need to touch "schemaVersion".
+type Migration func(doc map[string]json.RawMessage) error
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = map[string]map[int]Migration{}
+)
+
+// RegisterMigration registers m to upgrade payloads of the named type from
+// schema version from to from+1. typeName is the Go type name, e.g. "Forest".
+// Version steps without a registered migration only bump the version.
+func RegisterMigration(typeName string, from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if migrations[typeName] == nil {
+		migrations[typeName] = make(map[int]Migration)
+	}
+	migrations[typeName][from] = m
+}
+
+// migrate brings a JSON payload for v up to v's current schema version. A
+// payload without a schemaVersion field is version 0. Payloads from a newer
+// version are rejected rather than decoded with fields silently dropped.
+func migrate(v Versioned, data []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+		return data, nil // not an object; let the final decode report it
+	}
+
+	version := 0
+	if raw, ok := doc["schemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("schemaVersion: %w", err)
+		}
+	}
+	current := v.CurrentSchema()
+	name := typeName(v)
+	if version == current {
+		return data, nil
+	}
+	if version > current {
+		return nil, fmt.Errorf("%s schema version %d is newer than supported %d", name, version, current)
+	}
+
+	migrationsMu.RLock()
+	steps := migrations[name]
+	migrationsMu.RUnlock()
+	for ; version < current; version++ {
+		if m := steps[version]; m != nil {
+			if err := m(doc); err != nil {
+				return nil, fmt.Errorf("migrate %s from v%d: %w", name, version, err)
+			}
+		}
+	}
+	doc["schemaVersion"] = json.RawMessage(strconv.Itoa(current))
+	return json.Marshal(doc)
+}
+
+// typeName returns the name of the type v points to.
+func typeName(v any) string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,99 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/guide"
+)
+
+func TestLoadMigratesV0Forest(t *testing.T) {
+	// A fabricated v0 layout kept the prompt count at the top level as
+	// "prompts" instead of inside meta.
+	RegisterMigration("Forest", 0, func(doc map[string]json.RawMessage) error {
+		prompts, ok := doc["prompts"]
+		if !ok {
+			return nil
+		}
+		var meta map[string]json.RawMessage
+		if raw, ok := doc["meta"]; ok {
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				return err
+			}
+		}
+		if meta == nil {
+			meta = make(map[string]json.RawMessage)
+		}
+		meta["totalPrompts"] = prompts
+		raw, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		doc["meta"] = raw
+		delete(doc, "prompts")
+		return nil
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intent.json")
+	v0 := `{"trees":[{"id":"t1","rootId":"n1","nodes":{"n1":{"id":"n1","content":"auth","depth":0}}}],"prompts":7}`
+	if err := os.WriteFile(path, []byte(v0), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := forest.NewForest()
+	if err := Load(path, f); err != nil && !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("Load: %v", err)
+	}
+	if f.SchemaVersion != forest.SchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", f.SchemaVersion, forest.SchemaVersion)
+	}
+	if f.Meta.TotalPrompts != 7 {
+		t.Errorf("TotalPrompts = %d, want 7 after migration", f.Meta.TotalPrompts)
+	}
+	if len(f.Trees) != 1 || f.Trees[0].ID != "t1" {
+		t.Errorf("trees not preserved: %+v", f.Trees)
+	}
+}
+
+func TestLoadCurrentVersionSkipsMigration(t *testing.T) {
+	RegisterMigration("Guide", 0, func(doc map[string]json.RawMessage) error {
+		t.Error("migration should not run for a current-version payload")
+		return nil
+	})
+	defer RegisterMigration("Guide", 0, nil)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guide.json")
+	if err := SaveAtomic(path, guide.New(7)); err != nil {
+		t.Fatal(err)
+	}
+	g := guide.New(0)
+	if err := Load(path, g); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if g.MaxSize != 7 || g.SchemaVersion != guide.SchemaVersion {
+		t.Errorf("loaded guide = %+v", g)
+	}
+}
+
+func TestLoadRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intent.json")
+	data := []byte(`{"schemaVersion":99,"trees":[],"meta":{"totalPrompts":5}}`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := forest.NewForest()
+	if err := Load(path, f); err == nil || errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("Load err = %v, want newer-version error", err)
+	}
+	if f.Meta.TotalPrompts != 0 {
+		t.Error("a rejected payload should leave v unchanged")
+	}
+}
@@ -1,26 +1,96 @@
 package persist
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
+// GzipExt is the suffix that makes SaveAtomic compress its output.
+const GzipExt = ".gz"
+
+// gzipMagic is the two-byte header that starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// checksumPrefix starts the header line SaveAtomic writes before the payload:
+//
+//	#focus-gate v1 crc32=1a2b3c4d
+//
+// The version names the checksum format; v1 is CRC-32 (IEEE) over every byte
+// after the header line. The leading '#' can never begin JSON or gzip data,
+// so files without a header are recognised as written by older versions.
+const checksumPrefix = "#focus-gate "
+
+// checksumVersion is the header format SaveAtomic writes.
+const checksumVersion = "v1"
+
+// ErrCorrupt is reported by Load when a file's checksum does not match its
+// contents. Callers can back the file up instead of overwriting it.
+var ErrCorrupt = errors.New("checksum mismatch")
+
+// ErrNoChecksum is reported by Load when a file has no checksum header, e.g.
+// one saved by an older version or written by hand. The file was still
+// decoded into v, so callers can treat this as a warning.
+var ErrNoChecksum = errors.New("no checksum")
+
 // SaveAtomic writes v as indented JSON to a temporary file, then renames it
 // to the target path. On Unix, os.Rename is atomic (POSIX guarantee). On
 // Windows, Rename can fail if the target exists, so we remove it first. That
 // creates a brief window where neither file exists; RecoverTmpFiles handles
 // this on the next startup.
+//
+// Paths ending in GzipExt are written as gzip-compressed compact JSON; the
+// indentation is dropped since the file is not meant for humans. Either way
+// the payload is preceded by a checksum header that Load verifies.
 func SaveAtomic(path string, v any) error {
+	data, err := checksummed(path, v)
+	if err != nil {
+		return err
+	}
+	return WriteAtomic(path, data)
+}
+
+// WriteAtomic writes raw bytes to path with the same temp-file-then-rename
+// guarantee as SaveAtomic, but without a checksum header. Use it for files
+// people edit by hand, such as the config.
+func WriteAtomic(path string, data []byte) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	data, err := json.MarshalIndent(v, "", "  ")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	// On Windows, os.Rename fails when the target already exists.
+	if runtime.GOOS == "windows" {
+		_ = os.Remove(path)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// SaveAtomicWithBackup is SaveAtomic that first keeps up to n previous
+// versions of the file as path.1 (newest) through path.n (oldest). The new
+// data is written to the .tmp file before anything is rotated, so a failed
+// save leaves the backups untouched. The live file is copied to path.1 rather
+// than moved, so it stays in place until the final rename and the window that
+// RecoverTmpFiles covers is unchanged. n <= 0 behaves exactly like SaveAtomic.
+func SaveAtomicWithBackup(path string, v any, n int) error {
+	if n <= 0 || !Exists(path) {
+		return SaveAtomic(path, v)
+	}
+	data, err := checksummed(path, v)
 	if err != nil {
 		return err
 	}
@@ -29,15 +99,57 @@ func SaveAtomic(path string, v any) error {
 	if err := os.WriteFile(tmp, data, 0644); err != nil {
 		return err
 	}
+	if err := rotate(path, n); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
 
-	// On Windows, os.Rename fails when the target already exists.
 	if runtime.GOOS == "windows" {
 		_ = os.Remove(path)
 	}
-
 	return os.Rename(tmp, path)
 }
 
+// BackupPath returns the name of the i-th backup of path, e.g. intent.json.1.
+func BackupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// rotate shifts path.1..path.(n-1) up by one, dropping path.n, and copies the
+// live file to path.1.
+func rotate(path string, n int) error {
+	for i := n - 1; i >= 1; i-- {
+		from := BackupPath(path, i)
+		if !Exists(from) {
+			continue
+		}
+		to := BackupPath(path, i+1)
+		if runtime.GOOS == "windows" {
+			_ = os.Remove(to)
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("rotate %s: %w", from, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return WriteAtomic(BackupPath(path, 1), data)
+}
+
+// RestoreBackup promotes backup n of path to the live file. The backup is
+// copied, not moved, so restoring is repeatable and the other backups keep
+// their numbering.
+func RestoreBackup(path string, n int) error {
+	bak := BackupPath(path, n)
+	data, err := os.ReadFile(bak)
+	if err != nil {
+		return err
+	}
+	return WriteAtomic(path, data)
+}
+
 // RecoverTmpFiles restores data from stale .tmp files left by interrupted
 // SaveAtomic calls. For each path: if .tmp exists but the target is missing,
 // the .tmp is promoted; if both exist, the stale .tmp is removed. Should be
@@ -68,8 +180,48 @@ func RecoverTmpFiles(paths ...string) {
 	}
 }
 
+// checksummed encodes v for path and prepends the checksum header.
+func checksummed(path string, v any) ([]byte, error) {
+	data, err := encode(path, v)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("%s%s crc32=%08x\n", checksumPrefix, checksumVersion, crc32.ChecksumIEEE(data))
+	return append([]byte(header), data...), nil
+}
+
+// encode marshals v for the given path: indented JSON, or compact gzipped
+// JSON when the path ends in GzipExt.
+func encode(path string, v any) ([]byte, error) {
+	if !strings.HasSuffix(path, GzipExt) {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // Load reads a JSON file and unmarshals it into v.
 // If the file does not exist, v is left unchanged and no error is returned.
+// Gzip-compressed files are detected by their magic bytes rather than the
+// extension, so plain and compressed files load from either name.
+//
+// A checksum header is verified before decoding; on mismatch Load returns an
+// error matching ErrCorrupt and leaves v unchanged. A file without a header
+// is decoded as before and ErrNoChecksum is returned.
+//
+// If v implements Versioned, the payload is first migrated up to the current
+// schema version with the migrations registered for v's type.
 func Load(path string, v any) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -78,7 +230,68 @@ func Load(path string, v any) error {
 		}
 		return err
 	}
-	return json.Unmarshal(data, v)
+
+	checked := bytes.HasPrefix(data, []byte(checksumPrefix))
+	if checked {
+		if data, err = verify(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if bytes.HasPrefix(data, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+	if vv, ok := v.(Versioned); ok {
+		if data, err = migrate(vv, data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if !checked {
+		return ErrNoChecksum
+	}
+	return nil
+}
+
+// verify checks a checksum header and returns the payload after it.
+func verify(data []byte) ([]byte, error) {
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+	header := string(data[len(checksumPrefix):nl])
+	payload := data[nl+1:]
+
+	var version string
+	var sum uint32
+	if _, err := fmt.Sscanf(header, "%s crc32=%x", &version, &sum); err != nil {
+		return nil, fmt.Errorf("%w: bad header %q", ErrCorrupt, header)
+	}
+	if version != checksumVersion {
+		return nil, fmt.Errorf("unsupported checksum version %q", version)
+	}
+	if got := crc32.ChecksumIEEE(payload); got != sum {
+		return nil, fmt.Errorf("%w: crc32 %08x, header says %08x", ErrCorrupt, got, sum)
+	}
+	return payload, nil
+}
+
+// BackupCorrupt moves a file that failed verification aside to path +
+// ".corrupt", so the next save does not destroy it. Returns the backup path.
+func BackupCorrupt(path string) (string, error) {
+	bak := path + ".corrupt"
+	if runtime.GOOS == "windows" {
+		_ = os.Remove(bak)
+	}
+	return bak, os.Rename(path, bak)
 }
 
 // Remove deletes a file. No error if the file doesn't exist.
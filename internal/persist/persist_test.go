@@ -1,9 +1,15 @@
 package persist
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
 )
 
 type testData struct {
@@ -105,3 +111,233 @@ func TestRemove(t *testing.T) {
 		t.Errorf("Remove of nonexistent file should not error: %v", err)
 	}
 }
+
+func TestCompressedRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "intent.json")
+	gz := filepath.Join(dir, "intent.json.gz")
+
+	f := forest.NewForest()
+	for i := 0; i < 200; i++ {
+		tree := forest.NewTree(fmt.Sprintf("topic %d about authentication and databases", i), "")
+		for j := 0; j < 5; j++ {
+			tree.AddChild(tree.RootID, fmt.Sprintf("prompt %d-%d fixing the migration schema", i, j), "")
+		}
+		f.AddTree(tree)
+	}
+
+	if err := SaveAtomic(plain, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAtomic(gz, f); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(gz)
+	if payload := raw[bytes.IndexByte(raw, '\n')+1:]; !bytes.HasPrefix(payload, gzipMagic) {
+		t.Fatal(".gz file should be gzip-compressed")
+	}
+	plainInfo, _ := os.Stat(plain)
+	if int64(len(raw)) >= plainInfo.Size() {
+		t.Errorf("compressed size %d should be below plain size %d", len(raw), plainInfo.Size())
+	}
+
+	loaded := forest.NewForest()
+	if err := Load(gz, loaded); err != nil {
+		t.Fatalf("Load compressed: %v", err)
+	}
+	if loaded.NodeCount() != f.NodeCount() || len(loaded.Trees) != len(f.Trees) {
+		t.Errorf("loaded %d trees/%d nodes, want %d/%d",
+			len(loaded.Trees), loaded.NodeCount(), len(f.Trees), f.NodeCount())
+	}
+	want, _ := json.Marshal(f)
+	got, _ := json.Marshal(loaded)
+	if !bytes.Equal(want, got) {
+		t.Error("compressed round trip changed the forest")
+	}
+}
+
+func TestLoadDetectsGzipByContent(t *testing.T) {
+	dir := t.TempDir()
+	gz := filepath.Join(dir, "test.json.gz")
+	if err := SaveAtomic(gz, testData{Name: "zipped", Value: 7}); err != nil {
+		t.Fatal(err)
+	}
+	// A compressed file under a plain name still loads.
+	renamed := filepath.Join(dir, "test.json")
+	if err := os.Rename(gz, renamed); err != nil {
+		t.Fatal(err)
+	}
+	var loaded testData
+	if err := Load(renamed, &loaded); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Name != "zipped" || loaded.Value != 7 {
+		t.Errorf("loaded = %+v", loaded)
+	}
+}
+
+func TestRecoverTmpFilesPromotesGzTmp(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "engine.json.gz")
+
+	// Simulate an interrupted save: only the .gz.tmp exists.
+	if err := SaveAtomic(path, testData{Name: "pending", Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, path+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	RecoverTmpFiles(path)
+
+	if Exists(path + ".tmp") {
+		t.Error(".gz.tmp should have been promoted")
+	}
+	var loaded testData
+	if err := Load(path, &loaded); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Name != "pending" {
+		t.Errorf("loaded = %+v, want promoted data", loaded)
+	}
+}
+
+func TestLoadDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"test.json", "test.json.gz"} {
+		path := filepath.Join(dir, name)
+		if err := SaveAtomic(path, testData{Name: "intact", Value: 42}); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(path)
+		data[len(data)-5] ^= 0x01 // flip one payload bit
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := testData{Name: "untouched"}
+		err := Load(path, &loaded)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: Load err = %v, want ErrCorrupt", name, err)
+		}
+		if loaded.Name != "untouched" {
+			t.Errorf("%s: corrupt file should not be decoded, got %+v", name, loaded)
+		}
+
+		bak, err := BackupCorrupt(path)
+		if err != nil || Exists(path) || !Exists(bak) {
+			t.Errorf("%s: BackupCorrupt = %s, %v", name, bak, err)
+		}
+	}
+}
+
+func TestLoadLegacyFileWithoutChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "legacy.json")
+	os.WriteFile(path, []byte(`{"name":"old","value":1}`), 0644)
+
+	var loaded testData
+	err := Load(path, &loaded)
+	if !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("Load err = %v, want ErrNoChecksum", err)
+	}
+	if loaded.Name != "old" || loaded.Value != 1 {
+		t.Errorf("legacy file should still decode, got %+v", loaded)
+	}
+
+	// Saving adds the checksum, after which Load is clean.
+	if err := SaveAtomic(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path, &loaded); err != nil {
+		t.Errorf("Load after save: %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownChecksumVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "future.json")
+	os.WriteFile(path, []byte("#focus-gate v9 crc32=00000000\n{}"), 0644)
+
+	var loaded testData
+	if err := Load(path, &loaded); err == nil || errors.Is(err, ErrCorrupt) {
+		t.Errorf("Load err = %v, want unsupported version error", err)
+	}
+}
+
+func TestSaveAtomicWithBackupRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intent.json")
+
+	for i := 1; i <= 3; i++ {
+		if err := SaveAtomicWithBackup(path, testData{Name: "v", Value: i}, 2); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+
+	// Live file holds the latest save; .1 and .2 hold the two before it.
+	for i, want := range []int{3, 2, 1} {
+		p := path
+		if i > 0 {
+			p = BackupPath(path, i)
+		}
+		var loaded testData
+		if err := Load(p, &loaded); err != nil {
+			t.Fatalf("load %s: %v", p, err)
+		}
+		if loaded.Value != want {
+			t.Errorf("%s value = %d, want %d", filepath.Base(p), loaded.Value, want)
+		}
+	}
+	if Exists(BackupPath(path, 3)) {
+		t.Error("backups beyond the count should not be kept")
+	}
+	if Exists(path + ".tmp") {
+		t.Error(".tmp file should not exist after successful save")
+	}
+}
+
+func TestSaveAtomicWithBackupZeroKeepsNone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intent.json")
+	SaveAtomicWithBackup(path, testData{Value: 1}, 0)
+	SaveAtomicWithBackup(path, testData{Value: 2}, 0)
+	if Exists(BackupPath(path, 1)) {
+		t.Error("backup count 0 should not create backups")
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "intent.json")
+	for i := 1; i <= 3; i++ {
+		if err := SaveAtomicWithBackup(path, testData{Value: i}, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RestoreBackup(path, 1); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	var loaded testData
+	if err := Load(path, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Value != 2 {
+		t.Errorf("restored value = %d, want 2", loaded.Value)
+	}
+
+	// Restoring works after the live file is gone, as after --reset.
+	Remove(path)
+	if err := RestoreBackup(path, 2); err != nil {
+		t.Fatalf("RestoreBackup after remove: %v", err)
+	}
+	if err := Load(path, &loaded); err != nil || loaded.Value != 1 {
+		t.Errorf("restored = %+v (%v), want value 1", loaded, err)
+	}
+
+	if err := RestoreBackup(path, 5); err == nil {
+		t.Error("restoring a missing backup should fail")
+	}
+}
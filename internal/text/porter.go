@@ -0,0 +1,265 @@
+package text
+
+// StemPorter applies the Porter (1980) stemming algorithm: five steps of
+// suffix rules, each conditioned on the measure of the remaining stem, so
+// "running" → "run" and "relational" → "relat". It conflates more word forms
+// than Stem at the cost of less readable stems ("containers" → "contain").
+// Words of two letters or fewer, and words with non-ASCII bytes, are
+// returned unchanged.
+func StemPorter(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return word
+		}
+	}
+	p := &porter{b: []byte(word), k: len(word) - 1}
+	p.step1ab()
+	if p.k > 0 {
+		p.step1c()
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+	}
+	return string(p.b[:p.k+1])
+}
+
+// porter holds a word being stemmed: b[:k+1] is the current word and, after
+// a successful ends, b[:j+1] is the stem before the matched suffix.
+type porter struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant. 'y' is a consonant at the start
+// of a word or after a vowel.
+func (p *porter) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// m counts the vowel-consonant sequences in b[:j+1]: writing the stem as
+// [C](VC)^m[V], it returns m.
+func (p *porter) m() int {
+	n, i := 0, 0
+	for ; i <= p.j && p.cons(i); i++ {
+	}
+	for i <= p.j {
+		for ; i <= p.j && !p.cons(i); i++ {
+		}
+		if i > p.j {
+			break
+		}
+		n++
+		for ; i <= p.j && p.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem reports whether b[:j+1] contains a vowel.
+func (p *porter) vowelInStem() bool {
+	for i := 0; i <= p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleC reports whether b[i-1:i+1] is a double consonant.
+func (p *porter) doubleC(i int) bool {
+	return i >= 1 && p.b[i] == p.b[i-1] && p.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant with the last
+// consonant not w, x or y, as in "hop" but not "snow". It restores an "e"
+// on short words: "hoping" → "hope".
+func (p *porter) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	switch p.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with s, setting j to the end of the stem
+// before it when it does.
+func (p *porter) ends(s string) bool {
+	n := len(s)
+	if n > p.k+1 || string(p.b[p.k-n+1:p.k+1]) != s {
+		return false
+	}
+	p.j = p.k - n
+	return true
+}
+
+// setTo replaces the suffix after b[:j+1] with s.
+func (p *porter) setTo(s string) {
+	p.b = append(p.b[:p.j+1], s...)
+	p.k = p.j + len(s)
+}
+
+// r replaces the matched suffix with s when the stem has a measure above 0.
+func (p *porter) r(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing: "caresses" → "caress",
+// "ponies" → "poni", "meetings" → "meet", "hopping" → "hop".
+func (p *porter) step1ab() {
+	if p.b[p.k] == 's' {
+		switch {
+		case p.ends("sses"):
+			p.k -= 2
+		case p.ends("ies"):
+			p.setTo("i")
+		case p.b[p.k-1] != 's':
+			p.k--
+		}
+	}
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.k--
+		}
+		return
+	}
+	if !(p.ends("ed") || p.ends("ing")) || !p.vowelInStem() {
+		return
+	}
+	p.k = p.j
+	switch {
+	case p.ends("at"):
+		p.setTo("ate")
+	case p.ends("bl"):
+		p.setTo("ble")
+	case p.ends("iz"):
+		p.setTo("ize")
+	case p.doubleC(p.k):
+		switch p.b[p.k] {
+		case 'l', 's', 'z':
+		default:
+			p.k--
+		}
+	default:
+		p.j = p.k
+		if p.m() == 1 && p.cvc(p.k) {
+			p.setTo("e")
+		}
+	}
+}
+
+// step1c turns a final y into i when there is another vowel in the stem.
+func (p *porter) step1c() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+// step2Rules maps the penultimate letter to the double suffixes step2
+// reduces, in the order they are tried.
+var step2Rules = map[byte][][2]string{
+	'a': {{"ational", "ate"}, {"tional", "tion"}},
+	'c': {{"enci", "ence"}, {"anci", "ance"}},
+	'e': {{"izer", "ize"}},
+	'l': {{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}},
+	'o': {{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}},
+	's': {{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}},
+	't': {{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}},
+	'g': {{"logi", "log"}},
+}
+
+// step2 maps double suffixes to single ones: "relational" → "relate",
+// "optimization" → "optimize".
+func (p *porter) step2() {
+	for _, rule := range step2Rules[p.b[p.k-1]] {
+		if p.ends(rule[0]) {
+			p.r(rule[1])
+			return
+		}
+	}
+}
+
+// step3Rules maps the last letter to the suffixes step3 reduces.
+var step3Rules = map[byte][][2]string{
+	'e': {{"icate", "ic"}, {"ative", ""}, {"alize", "al"}},
+	'i': {{"iciti", "ic"}},
+	'l': {{"ical", "ic"}, {"ful", ""}},
+	's': {{"ness", ""}},
+}
+
+// step3 handles -ic-, -full, -ness and similar: "electrical" → "electric",
+// "hopefulness" → "hope".
+func (p *porter) step3() {
+	for _, rule := range step3Rules[p.b[p.k]] {
+		if p.ends(rule[0]) {
+			p.r(rule[1])
+			return
+		}
+	}
+}
+
+// step4Suffixes maps the penultimate letter to the suffixes step4 removes.
+var step4Suffixes = map[byte][]string{
+	'a': {"al"},
+	'c': {"ance", "ence"},
+	'e': {"er"},
+	'i': {"ic"},
+	'l': {"able", "ible"},
+	'n': {"ant", "ement", "ment", "ent"},
+	'o': {"ion", "ou"},
+	's': {"ism"},
+	't': {"ate", "iti"},
+	'u': {"ous"},
+	'v': {"ive"},
+	'z': {"ize"},
+}
+
+// step4 removes a final suffix from stems with a measure above 1:
+// "adjustment" → "adjust", "adoption" → "adopt".
+func (p *porter) step4() {
+	if p.k < 1 {
+		return
+	}
+	for _, suf := range step4Suffixes[p.b[p.k-1]] {
+		if !p.ends(suf) {
+			continue
+		}
+		// -ion is only removed after s or t.
+		if suf == "ion" && (p.j < 0 || (p.b[p.j] != 's' && p.b[p.j] != 't')) {
+			continue
+		}
+		if p.m() > 1 {
+			p.k = p.j
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and reduces a final -ll on long stems:
+// "probate" → "probat", "controll" → "control".
+func (p *porter) step5() {
+	p.j = p.k
+	if p.b[p.k] == 'e' {
+		a := p.m()
+		if a > 1 || (a == 1 && !p.cvc(p.k-1)) {
+			p.k--
+		}
+	}
+	if p.b[p.k] == 'l' && p.doubleC(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
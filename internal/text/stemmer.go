@@ -12,6 +12,18 @@ var derivational = []string{
 	"ful", "ous", "ive", "ing", "ed", "ly",
 }
 
+// protectedEr lists words ending in "er" where the suffix is part of the root.
+// StemAggressive checks this list before stripping "er".
+var protectedEr = map[string]bool{
+	"server": true, "container": true, "computer": true, "docker": true,
+	"water": true, "user": true, "order": true, "number": true, "buffer": true,
+	"header": true, "footer": true, "folder": true, "filter": true,
+	"cluster": true, "layer": true, "member": true, "parameter": true,
+	"register": true, "trigger": true, "paper": true, "power": true,
+	"browser": true, "letter": true, "master": true, "under": true,
+	"over": true, "other": true, "never": true, "ever": true, "after": true,
+}
+
 // Stem applies a lightweight two-pass suffix stemmer.
 //
 // Pass 1 strips plurals (s/es/ies).
@@ -19,6 +31,18 @@ var derivational = []string{
 //
 // This produces consistent stems: "containerization" and "containers" both → "container".
 func Stem(word string) string {
+	return stem(word, false)
+}
+
+// StemAggressive is Stem with "er" added as the last derivational suffix, so
+// "loaders" → "load" and "faster" → "fast". Words in the protected allowlist
+// ("servers" → "server") are checked after plural removal and before any
+// derivational stripping. The usual minimum remaining length still applies.
+func StemAggressive(word string) string {
+	return stem(word, true)
+}
+
+func stem(word string, aggressive bool) string {
 	if len(word) < 4 {
 		return word
 	}
@@ -32,11 +56,18 @@ func Stem(word string) string {
 		word = word[:len(word)-1]
 	}
 
+	if aggressive && protectedEr[word] {
+		return word
+	}
+
 	// Pass 2: remove one derivational suffix (longest match, single pass)
 	for _, suf := range derivational {
 		if len(word) > len(suf)+2 && strings.HasSuffix(word, suf) {
 			return word[:len(word)-len(suf)]
 		}
 	}
+	if aggressive && len(word) > 4 && strings.HasSuffix(word, "er") {
+		return word[:len(word)-2]
+	}
 	return word
 }
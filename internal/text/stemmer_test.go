@@ -66,3 +66,69 @@ func TestStem(t *testing.T) {
 		}
 	}
 }
+
+func TestStemAggressive(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"loaders", "load"},
+		{"loader", "load"},
+		{"faster", "fast"},
+		{"servers", "server"},
+		{"containers", "container"},
+		{"dockers", "docker"},
+		{"water", "water"},
+		{"user", "user"},    // too short to strip
+		{"running", "runn"}, // non-er suffixes unchanged
+		{"parser", "pars"},  // not protected
+		{"containerization", "container"},
+	}
+
+	for _, tt := range tests {
+		got := StemAggressive(tt.input)
+		if got != tt.want {
+			t.Errorf("StemAggressive(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Default stemmer still keeps "er".
+	if got := Stem("loaders"); got != "loader" {
+		t.Errorf("Stem(loaders) = %q, want loader", got)
+	}
+}
+
+func TestStemPorter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"go", "go"},
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"agreed", "agre"},
+		{"hopping", "hop"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"relational", "relat"},
+		{"generalizations", "gener"},
+		{"hopeful", "hope"},
+		{"adjustment", "adjust"},
+		{"adoption", "adopt"},
+		{"controlling", "control"},
+		{"running", "run"},
+		{"optimization", "optim"},
+		{"containers", "contain"},
+		{"café", "café"}, // non-ASCII words are left alone
+	}
+	for _, tt := range tests {
+		if got := StemPorter(tt.input); got != tt.want {
+			t.Errorf("StemPorter(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Porter merges forms the light stemmer keeps apart.
+	if Stem("running") == Stem("run") || StemPorter("running") != StemPorter("run") {
+		t.Errorf("running: Stem = %q, StemPorter = %q", Stem("running"), StemPorter("running"))
+	}
+}
@@ -1,7 +1,14 @@
 package text
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"unicode"
 )
@@ -40,39 +47,452 @@ var stopWords = map[string]bool{
 // tagPattern matches XML-style tags from IDE context injection.
 var tagPattern = regexp.MustCompile(`<[a-z_-]+>[\s\S]*?</[a-z_-]+>`)
 
+// Options configures a Tokenizer. The zero value reproduces the default
+// behaviour of the package-level Tokenize.
+type Options struct {
+	// StopWords lists extra words to filter. Each word is matched both as
+	// written (lowercased) and in its stemmed form, since filtering happens
+	// after stemming. The Porter stemmer also checks tokens before stemming.
+	StopWords []string `json:"stopWords,omitempty"`
+
+	// TermBlacklist lists project-specific noise, such as a ticket prefix or
+	// a bot's name, to drop from every token list so it never reaches the
+	// corpus. It is matched like StopWords, as written and stemmed, but is
+	// kept apart from them: stop words are grammar, the blacklist is the
+	// user's own vocabulary.
+	TermBlacklist []string `json:"termBlacklist,omitempty"`
+
+	// ReplaceStopWords discards the built-in list and filters only StopWords.
+	// It only takes effect when StopWords is non-nil, so an explicit empty
+	// list disables stop-word filtering while an absent list keeps defaults.
+	ReplaceStopWords bool `json:"replaceStopWords,omitempty"`
+
+	// SplitIdentifiers decomposes camelCase, PascalCase, snake_case and
+	// kebab-case identifiers into their component words before stemming, so
+	// "getUserProfile" matches prose about "user profile".
+	SplitIdentifiers bool `json:"splitIdentifiers,omitempty"`
+
+	// Bigrams appends adjacent token pairs after the unigrams, so phrase
+	// overlap ("access token") scores higher than shared words in any order.
+	Bigrams bool `json:"bigrams,omitempty"`
+
+	// AggressiveStemming uses StemAggressive, which also strips "er" outside
+	// a protected allowlist. Trades precision for recall. It only applies to
+	// the light stemmer.
+	AggressiveStemming bool `json:"aggressiveStemming,omitempty"`
+
+	// Stemmer selects the stemming algorithm: StemmerLight (Stem, the
+	// default when empty) or StemmerPorter (StemPorter). An unknown name is
+	// logged and the light stemmer is used.
+	Stemmer string `json:"stemmer,omitempty"`
+
+	// StripCode makes CleanPrompt remove fenced code blocks and inline code
+	// spans, so pasted snippets don't dominate the prompt's vector.
+	StripCode bool `json:"stripCode,omitempty"`
+
+	// TagPatterns replaces the default IDE tag regex used by CleanPrompt.
+	// Patterns are applied in order. Invalid patterns are logged and skipped;
+	// if none compile, the default pattern is used.
+	TagPatterns []string `json:"tagPatterns,omitempty"`
+
+	// DropPureNumbers filters tokens made only of digits ("42", "2024"),
+	// which are usually pasted line numbers or dates. Mixed tokens such as
+	// "v2" and "base64" are kept.
+	DropPureNumbers bool `json:"dropPureNumbers,omitempty"`
+
+	// Synonyms maps a primary word to aliases that should be read as it,
+	// e.g. {"kubernetes": ["k8s", "kube"]}. Keys and aliases are stemmed,
+	// and each alias token is replaced by the stemmed primary, so all forms
+	// share one corpus term. Only single words are matched.
+	Synonyms map[string][]string `json:"synonyms,omitempty"`
+
+	// MinTokenLen is the shortest token, in bytes after stemming, that is
+	// kept. 0 keeps the default of 2, dropping single characters; values
+	// below 0 are treated as 1.
+	MinTokenLen int `json:"minTokenLen,omitempty"`
+}
+
+// Stemmer names for Options.Stemmer.
+const (
+	StemmerLight  = "light"
+	StemmerPorter = "porter"
+)
+
+// DefaultMinTokenLen is the minimum token length used when
+// Options.MinTokenLen is 0.
+const DefaultMinTokenLen = 2
+
+// Tokenizer converts raw text into stemmed, filtered tokens using a fixed
+// stop-word set. Build one with NewTokenizer and reuse it — the same tokenizer
+// must be used for corpus documents and query vectors so DF stays consistent.
+type Tokenizer struct {
+	stopWords        map[string]bool
+	blacklist        map[string]bool
+	splitIdentifiers bool
+	bigrams          bool
+	stem             func(string) string
+	stemmer          string
+	stopBeforeStem   bool // also match stop words before stemming (Porter)
+	stripCode        bool
+	tagPatterns      []*regexp.Regexp
+	dropPureNumbers  bool
+	synonyms         map[string]string // stemmed alias → stemmed primary
+	minLen           int
+	fingerprint      string
+}
+
+// defaultTokenizer backs the package-level Tokenize.
+var defaultTokenizer = NewTokenizer(Options{})
+
+// NewTokenizer creates a Tokenizer from the given options.
+func NewTokenizer(opts Options) *Tokenizer {
+	stem, stemmer := Stem, StemmerLight
+	switch opts.Stemmer {
+	case "", StemmerLight:
+		if opts.AggressiveStemming {
+			stem = StemAggressive
+		}
+	case StemmerPorter:
+		stem, stemmer = StemPorter, StemmerPorter
+	default:
+		fmt.Fprintf(os.Stderr, "focus-gate: unknown stemmer %q, using %s\n", opts.Stemmer, StemmerLight)
+	}
+
+	sw := make(map[string]bool, len(stopWords)+2*len(opts.StopWords))
+	if !opts.ReplaceStopWords || opts.StopWords == nil {
+		for w := range stopWords {
+			sw[w] = true
+		}
+	}
+	for _, w := range opts.StopWords {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" {
+			continue
+		}
+		sw[w] = true
+		sw[stem(w)] = true
+	}
+	var blacklist map[string]bool
+	for _, w := range opts.TermBlacklist {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" {
+			continue
+		}
+		if blacklist == nil {
+			blacklist = make(map[string]bool, 2*len(opts.TermBlacklist))
+		}
+		blacklist[w] = true
+		blacklist[stem(w)] = true
+	}
+	var syn map[string]string
+	for primary, aliases := range opts.Synonyms {
+		primary = stem(strings.ToLower(strings.TrimSpace(primary)))
+		if primary == "" {
+			continue
+		}
+		for _, a := range aliases {
+			a = stem(strings.ToLower(strings.TrimSpace(a)))
+			if a == "" || a == primary {
+				continue
+			}
+			if syn == nil {
+				syn = make(map[string]string)
+			}
+			syn[a] = primary
+		}
+	}
+	var tags []*regexp.Regexp
+	for _, p := range opts.TagPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "focus-gate: skip tag pattern %q: %v\n", p, err)
+			continue
+		}
+		tags = append(tags, re)
+	}
+	if len(tags) == 0 {
+		tags = []*regexp.Regexp{tagPattern}
+	}
+	minLen := opts.MinTokenLen
+	if minLen == 0 {
+		minLen = DefaultMinTokenLen
+	}
+
+	stemming := stemmer
+	if stemmer == StemmerLight && opts.AggressiveStemming {
+		stemming += "+aggressive"
+	}
+	stopBeforeStem := stemmer == StemmerPorter
+	fingerprint := termsFingerprint(stemming, stopBeforeStem, sw, blacklist, syn, opts, max(minLen, 1))
+
+	return &Tokenizer{
+		stopWords:        sw,
+		blacklist:        blacklist,
+		splitIdentifiers: opts.SplitIdentifiers,
+		bigrams:          opts.Bigrams,
+		stem:             stem,
+		stemmer:          stemmer,
+		stopBeforeStem:   stopBeforeStem,
+		stripCode:        opts.StripCode,
+		tagPatterns:      tags,
+		dropPureNumbers:  opts.DropPureNumbers,
+		synonyms:         syn,
+		minLen:           max(minLen, 1),
+		fingerprint:      fingerprint,
+	}
+}
+
+// termsFingerprint hashes everything that decides which terms Tokenize
+// emits for a text. Tag patterns and StripCode only affect CleanPrompt,
+// which runs before content is stored, so they are left out.
+func termsFingerprint(stemming string, stopBeforeStem bool, stop, blacklist map[string]bool, syn map[string]string, opts Options, minLen int) string {
+	data, _ := json.Marshal(struct {
+		Stemming         string            `json:"stemming"`
+		StopBeforeStem   bool              `json:"stopBeforeStem"`
+		StopWords        []string          `json:"stopWords"`
+		Blacklist        []string          `json:"blacklist"`
+		Synonyms         map[string]string `json:"synonyms"`
+		SplitIdentifiers bool              `json:"splitIdentifiers"`
+		Bigrams          bool              `json:"bigrams"`
+		DropPureNumbers  bool              `json:"dropPureNumbers"`
+		MinLen           int               `json:"minLen"`
+	}{
+		stemming,
+		stopBeforeStem,
+		slices.Sorted(maps.Keys(stop)),
+		slices.Sorted(maps.Keys(blacklist)),
+		syn,
+		opts.SplitIdentifiers,
+		opts.Bigrams,
+		opts.DropPureNumbers,
+		minLen,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Stemmer returns the name of the stemming algorithm the tokenizer uses,
+// StemmerLight or StemmerPorter.
+func (tk *Tokenizer) Stemmer() string {
+	return tk.stemmer
+}
+
+// Fingerprint identifies the options that shape the tokenizer's output
+// terms: stemmer, stop words, blacklist, synonyms, identifier splitting,
+// bigrams, number dropping and minimum length. Two tokenizers with the same
+// fingerprint turn the same text into the same tokens, so a corpus built by
+// one can be queried with the other.
+func (tk *Tokenizer) Fingerprint() string {
+	return tk.fingerprint
+}
+
+// Tokenize converts raw text into stemmed, filtered tokens using the default
+// stop-word list.
+func Tokenize(text string) []string {
+	return defaultTokenizer.Tokenize(text)
+}
+
 // Tokenize converts raw text into stemmed, filtered tokens.
 // It lowercases, strips non-alphanumeric characters, stems each token,
-// and removes stop words and single-character tokens.
-func Tokenize(text string) []string {
+// and removes stop words, blacklisted terms and tokens shorter than the
+// minimum length (by default, single characters).
+func (tk *Tokenizer) Tokenize(text string) []string {
 	if text == "" {
 		return nil
 	}
 
-	lower := strings.ToLower(text)
+	var raw []string
+	if tk.splitIdentifiers {
+		// Split on every non-alphanumeric rune (including hyphens and
+		// underscores), then on case boundaries. Case must be inspected
+		// before lowercasing.
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, f := range fields {
+			for _, part := range splitCamel(f) {
+				raw = append(raw, strings.ToLower(part))
+			}
+		}
+	} else {
+		lower := strings.ToLower(text)
 
-	// Split on boundaries, keeping hyphens and underscores within tokens.
-	// This prevents compound-word fragments from false-stemming
-	// (e.g. "session-expiry" stays whole instead of "session" → "ses" via -sion).
-	raw := strings.FieldsFunc(lower, func(r rune) bool {
-		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
-	})
+		// Split on boundaries, keeping hyphens and underscores within tokens.
+		// This prevents compound-word fragments from false-stemming
+		// (e.g. "session-expiry" stays whole instead of "session" → "ses" via -sion).
+		raw = strings.FieldsFunc(lower, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+		})
+	}
 
 	var tokens []string
 	for _, t := range raw {
-		t = Stem(t)
-		if len(t) > 1 && !stopWords[t] {
+		// Porter turns "was", "has" and "his" into forms the list does not
+		// contain, so with it stop words are matched before stemming too.
+		// The light stemmer keeps its original output.
+		if tk.stopBeforeStem && tk.stopWords[t] {
+			continue
+		}
+		t = tk.stem(t)
+		if primary, ok := tk.synonyms[t]; ok {
+			t = primary
+		}
+		if tk.dropPureNumbers && isDigits(t) {
+			continue
+		}
+		if len(t) >= tk.minLen && !tk.stopWords[t] && !tk.blacklist[t] {
 			tokens = append(tokens, t)
 		}
 	}
 	if len(tokens) == 0 {
 		return nil
 	}
+	if tk.bigrams {
+		tokens = append(tokens, Bigrams(tokens)...)
+	}
 	return tokens
 }
 
+// isDigits reports whether s is non-empty and consists only of digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// BigramSep joins the two words of a bigram token. A space can never occur
+// inside a unigram, so bigrams are unambiguous even alongside snake_case tokens.
+const BigramSep = " "
+
+// Bigrams returns the adjacent pairs of tokens, e.g. ["jwt", "token", "expiry"]
+// → ["jwt token", "token expiry"]. Fewer than two tokens yield nil.
+func Bigrams(tokens []string) []string {
+	if len(tokens) < 2 {
+		return nil
+	}
+	pairs := make([]string, 0, len(tokens)-1)
+	for i := 1; i < len(tokens); i++ {
+		pairs = append(pairs, tokens[i-1]+BigramSep+tokens[i])
+	}
+	return pairs
+}
+
+// IsBigram reports whether a token was produced by Bigrams.
+func IsBigram(token string) bool {
+	return strings.Contains(token, BigramSep)
+}
+
+// splitCamel splits an identifier on case boundaries:
+//
+//	"UserProfile"  → ["User", "Profile"]
+//	"HTTPServer"   → ["HTTP", "Server"]   (acronym followed by a word)
+//	"base64Encode" → ["base64", "Encode"] (digit followed by upper case)
+//
+// A letter followed by a digit is not a boundary, so "base64" and "v2" stay whole.
+func splitCamel(word string) []string {
+	r := []rune(word)
+	var parts []string
+	start := 0
+	for i := 1; i < len(r); i++ {
+		prev, cur := r[i-1], r[i]
+		boundary := false
+		if unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			boundary = true
+		} else if unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			boundary = true
+		}
+		if boundary {
+			parts = append(parts, string(r[start:i]))
+			start = i
+		}
+	}
+	return append(parts, string(r[start:]))
+}
+
 // CleanPrompt strips IDE and system tags from raw prompt text.
 func CleanPrompt(raw string) string {
-	return strings.TrimSpace(tagPattern.ReplaceAllString(raw, ""))
+	return defaultTokenizer.CleanPrompt(raw)
+}
+
+// CleanPrompt strips IDE and system tags from raw prompt text, and code
+// blocks when StripCode is set.
+func (tk *Tokenizer) CleanPrompt(raw string) string {
+	cleaned := raw
+	for _, re := range tk.tagPatterns {
+		cleaned = re.ReplaceAllString(cleaned, "")
+	}
+	if tk.stripCode {
+		cleaned = StripCode(cleaned)
+	}
+	return strings.TrimSpace(cleaned)
+}
+
+// StripCode replaces fenced code blocks (three or more backticks) and inline
+// code spans with a single space. A fence closes on a backtick run at least as
+// long as the opener, so shorter runs inside it are treated as content; an
+// unclosed fence strips to the end of the string. An unmatched inline backtick
+// run is kept as literal text.
+func StripCode(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	i := 0
+	for i < len(s) {
+		if s[i] != '`' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		n := backtickRun(s, i)
+		end := -1
+		for j := i + n; j < len(s); {
+			if s[j] != '`' {
+				j++
+				continue
+			}
+			m := backtickRun(s, j)
+			if (n >= 3 && m >= n) || m == n {
+				end = j + m
+				break
+			}
+			j += m
+		}
+		switch {
+		case end >= 0:
+			b.WriteByte(' ')
+			i = end
+		case n >= 3:
+			b.WriteByte(' ')
+			i = len(s)
+		default:
+			b.WriteString(s[i : i+n])
+			i += n
+		}
+	}
+	return b.String()
+}
+
+// backtickRun returns the number of consecutive backticks starting at i.
+func backtickRun(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// TermCounts counts raw occurrences of each token.
+func TermCounts(tokens []string) map[string]int {
+	counts := make(map[string]int, len(tokens))
+	for _, t := range tokens {
+		counts[t]++
+	}
+	return counts
 }
 
 // TermFrequency computes normalized term frequencies for a token list.
@@ -122,3 +122,318 @@ func TestTermFrequencyEmpty(t *testing.T) {
 		t.Errorf("TermFrequency(nil) should be empty, got %v", tf)
 	}
 }
+
+func TestTokenizerExtraStopWords(t *testing.T) {
+	tk := NewTokenizer(Options{StopWords: []string{"please", "Actually"}})
+
+	got := tk.Tokenize("please actually fix the login bug")
+	want := []string{"fix", "login", "bug"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize with extra stop words\n  got  %v\n  want %v", got, want)
+	}
+
+	// Default tokenizer is unaffected.
+	got = Tokenize("please fix the login bug")
+	want = []string{"please", "fix", "login", "bug"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("default Tokenize\n  got  %v\n  want %v", got, want)
+	}
+}
+
+func TestTokenizerReplaceStopWords(t *testing.T) {
+	tk := NewTokenizer(Options{StopWords: []string{"login"}, ReplaceStopWords: true})
+
+	// Default stop words are no longer filtered, single chars still are.
+	got := tk.Tokenize("a fix for the login bug")
+	want := []string{"fix", "for", "the", "bug"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replace mode\n  got  %v\n  want %v", got, want)
+	}
+
+	// Replace without a list keeps the defaults.
+	tk = NewTokenizer(Options{ReplaceStopWords: true})
+	got = tk.Tokenize("a fix for the login bug")
+	want = []string{"fix", "login", "bug"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replace without list\n  got  %v\n  want %v", got, want)
+	}
+
+	// An explicit empty list disables stop-word filtering.
+	tk = NewTokenizer(Options{StopWords: []string{}, ReplaceStopWords: true})
+	got = tk.Tokenize("a fix for the bug")
+	want = []string{"fix", "for", "the", "bug"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replace with empty list\n  got  %v\n  want %v", got, want)
+	}
+}
+
+func TestTokenizerSplitIdentifiers(t *testing.T) {
+	tk := NewTokenizer(Options{SplitIdentifiers: true})
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "pascal case",
+			input: "Create UserProfileComponent",
+			want:  []string{"create", "user", "profile", "component"},
+		},
+		{
+			name:  "camel case",
+			input: "call fetchUserData",
+			want:  []string{"call", "fetch", "user", "data"},
+		},
+		{
+			name:  "snake case fragments still stop-word filtered",
+			input: "get_user_by_id",
+			want:  []string{"user", "id"},
+		},
+		{
+			name:  "leading acronym",
+			input: "HTTPServer config",
+			want:  []string{"http", "server", "config"},
+		},
+		{
+			name:  "digit boundary",
+			input: "base64Encode payload",
+			want:  []string{"base64", "encode", "payload"},
+		},
+		{
+			name:  "hyphens split when enabled",
+			input: "user-profile page",
+			want:  []string{"user", "profile", "page"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tk.Tokenize(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q)\n  got  %v\n  want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizerBigrams(t *testing.T) {
+	tk := NewTokenizer(Options{Bigrams: true})
+
+	got := tk.Tokenize("fix the jwt token expiry")
+	want := []string{"fix", "jwt", "token", "expiry", "fix jwt", "jwt token", "token expiry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize with bigrams\n  got  %v\n  want %v", got, want)
+	}
+
+	// A single content token produces no bigram.
+	got = tk.Tokenize("the authentication")
+	want = []string{"authentica"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("single token\n  got  %v\n  want %v", got, want)
+	}
+
+	if !IsBigram("jwt token") || IsBigram("session_id") {
+		t.Error("IsBigram should only match space-joined pairs")
+	}
+}
+
+func TestTokenizerDropPureNumbers(t *testing.T) {
+	prompt := "fix line 42 in file 7 base64"
+
+	got := NewTokenizer(Options{}).Tokenize(prompt)
+	if !reflect.DeepEqual(got, []string{"fix", "line", "42", "file", "base64"}) {
+		t.Errorf("default should keep numbers, got %v", got)
+	}
+
+	got = NewTokenizer(Options{DropPureNumbers: true}).Tokenize(prompt)
+	want := []string{"fix", "line", "file", "base64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DropPureNumbers\n  got  %v\n  want %v", got, want)
+	}
+
+	got = NewTokenizer(Options{DropPureNumbers: true}).Tokenize("release 2024 v2")
+	if !reflect.DeepEqual(got, []string{"release", "v2"}) {
+		t.Errorf("v2 should survive, got %v", got)
+	}
+}
+
+func TestTokenizerMinTokenLen(t *testing.T) {
+	prompt := "port the c parser to go at v2"
+
+	got := NewTokenizer(Options{}).Tokenize(prompt)
+	if !reflect.DeepEqual(got, []string{"port", "parser", "v2"}) {
+		t.Errorf("default should drop single characters only, got %v", got)
+	}
+
+	got = NewTokenizer(Options{MinTokenLen: 3}).Tokenize(prompt)
+	if !reflect.DeepEqual(got, []string{"port", "parser"}) {
+		t.Errorf("MinTokenLen 3 should drop two-letter tokens, got %v", got)
+	}
+
+	for _, n := range []int{1, -1} {
+		got = NewTokenizer(Options{MinTokenLen: n}).Tokenize(prompt)
+		if !reflect.DeepEqual(got, []string{"port", "c", "parser", "v2"}) {
+			t.Errorf("MinTokenLen %d should keep \"c\", got %v", n, got)
+		}
+	}
+}
+
+func TestTokenizerTermBlacklist(t *testing.T) {
+	tk := NewTokenizer(Options{TermBlacklist: []string{" JIRA ", "Dependabots"}, Bigrams: true})
+	got := tk.Tokenize("jira: dependabot bumped the parser, see Jira")
+	if !reflect.DeepEqual(got, []string{"bump", "parser", "bump parser"}) {
+		t.Errorf("Tokenize = %v, want blacklisted terms dropped, stemmed forms included, before bigrams", got)
+	}
+
+	// The blacklist is separate from stop words: replacing those keeps it.
+	tk = NewTokenizer(Options{TermBlacklist: []string{"jira"}, StopWords: []string{}, ReplaceStopWords: true})
+	if got := tk.Tokenize("the jira parser"); !reflect.DeepEqual(got, []string{"the", "parser"}) {
+		t.Errorf("Tokenize = %v, want [the parser]", got)
+	}
+}
+
+func TestTokenizerStemmer(t *testing.T) {
+	prompt := "running the optimizations"
+
+	light := NewTokenizer(Options{})
+	if got := light.Tokenize(prompt); !reflect.DeepEqual(got, []string{"runn", "optim"}) {
+		t.Errorf("light stemmer = %v", got)
+	}
+	porter := NewTokenizer(Options{Stemmer: StemmerPorter, AggressiveStemming: true})
+	if got := porter.Tokenize(prompt); !reflect.DeepEqual(got, []string{"run", "optim"}) {
+		t.Errorf("porter stemmer = %v", got)
+	}
+	// The light stemmer matches stop words only after stemming, as it always
+	// has, so default tokens are unchanged.
+	if got := light.Tokenize("this does really during"); !reflect.DeepEqual(got, []string{"thi", "doe", "real", "dur"}) {
+		t.Errorf("light stemmer stop words = %v", got)
+	}
+	// Porter stop words must not slip through by stemming to a form not on
+	// the list.
+	if got := porter.Tokenize("this was his issue, the user has it"); !reflect.DeepEqual(got, []string{"issu", "user"}) {
+		t.Errorf("porter stop words = %v", got)
+	}
+	if light.Stemmer() != StemmerLight || porter.Stemmer() != StemmerPorter {
+		t.Errorf("Stemmer() = %q, %q", light.Stemmer(), porter.Stemmer())
+	}
+	if got := NewTokenizer(Options{Stemmer: "snowball"}).Stemmer(); got != StemmerLight {
+		t.Errorf("unknown stemmer should fall back to light, got %q", got)
+	}
+}
+
+func TestTokenizerFingerprint(t *testing.T) {
+	base := NewTokenizer(Options{}).Fingerprint()
+	if base == "" || NewTokenizer(Options{TagPatterns: []string{"<x>"}, StripCode: true}).Fingerprint() != base {
+		t.Errorf("options that only affect CleanPrompt changed the fingerprint")
+	}
+	for name, opts := range map[string]Options{
+		"stemmer":          {Stemmer: StemmerPorter},
+		"aggressive":       {AggressiveStemming: true},
+		"stopWords":        {StopWords: []string{"please"}},
+		"blacklist":        {TermBlacklist: []string{"jira"}},
+		"synonyms":         {Synonyms: map[string][]string{"kubernetes": {"k8s"}}},
+		"splitIdentifiers": {SplitIdentifiers: true},
+		"bigrams":          {Bigrams: true},
+		"dropPureNumbers":  {DropPureNumbers: true},
+		"minTokenLen":      {MinTokenLen: 3},
+	} {
+		if NewTokenizer(opts).Fingerprint() == base {
+			t.Errorf("%s did not change the fingerprint", name)
+		}
+	}
+}
+
+func TestTokenizerSynonyms(t *testing.T) {
+	tk := NewTokenizer(Options{Synonyms: map[string][]string{
+		"Kubernetes": {"k8s", "kube"},
+		"database":   {"DB"},
+	}})
+
+	a := tk.Tokenize("k8s deployment")
+	b := tk.Tokenize("kubernetes deployment")
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("aliases should canonicalize: %v vs %v", a, b)
+	}
+	if got := tk.Tokenize("migrate the db"); !reflect.DeepEqual(got, tk.Tokenize("migrate the database")) {
+		t.Errorf("db should map to database, got %v", got)
+	}
+
+	// Without the mapping the two stay distinct.
+	plain := NewTokenizer(Options{})
+	if reflect.DeepEqual(plain.Tokenize("k8s deployment"), plain.Tokenize("kubernetes deployment")) {
+		t.Error("default tokenizer should not merge k8s and kubernetes")
+	}
+}
+
+func TestCleanPromptStripCode(t *testing.T) {
+	tk := NewTokenizer(Options{StripCode: true})
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "fenced block",
+			input: "why does this fail\n```\nfoo := bar()\n```\nin prod",
+			want:  "why does this fail\n \nin prod",
+		},
+		{
+			name:  "language-tagged fence",
+			input: "fix ```go\nfunc main() {}\n``` please",
+			want:  "fix   please",
+		},
+		{
+			name:  "nested backticks inside longer fence",
+			input: "docs ````md\n```go\nx := 1\n```\n```` done",
+			want:  "docs   done",
+		},
+		{
+			name:  "inline spans inside prose",
+			input: "rename `getUser` to `fetchUser` now",
+			want:  "rename   to   now",
+		},
+		{
+			name:  "unbalanced fence strips to end",
+			input: "explain this ```python\nprint(1)",
+			want:  "explain this",
+		},
+		{
+			name:  "unmatched inline backtick kept",
+			input: "what does ` mean",
+			want:  "what does ` mean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tk.CleanPrompt(tt.input)
+			if got != tt.want {
+				t.Errorf("CleanPrompt(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// Default CleanPrompt leaves code alone.
+	if got := CleanPrompt("rename `getUser`"); got != "rename `getUser`" {
+		t.Errorf("default CleanPrompt stripped code: %q", got)
+	}
+}
+
+func TestCleanPromptCustomTagPatterns(t *testing.T) {
+	tk := NewTokenizer(Options{TagPatterns: []string{
+		`<[A-Za-z_.:-]+>[\s\S]*?</[A-Za-z_.:-]+>`,
+	}})
+	got := tk.CleanPrompt("fix <IDE:Selection>x := 1</IDE:Selection>this <ctx.file>main.go</ctx.file>bug")
+	if got != "fix this bug" {
+		t.Errorf("custom pattern: got %q, want %q", got, "fix this bug")
+	}
+
+	// A malformed pattern is skipped and the default still runs.
+	tk = NewTokenizer(Options{TagPatterns: []string{`<(unclosed`}})
+	got = tk.CleanPrompt("<system-reminder>hook output</system-reminder>actual prompt")
+	if got != "actual prompt" {
+		t.Errorf("malformed pattern: got %q, want %q", got, "actual prompt")
+	}
+}
@@ -1,24 +1,88 @@
 package tfidf
 
 import (
+	"maps"
 	"math"
 
 	"github.com/kuandriy/focus-gate/internal/text"
 )
 
+// TF scaling modes for Options.Scaling.
+const (
+	ScalingLinear    = "linear"    // tf = count / total (default)
+	ScalingSublinear = "sublinear" // tf = 1 + log2(count)
+)
+
+// Options controls how vectors are weighted. Options are runtime settings,
+// not corpus state, so they are not persisted with the engine.
+type Options struct {
+	// Scaling selects the term-frequency formula. Empty means ScalingLinear.
+	// Sublinear scaling stops repeated terms from dominating a vector.
+	Scaling string `json:"scaling,omitempty"`
+
+	// Boosts multiplies the TF-IDF weight of a term by its factor, so terms
+	// the user knows matter (a project or subsystem name) dominate vectors.
+	// Keys are matched against tokens, so they must already be stemmed.
+	// Boosts change vectors only, never DocFreq.
+	Boosts map[string]float64 `json:"boosts,omitempty"`
+
+	// MaxTerms keeps only the MaxTerms highest-weight terms of each vector,
+	// bounding the cost of long prompts and dropping their filler terms.
+	// Zero means unlimited.
+	MaxTerms int `json:"maxTerms,omitempty"`
+}
+
+// SchemaVersion is the current on-disk layout of Engine. It is unrelated to
+// Engine.Version, which stamps the corpus contents.
+const SchemaVersion = 1
+
 // Engine is an incremental TF-IDF engine. Unlike rebuilding the entire corpus
 // on every invocation, it persists document frequency counts and updates them
 // incrementally as documents are added or removed (during pruning).
 type Engine struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	DocFreq   map[string]int `json:"docFreq"`
 	TotalDocs int            `json:"totalDocs"`
+
+	// Version is a corpus stamp incremented by every AddDocument and
+	// RemoveDocument. Anything derived from IDF (cached vectors) is valid
+	// only for the version it was computed at.
+	Version int `json:"version"`
+
+	// Stemmer names the stemming algorithm that produced the corpus terms
+	// (text.StemmerLight or text.StemmerPorter). It is empty in corpora
+	// saved before it was recorded, which all used the light stemmer.
+	Stemmer string `json:"stemmer,omitempty"`
+
+	// Tokenizer is the fingerprint (text.Tokenizer.Fingerprint) of the
+	// tokenizer options that produced the corpus terms. It is empty in
+	// corpora saved before it was recorded.
+	Tokenizer string `json:"tokenizer,omitempty"`
+
+	Options Options `json:"-"`
 }
 
 // NewEngine creates an empty TF-IDF engine.
 func NewEngine() *Engine {
 	return &Engine{
-		DocFreq: make(map[string]int),
+		SchemaVersion: SchemaVersion,
+		DocFreq:       make(map[string]int),
+	}
+}
+
+// CurrentSchema reports SchemaVersion for persist.Load migrations.
+func (e *Engine) CurrentSchema() int { return SchemaVersion }
+
+// Clone returns a deep copy of the engine's corpus. Options are
+// configuration and are shared.
+func (e *Engine) Clone() *Engine {
+	c := *e
+	c.DocFreq = maps.Clone(e.DocFreq)
+	if c.DocFreq == nil {
+		c.DocFreq = make(map[string]int)
 	}
+	return &c
 }
 
 // AddDocument updates document frequency counts for a new document's tokens.
@@ -32,6 +96,7 @@ func (e *Engine) AddDocument(tokens []string) {
 		}
 	}
 	e.TotalDocs++
+	e.Version++
 }
 
 // RemoveDocument decrements document frequency counts when a document is pruned.
@@ -51,6 +116,7 @@ func (e *Engine) RemoveDocument(tokens []string) {
 	if e.TotalDocs < 0 {
 		e.TotalDocs = 0
 	}
+	e.Version++
 }
 
 // IDF computes the inverse document frequency for a term.
@@ -64,37 +130,48 @@ func (e *Engine) IDF(term string) float64 {
 	return math.Log2(1 + float64(e.TotalDocs)/float64(df))
 }
 
-// Vectorize converts raw text into a sorted TF-IDF Vector.
-// Tokenizes the text, computes term frequencies, multiplies by IDF weights,
-// and returns a sorted sparse vector ready for cosine similarity.
+// Vectorize converts raw text into a sorted TF-IDF Vector: it tokenizes the
+// text with the default tokenizer once and hands the tokens to
+// VectorizeTokens, so both produce identical vectors.
 func (e *Engine) Vectorize(rawText string) Vector {
-	tokens := text.Tokenize(rawText)
-	if len(tokens) == 0 {
-		return nil
-	}
-	tf := text.TermFrequency(tokens)
-	weights := make(map[string]float64, len(tf))
-	for term, freq := range tf {
-		idf := e.IDF(term)
-		if idf > 0 {
-			weights[term] = freq * idf
-		}
-	}
-	return NewVector(weights)
+	return e.VectorizeTokens(text.Tokenize(rawText))
 }
 
 // VectorizeTokens converts pre-tokenized text into a sorted TF-IDF Vector.
+// It computes term frequencies, multiplies by IDF weights, and returns a
+// sorted sparse vector ready for cosine similarity.
 func (e *Engine) VectorizeTokens(tokens []string) Vector {
 	if len(tokens) == 0 {
 		return nil
 	}
-	tf := text.TermFrequency(tokens)
+	tf := e.termFrequency(tokens)
 	weights := make(map[string]float64, len(tf))
 	for term, freq := range tf {
 		idf := e.IDF(term)
 		if idf > 0 {
-			weights[term] = freq * idf
+			weights[term] = freq * idf * e.boost(term)
 		}
 	}
-	return NewVector(weights)
+	return NewVector(weights).Top(e.Options.MaxTerms)
+}
+
+// boost returns the Options.Boosts factor for term, or 1.
+func (e *Engine) boost(term string) float64 {
+	if b, ok := e.Options.Boosts[term]; ok {
+		return b
+	}
+	return 1
+}
+
+// termFrequency computes per-term TF according to Options.Scaling.
+func (e *Engine) termFrequency(tokens []string) map[string]float64 {
+	if e.Options.Scaling != ScalingSublinear {
+		return text.TermFrequency(tokens)
+	}
+	counts := text.TermCounts(tokens)
+	tf := make(map[string]float64, len(counts))
+	for term, c := range counts {
+		tf[term] = 1 + math.Log2(float64(c))
+	}
+	return tf
 }
@@ -1,8 +1,12 @@
 package tfidf
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"testing"
+
+	"github.com/kuandriy/focus-gate/internal/text"
 )
 
 func TestEngineAddDocument(t *testing.T) {
@@ -123,6 +127,35 @@ func TestEngineVectorizeEmpty(t *testing.T) {
 	}
 }
 
+func TestVectorizeMatchesVectorizeTokens(t *testing.T) {
+	e := NewEngine()
+	for _, doc := range []string{"add JWT authentication to the API", "fix the database migration", "JWT token expiry"} {
+		e.AddDocument(text.Tokenize(doc))
+	}
+	inputs := []string{
+		"",
+		"the and of",
+		"JWT authentication token refresh",
+		"tokens tokens TOKENS expiry",
+		"fix the database migration schema, then the API's JWT authentication",
+	}
+	for _, opts := range []Options{{}, {Scaling: ScalingSublinear, MaxTerms: 2}} {
+		e.Options = opts
+		for _, in := range inputs {
+			got, want := e.Vectorize(in), e.VectorizeTokens(text.Tokenize(in))
+			if len(got) != len(want) {
+				t.Errorf("%+v %q: Vectorize = %v, VectorizeTokens = %v", opts, in, got, want)
+				continue
+			}
+			for j := range got {
+				if got[j] != want[j] {
+					t.Errorf("%+v %q: term %d = %v, want %v", opts, in, j, got[j], want[j])
+				}
+			}
+		}
+	}
+}
+
 func TestEngineVectorizeRareTermHigher(t *testing.T) {
 	e := NewEngine()
 	e.AddDocument([]string{"auth", "token"})
@@ -148,3 +181,171 @@ func TestEngineVectorizeRareTermHigher(t *testing.T) {
 			tokenWeight, authWeight)
 	}
 }
+
+func TestVectorizeSublinearScaling(t *testing.T) {
+	e := NewEngine()
+	e.AddDocument([]string{"test", "suite"})
+	e.AddDocument([]string{"database", "schema"})
+
+	once := []string{"test", "suite"}
+	five := []string{"test", "test", "test", "test", "test", "suite"}
+
+	weight := func(v Vector, word string) float64 {
+		for _, term := range v {
+			if term.Word == word {
+				return term.Weight
+			}
+		}
+		return 0
+	}
+
+	// Linear: tf = count/total.
+	idf := e.IDF("test")
+	if got := weight(e.VectorizeTokens(once), "test"); math.Abs(got-0.5*idf) > 1e-9 {
+		t.Errorf("linear once: weight = %f, want %f", got, 0.5*idf)
+	}
+	if got := weight(e.VectorizeTokens(five), "test"); math.Abs(got-(5.0/6.0)*idf) > 1e-9 {
+		t.Errorf("linear five: weight = %f, want %f", got, (5.0/6.0)*idf)
+	}
+
+	// Sublinear: tf = 1 + log2(count).
+	e.Options.Scaling = ScalingSublinear
+	if got := weight(e.VectorizeTokens(once), "test"); math.Abs(got-idf) > 1e-9 {
+		t.Errorf("sublinear once: weight = %f, want %f", got, idf)
+	}
+	want := (1 + math.Log2(5)) * idf
+	v := e.VectorizeTokens(five)
+	if got := weight(v, "test"); math.Abs(got-want) > 1e-9 {
+		t.Errorf("sublinear five: weight = %f, want %f", got, want)
+	}
+	for i := 1; i < len(v); i++ {
+		if v[i-1].Word >= v[i].Word {
+			t.Errorf("sublinear vector not sorted: %v", v)
+		}
+	}
+
+	// Unknown terms (zero IDF) are still dropped.
+	if v := e.VectorizeTokens([]string{"unknown", "unknown"}); v != nil {
+		t.Errorf("unknown terms should yield nil vector, got %v", v)
+	}
+}
+
+func TestEngineVersionIncrements(t *testing.T) {
+	e := NewEngine()
+	e.AddDocument([]string{"auth"})
+	e.AddDocument([]string{"token"})
+	e.RemoveDocument([]string{"auth"})
+	if e.Version != 3 {
+		t.Errorf("Version = %d, want 3", e.Version)
+	}
+}
+
+func TestEngineVersionPersists(t *testing.T) {
+	e := NewEngine()
+	e.AddDocument([]string{"auth"})
+	e.AddDocument([]string{"token"})
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	loaded := NewEngine()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if loaded.Version != e.Version {
+		t.Errorf("loaded Version = %d, want %d", loaded.Version, e.Version)
+	}
+}
+
+func TestVectorizeTermBoost(t *testing.T) {
+	e := NewEngine()
+	e.AddDocument([]string{"bill", "export"})
+	e.AddDocument([]string{"databas", "export"})
+	df := fmt.Sprint(e.DocFreq)
+
+	plain := e.VectorizeTokens([]string{"bill", "export"})
+	e.Options.Boosts = map[string]float64{"bill": 2}
+	boosted := e.VectorizeTokens([]string{"bill", "export"})
+
+	weight := func(v Vector, term string) float64 {
+		for _, tm := range v {
+			if tm.Word == term {
+				return tm.Weight
+			}
+		}
+		return 0
+	}
+	if got, want := weight(boosted, "bill"), 2*weight(plain, "bill"); math.Abs(got-want) > 1e-9 {
+		t.Errorf("boosted bill = %.4f, want %.4f", got, want)
+	}
+	if weight(boosted, "export") != weight(plain, "export") {
+		t.Error("unboosted term weight changed")
+	}
+	if fmt.Sprint(e.DocFreq) != df {
+		t.Errorf("DocFreq changed by boosting: %s -> %v", df, e.DocFreq)
+	}
+	if got := weight(e.Vectorize("bill export"), "bill"); math.Abs(got-weight(boosted, "bill")) > 1e-9 {
+		t.Errorf("Vectorize bill = %.4f, want it boosted like VectorizeTokens", got)
+	}
+}
+
+func TestVectorizeMaxTerms(t *testing.T) {
+	// Term tNN appears in (NN % 10) + 1 of ten documents, so lower NN % 10
+	// means higher IDF.
+	e := NewEngine()
+	for d := 0; d < 10; d++ {
+		var doc []string
+		for i := 0; i < 50; i++ {
+			if d <= i%10 {
+				doc = append(doc, fmt.Sprintf("t%02d", i))
+			}
+		}
+		e.AddDocument(doc)
+	}
+	var prompt []string
+	for i := 0; i < 50; i++ {
+		prompt = append(prompt, fmt.Sprintf("t%02d", i))
+	}
+
+	full := e.VectorizeTokens(prompt)
+	e.Options.MaxTerms = 5
+	capped := e.VectorizeTokens(prompt)
+	if len(full) != 50 || len(capped) != 5 {
+		t.Fatalf("len(full) = %d, len(capped) = %d; want 50 and 5", len(full), len(capped))
+	}
+	// The five rarest terms (df 1) are kept, still sorted by word.
+	want := []string{"t00", "t10", "t20", "t30", "t40"}
+	for i, term := range capped {
+		if term.Word != want[i] {
+			t.Errorf("capped[%d] = %s, want %s", i, term.Word, want[i])
+		}
+	}
+
+	// A node about the discriminative terms matches the capped prompt at
+	// least as well as the full one, and well in absolute terms.
+	e.Options.MaxTerms = 0
+	node := e.VectorizeTokens([]string{"t00", "t10", "t20"})
+	if cf, cc := CosineSimilarity(full, node), CosineSimilarity(capped, node); cc < cf || cc < 0.7 {
+		t.Errorf("cosine capped = %.3f, full = %.3f; want capped >= full and >= 0.7", cc, cf)
+	}
+}
+
+func TestEngineCloneIsIndependent(t *testing.T) {
+	e := NewEngine()
+	e.AddDocument([]string{"auth", "token"})
+
+	c := e.Clone()
+	c.DocFreq["auth"] = 7
+	c.AddDocument([]string{"database"})
+
+	if e.DocFreq["auth"] != 1 || e.TotalDocs != 1 {
+		t.Errorf("original changed: DocFreq[auth] = %d, TotalDocs = %d", e.DocFreq["auth"], e.TotalDocs)
+	}
+	if _, ok := e.DocFreq["database"]; ok {
+		t.Error("original gained a term added to the clone")
+	}
+	if c.IDF("auth") == e.IDF("auth") {
+		t.Error("clone IDF should follow its own counts")
+	}
+}
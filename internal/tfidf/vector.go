@@ -29,6 +29,25 @@ func NewVector(weights map[string]float64) Vector {
 	return v
 }
 
+// Top returns the k highest-weight terms of v, sorted by Word again so the
+// result can still be merge-joined. Ties keep the alphabetically first term.
+// A k <= 0 or a vector with at most k terms returns v unchanged.
+func (v Vector) Top(k int) Vector {
+	if k <= 0 || len(v) <= k {
+		return v
+	}
+	top := make(Vector, len(v))
+	copy(top, v)
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Weight > top[j].Weight
+	})
+	top = top[:k]
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].Word < top[j].Word
+	})
+	return top
+}
+
 // CosineSimilarity computes the cosine of the angle between two sorted sparse vectors
 // using a merge-join. Zero allocations, O(n+m) time.
 //
@@ -72,3 +91,126 @@ func CosineSimilarity(a, b Vector) float64 {
 	}
 	return dot / denom
 }
+
+// Similarity metrics for SimilarityFunc.
+const (
+	MetricCosine  = "cosine"  // angle between the vectors (default)
+	MetricJaccard = "jaccard" // weighted Jaccard: Σmin / Σmax
+	MetricDice    = "dice"    // weighted Sørensen–Dice: 2·Σmin / (Σa + Σb)
+)
+
+// SimilarityFunc scores two sorted sparse vectors in [0, 1].
+type SimilarityFunc func(a, b Vector) float64
+
+// Similarity returns the function for metric. Empty or unknown names select
+// CosineSimilarity.
+func Similarity(metric string) SimilarityFunc {
+	switch metric {
+	case MetricJaccard:
+		return JaccardSimilarity
+	case MetricDice:
+		return DiceSimilarity
+	default:
+		return CosineSimilarity
+	}
+}
+
+// JaccardSimilarity computes the weighted Jaccard index of two sorted sparse
+// vectors: the sum of per-term minimum weights over the sum of per-term
+// maximums, a term absent from one vector counting as zero there. With equal
+// weights it is the plain token-set Jaccard index. Unlike cosine it is not
+// scale-invariant, so a term's share of its vector's weight matters.
+//
+// Returns 0.0 if either vector is empty.
+func JaccardSimilarity(a, b Vector) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared, sumA, sumB := overlap(a, b)
+	union := sumA + sumB - shared
+	if union == 0 {
+		return 0
+	}
+	return shared / union
+}
+
+// DiceSimilarity computes the weighted Sørensen–Dice coefficient of two
+// sorted sparse vectors: twice the sum of per-term minimum weights over the
+// total weight of both. It ranks like JaccardSimilarity but scores partial
+// overlap higher (D = 2J / (1 + J)).
+//
+// Returns 0.0 if either vector is empty.
+func DiceSimilarity(a, b Vector) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared, sumA, sumB := overlap(a, b)
+	if sumA+sumB == 0 {
+		return 0
+	}
+	return 2 * shared / (sumA + sumB)
+}
+
+// overlap merge-joins two sorted vectors, returning the sum of per-term
+// minimum weights and the total weight of each vector.
+func overlap(a, b Vector) (shared, sumA, sumB float64) {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Word == b[j].Word:
+			shared += math.Min(a[i].Weight, b[j].Weight)
+			sumA += a[i].Weight
+			sumB += b[j].Weight
+			i++
+			j++
+		case a[i].Word < b[j].Word:
+			sumA += a[i].Weight
+			i++
+		default:
+			sumB += b[j].Weight
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		sumA += a[i].Weight
+	}
+	for ; j < len(b); j++ {
+		sumB += b[j].Weight
+	}
+	return shared, sumA, sumB
+}
+
+// Contribution is one shared term's share of a dot product: the product of
+// its weights in the two vectors.
+type Contribution struct {
+	Word    string
+	Product float64
+}
+
+// CosineSimilarityExplained is CosineSimilarity that also returns the terms
+// the two vectors share with their dot-product contributions, largest
+// first. The contributions sum to the score times both vector norms.
+func CosineSimilarityExplained(a, b Vector) (float64, []Contribution) {
+	score := CosineSimilarity(a, b)
+	if score == 0 {
+		return 0, nil
+	}
+	var contribs []Contribution
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Word == b[j].Word:
+			contribs = append(contribs, Contribution{Word: a[i].Word, Product: a[i].Weight * b[j].Weight})
+			i++
+			j++
+		case a[i].Word < b[j].Word:
+			i++
+		default:
+			j++
+		}
+	}
+	sort.SliceStable(contribs, func(i, j int) bool {
+		return contribs[i].Product > contribs[j].Product
+	})
+	return score, contribs
+}
@@ -87,3 +87,71 @@ func TestCosineSimilarityKnownValue(t *testing.T) {
 		t.Errorf("known value: similarity = %f, want 0.64", sim)
 	}
 }
+
+func TestSimilarityMetricsKnownValues(t *testing.T) {
+	// Same pair as TestCosineSimilarityKnownValue: a=[3,4,0], b=[0,4,3].
+	// Shared min weight = 4, total weights 7 and 7.
+	a := NewVector(map[string]float64{"alpha": 3.0, "beta": 4.0})
+	b := NewVector(map[string]float64{"beta": 4.0, "gamma": 3.0})
+
+	for _, tc := range []struct {
+		metric string
+		want   float64
+	}{
+		{MetricCosine, 0.64},     // 16 / 25
+		{MetricJaccard, 0.4},     // 4 / (7 + 7 - 4)
+		{MetricDice, 8.0 / 14.0}, // 2·4 / (7 + 7)
+		{"", 0.64},               // default is cosine
+		{"unknown", 0.64},
+	} {
+		if got := Similarity(tc.metric)(a, b); math.Abs(got-tc.want) > 1e-10 {
+			t.Errorf("%q: similarity = %f, want %f", tc.metric, got, tc.want)
+		}
+	}
+
+	for _, metric := range []string{MetricJaccard, MetricDice} {
+		sim := Similarity(metric)
+		if got := sim(a, a); math.Abs(got-1) > 1e-10 {
+			t.Errorf("%s: identical vectors = %f, want 1", metric, got)
+		}
+		if got := sim(a, nil); got != 0 {
+			t.Errorf("%s: empty vector = %f, want 0", metric, got)
+		}
+		c := NewVector(map[string]float64{"delta": 1.0})
+		if got := sim(a, c); got != 0 {
+			t.Errorf("%s: disjoint vectors = %f, want 0", metric, got)
+		}
+	}
+}
+
+func TestCosineSimilarityExplained(t *testing.T) {
+	a := NewVector(map[string]float64{"auth": 2, "jwt": 3, "token": 1, "api": 0.5})
+	b := NewVector(map[string]float64{"jwt": 1, "token": 4, "database": 2})
+
+	score, contribs := CosineSimilarityExplained(a, b)
+	if want := CosineSimilarity(a, b); math.Abs(score-want) > 1e-12 {
+		t.Fatalf("score = %v, want %v", score, want)
+	}
+	if len(contribs) != 2 || contribs[0].Word != "token" || contribs[1].Word != "jwt" {
+		t.Fatalf("contributions = %+v, want token then jwt", contribs)
+	}
+
+	norm := func(v Vector) float64 {
+		sum := 0.0
+		for _, tm := range v {
+			sum += tm.Weight * tm.Weight
+		}
+		return math.Sqrt(sum)
+	}
+	dot := 0.0
+	for _, c := range contribs {
+		dot += c.Product
+	}
+	if got := dot / (norm(a) * norm(b)); math.Abs(got-score) > 1e-12 {
+		t.Errorf("contributions / norms = %v, want cosine %v", got, score)
+	}
+
+	if s, c := CosineSimilarityExplained(a, NewVector(map[string]float64{"other": 1})); s != 0 || c != nil {
+		t.Errorf("disjoint vectors: score %v, contributions %v", s, c)
+	}
+}
@@ -0,0 +1,503 @@
+package focusgate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/archive"
+	"github.com/kuandriy/focus-gate/internal/audit"
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/gate"
+	"github.com/kuandriy/focus-gate/internal/guide"
+	"github.com/kuandriy/focus-gate/internal/markov"
+	"github.com/kuandriy/focus-gate/internal/persist"
+	"github.com/kuandriy/focus-gate/internal/text"
+	"github.com/kuandriy/focus-gate/internal/tfidf"
+)
+
+// LockTimeout bounds how long a Session waits for another process to release
+// the state lock before going ahead without it.
+const LockTimeout = 2 * time.Second
+
+// Errors returned by Peek and by sessions it opens.
+var (
+	// ErrBusy means another process held the state lock, so the state may
+	// be mid-save.
+	ErrBusy = errors.New("state is being saved by another process")
+
+	// ErrReadOnly is returned by Process and ProcessBatch on a session
+	// opened by Peek.
+	ErrReadOnly = errors.New("session is read-only")
+)
+
+// BatchResult reports what ProcessBatch did with one prompt.
+type BatchResult = gate.BatchResult
+
+// Session is an open focus-gate state directory. It loads the forest, engine,
+// guide and Markov chain once, and saves them after every prompt it
+// processes, so a long-running host such as an editor plugin can keep one
+// open across prompts. The state lock is only held while a prompt is
+// processed or the status read, and state another process saved in between,
+// such as a CLI hook, is reloaded first rather than overwritten. A Session
+// may be used from several goroutines; its calls run one at a time.
+type Session struct {
+	// mu serializes Process, ProcessBatch and the Status methods, which all
+	// touch the guide and the gate and may save the state files.
+	mu sync.Mutex
+
+	cfg   Config
+	files Files
+	// lockTimeout is how long acquire waits for the state lock: LockTimeout
+	// unless a test shortens it.
+	lockTimeout time.Duration
+	// stamp is stateStamp as of the last load or save.
+	stamp string
+
+	forest *forest.Forest
+	engine *tfidf.Engine
+	guide  *guide.Guide
+	chain  *markov.Chain
+	gate   *gate.Gate
+
+	readOnly bool
+}
+
+// Open loads the state in dataDir, creating it on first use. It takes the
+// state lock while loading, and again for each prompt, so overlapping
+// processes don't clobber each other's files; the lock is advisory, and if it
+// can't be taken within LockTimeout the session warns and continues without
+// it. Interrupted saves are recovered and problems loading state are logged
+// to stderr, falling back to empty state, so only a data directory that
+// can't be created is an error.
+func Open(dataDir string, cfg Config) (*Session, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	s := &Session{cfg: cfg, files: FilesIn(dataDir), lockTimeout: LockTimeout}
+	defer s.acquire().Release()
+
+	s.files = s.files.Prepare(cfg)
+	s.load()
+	return s, nil
+}
+
+// acquire takes the state lock, or warns and returns nil if another process
+// holds it for longer than LockTimeout. Release on nil is a no-op.
+func (s *Session) acquire() *persist.Lock {
+	lock, err := persist.AcquireLock(s.files.Lock, s.lockTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: state lock: %v; continuing without it\n", err)
+	}
+	return lock
+}
+
+// load reads the state from s.files and builds the gate over it. The caller
+// holds the state lock.
+func (s *Session) load() {
+	cfg := s.cfg
+	s.forest = forest.NewForest()
+	LoadState("intent", s.files.Intent, s.forest)
+
+	s.engine = tfidf.NewEngine()
+	LoadState("engine", s.files.Engine, s.engine)
+
+	s.guide = guide.New(cfg.GuideSize)
+	LoadState("guide", s.files.Guide, s.guide)
+	s.guide.RenderLimit = cfg.GuideRenderLimit
+
+	// With Markov modelling disabled the chain only tracks the current topic
+	// for this session, so markov.json is neither read nor written.
+	s.chain = markov.New()
+	if cfg.MarkovEnabled {
+		LoadState("markov", s.files.Markov, s.chain)
+	}
+
+	s.gate = gate.NewWithChain(s.forest, s.engine, s.chain, cfg.GateConfig())
+	s.syncTokenizer()
+	s.reconcileCorpus()
+	LogLoadErr("veccache", s.gate.LoadVecCache(s.files.VecCache))
+	if cfg.Metrics {
+		s.gate.Metrics = gate.NewMetrics()
+		LoadState("metrics", s.files.Metrics, s.gate.Metrics)
+	}
+	s.stamp = s.stateStamp()
+}
+
+// refresh reloads the state if another process saved it since this session
+// last loaded or saved. The caller holds the state lock.
+func (s *Session) refresh() {
+	if s.stateStamp() != s.stamp {
+		s.load()
+	}
+}
+
+// stateStamp summarizes the size and modification time of the core state
+// files, so any save to them changes it.
+func (s *Session) stateStamp() string {
+	var b strings.Builder
+	for _, path := range s.files.BackedUpFiles() {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%d:%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			b.WriteString("-;")
+		}
+	}
+	return b.String()
+}
+
+// Peek loads the state in dataDir for reading only, for Status and
+// StatusJSON. It writes nothing: it takes no lock and leaves interrupted
+// saves and files in the other storage format where they are. It reads the
+// vector cache the last prompt saved, if still current, but not metrics.
+// Unlike Open, it returns an error instead of
+// empty state when a file fails to load, and ErrBusy when another process
+// held the lock before or during loading, so a caller polling for changes
+// can skip that moment rather than show a partial state.
+func Peek(dataDir string, cfg Config) (*Session, error) {
+	files := FilesIn(dataDir)
+	if cfg.Compress {
+		files = files.Compressed()
+	}
+	if locked(files.Lock) {
+		return nil, ErrBusy
+	}
+
+	s := &Session{cfg: cfg, files: files, readOnly: true}
+	s.forest = forest.NewForest()
+	s.engine = tfidf.NewEngine()
+	s.guide = guide.New(cfg.GuideSize)
+	s.guide.RenderLimit = cfg.GuideRenderLimit
+	s.chain = markov.New()
+	type load struct {
+		name, path string
+		v          any
+	}
+	loads := []load{
+		{"intent", files.Intent, s.forest},
+		{"engine", files.Engine, s.engine},
+		{"guide", files.Guide, s.guide},
+	}
+	if cfg.MarkovEnabled {
+		loads = append(loads, load{"markov", files.Markov, s.chain})
+	}
+	for _, l := range loads {
+		path := l.path
+		if !persist.Exists(path) && persist.Exists(Alternate(path)) {
+			path = Alternate(path)
+		}
+		if err := persist.Load(path, l.v); err != nil && !errors.Is(err, persist.ErrNoChecksum) {
+			return nil, fmt.Errorf("load %s: %w", l.name, err)
+		}
+	}
+	s.gate = gate.NewWithChain(s.forest, s.engine, s.chain, cfg.GateConfig())
+	// A missing or stale cache only costs time, so it is not an error here.
+	s.gate.LoadVecCache(files.VecCache)
+	if locked(files.Lock) {
+		return nil, ErrBusy
+	}
+	return s, nil
+}
+
+// locked reports whether a live lock file exists at path. A lock older than
+// persist.StaleLockAge is left by a crashed process and doesn't count.
+func locked(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) < persist.StaleLockAge
+}
+
+// Close ends the session. The state lock is only held within calls, so
+// there is nothing left to release; Close exists so callers can defer it
+// whatever the locking. The session must not be used afterwards.
+func (s *Session) Close() error {
+	return nil
+}
+
+// Process classifies prompt into the forest and returns the context block for
+// it. When transcriptPath is set, the last assistant message in it is added
+// to the guide first and reinforces the forest before classification. State
+// is saved before Process returns; a failed save is reported in the error
+// alongside the context, which is still valid for this prompt.
+//
+// A blank prompt returns "". A prompt that is entirely IDE context tags
+// returns the Status block without counting as a prompt.
+func (s *Session) Process(prompt, transcriptPath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return "", ErrReadOnly
+	}
+	defer s.acquire().Release()
+	s.refresh()
+
+	cleaned := text.NewTokenizer(s.cfg.TokenizerOptions()).CleanPrompt(prompt)
+	if cleaned == "" {
+		if strings.TrimSpace(prompt) == "" {
+			return "", nil
+		}
+		return s.status(), nil
+	}
+
+	s.guide.Expire(time.Now().UnixMilli(), s.cfg.GuideMaxAgeHours)
+	if transcriptPath != "" {
+		s.updateGuide(transcriptPath)
+	}
+	s.reinforce()
+
+	ctx := s.gate.ProcessPrompt(cleaned, fmt.Sprintf("p%d", s.forest.Meta.TotalPrompts))
+	ctx = s.withGuide(ctx)
+	return ctx, s.save()
+}
+
+// ProcessBatch backfills state from prompts, run in order through one gate so
+// Markov transitions chain across them, and saves once at the end. It returns
+// the context block after the last prompt, or "" if every prompt was
+// skipped, and what happened to each prompt.
+func (s *Session) ProcessBatch(prompts []string) (string, []BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return "", nil, ErrReadOnly
+	}
+	defer s.acquire().Release()
+	s.refresh()
+
+	s.guide.Expire(time.Now().UnixMilli(), s.cfg.GuideMaxAgeHours)
+	s.reinforce()
+
+	ctx, results := s.gate.ProcessBatch(prompts)
+	if ctx != "" {
+		ctx = s.withGuide(ctx)
+	}
+	return ctx, results, s.save()
+}
+
+// Status returns the current context block and guide without processing a
+// prompt.
+func (s *Session) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.lockForRead()()
+	return s.status()
+}
+
+// status is Status for a caller that already holds s.mu and the state lock.
+func (s *Session) status() string {
+	s.guide.Expire(time.Now().UnixMilli(), s.cfg.GuideMaxAgeHours)
+	return s.gate.StatusContext() + s.guide.Render(s.forest)
+}
+
+// StatusDisplay is Status for a person rather than the model: with
+// normalizeScores, trees show their 0–100 focus intensity instead of a raw
+// score.
+func (s *Session) StatusDisplay() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.lockForRead()()
+	s.guide.Expire(time.Now().UnixMilli(), s.cfg.GuideMaxAgeHours)
+	return s.gate.DisplayContext() + s.guide.Render(s.forest)
+}
+
+// StatusJSON returns the current context as JSON.
+func (s *Session) StatusJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.lockForRead()()
+	return s.gate.GenerateContextJSON()
+}
+
+// lockForRead takes the state lock and picks up state saved by other
+// processes before a status read, returning the function that releases it.
+// A session from Peek is a snapshot and is left as it is.
+func (s *Session) lockForRead() func() {
+	if s.readOnly {
+		return func() {}
+	}
+	lock := s.acquire()
+	s.refresh()
+	return func() { lock.Release() }
+}
+
+// reinforce strengthens the forest from guide entries not yet applied, so
+// tree scores reflect recent assistant activity before the next prompt is
+// classified.
+func (s *Session) reinforce() {
+	if reinforced := s.gate.ReinforceFromGuide(s.guide); reinforced > 0 {
+		fmt.Fprintf(os.Stderr, "focus-gate: reinforced %d guide entries\n", reinforced)
+	}
+}
+
+// save archives pruned trees, then saves all state atomically. Failures to
+// save the core state are returned; the vector cache, undo journal and
+// metrics can be rebuilt or lost without harm, so their failures are only
+// logged.
+func (s *Session) save() error {
+	// Archive pruned trees before the forest without them is saved.
+	ArchivePrunedTrees(s.files.Archive, s.gate)
+	s.logDecisions()
+
+	var errs []error
+	if err := SaveState(s.cfg, s.files.Intent, s.forest); err != nil {
+		errs = append(errs, fmt.Errorf("save intent: %w", err))
+	}
+	if err := SaveState(s.cfg, s.files.Engine, s.engine); err != nil {
+		errs = append(errs, fmt.Errorf("save engine: %w", err))
+	}
+	if err := SaveState(s.cfg, s.files.Guide, s.guide); err != nil {
+		errs = append(errs, fmt.Errorf("save guide: %w", err))
+	}
+	if s.cfg.MarkovEnabled {
+		if err := SaveState(s.cfg, s.files.Markov, s.chain); err != nil {
+			errs = append(errs, fmt.Errorf("save markov: %w", err))
+		}
+	}
+	if err := s.gate.SaveVecCache(s.files.VecCache); err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: save veccache: %v\n", err)
+	}
+	if s.gate.LastJournal != nil {
+		if err := persist.SaveAtomic(s.files.Journal, s.gate.LastJournal); err != nil {
+			fmt.Fprintf(os.Stderr, "focus-gate: save journal: %v\n", err)
+		}
+	}
+	if s.gate.Metrics != nil {
+		if err := persist.SaveAtomic(s.files.Metrics, s.gate.Metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "focus-gate: save metrics: %v\n", err)
+		}
+	}
+	s.stamp = s.stateStamp()
+	return errors.Join(errs...)
+}
+
+// ArchivePrunedTrees appends the whole trees gt pruned to the tree archive at
+// path when archivePruned is set. Failures are logged: the prompt still goes
+// through, but those topics are lost as they would be without archiving.
+func ArchivePrunedTrees(path string, gt *gate.Gate) {
+	if len(gt.PrunedTrees) == 0 {
+		return
+	}
+	if _, err := archive.AppendTrees(path, gt.PrunedTrees, time.Now().UnixMilli()); err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: archive %d pruned trees: %v\n", len(gt.PrunedTrees), err)
+		return
+	}
+	gt.PrunedTrees = nil
+}
+
+// logDecisions appends the gate's recorded decisions to the audit log. The
+// log is observability only, so a failure is logged and never fails the save.
+func (s *Session) logDecisions() {
+	if len(s.gate.Decisions) == 0 {
+		return
+	}
+	if err := audit.Append(s.files.Decisions, s.gate.Decisions, s.cfg.AuditPromptText); err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: audit log: %v\n", err)
+	}
+	s.gate.Decisions = nil
+}
+
+// syncTokenizer re-indexes the corpus when the tokenizer config changed since
+// it was built, so stored terms and new query vectors are tokenized alike.
+func (s *Session) syncTokenizer() {
+	recorded := s.engine.Tokenizer != ""
+	from, ok := s.gate.SyncTokenizer()
+	switch {
+	case !ok:
+	case from != s.engine.Stemmer:
+		fmt.Fprintf(os.Stderr, "focus-gate: stemmer changed from %s to %s, re-indexed %d nodes\n",
+			from, s.engine.Stemmer, s.engine.TotalDocs)
+	case recorded:
+		fmt.Fprintf(os.Stderr, "focus-gate: tokenizer options changed, re-indexed %d nodes\n", s.engine.TotalDocs)
+	default:
+		fmt.Fprintf(os.Stderr, "focus-gate: recorded tokenizer options, re-indexed %d nodes\n", s.engine.TotalDocs)
+	}
+}
+
+// reconcileCorpus rebuilds the TF-IDF corpus from the forest's indexed nodes
+// when reconcileOnLoad is set, logging any drift it corrected.
+func (s *Session) reconcileCorpus() {
+	if !s.cfg.ReconcileOnLoad {
+		return
+	}
+	if r := s.gate.Reconcile(); r.Drifted() {
+		fmt.Fprintf(os.Stderr, "focus-gate: reconciled corpus: %d docs -> %d, %d terms corrected\n",
+			r.DocsBefore, r.DocsAfter, r.TermsFixed)
+	}
+}
+
+// withGuide appends guide context to a context block, optionally only
+// entries about the tree ProcessPrompt classified into.
+func (s *Session) withGuide(ctx string) string {
+	guideCtx := s.guide.Render(s.forest)
+	if s.cfg.GuideTopicOnly {
+		guideCtx = s.guide.RenderForTopic(s.forest, s.chain.LastTopic)
+	}
+	if guideCtx == "" {
+		return ctx
+	}
+	// Insert guide before the closing footer. The footer is always the
+	// final line, so only that occurrence is replaced even if a prompt
+	// quoted it in the body. A block from contextTemplate may have no
+	// footer, and then the guide simply follows it.
+	body, ok := strings.CutSuffix(ctx, gate.ContextFooter)
+	if !ok {
+		return ctx + guideCtx
+	}
+	return body + guideCtx + gate.ContextFooter
+}
+
+// updateGuide extracts the last assistant message from a transcript and adds
+// it to the guide. The transcript is decoded by the parser selected with the
+// transcriptFormat config field; truncation and linking are shared by all
+// formats. Only the tail of a large transcript is read, as ReadTranscript
+// does. A transcript that does not exist is skipped silently; any other read
+// error points to a misconfigured path, so it is logged, and the prompt goes
+// ahead without a guide update.
+func (s *Session) updateGuide(transcriptPath string) {
+	parser, err := guide.ParserFor(s.cfg.TranscriptFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: %v\n", err)
+		return
+	}
+
+	data, err := guide.ReadTranscript(transcriptPath, guide.MaxTranscriptBytes)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "focus-gate: transcript: %v\n", err)
+		}
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+	snippet, err := parser.LastAssistantMessage(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "focus-gate: transcript: %s: %v\n", transcriptPath, err)
+		return
+	}
+
+	// Truncate to the configured summary length.
+	snippet = guide.Summarize(snippet, s.cfg.GuideSummaryLen)
+	if snippet == "" {
+		return
+	}
+
+	// Link to the most recent leaf in the last tree, labelled with the
+	// tree's topic in case the leaf is pruned.
+	intentID, label := "", ""
+	if len(s.forest.Trees) > 0 {
+		lastTree := s.forest.Trees[len(s.forest.Trees)-1]
+		leaves := lastTree.GetLeaves()
+		if len(leaves) > 0 {
+			intentID = leaves[len(leaves)-1].ID
+		}
+		if root := lastTree.Root(); root != nil {
+			label = root.Content
+		}
+	}
+
+	s.guide.AddForTopic(snippet, intentID, label, nil)
+}
@@ -0,0 +1,426 @@
+package focusgate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuandriy/focus-gate/internal/forest"
+	"github.com/kuandriy/focus-gate/internal/persist"
+)
+
+func TestSessionPersistsAcrossOpen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := s.Process("add JWT authentication to the API", "")
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if !strings.Contains(ctx, "JWT") {
+		t.Errorf("context does not mention the prompt:\n%s", ctx)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if persist.Exists(filepath.Join(dir, ".lock")) {
+		t.Error("Close left the state lock behind")
+	}
+
+	s, err = Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if status := s.Status(); !strings.Contains(status, "JWT") {
+		t.Errorf("reopened status lost the first prompt:\n%s", status)
+	}
+	if _, err := s.Process("fix the database migration", ""); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	f := forest.NewForest()
+	LoadState("intent", FilesIn(dir).Intent, f)
+	if f.Meta.TotalPrompts != 2 {
+		t.Errorf("saved forest has %d prompts, want 2", f.Meta.TotalPrompts)
+	}
+}
+
+func TestSessionSavesFilledVecCache(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"add JWT authentication to the API", "fix the JWT token expiry", "fix the database migration"} {
+		if _, err := s.Process(p, ""); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	}
+	nodes := s.forest.NodeCount()
+	s.Close()
+
+	s, err = Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.gate.VecCacheStats().Entries; got != nodes {
+		t.Errorf("reopened cache has %d entries, want one per node (%d)", got, nodes)
+	}
+}
+
+func TestSessionsInterleave(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	host, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	if persist.Exists(FilesIn(dir).Lock) {
+		t.Fatal("an open session should not hold the lock between calls")
+	}
+
+	// A hook runs in its own session while the host keeps one open.
+	for _, p := range []string{"add JWT authentication to the API", "fix the database migration"} {
+		hook, err := Open(dir, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := hook.Process(p, ""); err != nil {
+			t.Fatalf("hook Process: %v", err)
+		}
+		hook.Close()
+	}
+	if _, err := host.Process("style the frontend react component", ""); err != nil {
+		t.Fatalf("host Process: %v", err)
+	}
+	if status := host.Status(); !strings.Contains(status, "JWT") {
+		t.Errorf("host status lost the hook's prompts:\n%s", status)
+	}
+
+	f := forest.NewForest()
+	LoadState("intent", FilesIn(dir).Intent, f)
+	if f.Meta.TotalPrompts != 3 {
+		t.Errorf("saved forest has %d prompts, want all 3 from both sessions", f.Meta.TotalPrompts)
+	}
+}
+
+func TestSessionConcurrentProcess(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// Hold the state lock as a stuck process would, so every call gives up on
+	// it quickly and only the session's own mutex keeps them apart.
+	lock, err := persist.AcquireLock(FilesIn(dir).Lock, LockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	s.lockTimeout = time.Millisecond
+
+	prompts := []string{
+		"add JWT authentication to the API", "fix the JWT token expiry",
+		"fix the database migration", "add an index to the users table",
+		"style the frontend react component", "fix the react button layout",
+	}
+	var wg sync.WaitGroup
+	for _, p := range prompts {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Process(p, ""); err != nil {
+				t.Errorf("Process: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.Status()
+		}()
+	}
+	wg.Wait()
+
+	f := forest.NewForest()
+	LoadState("intent", FilesIn(dir).Intent, f)
+	if f.Meta.TotalPrompts != len(prompts) {
+		t.Errorf("saved forest has %d prompts, want %d", f.Meta.TotalPrompts, len(prompts))
+	}
+}
+
+func TestSessionBlankPrompt(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, err := s.Process("   ", "")
+	if err != nil || ctx != "" {
+		t.Errorf("Process(blank) = %q, %v; want \"\", nil", ctx, err)
+	}
+	if persist.Exists(FilesIn(dir).Intent) {
+		t.Error("a blank prompt should not save state")
+	}
+}
+
+func TestSessionTagOnlyPrompt(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Process("add JWT authentication to the API", ""); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	// Process holds the session's locks while it falls back to the Status
+	// block, so a call that took them again would never return.
+	type result struct {
+		ctx string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ctx, err := s.Process("<ide_selection>func main() {}</ide_selection>", "")
+		done <- result{ctx, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil || r.ctx != s.Status() {
+			t.Errorf("Process(tags only) = %q, %v; want the Status block", r.ctx, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process(tags only) did not return")
+	}
+
+	f := forest.NewForest()
+	LoadState("intent", FilesIn(dir).Intent, f)
+	if f.Meta.TotalPrompts != 1 {
+		t.Errorf("saved forest has %d prompts, want 1: a tag-only prompt should not count", f.Meta.TotalPrompts)
+	}
+}
+
+func TestSessionTranscriptErrors(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Capture the diagnostics updateGuide writes to stderr.
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = orig }()
+	logged := func() string {
+		data, err := os.ReadFile(stderr.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if _, err := s.Process("add JWT authentication to the API", filepath.Join(dir, "missing.jsonl")); err != nil {
+		t.Fatalf("Process with a missing transcript: %v", err)
+	}
+	if got := logged(); got != "" {
+		t.Errorf("a missing transcript should be silent, logged %q", got)
+	}
+
+	ctx, err := s.Process("fix the database migration", t.TempDir())
+	if err != nil || !strings.Contains(ctx, "migration") {
+		t.Fatalf("Process with a directory transcript = %q, %v; want the prompt handled", ctx, err)
+	}
+	if got := logged(); !strings.Contains(got, "focus-gate: transcript:") || !strings.Contains(got, "is a directory") {
+		t.Errorf("a directory transcript should be logged, got %q", got)
+	}
+
+	// An empty transcript has nothing to parse yet; one in the wrong format
+	// is reported.
+	empty := filepath.Join(dir, "empty.jsonl")
+	garbled := filepath.Join(dir, "garbled.json")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(garbled, []byte("not a transcript"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before := logged()
+	if _, err := s.Process("fix JWT token expiry", empty); err != nil {
+		t.Fatalf("Process with an empty transcript: %v", err)
+	}
+	if got := logged(); got != before {
+		t.Errorf("an empty transcript should be silent, logged %q", strings.TrimPrefix(got, before))
+	}
+	if _, err := s.Process("add a migration rollback", garbled); err != nil {
+		t.Fatalf("Process with a garbled transcript: %v", err)
+	}
+	if got := strings.TrimPrefix(logged(), before); !strings.Contains(got, "focus-gate: transcript: "+garbled) {
+		t.Errorf("a garbled transcript should be logged, got %q", got)
+	}
+	if len(s.guide.Entries) != 0 {
+		t.Errorf("guide has %d entries, want none", len(s.guide.Entries))
+	}
+}
+
+func TestSessionRecoversTmp(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	files := FilesIn(dir)
+
+	f := forest.NewForest()
+	f.AddTree(forest.NewTree("add JWT authentication", "p1"))
+	if err := SaveState(cfg, files.Intent, f); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a save interrupted after the temp file was written but
+	// before it replaced the target.
+	if err := os.Rename(files.Intent, files.Intent+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if status := s.Status(); !strings.Contains(status, "JWT") {
+		t.Errorf("interrupted save was not recovered:\n%s", status)
+	}
+}
+
+func TestSessionCompressMigrates(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Process("add JWT authentication to the API", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	cfg.Compress = true
+	s, err = Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if status := s.Status(); !strings.Contains(status, "JWT") {
+		t.Errorf("state saved uncompressed was not adopted:\n%s", status)
+	}
+	if !persist.Exists(FilesIn(dir).Compressed().Intent) {
+		t.Error("intent was not migrated to the compressed name")
+	}
+}
+
+func TestSessionMarkovDisabled(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.MarkovEnabled = false
+
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, prompt := range []string{"add JWT authentication to the API", "fix the database migration"} {
+		if _, err := s.Process(prompt, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if persist.Exists(FilesIn(dir).Markov) {
+		t.Error("markov.json written with Markov disabled")
+	}
+}
+
+func TestPeekLoadsVecCache(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Process("add JWT authentication to the API", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	peek, err := Peek(dir, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peek.Status()
+	if st := peek.gate.VecCacheStats(); st.Entries != peek.forest.NodeCount() || st.Misses != 0 {
+		t.Errorf("Peek cache stats %+v, want the saved vectors reused", st)
+	}
+}
+
+func TestPeekIsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	s, err := Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Process("add JWT authentication to the API", ""); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	// A held lock means a save may be under way.
+	lock, err := persist.AcquireLock(FilesIn(dir).Lock, LockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Peek(dir, cfg); !errors.Is(err, ErrBusy) {
+		t.Errorf("Peek while locked: err = %v, want ErrBusy", err)
+	}
+	lock.Release()
+	s.Close()
+
+	p, err := Peek(dir, cfg)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if status := p.Status(); !strings.Contains(status, "JWT") {
+		t.Errorf("peeked status lost the prompt:\n%s", status)
+	}
+	if _, err := p.Process("fix the database migration", ""); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Process on a peeked session: err = %v, want ErrReadOnly", err)
+	}
+	if persist.Exists(FilesIn(dir).Lock) {
+		t.Error("Peek left a lock behind")
+	}
+
+	// A damaged file is an error rather than empty state, and is left in place.
+	intent := FilesIn(dir).Intent
+	if err := os.WriteFile(intent, []byte("{\"trees\": ["), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Peek(dir, cfg); err == nil {
+		t.Error("Peek of a truncated intent file should fail")
+	}
+	if !persist.Exists(intent) {
+		t.Error("Peek moved the damaged file")
+	}
+}